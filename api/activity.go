@@ -11,10 +11,14 @@ func GetRecentActivities(c *gin.Context) {
 	query := `
 		SELECT id, type, title, description, room_id, player_name, color, created_at
 		FROM activity_logs
+		WHERE 1 = 1
+	`
+	scope, scopeArgs := statsRoomScope(c, "room_id")
+	query += scope + `
 		ORDER BY created_at DESC
 		LIMIT ?
 	`
-	rows, err := db.DB.Query(query, limit)
+	rows, err := db.DB.Query(query, append(scopeArgs, limit)...)
 	if err != nil {
 		fmt.Printf("[ERROR] Failed to query activity logs: %v\n", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("查询活动日志失败"))
@@ -102,6 +106,22 @@ func LogPlayerLeave(roomID int, roomName, playerName string) {
 		models.ColorGray,
 	)
 }
+func LogBossEvent(roomID int, roomName, bossName, action string) {
+	title := fmt.Sprintf("Boss \"%s\" 已苏醒", bossName)
+	color := models.ColorOrange
+	if action == models.BossEventDefeated {
+		title = fmt.Sprintf("Boss \"%s\" 已被击败", bossName)
+		color = models.ColorPurple
+	}
+	LogActivity(
+		models.ActivityTypeBoss,
+		title,
+		fmt.Sprintf("房间: %s", roomName),
+		&roomID,
+		"",
+		color,
+	)
+}
 func LogPlayerBan(playerName, reason string) {
 	LogActivity(
 		models.ActivityTypePlayerBan,
@@ -132,6 +152,16 @@ func LogPlayerKick(roomID int, roomName, playerName, reason string) {
 		models.ColorOrange,
 	)
 }
+func LogPlayerWarning(playerName, reason string, warnings int) {
+	LogActivity(
+		models.ActivityTypePlayerWarn,
+		fmt.Sprintf("玩家 \"%s\" 收到警告", playerName),
+		fmt.Sprintf("原因: %s, 有效警告: %d", reason, warnings),
+		nil,
+		playerName,
+		models.ColorOrange,
+	)
+}
 func LogBackup(roomID int, roomName string) {
 	LogActivity(
 		models.ActivityTypeBackup,
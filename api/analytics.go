@@ -0,0 +1,424 @@
+package api
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"terraria-panel/models"
+	"terraria-panel/services"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+type sessionSpan struct {
+	playerID int
+	roomID   int
+	start    time.Time
+	end      time.Time
+}
+type concurrencyEvent struct {
+	at    time.Time
+	delta int
+}
+func dayStart(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+func analyticsRange(c *gin.Context, defaultDays, maxDays int) (time.Time, time.Time, int) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultDays)))
+	if err != nil || days <= 0 || days > maxDays {
+		days = defaultDays
+	}
+	now := time.Now()
+	return dayStart(now).AddDate(0, 0, -(days - 1)), now, days
+}
+func analyticsRoom(c *gin.Context) (string, []interface{}, bool) {
+	value := c.Query("roomId")
+	if value == "" {
+		scope, scopeArgs := statsRoomScope(c, "room_id")
+		return scope, scopeArgs, true
+	}
+	roomID, err := strconv.Atoi(value)
+	if err != nil || roomID < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的房间ID"))
+		return "", nil, false
+	}
+	if !checkRoomPermission(c, roomID, models.RoomPermissionView) {
+		return "", nil, false
+	}
+	return " AND room_id = ?", []interface{}{roomID}, true
+}
+func loadSessionSpans(from, to time.Time, scope string, scopeArgs []interface{}) ([]sessionSpan, error) {
+	query := `
+		SELECT player_id, room_id, join_time, leave_time
+		FROM player_sessions
+		WHERE join_time < ? AND (leave_time IS NULL OR leave_time >= ?)
+	`
+	args := append([]interface{}{to.Add(24 * time.Hour), from.Add(-24 * time.Hour)}, scopeArgs...)
+	rows, err := statsDB.Query(query+scope, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	now := time.Now()
+	spans := []sessionSpan{}
+	for rows.Next() {
+		var span sessionSpan
+		var leaveTime sql.NullTime
+		if err := rows.Scan(&span.playerID, &span.roomID, &span.start, &leaveTime); err != nil {
+			return nil, err
+		}
+		span.end = now
+		if leaveTime.Valid && leaveTime.Time.Before(now) {
+			span.end = leaveTime.Time
+		}
+		if span.start.Before(from) {
+			span.start = from
+		}
+		if span.end.After(to) {
+			span.end = to
+		}
+		if span.end.Before(span.start) {
+			continue
+		}
+		spans = append(spans, span)
+	}
+	return spans, rows.Err()
+}
+func loadFirstSessions(scope string, scopeArgs []interface{}) (map[int]time.Time, error) {
+	query := `
+		SELECT player_id, join_time
+		FROM player_sessions
+		WHERE id IN (SELECT MIN(id) FROM player_sessions WHERE 1 = 1` + scope + ` GROUP BY player_id)
+	`
+	rows, err := statsDB.Query(query, scopeArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	firstSeen := make(map[int]time.Time)
+	for rows.Next() {
+		var playerID int
+		var joinTime time.Time
+		if err := rows.Scan(&playerID, &joinTime); err != nil {
+			return nil, err
+		}
+		firstSeen[playerID] = joinTime
+	}
+	return firstSeen, rows.Err()
+}
+func concurrencyEvents(spans []sessionSpan) []concurrencyEvent {
+	events := make([]concurrencyEvent, 0, len(spans)*2)
+	for _, span := range spans {
+		events = append(events, concurrencyEvent{at: span.start, delta: 1}, concurrencyEvent{at: span.end, delta: -1})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+	return events
+}
+func peakConcurrency(spans []sessionSpan) (int, *time.Time) {
+	peak, current := 0, 0
+	var peakAt *time.Time
+	for _, event := range concurrencyEvents(spans) {
+		current += event.delta
+		if current > peak {
+			peak = current
+			at := event.at
+			peakAt = &at
+		}
+	}
+	return peak, peakAt
+}
+func roundRate(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+func GetRoomStats(c *gin.Context) {
+	from, to, days := analyticsRange(c, 30, 365)
+	spans, err := loadSessionSpans(from, to, "", nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取会话数据失败: "+err.Error()))
+		return
+	}
+	byRoom := make(map[int][]sessionSpan)
+	for _, span := range spans {
+		byRoom[span.roomID] = append(byRoom[span.roomID], span)
+	}
+	names := map[int]string{services.PluginServerID: services.PluginServerName}
+	if rooms, err := roomStorage.GetAll(); err == nil {
+		for _, room := range rooms {
+			names[room.ID] = room.Name
+			if _, exists := byRoom[room.ID]; !exists {
+				byRoom[room.ID] = nil
+			}
+		}
+	}
+	result := []*models.RoomAnalytics{}
+	for roomID, roomSpans := range byRoom {
+		if !hasRoomPermission(c.GetInt("user_id"), c.GetString("role"), roomID, models.RoomPermissionView) {
+			continue
+		}
+		stats := &models.RoomAnalytics{RoomID: roomID, RoomName: names[roomID], Sessions: len(roomSpans)}
+		players := make(map[int]bool)
+		var playTime time.Duration
+		for _, span := range roomSpans {
+			players[span.playerID] = true
+			playTime += span.end.Sub(span.start)
+		}
+		stats.UniquePlayers = len(players)
+		stats.TotalPlayTime = int(playTime.Seconds())
+		if stats.Sessions > 0 {
+			stats.AvgSessionTime = stats.TotalPlayTime / stats.Sessions
+		}
+		stats.PeakConcurrent, stats.PeakAt = peakConcurrency(roomSpans)
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalPlayTime == result[j].TotalPlayTime {
+			return result[i].RoomID < result[j].RoomID
+		}
+		return result[i].TotalPlayTime > result[j].TotalPlayTime
+	})
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"rooms": result,
+		"days":  days,
+		"from":  from.Format("2006-01-02"),
+		"to":    to.Format("2006-01-02"),
+	}))
+}
+func GetConcurrencyStats(c *gin.Context) {
+	scope, scopeArgs, ok := analyticsRoom(c)
+	if !ok {
+		return
+	}
+	from, to, _ := analyticsRange(c, 14, 90)
+	spans, err := loadSessionSpans(from, to, scope, scopeArgs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取会话数据失败: "+err.Error()))
+		return
+	}
+	events := concurrencyEvents(spans)
+	result := []*models.DailyConcurrency{}
+	current, i := 0, 0
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1)
+		if end.After(to) {
+			end = to
+		}
+		for i < len(events) && events[i].at.Before(day) {
+			current += events[i].delta
+			i++
+		}
+		stats := &models.DailyConcurrency{Date: day.Format("2006-01-02"), Peak: current}
+		if current > 0 {
+			at := day
+			stats.PeakAt = &at
+		}
+		area := 0.0
+		last := day
+		for i < len(events) && events[i].at.Before(end) {
+			area += float64(current) * events[i].at.Sub(last).Seconds()
+			last = events[i].at
+			current += events[i].delta
+			if current > stats.Peak {
+				stats.Peak = current
+				at := events[i].at
+				stats.PeakAt = &at
+			}
+			i++
+		}
+		area += float64(current) * end.Sub(last).Seconds()
+		if seconds := end.Sub(day).Seconds(); seconds > 0 {
+			stats.AvgConcurrent = roundRate(area / seconds)
+		}
+		result = append(result, stats)
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(result))
+}
+func GetActivityHeatmap(c *gin.Context) {
+	scope, scopeArgs, ok := analyticsRoom(c)
+	if !ok {
+		return
+	}
+	from, to, _ := analyticsRange(c, 28, 180)
+	spans, err := loadSessionSpans(from, to, scope, scopeArgs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取会话数据失败: "+err.Error()))
+		return
+	}
+	var seconds [7][24]float64
+	var occurrences [7][24]int
+	unique := make(map[int]map[int]bool)
+	for slot := from; slot.Before(to); slot = slot.Add(time.Hour) {
+		occurrences[slot.Weekday()][slot.Hour()]++
+	}
+	for _, span := range spans {
+		start := span.start.In(time.Local)
+		slot := time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, time.Local)
+		for slot.Before(span.end) || slot.Equal(span.start) {
+			slotEnd := slot.Add(time.Hour)
+			overlapStart, overlapEnd := slot, slotEnd
+			if span.start.After(overlapStart) {
+				overlapStart = span.start
+			}
+			if span.end.Before(overlapEnd) {
+				overlapEnd = span.end
+			}
+			weekday, hour := int(slot.Weekday()), slot.Hour()
+			if overlapEnd.After(overlapStart) {
+				seconds[weekday][hour] += overlapEnd.Sub(overlapStart).Seconds()
+			}
+			cell := weekday*24 + hour
+			if unique[cell] == nil {
+				unique[cell] = make(map[int]bool)
+			}
+			unique[cell][span.playerID] = true
+			slot = slotEnd
+		}
+	}
+	heatmap := &models.ActivityHeatmap{
+		From: from.Format("2006-01-02"),
+		To:   to.Format("2006-01-02"),
+	}
+	peak, quiet := -1.0, math.MaxFloat64
+	for weekday := 0; weekday < 7; weekday++ {
+		for hour := 0; hour < 24; hour++ {
+			avg := 0.0
+			if occurrences[weekday][hour] > 0 {
+				avg = roundRate(seconds[weekday][hour] / 3600 / float64(occurrences[weekday][hour]))
+			}
+			heatmap.AvgPlayers[weekday][hour] = avg
+			heatmap.UniquePlayers[weekday][hour] = len(unique[weekday*24+hour])
+			if avg > peak {
+				peak = avg
+				heatmap.PeakWeekday, heatmap.PeakHour = weekday, hour
+			}
+			if avg < quiet {
+				quiet = avg
+				heatmap.QuietWeekday, heatmap.QuietHour = weekday, hour
+			}
+		}
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(heatmap))
+}
+func GetNewReturningStats(c *gin.Context) {
+	scope, scopeArgs, ok := analyticsRoom(c)
+	if !ok {
+		return
+	}
+	from, to, _ := analyticsRange(c, 30, 365)
+	spans, err := loadSessionSpans(from, to, scope, scopeArgs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取会话数据失败: "+err.Error()))
+		return
+	}
+	firstSeen, err := loadFirstSessions(scope, scopeArgs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取会话数据失败: "+err.Error()))
+		return
+	}
+	active := activeDays(spans)
+	result := []*models.NewReturningDay{}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		stats := &models.NewReturningDay{Date: date}
+		for playerID := range active[date] {
+			if first, exists := firstSeen[playerID]; exists && dayStart(first).Equal(day) {
+				stats.NewPlayers++
+			} else {
+				stats.ReturningPlayers++
+			}
+		}
+		result = append(result, stats)
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(result))
+}
+func GetRetentionStats(c *gin.Context) {
+	scope, scopeArgs, ok := analyticsRoom(c)
+	if !ok {
+		return
+	}
+	from, to, _ := analyticsRange(c, 30, 180)
+	spans, err := loadSessionSpans(from, to, scope, scopeArgs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取会话数据失败: "+err.Error()))
+		return
+	}
+	firstSeen, err := loadFirstSessions(scope, scopeArgs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取会话数据失败: "+err.Error()))
+		return
+	}
+	lastActive := make(map[int]time.Time)
+	for date, players := range activeDays(spans) {
+		day, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+		for playerID := range players {
+			if day.After(lastActive[playerID]) {
+				lastActive[playerID] = day
+			}
+		}
+	}
+	cohorts := make(map[string][]int)
+	for playerID, first := range firstSeen {
+		if !first.Before(from) && first.Before(to) {
+			date := dayStart(first).Format("2006-01-02")
+			cohorts[date] = append(cohorts[date], playerID)
+		}
+	}
+	today := dayStart(to)
+	totals := map[int]*models.RetentionPoint{1: {}, 7: {}, 30: {}}
+	eligible := map[int]int{}
+	result := []*models.RetentionCohort{}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		members := cohorts[date]
+		cohort := &models.RetentionCohort{Date: date, Size: len(members)}
+		points := map[int]**models.RetentionPoint{1: &cohort.Day1, 7: &cohort.Day7, 30: &cohort.Day30}
+		for offset, target := range points {
+			threshold := day.AddDate(0, 0, offset)
+			if threshold.After(today) || len(members) == 0 {
+				continue
+			}
+			point := &models.RetentionPoint{}
+			for _, playerID := range members {
+				if !lastActive[playerID].Before(threshold) {
+					point.Retained++
+				}
+			}
+			point.Rate = roundRate(float64(point.Retained) / float64(len(members)))
+			*target = point
+			totals[offset].Retained += point.Retained
+			eligible[offset] += len(members)
+		}
+		result = append(result, cohort)
+	}
+	summary := gin.H{}
+	for offset, point := range totals {
+		if eligible[offset] > 0 {
+			point.Rate = roundRate(float64(point.Retained) / float64(eligible[offset]))
+			summary["day"+strconv.Itoa(offset)] = point
+		} else {
+			summary["day"+strconv.Itoa(offset)] = nil
+		}
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"cohorts": result,
+		"summary": summary,
+	}))
+}
+func activeDays(spans []sessionSpan) map[string]map[int]bool {
+	active := make(map[string]map[int]bool)
+	for _, span := range spans {
+		for day := dayStart(span.start); !day.After(span.end); day = day.AddDate(0, 0, 1) {
+			date := day.Format("2006-01-02")
+			if active[date] == nil {
+				active[date] = make(map[int]bool)
+			}
+			active[date][span.playerID] = true
+		}
+	}
+	return active
+}
@@ -0,0 +1,243 @@
+package api
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"terraria-panel/utils"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+const (
+	apiTokenPrefix     = "trp_"
+	apiTokenContextKey = "api_token"
+)
+var apiTokenStorage storage.APITokenStorage
+func InitAPITokens(db *sql.DB) {
+	apiTokenStorage = storage.NewSQLiteAPITokenStorage(db)
+}
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+func requestAPIToken(c *gin.Context) string {
+	if token := c.GetHeader("X-API-Token"); token != "" {
+		return token
+	}
+	if token := c.Query("token"); token != "" {
+		return token
+	}
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) == 2 && parts[0] == "Bearer" && strings.HasPrefix(parts[1], apiTokenPrefix) {
+		return parts[1]
+	}
+	return ""
+}
+func requireAPIToken(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := requestAPIToken(c)
+		if raw == "" || !strings.HasPrefix(raw, apiTokenPrefix) || apiTokenStorage == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "缺少有效的 API 令牌"})
+			c.Abort()
+			return
+		}
+		token, err := apiTokenStorage.GetByHash(hashAPIToken(raw))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "验证 API 令牌失败"})
+			c.Abort()
+			return
+		}
+		if token == nil || !token.IsActive() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "API 令牌无效、已过期或已被吊销"})
+			c.Abort()
+			return
+		}
+		if !token.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API 令牌没有 " + scope + " 权限"})
+			c.Abort()
+			return
+		}
+		if err := apiTokenStorage.TouchLastUsed(token.ID); err != nil {
+			log.Printf("[APIToken] Failed to update last used time for token %d: %v", token.ID, err)
+		}
+		c.Set(apiTokenContextKey, token)
+		c.Next()
+	}
+}
+func currentAPIToken(c *gin.Context) *models.APIToken {
+	if value, exists := c.Get(apiTokenContextKey); exists {
+		if token, ok := value.(*models.APIToken); ok {
+			return token
+		}
+	}
+	return nil
+}
+func GetAPITokens(c *gin.Context) {
+	tokens, err := apiTokenStorage.GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取 API 令牌失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(tokens))
+}
+func CreateAPIToken(c *gin.Context) {
+	var req struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes"`
+		RoomIDs       []int    `json:"roomIds"`
+		ExpiresInDays int      `json:"expiresInDays"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误: "+err.Error()))
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{models.APITokenScopeStatus}
+	}
+	for _, scope := range req.Scopes {
+		if !models.IsValidAPITokenScope(scope) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的权限范围: "+scope+"，可选值: "+strings.Join(models.APITokenScopes, ", ")))
+			return
+		}
+	}
+	for _, roomID := range req.RoomIDs {
+		room, err := roomStorage.GetByID(roomID)
+		if err != nil || room == nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("房间不存在: "+strconv.Itoa(roomID)))
+			return
+		}
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成 API 令牌失败"))
+		return
+	}
+	raw := apiTokenPrefix + hex.EncodeToString(buf)
+	token := &models.APIToken{
+		Name:      strings.TrimSpace(req.Name),
+		TokenHash: hashAPIToken(raw),
+		Prefix:    raw[:len(apiTokenPrefix)+8],
+		Scopes:    req.Scopes,
+		RoomIDs:   req.RoomIDs,
+		CreatedBy: c.GetString("username"),
+	}
+	if token.RoomIDs == nil {
+		token.RoomIDs = []int{}
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := apiTokenStorage.Create(token); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建 API 令牌失败: "+err.Error()))
+		return
+	}
+	setAuditTarget(c, token.Name)
+	setAuditChange(c, nil, token)
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"token":   raw,
+		"details": token,
+		"message": "请立即保存该令牌，它只会显示一次",
+	}))
+}
+func RevokeAPIToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的令牌ID"))
+		return
+	}
+	if err := apiTokenStorage.Revoke(id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse("令牌不存在或已被吊销"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("吊销 API 令牌失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.MessageResponse("API 令牌已吊销"))
+}
+func GetPublicStatus(c *gin.Context) {
+	token := currentAPIToken(c)
+	rooms, err := roomStorage.GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取房间列表失败"))
+		return
+	}
+	onlineCounts := map[int]int{}
+	rows, err := statsDB.Query("SELECT room_id, COUNT(*) FROM players WHERE status = 'online' GROUP BY room_id")
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var roomID, count int
+			if rows.Scan(&roomID, &count) == nil {
+				onlineCounts[roomID] = count
+			}
+		}
+	}
+	servers := []gin.H{}
+	totalOnline := 0
+	for _, room := range rooms {
+		if token != nil && !token.AllowsRoom(room.ID) {
+			continue
+		}
+		status := "stopped"
+		if p, exists := utils.GetProcess(room.ID); exists && p.IsRunning() {
+			status = "running"
+		}
+		totalOnline += onlineCounts[room.ID]
+		servers = append(servers, gin.H{
+			"id":            room.ID,
+			"name":          room.Name,
+			"serverType":    room.ServerType,
+			"status":        status,
+			"onlinePlayers": onlineCounts[room.ID],
+			"maxPlayers":    room.MaxPlayers,
+		})
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"servers":       servers,
+		"onlinePlayers": totalOnline,
+		"time":          time.Now().Format("2006-01-02 15:04:05"),
+	}))
+}
+func GetPublicPlayers(c *gin.Context) {
+	token := currentAPIToken(c)
+	rows, err := statsDB.Query(`
+		SELECT p.name, p.room_id, COALESCE(r.name, '')
+		FROM players p
+		JOIN rooms r ON p.room_id = r.id
+		WHERE p.status = 'online'
+		ORDER BY p.name
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取在线玩家失败"))
+		return
+	}
+	defer rows.Close()
+	players := []gin.H{}
+	for rows.Next() {
+		var name, roomName string
+		var roomID int
+		if err := rows.Scan(&name, &roomID, &roomName); err != nil {
+			continue
+		}
+		if token != nil && !token.AllowsRoom(roomID) {
+			continue
+		}
+		players = append(players, gin.H{
+			"name":     name,
+			"roomId":   roomID,
+			"roomName": roomName,
+		})
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"players": players,
+		"total":   len(players),
+	}))
+}
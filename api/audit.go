@@ -0,0 +1,233 @@
+package api
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+const (
+	auditBeforeKey     = "audit_before"
+	auditAfterKey      = "audit_after"
+	auditTargetKey     = "audit_target"
+	auditRoomKey       = "audit_room"
+	auditDetailsKey    = "audit_details"
+	auditMaxValueSize  = 8192
+	auditMaxErrorBytes = 1024
+	auditRedacted      = "[redacted]"
+)
+var operationLogStorage storage.OperationLogStorage
+var auditActionOverrides = map[string]string{
+	"POST /api/rooms/:id/plugins": "rooms.plugins.create",
+	"POST /api/tshock-db/bans":    "tshock-db.bans.create",
+}
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if w.body.Len() < auditMaxErrorBytes {
+		remaining := auditMaxErrorBytes - w.body.Len()
+		if len(data) < remaining {
+			remaining = len(data)
+		}
+		w.body.Write(data[:remaining])
+	}
+	return w.ResponseWriter.Write(data)
+}
+func InitAuditStorage(db *sql.DB) {
+	operationLogStorage = storage.NewSQLiteOperationLogStorage(db)
+}
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if method != http.MethodPost && method != http.MethodPut && method != http.MethodDelete && method != http.MethodPatch {
+			c.Next()
+			return
+		}
+		writer := &auditResponseWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = writer
+		c.Next()
+		if operationLogStorage == nil || c.FullPath() == "" {
+			return
+		}
+		entry := buildOperationLog(c)
+		if entry.StatusCode >= 400 && entry.Details == "" {
+			entry.Details = extractErrorMessage(writer.body.Bytes())
+		}
+		if err := operationLogStorage.Create(entry); err != nil {
+			log.Printf("[Audit] Failed to record operation %s: %v", entry.Action, err)
+		}
+	}
+}
+func buildOperationLog(c *gin.Context) *models.OperationLog {
+	fullPath := c.FullPath()
+	entry := &models.OperationLog{
+		UserID:     c.GetInt("user_id"),
+		Username:   c.GetString("username"),
+		Action:     auditAction(c.Request.Method, fullPath),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		StatusCode: c.Writer.Status(),
+		IPAddress:  c.ClientIP(),
+		Details:    c.GetString(auditDetailsKey),
+	}
+	segments := strings.Split(strings.TrimPrefix(fullPath, "/api/"), "/")
+	entry.TargetType = segments[0]
+	for _, param := range c.Params {
+		if id, err := strconv.Atoi(param.Value); err == nil && entry.TargetID == 0 {
+			entry.TargetID = id
+		} else if entry.TargetName == "" {
+			entry.TargetName = param.Value
+		}
+	}
+	if target := c.GetString(auditTargetKey); target != "" {
+		entry.TargetName = target
+	}
+	if roomID, exists := c.Get(auditRoomKey); exists {
+		if id, ok := roomID.(int); ok {
+			entry.RoomID = &id
+		}
+	} else if entry.TargetType == "rooms" && c.Param("id") != "" {
+		id := entry.TargetID
+		entry.RoomID = &id
+	} else if entry.TargetType == "plugin-server" {
+		id := 0
+		entry.RoomID = &id
+	}
+	if before, exists := c.Get(auditBeforeKey); exists {
+		entry.Before = auditValue(before)
+	}
+	if after, exists := c.Get(auditAfterKey); exists {
+		entry.After = auditValue(after)
+	}
+	return entry
+}
+func auditAction(method, fullPath string) string {
+	if action, exists := auditActionOverrides[method+" "+fullPath]; exists {
+		return action
+	}
+	segments := strings.Split(strings.TrimPrefix(fullPath, "/api/"), "/")
+	names := []string{}
+	for _, segment := range segments {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			names = append(names, segment)
+		}
+	}
+	last := segments[len(segments)-1]
+	endsWithParam := strings.HasPrefix(last, ":") || strings.HasPrefix(last, "*")
+	if method == http.MethodPost && !endsWithParam && len(names) > 1 {
+		return strings.Join(names, ".")
+	}
+	verb := "create"
+	switch method {
+	case http.MethodPut, http.MethodPatch:
+		verb = "update"
+	case http.MethodDelete:
+		verb = "delete"
+	}
+	return strings.Join(append(names, verb), ".")
+}
+func auditValue(value interface{}) string {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		text = string(data)
+	}
+	if len(text) > auditMaxValueSize {
+		text = text[:auditMaxValueSize] + "...(truncated)"
+	}
+	return text
+}
+func extractErrorMessage(body []byte) string {
+	var response struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil {
+		if response.Error != "" {
+			return response.Error
+		}
+		return response.Message
+	}
+	return ""
+}
+func setAuditChange(c *gin.Context, before, after interface{}) {
+	if _, exists := c.Get(auditBeforeKey); !exists && before != nil {
+		c.Set(auditBeforeKey, before)
+	}
+	if after != nil {
+		c.Set(auditAfterKey, after)
+	}
+}
+func setAuditTarget(c *gin.Context, target string) {
+	c.Set(auditTargetKey, target)
+}
+func setAuditRoom(c *gin.Context, roomID int) {
+	c.Set(auditRoomKey, roomID)
+}
+func setAuditDetails(c *gin.Context, details string) {
+	c.Set(auditDetailsKey, details)
+}
+func GetOperationLogs(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if err != nil || pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	filter := models.OperationLogFilter{
+		Username:   c.Query("username"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		IPAddress:  c.Query("ip"),
+		FailedOnly: c.Query("failed") == "true",
+	}
+	filter.UserID, _ = strconv.Atoi(c.Query("userId"))
+	filter.TargetID, _ = strconv.Atoi(c.Query("targetId"))
+	if roomID, err := strconv.Atoi(c.Query("roomId")); err == nil {
+		filter.RoomID = &roomID
+	}
+	if since, ok := parseAuditTime(c.Query("from")); ok {
+		filter.Since = &since
+	}
+	if until, ok := parseAuditTime(c.Query("to")); ok {
+		filter.Until = &until
+	}
+	logs, total, err := operationLogStorage.Query(filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取操作日志失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"logs":     logs,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}))
+}
+func parseAuditTime(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
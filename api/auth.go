@@ -1,5 +1,7 @@
 package api
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"terraria-panel/middleware"
 	"terraria-panel/models"
@@ -23,32 +25,47 @@ func Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误"))
 		return
 	}
+	ip := c.ClientIP()
+	if lockout := activeLoginLockout(req.Username, ip); lockout != nil {
+		respondLoginLocked(c, lockout)
+		return
+	}
 	user, err := userStorage.GetByUsername(req.Username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("服务器错误"))
 		return
 	}
-	if user == nil {
+	if user == nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		if lockout := recordLoginFailure(req.Username, ip); lockout != nil {
+			respondLoginLocked(c, lockout)
+			return
+		}
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse("用户名或密码错误"))
 		return
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse("用户名或密码错误"))
+	if twoFactorEnabled(user.ID) {
+		challenge, err := middleware.GenerateChallengeToken(user, twoFactorChallenge, twoFactorChallengeTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成令牌失败"))
+			return
+		}
+		c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+			"requires2FA":    true,
+			"challengeToken": challenge,
+			"expiresIn":      int(twoFactorChallengeTTL.Seconds()),
+		}))
 		return
 	}
-	token, err := middleware.GenerateToken(user)
+	clearLoginFailures(req.Username, ip)
+	data, err := issueSession(c, user)
+	if err == nil && twoFactorRequired(user.Role) {
+		data["twoFactorSetupRequired"] = true
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成令牌失败"))
 		return
 	}
-	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"role":     user.Role,
-		},
-	}))
+	c.JSON(http.StatusOK, models.SuccessResponse(data))
 }
 func CheckHasUsers(c *gin.Context) {
 	count, err := userStorage.Count()
@@ -62,8 +79,13 @@ func CheckHasUsers(c *gin.Context) {
 		"userCount": count,
 	})
 }
+type RegisterRequest struct {
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	InviteCode string `json:"inviteCode"`
+}
 func Register(c *gin.Context) {
-	var req LoginRequest
+	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误"))
 		return
@@ -73,9 +95,21 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("服务器错误"))
 		return
 	}
+	var invitation *models.Invitation
 	if userCount > 0 {
-		c.JSON(http.StatusForbidden, models.ErrorResponse("系统已初始化完成，不允许注册新用户"))
-		return
+		if req.InviteCode == "" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("系统已初始化完成，需要邀请码才能注册"))
+			return
+		}
+		invitation, err = invitationStorage.GetByCode(req.InviteCode)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("服务器错误"))
+			return
+		}
+		if invitation == nil || !invitation.IsUsable() {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("邀请码无效或已过期"))
+			return
+		}
 	}
 	existingUser, err := userStorage.GetByUsername(req.Username)
 	if err != nil {
@@ -91,21 +125,38 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("密码加密失败"))
 		return
 	}
-	role := "user"
-	if userCount == 0 {
-		role = "admin"
+	role := models.RoleOwner
+	if invitation != nil {
+		role = invitation.Role
 	}
 	user := &models.User{
 		Username: req.Username,
 		Password: string(hashedPassword),
 		Role:     role,
 	}
-	if err := userStorage.Create(user); err != nil {
+	if invitation != nil {
+		err = invitationStorage.Redeem(invitation, user)
+	} else {
+		err = userStorage.CreateFirst(user)
+	}
+	if errors.Is(err, storage.ErrUsersAlreadyExist) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse("系统已初始化完成，需要邀请码才能注册"))
+		return
+	}
+	if errors.Is(err, storage.ErrInvitationUnavailable) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse("邀请码无效或已过期"))
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建用户失败"))
 		return
 	}
+	if invitation != nil {
+		applyGrants(user.ID, invitation.Grants, invitation.CreatedBy)
+		LogActivity(models.ActivityTypeSystem, "新用户通过邀请注册", fmt.Sprintf("用户 %s 使用 %s 创建的邀请注册，角色: %s", user.Username, invitation.CreatedBy, user.Role), nil, "", models.ColorBlue)
+	}
 	if userCount == 0 {
-		token, err := middleware.GenerateToken(user)
+		data, err := issueSession(c, user)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成令牌失败"))
 			return
@@ -113,14 +164,7 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "注册成功，已自动登录",
-			"data": gin.H{
-				"token": token,
-				"user": gin.H{
-					"id":       user.ID,
-					"username": user.Username,
-					"role":     user.Role,
-				},
-			},
+			"data":    data,
 		})
 		return
 	}
@@ -0,0 +1,44 @@
+package api
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"terraria-panel/models"
+)
+func TestRegisterCreatesOnlyOneFirstOwner(t *testing.T) {
+	setupTestDB(t)
+	const attempts = 8
+	codes := make([]int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := performTestRequest(Register, http.MethodPost, "/", nil, RegisterRequest{Username: fmt.Sprintf("racer%d", i), Password: "password"}, nil)
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+	succeeded := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d registrations succeeded without an invitation, want 1 (statuses %v)", succeeded, codes)
+	}
+	users, err := userStorage.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Role != models.RoleOwner {
+		t.Fatalf("users after concurrent first registration = %+v, want a single owner", users)
+	}
+	w := performTestRequest(Register, http.MethodPost, "/", nil, RegisterRequest{Username: "latecomer", Password: "password"}, nil)
+	testResponseStatus(t, "second registration without invitation", w, http.StatusForbidden)
+	if count, _ := userStorage.Count(); count != 1 {
+		t.Errorf("user count = %d after rejected registration, want 1", count)
+	}
+}
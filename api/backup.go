@@ -1,64 +1,81 @@
 package api
 import (
-	"archive/zip"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"terraria-panel/config"
 	"terraria-panel/db"
 	"terraria-panel/models"
+	"terraria-panel/services"
 	"terraria-panel/storage"
-	"time"
 	"github.com/gin-gonic/gin"
 )
+var backupService *services.BackupService
+var backupStorage storage.BackupStorage
+var backupTargetStorage storage.BackupTargetStorage
+func InitBackups(backupStore storage.BackupStorage, targetStore storage.BackupTargetStorage, service *services.BackupService) {
+	backupStorage = backupStore
+	backupTargetStorage = targetStore
+	backupService = service
+	if _, total, err := backupStorage.List(models.BackupFilter{}, 1, 0); err != nil || total > 0 {
+		return
+	}
+	imported, err := backupService.ImportOrphans("system")
+	if err != nil {
+		log.Printf("[Backup] Failed to import existing backups into catalog: %v", err)
+		return
+	}
+	if len(imported) > 0 {
+		log.Printf("[Backup] Imported %d existing backups into catalog", len(imported))
+	}
+}
 func GetBackups(c *gin.Context) {
-	entries, err := os.ReadDir(config.BackupDir)
+	filter := models.BackupFilter{
+		Trigger:    c.Query("trigger"),
+		Status:     c.Query("status"),
+		SaveStatus: c.Query("saveStatus"),
+	}
+	if roomIDStr := c.Query("roomId"); roomIDStr != "" {
+		roomID, err := strconv.Atoi(roomIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的房间ID"))
+			return
+		}
+		filter.RoomID = &roomID
+	}
+	backups, _, err := backupStorage.List(filter, -1, 0)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份列表失败"))
 		return
 	}
-	backups := []gin.H{}
-	re := regexp.MustCompile(`^room-(\d+)_(.+)_(\d{8}_\d{6})\.zip$`)
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".zip") {
+	visible := []*models.Backup{}
+	byID := make(map[int]*models.Backup)
+	backupIDs := []int{}
+	for _, backup := range backups {
+		if !hasRoomPermission(c.GetInt("user_id"), c.GetString("role"), backup.RoomID, models.RoomPermissionView) {
 			continue
 		}
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-		matches := re.FindStringSubmatch(entry.Name())
-		var roomID int
-		var roomName string
-		var timestamp string
-		if len(matches) == 4 {
-			roomID, _ = strconv.Atoi(matches[1])
-			roomName = matches[2]
-			timestamp = matches[3]
-		}
-		createdAt := info.ModTime().Format("2006-01-02 15:04:05")
-		if timestamp != "" {
-			if t, err := time.Parse("20060102_150405", timestamp); err == nil {
-				createdAt = t.Format("2006-01-02 15:04:05")
-			}
+		backupService.RefreshStatus(backup)
+		visible = append(visible, backup)
+		byID[backup.ID] = backup
+		backupIDs = append(backupIDs, backup.ID)
+	}
+	copies, err := backupTargetStorage.GetCopies(backupIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份副本失败"))
+		return
+	}
+	for _, backupCopy := range copies {
+		if backup := byID[backupCopy.BackupID]; backup != nil {
+			backup.Copies = append(backup.Copies, backupCopy)
 		}
-		backups = append(backups, gin.H{
-			"id":        strings.TrimSuffix(entry.Name(), ".zip"),
-			"name":      entry.Name(),
-			"roomId":    roomID,
-			"roomName":  roomName,
-			"type":      "full",
-			"size":      info.Size(),
-			"createdAt": createdAt,
-		})
 	}
-	c.JSON(http.StatusOK, models.SuccessResponse(backups))
+	c.JSON(http.StatusOK, models.SuccessResponse(visible))
 }
 func CreateBackup(c *gin.Context) {
 	var req struct {
@@ -71,7 +88,14 @@ func CreateBackup(c *gin.Context) {
 		return
 	}
 	if req.Type == "" {
-		req.Type = "full"
+		req.Type = models.BackupTypeFull
+	}
+	if !models.IsValidBackupType(req.Type) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("不支持的备份类型: "+req.Type))
+		return
+	}
+	if !checkRoomPermission(c, req.RoomID, models.RoomPermissionOperate) {
+		return
 	}
 	roomStorage := storage.NewSQLiteRoomStorage(db.DB)
 	room, err := roomStorage.GetByID(req.RoomID)
@@ -79,176 +103,278 @@ func CreateBackup(c *gin.Context) {
 		c.JSON(http.StatusNotFound, models.ErrorResponse("房间不存在"))
 		return
 	}
-	timestamp := time.Now().Format("20060102_150405")
-	zipName := fmt.Sprintf("room-%d_%s_%s.zip", room.ID, room.Name, timestamp)
-	zipPath := filepath.Join(config.BackupDir, zipName)
-	log.Printf("[Backup] Creating backup for room #%d: %s", room.ID, zipName)
-	zipFile, err := os.Create(zipPath)
+	setAuditRoom(c, room.ID)
+	backup, err := backupService.Create(room.ID, services.BackupOptions{
+		Trigger:   models.BackupTriggerManual,
+		Type:      req.Type,
+		Note:      strings.TrimSpace(req.Note),
+		CreatedBy: c.GetString("username"),
+	})
 	if err != nil {
-		log.Printf("[Backup] Failed to create ZIP file: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建备份文件失败"))
+		log.Printf("[Backup] Failed to create backup for room #%d: %v", room.ID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建备份失败: "+err.Error()))
 		return
 	}
-	defer zipFile.Close()
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
-	roomDir := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", room.ID))
-	if _, err := os.Stat(roomDir); os.IsNotExist(err) {
-		log.Printf("[Backup] Room directory does not exist: %s", roomDir)
-		c.JSON(http.StatusNotFound, models.ErrorResponse("房间目录不存在"))
-		return
+	setAuditTarget(c, backup.FileName)
+	setAuditChange(c, nil, backup)
+	message := "备份创建成功"
+	if backup.SaveStatus == models.BackupSaveUnconfirmed {
+		message = "备份已创建，但未能确认世界已保存完成，快照可能不一致: " + backup.SaveDetail
 	}
-	if err := addDirToZip(zipWriter, roomDir, ""); err != nil {
-		log.Printf("[Backup] Failed to add room directory to ZIP: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("备份房间数据失败: "+err.Error()))
-		return
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: message,
+		Data:    backup,
+	})
+}
+func loadBackup(c *gin.Context) (*models.Backup, bool) {
+	backup, err := backupStorage.GetByName(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份失败: "+err.Error()))
+		return nil, false
 	}
-	log.Printf("[Backup] Backup created successfully: %s (size: %d bytes)", zipName, getFileSize(zipPath))
-	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
-		"id":   strings.TrimSuffix(zipName, ".zip"),
-		"name": zipName,
-		"size": getFileSize(zipPath),
-		"message": "备份创建成功",
-	}))
+	if backup == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("备份不存在"))
+		return nil, false
+	}
+	backupService.RefreshStatus(backup)
+	return backup, true
 }
 func RestoreBackup(c *gin.Context) {
-	backupID := c.Param("id")
 	var req struct {
 		TargetRoomID int  `json:"targetRoomId" binding:"required"`
 		CreateNew    bool `json:"createNew"`
+		CopyID       int  `json:"copyId"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误: "+err.Error()))
 		return
 	}
-	roomStorage := storage.NewSQLiteRoomStorage(db.DB)
-	room, err := roomStorage.GetByID(req.TargetRoomID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse("目标房间不存在"))
+	if !checkRoomPermission(c, req.TargetRoomID, models.RoomPermissionManage) {
 		return
 	}
-	if room.Status == "running" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("请先停止房间再恢复备份"))
+	backup, ok := loadBackup(c)
+	if !ok {
 		return
 	}
-	backupPath := filepath.Join(config.BackupDir, backupID+".zip")
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+	var backupCopy *models.BackupCopy
+	if req.CopyID > 0 {
+		var err error
+		if backupCopy, err = backupTargetStorage.GetCopy(req.CopyID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份副本失败: "+err.Error()))
+			return
+		}
+		if backupCopy == nil || backupCopy.BackupID != backup.ID {
+			c.JSON(http.StatusNotFound, models.ErrorResponse("备份副本不存在"))
+			return
+		}
+		if backupCopy.Status != models.BackupCopyVerified {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("该备份副本尚未上传并校验成功，无法恢复"))
+			return
+		}
+	} else if backup.Status == models.BackupStatusMissing {
 		c.JSON(http.StatusNotFound, models.ErrorResponse("备份文件不存在"))
 		return
+	} else if backup.Status == models.BackupStatusOffsite {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("本地备份已删除，请选择异地副本恢复"))
+		return
+	}
+	if backup.Status != models.BackupStatusCompleted && backupCopy == nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("该备份未成功完成，无法恢复"))
+		return
 	}
-	log.Printf("[Backup] Restoring backup %s to room #%d", backupID, room.ID)
-	zipReader, err := zip.OpenReader(backupPath)
+	roomStorage := storage.NewSQLiteRoomStorage(db.DB)
+	room, err := roomStorage.GetByID(req.TargetRoomID)
 	if err != nil {
-		log.Printf("[Backup] Failed to open backup file: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("打开备份文件失败"))
+		c.JSON(http.StatusNotFound, models.ErrorResponse("目标房间不存在"))
 		return
 	}
-	defer zipReader.Close()
-	roomDir := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", room.ID))
-	if err := os.MkdirAll(roomDir, 0755); err != nil {
-		log.Printf("[Backup] Failed to create room directory: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建房间目录失败"))
+	if room.Status == "running" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请先停止房间再恢复备份"))
 		return
 	}
-	for _, file := range zipReader.File {
-		destPath := filepath.Join(roomDir, file.Name)
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(destPath, file.Mode())
-			continue
-		}
-		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-			log.Printf("[Backup] Failed to create directory: %v", err)
-			continue
-		}
-		srcFile, err := file.Open()
-		if err != nil {
-			log.Printf("[Backup] Failed to open file in ZIP: %v", err)
-			continue
-		}
-		dstFile, err := os.Create(destPath)
-		if err != nil {
-			log.Printf("[Backup] Failed to create destination file: %v", err)
-			srcFile.Close()
-			continue
+	archivePath := ""
+	if backupCopy != nil {
+		log.Printf("[Backup] Downloading copy of backup %s from %s", backup.Name, backupCopy.Location)
+		if archivePath, err = backupService.FetchCopy(backupCopy); err != nil {
+			log.Printf("[Backup] Failed to fetch copy of backup %s from %s: %v", backup.Name, backupCopy.Location, err)
+			status := http.StatusBadGateway
+			if errors.Is(err, services.ErrBackupChecksumMismatch) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, models.ErrorResponse("下载远程备份副本失败: "+err.Error()))
+			return
 		}
-		_, err = io.Copy(dstFile, srcFile)
-		dstFile.Close()
-		srcFile.Close()
+		defer os.Remove(archivePath)
+	} else if err := backupService.Verify(backup); err != nil {
+		log.Printf("[Backup] Backup %s failed verification: %v", backup.Name, err)
+		c.JSON(http.StatusConflict, models.ErrorResponse("备份文件校验失败，文件可能已损坏: "+err.Error()))
+		return
+	}
+	setAuditRoom(c, room.ID)
+	setAuditTarget(c, backup.FileName)
+	var preRestore *models.Backup
+	roomDir := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", room.ID))
+	if _, err := os.Stat(roomDir); err == nil {
+		preRestore, err = backupService.Create(room.ID, services.BackupOptions{
+			Trigger:   models.BackupTriggerPreRestore,
+			Type:      backup.Type,
+			Note:      "恢复备份 " + backup.Name + " 前自动创建",
+			CreatedBy: c.GetString("username"),
+		})
 		if err != nil {
-			log.Printf("[Backup] Failed to copy file: %v", err)
+			log.Printf("[Backup] Pre-restore backup of room #%d failed: %v", room.ID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("恢复前自动备份失败，已取消恢复: "+err.Error()))
+			return
 		}
 	}
+	log.Printf("[Backup] Restoring backup %s to room #%d", backup.Name, room.ID)
+	var restored, total int
+	if archivePath != "" {
+		restored, total, err = backupService.RestoreZip(backup, archivePath, room.ID)
+	} else {
+		restored, total, err = backupService.Restore(backup, room.ID)
+	}
+	if err != nil {
+		log.Printf("[Backup] Failed to restore backup %s: %v", backup.Name, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("恢复备份失败: "+err.Error()))
+		return
+	}
 	log.Printf("[Backup] Backup restored successfully to room #%d", room.ID)
-	c.JSON(http.StatusOK, models.MessageResponse("备份恢复成功"))
+	result := gin.H{"backup": backup.Name, "restoredFiles": restored, "totalFiles": total}
+	if preRestore != nil {
+		result["preRestoreBackup"] = preRestore.Name
+	}
+	if backupCopy != nil {
+		result["copy"] = backupCopy.Location
+	}
+	setAuditChange(c, gin.H{"room": room.Name, "status": room.Status}, result)
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "备份恢复成功",
+		Data:    result,
+	})
 }
 func DeleteBackup(c *gin.Context) {
 	backupID := c.Param("id")
-	backupPath := filepath.Join(config.BackupDir, backupID+".zip")
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, models.ErrorResponse("备份文件不存在"))
+	backup, err := backupStorage.GetByName(backupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份失败: "+err.Error()))
+		return
+	}
+	if backup == nil {
+		deleteOrphanBackup(c, backupID)
+		return
+	}
+	if backup.Pinned {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("该备份已固定，请先取消固定再删除"))
+		return
+	}
+	deleteCopies := c.Query("deleteCopies") == "true"
+	if backup.Status == models.BackupStatusOffsite && !deleteCopies {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("该备份仅剩异地副本，如需删除请同时删除异地副本"))
+		return
+	}
+	log.Printf("[Backup] Deleting backup: %s (deleteCopies=%v)", backupID, deleteCopies)
+	setAuditRoom(c, backup.RoomID)
+	setAuditChange(c, backup, nil)
+	if deleteCopies {
+		setAuditDetails(c, "deleted offsite copies")
+	}
+	if err := backupService.Delete(backup, deleteCopies); err != nil {
+		log.Printf("[Backup] Failed to delete backup %s: %v", backupID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除备份失败"))
+		return
+	}
+	if backup.Type == models.BackupTypeIncremental {
+		if _, err := backupService.GarbageCollect(); err != nil {
+			log.Printf("[Backup] Garbage collection after deleting %s failed: %v", backupID, err)
+		}
+	}
+	if backup.Status == models.BackupStatusOffsite {
+		log.Printf("[Backup] Local files of backup %s deleted, offsite copies kept", backupID)
+		c.JSON(http.StatusOK, models.MessageResponse("本地备份已删除，异地副本已保留"))
 		return
 	}
-	log.Printf("[Backup] Deleting backup: %s", backupID)
+	log.Printf("[Backup] Backup deleted successfully: %s", backupID)
+	c.JSON(http.StatusOK, models.MessageResponse("备份删除成功"))
+}
+func deleteOrphanBackup(c *gin.Context, backupID string) {
+	backupPath := filepath.Join(config.BackupDir, filepath.Base(backupID)+".zip")
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("备份不存在"))
+		return
+	}
+	log.Printf("[Backup] Deleting orphan backup file: %s", backupID)
+	setAuditChange(c, gin.H{"backup": backupID, "size": info.Size(), "orphan": true}, nil)
 	if err := os.Remove(backupPath); err != nil {
 		log.Printf("[Backup] Failed to delete backup file: %v", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除备份文件失败"))
 		return
 	}
-	log.Printf("[Backup] Backup deleted successfully: %s", backupID)
 	c.JSON(http.StatusOK, models.MessageResponse("备份删除成功"))
 }
 func DownloadBackup(c *gin.Context) {
-	backupID := c.Param("id")
-	backupPath := filepath.Join(config.BackupDir, backupID+".zip")
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+	backup, ok := loadBackup(c)
+	if !ok {
+		return
+	}
+	if backup.Status != models.BackupStatusCompleted {
 		c.JSON(http.StatusNotFound, models.ErrorResponse("备份文件不存在"))
 		return
 	}
-	log.Printf("[Backup] Downloading backup: %s", backupID)
+	log.Printf("[Backup] Downloading backup: %s", backup.Name)
 	c.Header("Content-Description", "File Transfer")
 	c.Header("Content-Transfer-Encoding", "binary")
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", backupID))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", backup.Name))
 	c.Header("Content-Type", "application/zip")
-	c.File(backupPath)
-}
-func addDirToZip(zipWriter *zip.Writer, sourceDir, baseInZip string) error {
-	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	if backup.Type == models.BackupTypeIncremental {
+		if err := backupService.Verify(backup); err != nil {
+			c.JSON(http.StatusConflict, models.ErrorResponse("备份快照不完整: "+err.Error()))
+			return
 		}
-		relPath, err := filepath.Rel(sourceDir, path)
-		if err != nil {
-			return err
-		}
-		zipPath := filepath.Join(baseInZip, relPath)
-		zipPath = filepath.ToSlash(zipPath)
-		if zipPath == "." || zipPath == "" {
-			return nil
+		c.Status(http.StatusOK)
+		if err := backupService.WriteZip(backup, c.Writer); err != nil {
+			log.Printf("[Backup] Failed to stream snapshot %s as ZIP: %v", backup.Name, err)
 		}
-		if info.IsDir() {
-			_, err := zipWriter.Create(zipPath + "/")
-			return err
-		}
-		return addFileToZip(zipWriter, path, zipPath)
-	})
+		return
+	}
+	if backup.SHA256 != "" {
+		c.Header("X-Checksum-Sha256", backup.SHA256)
+	}
+	c.File(backupService.Path(backup))
 }
-func addFileToZip(zipWriter *zip.Writer, filePath, fileName string) error {
-	file, err := os.Open(filePath)
+func CheckBackups(c *gin.Context) {
+	orphans, missing, err := backupService.Check()
 	if err != nil {
-		return err
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("检查备份目录失败: "+err.Error()))
+		return
 	}
-	defer file.Close()
-	writer, err := zipWriter.Create(fileName)
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"orphans": orphans,
+		"missing": missing,
+	}))
+}
+func ImportOrphanBackups(c *gin.Context) {
+	imported, err := backupService.ImportOrphans(c.GetString("username"))
 	if err != nil {
-		return err
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("导入孤立备份失败: "+err.Error()))
+		return
 	}
-	_, err = io.Copy(writer, file)
-	return err
+	setAuditDetails(c, fmt.Sprintf("imported %d orphan backups", len(imported)))
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: fmt.Sprintf("已导入 %d 个孤立备份", len(imported)),
+		Data:    imported,
+	})
 }
-func getFileSize(path string) int64 {
-	info, err := os.Stat(path)
+func CollectBackupGarbage(c *gin.Context) {
+	result, err := backupService.GarbageCollect()
 	if err != nil {
-		return 0
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("清理备份存储失败: "+err.Error()))
+		return
 	}
-	return info.Size()
+	setAuditDetails(c, fmt.Sprintf("removed %d chunks, freed %d bytes", result.RemovedChunks, result.FreedBytes))
+	c.JSON(http.StatusOK, models.SuccessResponse(result))
 }
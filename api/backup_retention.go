@@ -0,0 +1,169 @@
+package api
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"terraria-panel/models"
+	"github.com/gin-gonic/gin"
+)
+type backupRetentionRequest struct {
+	Enabled     *bool  `json:"enabled"`
+	KeepLast    *int   `json:"keepLast"`
+	KeepHourly  *int   `json:"keepHourly"`
+	KeepDaily   *int   `json:"keepDaily"`
+	KeepWeekly  *int   `json:"keepWeekly"`
+	KeepMonthly *int   `json:"keepMonthly"`
+	MaxSizeMB   *int64 `json:"maxSizeMb"`
+}
+func (req *backupRetentionRequest) apply(policy *models.BackupRetentionPolicy) bool {
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	for _, field := range []struct {
+		value  *int
+		target *int
+	}{
+		{req.KeepLast, &policy.KeepLast},
+		{req.KeepHourly, &policy.KeepHourly},
+		{req.KeepDaily, &policy.KeepDaily},
+		{req.KeepWeekly, &policy.KeepWeekly},
+		{req.KeepMonthly, &policy.KeepMonthly},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if *field.value < 0 {
+			return false
+		}
+		*field.target = *field.value
+	}
+	if req.MaxSizeMB != nil {
+		if *req.MaxSizeMB < 0 {
+			return false
+		}
+		policy.MaxSizeMB = *req.MaxSizeMB
+	}
+	return true
+}
+func backupRoomParam(c *gin.Context) (int, bool) {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的房间ID"))
+		return 0, false
+	}
+	setAuditRoom(c, roomID)
+	return roomID, true
+}
+func GetBackupRetention(c *gin.Context) {
+	roomID, ok := backupRoomParam(c)
+	if !ok {
+		return
+	}
+	policy, err := backupStorage.GetRetentionPolicy(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份保留策略失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(policy))
+}
+func UpdateBackupRetention(c *gin.Context) {
+	roomID, ok := backupRoomParam(c)
+	if !ok {
+		return
+	}
+	var req backupRetentionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	policy, err := backupStorage.GetRetentionPolicy(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份保留策略失败: "+err.Error()))
+		return
+	}
+	before := *policy
+	if !req.apply(policy) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("保留数量和容量上限不能为负数"))
+		return
+	}
+	policy.UpdatedBy = c.GetString("username")
+	if err := backupStorage.SaveRetentionPolicy(policy); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("保存备份保留策略失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, before, policy)
+	c.JSON(http.StatusOK, models.SuccessResponse(policy))
+}
+func DryRunBackupRetention(c *gin.Context) {
+	roomID, ok := backupRoomParam(c)
+	if !ok {
+		return
+	}
+	policy, err := backupStorage.GetRetentionPolicy(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份保留策略失败: "+err.Error()))
+		return
+	}
+	if c.Request.ContentLength > 0 {
+		var req backupRetentionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+			return
+		}
+		if !req.apply(policy) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("保留数量和容量上限不能为负数"))
+			return
+		}
+	}
+	plan, err := backupService.PlanRetention(roomID, policy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("计算保留计划失败: "+err.Error()))
+		return
+	}
+	plan.DryRun = true
+	c.JSON(http.StatusOK, models.SuccessResponse(plan))
+}
+func ApplyBackupRetention(c *gin.Context) {
+	roomID, ok := backupRoomParam(c)
+	if !ok {
+		return
+	}
+	plan, err := backupService.ApplyRetention(roomID)
+	if err != nil {
+		log.Printf("[Backup] Retention for room #%d failed: %v", roomID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("执行保留策略失败: "+err.Error()))
+		return
+	}
+	if plan == nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("该房间未启用备份保留策略"))
+		return
+	}
+	deleted := []string{}
+	for _, decision := range plan.Delete {
+		deleted = append(deleted, decision.Backup.Name)
+	}
+	setAuditChange(c, gin.H{"deleted": deleted}, gin.H{"failed": plan.Failed})
+	c.JSON(http.StatusOK, models.SuccessResponse(plan))
+}
+func PinBackup(c *gin.Context) {
+	var req struct {
+		Pinned bool `json:"pinned"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	backup, ok := loadBackup(c)
+	if !ok {
+		return
+	}
+	setAuditRoom(c, backup.RoomID)
+	setAuditTarget(c, backup.Name)
+	if err := backupStorage.SetPinned(backup.ID, req.Pinned); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("更新备份固定状态失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, gin.H{"pinned": backup.Pinned}, gin.H{"pinned": req.Pinned})
+	backup.Pinned = req.Pinned
+	c.JSON(http.StatusOK, models.SuccessResponse(backup))
+}
@@ -0,0 +1,259 @@
+package api
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"terraria-panel/models"
+	"terraria-panel/services"
+	"github.com/gin-gonic/gin"
+)
+type backupTargetRequest struct {
+	Name       *string `json:"name"`
+	Type       *string `json:"type"`
+	Enabled    *bool   `json:"enabled"`
+	Path       *string `json:"path"`
+	Host       *string `json:"host"`
+	Bucket     *string `json:"bucket"`
+	Region     *string `json:"region"`
+	Username   *string `json:"username"`
+	Secret     *string `json:"secret"`
+	PrivateKey *string `json:"privateKey"`
+	HostKey    *string `json:"hostKey"`
+}
+func (req *backupTargetRequest) apply(target *models.BackupTarget) {
+	for _, field := range []struct {
+		value  *string
+		target *string
+	}{
+		{req.Name, &target.Name},
+		{req.Type, &target.Type},
+		{req.Path, &target.Path},
+		{req.Host, &target.Host},
+		{req.Bucket, &target.Bucket},
+		{req.Region, &target.Region},
+		{req.Username, &target.Username},
+		{req.Secret, &target.Secret},
+		{req.PrivateKey, &target.PrivateKey},
+		{req.HostKey, &target.HostKey},
+	} {
+		if field.value != nil {
+			*field.target = strings.TrimSpace(*field.value)
+		}
+	}
+	if req.Enabled != nil {
+		target.Enabled = *req.Enabled
+	}
+	target.HasSecret = target.Secret != ""
+	target.HasPrivateKey = target.PrivateKey != ""
+}
+func loadBackupTarget(c *gin.Context) (*models.BackupTarget, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的备份目标ID"))
+		return nil, false
+	}
+	target, err := backupTargetStorage.Get(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份目标失败: "+err.Error()))
+		return nil, false
+	}
+	if target == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("备份目标不存在"))
+		return nil, false
+	}
+	setAuditTarget(c, target.Name)
+	return target, true
+}
+func GetBackupTargets(c *gin.Context) {
+	targets, err := backupTargetStorage.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份目标失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(targets))
+}
+func CreateBackupTarget(c *gin.Context) {
+	var req backupTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	target := &models.BackupTarget{Enabled: true, CreatedBy: c.GetString("username")}
+	req.apply(target)
+	if err := services.ValidateBackupTarget(target); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("备份目标配置无效: "+err.Error()))
+		return
+	}
+	if err := backupTargetStorage.Create(target); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("备份目标名称已存在"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建备份目标失败: "+err.Error()))
+		return
+	}
+	setAuditTarget(c, target.Name)
+	setAuditChange(c, nil, target)
+	c.JSON(http.StatusOK, models.SuccessResponse(target))
+}
+func UpdateBackupTarget(c *gin.Context) {
+	target, ok := loadBackupTarget(c)
+	if !ok {
+		return
+	}
+	var req backupTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	before := *target
+	req.apply(target)
+	if target.Host != before.Host && req.HostKey == nil {
+		target.HostKey = ""
+	}
+	if err := services.ValidateBackupTarget(target); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("备份目标配置无效: "+err.Error()))
+		return
+	}
+	if err := backupTargetStorage.Update(target); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("备份目标名称已存在"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("更新备份目标失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, before, target)
+	c.JSON(http.StatusOK, models.SuccessResponse(target))
+}
+func DeleteBackupTarget(c *gin.Context) {
+	target, ok := loadBackupTarget(c)
+	if !ok {
+		return
+	}
+	if err := backupTargetStorage.Delete(target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除备份目标失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, target, nil)
+	c.JSON(http.StatusOK, models.MessageResponse("备份目标已删除，已上传到该目标的远程文件不会被删除"))
+}
+func ProbeBackupTarget(c *gin.Context) {
+	target, ok := loadBackupTarget(c)
+	if !ok {
+		return
+	}
+	pinned := target.HostKey
+	err := services.ProbeBackupTarget(target)
+	if pinned == "" && target.HostKey != "" {
+		if pinErr := backupTargetStorage.PinHostKey(target.ID, target.HostKey); pinErr != nil {
+			c.JSON(http.StatusConflict, models.ErrorResponse("记录主机密钥失败: "+pinErr.Error()))
+			return
+		}
+		setAuditChange(c, gin.H{"hostKey": ""}, gin.H{"hostKey": target.HostKey})
+	}
+	if err != nil {
+		log.Printf("[Backup] Backup target %s failed connectivity test: %v", target.Name, err)
+		c.JSON(http.StatusBadGateway, models.ErrorResponse("备份目标测试失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.MessageResponse("备份目标连接正常，上传、校验和下载均成功"))
+}
+func GetRoomBackupTargets(c *gin.Context) {
+	roomID, ok := backupRoomParam(c)
+	if !ok {
+		return
+	}
+	targetIDs, err := backupTargetStorage.GetRoomTargets(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取房间备份目标失败: "+err.Error()))
+		return
+	}
+	targets := []*models.BackupTarget{}
+	for _, targetID := range targetIDs {
+		target, err := backupTargetStorage.Get(targetID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份目标失败: "+err.Error()))
+			return
+		}
+		if target != nil {
+			targets = append(targets, target)
+		}
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(targets))
+}
+func UpdateRoomBackupTargets(c *gin.Context) {
+	roomID, ok := backupRoomParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		TargetIDs []int `json:"targetIds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	for _, targetID := range req.TargetIDs {
+		target, err := backupTargetStorage.Get(targetID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取备份目标失败: "+err.Error()))
+			return
+		}
+		if target == nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("备份目标不存在: "+strconv.Itoa(targetID)))
+			return
+		}
+	}
+	before, err := backupTargetStorage.GetRoomTargets(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取房间备份目标失败: "+err.Error()))
+		return
+	}
+	if req.TargetIDs == nil {
+		req.TargetIDs = []int{}
+	}
+	if err := backupTargetStorage.SetRoomTargets(roomID, req.TargetIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("保存房间备份目标失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, gin.H{"targetIds": before}, gin.H{"targetIds": req.TargetIDs})
+	c.JSON(http.StatusOK, models.SuccessResponse(req.TargetIDs))
+}
+func ReplicateBackup(c *gin.Context) {
+	var req struct {
+		TargetIDs []int `json:"targetIds"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+			return
+		}
+	}
+	backup, ok := loadBackup(c)
+	if !ok {
+		return
+	}
+	if backup.Status != models.BackupStatusCompleted {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("只能复制已完成且本地文件存在的备份"))
+		return
+	}
+	setAuditRoom(c, backup.RoomID)
+	setAuditTarget(c, backup.Name)
+	copies, err := backupService.Replicate(backup, req.TargetIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建复制任务失败: "+err.Error()))
+		return
+	}
+	if len(copies) == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("没有可用的备份目标，请先为房间配置已启用的备份目标"))
+		return
+	}
+	setAuditDetails(c, "queued replication to "+strconv.Itoa(len(copies))+" targets")
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "已加入复制队列，上传并校验完成后副本状态将变为 verified",
+		Data:    copies,
+	})
+}
@@ -0,0 +1,108 @@
+package api
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"terraria-panel/models"
+	"terraria-panel/services"
+	"terraria-panel/storage"
+	wshandler "terraria-panel/websocket"
+	"github.com/gin-gonic/gin"
+)
+var chatStorage storage.ChatMessageStorage
+func InitChat(db *sql.DB, pipeline *services.LogPipeline) {
+	chatStorage = storage.NewSQLiteChatMessageStorage(db)
+	wshandler.SetChatAuthorizer(func(userID, roomID int) bool {
+		user, err := userStorage.GetByID(userID)
+		if err != nil || user == nil {
+			return false
+		}
+		return hasRoomPermission(user.ID, user.Role, roomID, models.RoomPermissionView)
+	})
+	pipeline.Subscribe("chat", recordChatMessage)
+}
+func recordChatMessage(event *models.GameEvent) {
+	if event.Type != models.GameEventChat || event.PlayerName == "" {
+		return
+	}
+	message := &models.ChatMessage{
+		RoomID:     event.RoomID,
+		PlayerName: event.PlayerName,
+		Message:    event.Message,
+		CreatedAt:  event.Time,
+	}
+	if err := chatStorage.Create(message); err != nil {
+		log.Printf("[Chat] Failed to save chat message from room %d: %v", event.RoomID, err)
+		return
+	}
+	wshandler.BroadcastChatMessage(message)
+}
+func SearchChatMessages(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if err != nil || pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	filter := models.ChatMessageFilter{
+		PlayerName: strings.TrimSpace(c.Query("player")),
+		Keyword:    strings.TrimSpace(c.Query("keyword")),
+	}
+	if value := c.Query("roomId"); value != "" {
+		roomID, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的房间ID"))
+			return
+		}
+		if !checkRoomPermission(c, roomID, models.RoomPermissionView) {
+			return
+		}
+		filter.RoomID = &roomID
+	} else if roomIDs, all := viewableRoomIDs(c); !all {
+		filter.RoomIDs = roomIDs
+	}
+	if since, ok := parseAuditTime(c.Query("from")); ok {
+		filter.Since = &since
+	}
+	if until, ok := parseAuditTime(c.Query("to")); ok {
+		filter.Until = &until
+	}
+	messages, total, err := chatStorage.Search(filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取聊天记录失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"messages": messages,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}))
+}
+func HandleChatStreamWS(c *gin.Context) {
+	wshandler.HandleChatStream(c)
+}
+func viewableRoomIDs(c *gin.Context) ([]int, bool) {
+	userID, role := c.GetInt("user_id"), c.GetString("role")
+	if models.RoomPermissionLevel(models.DefaultRoomPermission(role)) >= models.RoomPermissionLevel(models.RoomPermissionView) {
+		return nil, true
+	}
+	roomIDs := []int{}
+	if hasRoomPermission(userID, role, services.PluginServerID, models.RoomPermissionView) {
+		roomIDs = append(roomIDs, services.PluginServerID)
+	}
+	rooms, err := roomStorage.GetAll()
+	if err != nil {
+		return roomIDs, false
+	}
+	for _, room := range rooms {
+		if hasRoomPermission(userID, role, room.ID, models.RoomPermissionView) {
+			roomIDs = append(roomIDs, room.ID)
+		}
+	}
+	return roomIDs, false
+}
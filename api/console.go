@@ -0,0 +1,51 @@
+package api
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	wshandler "terraria-panel/websocket"
+	"github.com/gin-gonic/gin"
+)
+var consoleHistoryStorage storage.ConsoleHistoryStorage
+func InitConsoleStorage(db *sql.DB) {
+	consoleHistoryStorage = storage.NewSQLiteConsoleHistoryStorage(db)
+	wshandler.SetConsoleHistoryStorage(consoleHistoryStorage)
+}
+func SendRoomCommand(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的房间ID"))
+		return
+	}
+	var req struct {
+		Command string `json:"command" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	if err := wshandler.SendConsoleCommand(id, c.GetInt("user_id"), c.GetString("username"), req.Command); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("命令发送失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.MessageResponse("命令已发送"))
+}
+func GetConsoleHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的房间ID"))
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	entries, err := consoleHistoryStorage.GetRecent(c.GetInt("user_id"), id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取命令历史失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(entries))
+}
@@ -1,8 +1,13 @@
 package api
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"terraria-panel/config"
 	"terraria-panel/models"
 	"github.com/gin-gonic/gin"
@@ -71,6 +76,8 @@ func WriteFile(c *gin.Context) {
 		return
 	}
 	fullPath := filepath.Join(config.DataDir, req.Path)
+	auditFileTarget(c, req.Path)
+	before := fileAuditState(fullPath)
 	dir := filepath.Dir(fullPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建目录失败"))
@@ -80,6 +87,7 @@ func WriteFile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("写入文件失败: "+err.Error()))
 		return
 	}
+	setAuditChange(c, before, fileAuditState(fullPath))
 	c.JSON(http.StatusOK, models.MessageResponse("文件保存成功"))
 }
 func UploadFile(c *gin.Context) {
@@ -93,6 +101,8 @@ func UploadFile(c *gin.Context) {
 		targetPath = "."
 	}
 	fullPath := filepath.Join(config.DataDir, targetPath, file.Filename)
+	auditFileTarget(c, filepath.Join(targetPath, file.Filename))
+	before := fileAuditState(fullPath)
 	dir := filepath.Dir(fullPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建目录失败"))
@@ -102,6 +112,7 @@ func UploadFile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("保存文件失败: "+err.Error()))
 		return
 	}
+	setAuditChange(c, before, fileAuditState(fullPath))
 	c.JSON(http.StatusOK, models.MessageResponse("文件上传成功"))
 }
 func DeleteFile(c *gin.Context) {
@@ -111,9 +122,38 @@ func DeleteFile(c *gin.Context) {
 		return
 	}
 	fullPath := filepath.Join(config.DataDir, relativePath)
+	auditFileTarget(c, relativePath)
+	setAuditChange(c, fileAuditState(fullPath), nil)
 	if err := os.Remove(fullPath); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除文件失败: "+err.Error()))
 		return
 	}
 	c.JSON(http.StatusOK, models.MessageResponse("文件删除成功"))
 }
+var roomPathPattern = regexp.MustCompile(`^rooms/room-(\d+)(?:/|$)`)
+func auditFileTarget(c *gin.Context, relativePath string) {
+	cleaned := filepath.ToSlash(filepath.Clean(relativePath))
+	setAuditTarget(c, cleaned)
+	if matches := roomPathPattern.FindStringSubmatch(cleaned); len(matches) > 1 {
+		if roomID, err := strconv.Atoi(matches[1]); err == nil {
+			setAuditRoom(c, roomID)
+		}
+	}
+}
+func fileAuditState(fullPath string) gin.H {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return gin.H{"exists": false}
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return gin.H{"exists": true}
+	}
+	return gin.H{
+		"exists": true,
+		"size":   size,
+		"sha256": hex.EncodeToString(hash.Sum(nil)),
+	}
+}
@@ -663,7 +663,7 @@ func checkDotNetVersion() (bool, string, error) {
 func installDotNet8(gameType string) error {
 	fmt.Println("\n========================================")
 	fmt.Println("[.NET 8.0] 开始检测和安装流程")
-	fmt.Println("========================================\n")
+	fmt.Print("========================================\n\n")
 	sendInstallProgress(gameType, "检测 .NET 运行时...", 91)
 	hasNet8, installedVersions, err := checkDotNetVersion()
 	if err != nil {
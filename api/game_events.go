@@ -0,0 +1,30 @@
+package api
+import (
+	"fmt"
+	"terraria-panel/models"
+	"terraria-panel/services"
+	wshandler "terraria-panel/websocket"
+)
+func InitGameEvents(pipeline *services.LogPipeline) {
+	pipeline.Subscribe("activity", recordGameActivity)
+	pipeline.Subscribe("websocket", wshandler.BroadcastGameEvent)
+}
+func recordGameActivity(event *models.GameEvent) {
+	switch event.Type {
+	case models.GameEventJoin:
+		LogPlayerJoin(event.RoomID, gameEventRoomName(event.RoomID), event.PlayerName)
+	case models.GameEventLeave:
+		LogPlayerLeave(event.RoomID, gameEventRoomName(event.RoomID), event.PlayerName)
+	case models.GameEventBoss:
+		LogBossEvent(event.RoomID, gameEventRoomName(event.RoomID), event.Target, event.Action)
+	}
+}
+func gameEventRoomName(roomID int) string {
+	if roomID == services.PluginServerID {
+		return services.PluginServerName
+	}
+	if room, err := roomStorage.GetByID(roomID); err == nil && room != nil {
+		return room.Name
+	}
+	return fmt.Sprintf("房间 %d", roomID)
+}
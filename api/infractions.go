@@ -0,0 +1,463 @@
+package api
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"terraria-panel/models"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+const (
+	infractionSystemUser    = "system"
+	muteExpiryCheckInterval = time.Minute
+)
+type MuteExpiry struct {
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+func NewMuteExpiry() *MuteExpiry {
+	return &MuteExpiry{stopChan: make(chan struct{})}
+}
+func (m *MuteExpiry) Start() {
+	m.wg.Add(1)
+	go m.run()
+}
+func (m *MuteExpiry) Stop() {
+	close(m.stopChan)
+	m.wg.Wait()
+}
+func (m *MuteExpiry) run() {
+	defer m.wg.Done()
+	liftExpiredMutes()
+	ticker := time.NewTicker(muteExpiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			liftExpiredMutes()
+		}
+	}
+}
+func liftExpiredMutes() {
+	if playerInfractionStorage == nil {
+		return
+	}
+	mutes, err := playerInfractionStorage.GetPendingMuteLifts()
+	if err != nil {
+		log.Printf("[Infractions] Failed to load expired mutes: %v", err)
+		return
+	}
+	for _, mute := range mutes {
+		if mute.RoomID != nil && stillInMutedSession(mute) {
+			console, err := getRoomConsole(*mute.RoomID)
+			if err == nil && console.serverType == "tshock" {
+				command := fmt.Sprintf(`unmute "%s"`, sanitizeConsoleArg(mute.PlayerName))
+				if _, err := sendModerationCommand(console, command); err != nil {
+					log.Printf("[Infractions] Failed to lift mute %d for %s: %v", mute.ID, mute.PlayerName, err)
+					continue
+				}
+				log.Printf("[Infractions] Lifted mute %d for %s in room %d", mute.ID, mute.PlayerName, console.roomID)
+			}
+		}
+		if err := playerInfractionStorage.MarkLifted(mute.ID); err != nil {
+			log.Printf("[Infractions] Failed to mark mute %d as lifted: %v", mute.ID, err)
+		}
+	}
+}
+func stillInMutedSession(mute *models.PlayerInfraction) bool {
+	var count int
+	err := moderationDB.QueryRow(`
+		SELECT COUNT(*) FROM player_sessions s
+		JOIN players p ON p.id = s.player_id
+		WHERE p.name = ? AND s.room_id = ? AND s.leave_time IS NULL AND s.join_time <= ?
+	`, mute.PlayerName, *mute.RoomID, mute.CreatedAt).Scan(&count)
+	return err == nil && count > 0
+}
+func recordInfraction(infraction *models.PlayerInfraction) {
+	if playerInfractionStorage == nil {
+		return
+	}
+	if err := playerInfractionStorage.Create(infraction); err != nil {
+		log.Printf("[Infractions] Failed to record %s for %s: %v", infraction.Type, infraction.PlayerName, err)
+	}
+}
+func loadInfractionPolicy() models.InfractionPolicy {
+	policy := models.DefaultInfractionPolicy()
+	if settingStorage == nil {
+		return policy
+	}
+	value, err := settingStorage.Get(models.SettingInfractionPolicy)
+	if err != nil {
+		log.Printf("[Infractions] Failed to load escalation policy: %v", err)
+		return policy
+	}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &policy); err != nil {
+			log.Printf("[Infractions] Invalid escalation policy, using defaults: %v", err)
+			return models.DefaultInfractionPolicy()
+		}
+	}
+	return policy
+}
+func activeWarningCount(name string, policy models.InfractionPolicy) (int, error) {
+	filter := models.PlayerInfractionFilter{
+		PlayerName: name,
+		Type:       models.InfractionWarning,
+		ActiveOnly: true,
+	}
+	if policy.WindowDays > 0 {
+		since := time.Now().AddDate(0, 0, -policy.WindowDays)
+		filter.Since = &since
+	}
+	last, err := playerInfractionStorage.LastEscalation(name)
+	if err != nil {
+		return 0, err
+	}
+	if last != nil && (filter.Since == nil || last.After(*filter.Since)) {
+		filter.Since = last
+	}
+	_, total, err := playerInfractionStorage.Query(filter, 1, 0)
+	return total, err
+}
+func escalateInfractions(name string, warnings int, policy models.InfractionPolicy, userID int, role string) (*models.PlayerInfraction, error) {
+	if !policy.Enabled || policy.WarningThreshold <= 0 || warnings < policy.WarningThreshold {
+		return nil, nil
+	}
+	player, err := getPlayerByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if player == nil {
+		log.Printf("[Infractions] %s reached %d warnings but has no panel player record, skipping escalation", name, warnings)
+		return nil, nil
+	}
+	if existing, err := playerBanStorage.GetActiveByPlayerID(player.ID); err != nil || existing != nil {
+		return nil, err
+	}
+	if roomID, _ := banTargetRoom(player); !hasRoomPermission(userID, role, roomID, models.RoomPermissionOperate) {
+		return nil, fmt.Errorf("没有房间 %d 的 %s 权限，未自动封禁", roomID, models.RoomPermissionOperate)
+	}
+	var expiresAt *time.Time
+	if policy.BanDurationHours > 0 {
+		expiry := time.Now().Add(time.Duration(policy.BanDurationHours) * time.Hour)
+		expiresAt = &expiry
+	}
+	reason := fmt.Sprintf("累计 %d 次警告，自动封禁", warnings)
+	result, err := issuePlayerBan(player, reason, infractionSystemUser, expiresAt, canPropagateNetworkBan(userID, role))
+	if err != nil {
+		return nil, err
+	}
+	infraction := &models.PlayerInfraction{
+		PlayerID:   player.ID,
+		PlayerName: player.Name,
+		Type:       models.InfractionBan,
+		Reason:     reason,
+		RoomID:     &result.ban.RoomID,
+		BanID:      result.ban.ID,
+		Escalated:  true,
+		CreatedBy:  infractionSystemUser,
+		ExpiresAt:  expiresAt,
+	}
+	if err := playerInfractionStorage.Create(infraction); err != nil {
+		return nil, err
+	}
+	log.Printf("[Infractions] Escalated %s to a ban after %d warnings (command: %q)", player.Name, warnings, result.command)
+	return infraction, nil
+}
+func infractionPage(c *gin.Context) (int, int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if err != nil || pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+func queryInfractions(c *gin.Context, filter models.PlayerInfractionFilter) {
+	page, pageSize := infractionPage(c)
+	filter.Type = c.Query("type")
+	filter.CreatedBy = c.Query("createdBy")
+	filter.ActiveOnly = c.Query("active") == "true"
+	if roomID, err := strconv.Atoi(c.Query("roomId")); err == nil {
+		filter.RoomID = &roomID
+	}
+	infractions, total, err := playerInfractionStorage.Query(filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取违规记录失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"infractions": infractions,
+		"total":       total,
+		"page":        page,
+		"pageSize":    pageSize,
+	}))
+}
+func GetInfractions(c *gin.Context) {
+	queryInfractions(c, models.PlayerInfractionFilter{PlayerName: strings.TrimSpace(c.Query("player"))})
+}
+func GetPlayerInfractions(c *gin.Context) {
+	player, ok := loadPlayerParam(c)
+	if !ok {
+		return
+	}
+	queryInfractions(c, models.PlayerInfractionFilter{PlayerName: player.Name})
+}
+func CreatePlayerInfraction(c *gin.Context) {
+	player, ok := loadPlayerParam(c)
+	if !ok {
+		return
+	}
+	createInfraction(c, player)
+}
+func CreateInfraction(c *gin.Context) {
+	createInfraction(c, nil)
+}
+func createInfraction(c *gin.Context, player *models.Player) {
+	var req struct {
+		PlayerName      string `json:"playerName"`
+		Type            string `json:"type" binding:"required"`
+		Reason          string `json:"reason"`
+		EvidenceURL     string `json:"evidenceUrl"`
+		RoomID          *int   `json:"roomId"`
+		DurationMinutes int    `json:"durationMinutes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	name := strings.TrimSpace(req.PlayerName)
+	if player != nil {
+		name = player.Name
+	}
+	switch req.Type {
+	case models.InfractionWarning, models.InfractionNote, models.InfractionMute:
+	case models.InfractionKick, models.InfractionBan:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("踢出和封禁请通过玩家踢出/封禁接口执行，记录会自动写入违规历史"))
+		return
+	default:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的记录类型，可选值: warning, note, mute"))
+		return
+	}
+	reason := sanitizeConsoleArg(req.Reason)
+	if name == "" || (req.Type == models.InfractionNote && reason == "") {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("玩家名和备注内容不能为空"))
+		return
+	}
+	if req.DurationMinutes < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("时长不能为负数"))
+		return
+	}
+	if req.RoomID != nil && !checkRoomPermission(c, *req.RoomID, models.RoomPermissionOperate) {
+		return
+	}
+	if player == nil {
+		var err error
+		if player, err = getPlayerByName(name); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取玩家信息失败: "+err.Error()))
+			return
+		}
+	}
+	if req.RoomID == nil {
+		if player == nil {
+			if c.GetString("role") != "admin" {
+				c.JSON(http.StatusForbidden, models.ErrorResponse("未指定房间时仅管理员可为未知玩家添加记录"))
+				return
+			}
+		} else if roomID, _ := banTargetRoom(player); !checkRoomPermission(c, roomID, models.RoomPermissionOperate) {
+			return
+		}
+	}
+	infraction := &models.PlayerInfraction{
+		PlayerName:  name,
+		Type:        req.Type,
+		Reason:      reason,
+		EvidenceURL: strings.TrimSpace(req.EvidenceURL),
+		RoomID:      req.RoomID,
+		CreatedBy:   c.GetString("username"),
+	}
+	if player != nil {
+		infraction.PlayerID = player.ID
+	}
+	if req.DurationMinutes > 0 {
+		expiry := time.Now().Add(time.Duration(req.DurationMinutes) * time.Minute)
+		infraction.ExpiresAt = &expiry
+	}
+	var command, output string
+	if req.Type == models.InfractionMute && player != nil {
+		if roomID, online := findOnlineRoomID(player); online {
+			if console, err := getRoomConsole(roomID); err == nil && console.serverType == "tshock" {
+				if !checkRoomPermission(c, roomID, models.RoomPermissionOperate) {
+					return
+				}
+				command = strings.TrimSpace(fmt.Sprintf(`mute "%s" %s`, sanitizeConsoleArg(player.Name), reason))
+				if output, err = sendModerationCommand(console, command); err != nil {
+					c.JSON(http.StatusInternalServerError, models.ErrorResponse("发送禁言命令失败: "+err.Error()))
+					return
+				}
+				infraction.RoomID = &console.roomID
+			}
+		}
+	}
+	if err := playerInfractionStorage.Create(infraction); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("保存违规记录失败: "+err.Error()))
+		return
+	}
+	data := gin.H{
+		"infraction": infraction,
+		"command":    command,
+		"output":     output,
+	}
+	if req.Type == models.InfractionWarning {
+		policy := loadInfractionPolicy()
+		warnings, err := activeWarningCount(name, policy)
+		if err != nil {
+			log.Printf("[Infractions] Failed to count warnings for %s: %v", name, err)
+		}
+		LogPlayerWarning(name, reason, warnings)
+		data["warnings"] = warnings
+		escalation, err := escalateInfractions(name, warnings, policy, c.GetInt("user_id"), c.GetString("role"))
+		if err != nil {
+			log.Printf("[Infractions] Escalation for %s failed: %v", name, err)
+			data["escalationError"] = err.Error()
+		}
+		data["escalation"] = escalation
+	}
+	if infraction.RoomID != nil {
+		setAuditRoom(c, *infraction.RoomID)
+	}
+	setAuditTarget(c, name)
+	setAuditChange(c, nil, infraction)
+	c.JSON(http.StatusOK, models.SuccessResponse(data))
+}
+func loadInfraction(c *gin.Context) (*models.PlayerInfraction, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的记录ID"))
+		return nil, false
+	}
+	infraction, err := playerInfractionStorage.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取违规记录失败: "+err.Error()))
+		return nil, false
+	}
+	if infraction == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("违规记录不存在"))
+		return nil, false
+	}
+	if infraction.RoomID != nil && !checkRoomPermission(c, *infraction.RoomID, models.RoomPermissionOperate) {
+		return nil, false
+	}
+	setAuditTarget(c, infraction.PlayerName)
+	if infraction.RoomID != nil {
+		setAuditRoom(c, *infraction.RoomID)
+	}
+	return infraction, true
+}
+func UpdateInfraction(c *gin.Context) {
+	infraction, ok := loadInfraction(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason      *string    `json:"reason"`
+		EvidenceURL *string    `json:"evidenceUrl"`
+		ExpiresAt   *time.Time `json:"expiresAt"`
+		Permanent   bool       `json:"permanent"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	before := *infraction
+	if req.Reason != nil {
+		infraction.Reason = sanitizeConsoleArg(*req.Reason)
+	}
+	if req.EvidenceURL != nil {
+		infraction.EvidenceURL = strings.TrimSpace(*req.EvidenceURL)
+	}
+	if infraction.Type != models.InfractionBan {
+		if req.Permanent {
+			infraction.ExpiresAt = nil
+		} else if req.ExpiresAt != nil {
+			infraction.ExpiresAt = req.ExpiresAt
+		}
+	}
+	if err := playerInfractionStorage.Update(infraction); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("更新违规记录失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, before, infraction)
+	c.JSON(http.StatusOK, models.SuccessResponse(infraction))
+}
+func RevokeInfraction(c *gin.Context) {
+	infraction, ok := loadInfraction(c)
+	if !ok {
+		return
+	}
+	if infraction.Type == models.InfractionBan && infraction.IsActive() {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("生效中的封禁请通过解封接口撤销"))
+		return
+	}
+	if infraction.RevokedAt != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("该记录已被撤销"))
+		return
+	}
+	if err := playerInfractionStorage.Revoke(infraction.ID, c.GetString("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("撤销违规记录失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, infraction, gin.H{"revoked": true})
+	c.JSON(http.StatusOK, models.MessageResponse("违规记录已撤销"))
+}
+func DeleteInfraction(c *gin.Context) {
+	infraction, ok := loadInfraction(c)
+	if !ok {
+		return
+	}
+	if infraction.Type == models.InfractionBan && infraction.IsActive() {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("生效中的封禁请先解封再删除记录"))
+		return
+	}
+	if err := playerInfractionStorage.Delete(infraction.ID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse("违规记录不存在"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除违规记录失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, infraction, nil)
+	c.JSON(http.StatusOK, models.MessageResponse("违规记录已删除"))
+}
+func GetInfractionPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, models.SuccessResponse(loadInfractionPolicy()))
+}
+func UpdateInfractionPolicy(c *gin.Context) {
+	var policy models.InfractionPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误: "+err.Error()))
+		return
+	}
+	if policy.WarningThreshold <= 0 || policy.WindowDays < 0 || policy.BanDurationHours < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("警告阈值必须大于 0，统计窗口和封禁时长不能为负数（0 表示不限/永久）"))
+		return
+	}
+	before := loadInfractionPolicy()
+	data, _ := json.Marshal(policy)
+	if err := settingStorage.Set(models.SettingInfractionPolicy, string(data), c.GetString("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("保存升级策略失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, before, policy)
+	c.JSON(http.StatusOK, models.SuccessResponse(policy))
+}
@@ -0,0 +1,222 @@
+package api
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+const (
+	loginFailureWindow = 15 * time.Minute
+	loginLockoutDecay  = 24 * time.Hour
+	loginAttemptRetain = 30 * 24 * time.Hour
+)
+type loginLockoutRule struct {
+	scope     string
+	threshold int
+}
+var loginLockoutRules = []loginLockoutRule{
+	{scope: models.LockoutScopeAccountIP, threshold: 5},
+	{scope: models.LockoutScopeAccount, threshold: 10},
+	{scope: models.LockoutScopeIP, threshold: 20},
+}
+var loginLockoutDurations = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+var loginAttemptStorage storage.LoginAttemptStorage
+func InitLoginProtection(db *sql.DB) {
+	loginAttemptStorage = storage.NewSQLiteLoginAttemptStorage(db)
+	if removed, err := loginAttemptStorage.DeleteBefore(time.Now().Add(-loginAttemptRetain)); err != nil {
+		log.Printf("[Auth] Failed to clean up old login attempts: %v", err)
+	} else if removed > 0 {
+		log.Printf("[Auth] Removed %d old login attempts", removed)
+	}
+}
+func lockoutSubject(scope, username, ipAddress string) (string, string, string) {
+	switch scope {
+	case models.LockoutScopeAccount:
+		return username, username, ""
+	case models.LockoutScopeIP:
+		return ipAddress, "", ipAddress
+	}
+	return username + "|" + ipAddress, username, ipAddress
+}
+func activeLoginLockout(username, ipAddress string) *models.LoginLockout {
+	if loginAttemptStorage == nil {
+		return nil
+	}
+	var longest *models.LoginLockout
+	for _, rule := range loginLockoutRules {
+		key, _, _ := lockoutSubject(rule.scope, username, ipAddress)
+		lockout, err := loginAttemptStorage.GetLockout(rule.scope, key)
+		if err != nil {
+			log.Printf("[Auth] Failed to read login lockout (%s %s): %v", rule.scope, key, err)
+			continue
+		}
+		if lockout != nil && lockout.IsActive() && (longest == nil || lockout.LockedUntil.After(longest.LockedUntil)) {
+			longest = lockout
+		}
+	}
+	return longest
+}
+func recordLoginFailure(username, ipAddress string) *models.LoginLockout {
+	if loginAttemptStorage == nil {
+		return nil
+	}
+	if err := loginAttemptStorage.RecordFailure(username, ipAddress); err != nil {
+		log.Printf("[Auth] Failed to record login failure for %s from %s: %v", username, ipAddress, err)
+		return nil
+	}
+	now := time.Now()
+	var longest *models.LoginLockout
+	for _, rule := range loginLockoutRules {
+		key, lockUsername, lockIP := lockoutSubject(rule.scope, username, ipAddress)
+		existing, err := loginAttemptStorage.GetLockout(rule.scope, key)
+		if err != nil {
+			log.Printf("[Auth] Failed to read login lockout (%s %s): %v", rule.scope, key, err)
+			continue
+		}
+		since := now.Add(-loginFailureWindow)
+		if existing != nil && existing.LockedUntil.After(since) {
+			since = existing.LockedUntil
+		}
+		count, err := loginAttemptStorage.CountFailures(lockUsername, lockIP, since)
+		if err != nil || count < rule.threshold {
+			continue
+		}
+		lockout := &models.LoginLockout{
+			Scope:     rule.scope,
+			Key:       key,
+			Username:  lockUsername,
+			IPAddress: lockIP,
+			Level:     nextLockoutLevel(existing, now),
+		}
+		if existing != nil {
+			lockout.CreatedAt = existing.CreatedAt
+		}
+		duration := lockoutDuration(lockout.Level)
+		lockout.FailedCount = count
+		lockout.LockedUntil = now.Add(duration)
+		if err := loginAttemptStorage.SaveLockout(lockout); err != nil {
+			log.Printf("[Auth] Failed to save login lockout (%s %s): %v", rule.scope, key, err)
+			continue
+		}
+		lockout.Active = true
+		log.Printf("[Auth] Locked %s %s for %v after %d failed logins (level %d)", rule.scope, key, duration, count, lockout.Level)
+		LogActivity(models.ActivityTypeSystem, "登录已被锁定",
+			fmt.Sprintf("%s 连续 %d 次登录失败，锁定 %s（第 %d 级）", describeLockout(lockout), count, formatDuration(int(duration.Seconds())), lockout.Level),
+			nil, "", models.ColorRed)
+		if longest == nil || lockout.LockedUntil.After(longest.LockedUntil) {
+			longest = lockout
+		}
+	}
+	return longest
+}
+func nextLockoutLevel(existing *models.LoginLockout, now time.Time) int {
+	if existing != nil && now.Sub(existing.LockedUntil) < loginLockoutDecay {
+		return existing.Level + 1
+	}
+	return 1
+}
+func lockoutDuration(level int) time.Duration {
+	if level < 1 {
+		level = 1
+	}
+	if level > len(loginLockoutDurations) {
+		return loginLockoutDurations[len(loginLockoutDurations)-1]
+	}
+	return loginLockoutDurations[level-1]
+}
+func clearLoginFailures(username, ipAddress string) {
+	if loginAttemptStorage == nil {
+		return
+	}
+	if err := loginAttemptStorage.ClearFailures(username, ipAddress); err != nil {
+		log.Printf("[Auth] Failed to clear login failures for %s from %s: %v", username, ipAddress, err)
+	}
+	key, _, _ := lockoutSubject(models.LockoutScopeAccountIP, username, ipAddress)
+	if lockout, err := loginAttemptStorage.GetLockout(models.LockoutScopeAccountIP, key); err == nil && lockout != nil {
+		loginAttemptStorage.DeleteLockout(lockout.ID)
+	}
+}
+func describeLockout(lockout *models.LoginLockout) string {
+	switch lockout.Scope {
+	case models.LockoutScopeAccount:
+		return "账号 " + lockout.Username
+	case models.LockoutScopeIP:
+		return "IP " + lockout.IPAddress
+	}
+	return "账号 " + lockout.Username + "（来自 " + lockout.IPAddress + "）"
+}
+func respondLoginLocked(c *gin.Context, lockout *models.LoginLockout) {
+	remaining := int(time.Until(lockout.LockedUntil).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(remaining))
+	c.JSON(http.StatusTooManyRequests, models.ErrorResponse(fmt.Sprintf("登录失败次数过多，%s已被锁定，请在 %s 后重试",
+		describeLockout(lockout), formatDuration(remaining+59))))
+}
+func GetLoginLockouts(c *gin.Context) {
+	lockouts, err := loginAttemptStorage.GetLockouts(c.Query("all") != "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取登录锁定记录失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(lockouts))
+}
+func DeleteLoginLockout(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的锁定记录ID"))
+		return
+	}
+	lockout, err := loginAttemptStorage.GetLockoutByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取登录锁定记录失败: "+err.Error()))
+		return
+	}
+	if lockout == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("锁定记录不存在"))
+		return
+	}
+	if err := loginAttemptStorage.DeleteLockout(id); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("解除锁定失败: "+err.Error()))
+		return
+	}
+	if err := loginAttemptStorage.ClearFailures(lockout.Username, lockout.IPAddress); err != nil {
+		log.Printf("[Auth] Failed to clear login failures for lockout %d: %v", id, err)
+	}
+	setAuditTarget(c, describeLockout(lockout))
+	setAuditChange(c, lockout, nil)
+	LogActivity(models.ActivityTypeSystem, "登录锁定已解除",
+		fmt.Sprintf("%s 解除了 %s 的登录锁定", c.GetString("username"), describeLockout(lockout)), nil, "", models.ColorGreen)
+	c.JSON(http.StatusOK, models.MessageResponse("已解除锁定"))
+}
+func GetLoginAttempts(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if err != nil || pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	attempts, total, err := loginAttemptStorage.GetRecent(c.Query("username"), c.Query("ip"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取登录失败记录失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"attempts": attempts,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}))
+}
@@ -0,0 +1,65 @@
+package api
+import (
+	"testing"
+	"terraria-panel/models"
+	"time"
+)
+func TestNextLockoutLevel(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		existing *models.LoginLockout
+		want     int
+	}{
+		{"first lockout", nil, 1},
+		{"still locked", &models.LoginLockout{Level: 1, LockedUntil: now.Add(time.Minute)}, 2},
+		{"expired recently", &models.LoginLockout{Level: 2, LockedUntil: now.Add(-time.Hour)}, 3},
+		{"just inside decay", &models.LoginLockout{Level: 4, LockedUntil: now.Add(-loginLockoutDecay + time.Second)}, 5},
+		{"decayed exactly", &models.LoginLockout{Level: 4, LockedUntil: now.Add(-loginLockoutDecay)}, 1},
+		{"decayed long ago", &models.LoginLockout{Level: 6, LockedUntil: now.Add(-7 * 24 * time.Hour)}, 1},
+		{"beyond last level", &models.LoginLockout{Level: 6, LockedUntil: now.Add(-time.Minute)}, 7},
+	}
+	for _, tt := range tests {
+		if got := nextLockoutLevel(tt.existing, now); got != tt.want {
+			t.Errorf("%s: nextLockoutLevel() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		level int
+		want  time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 5 * time.Minute},
+		{3, 15 * time.Minute},
+		{4, time.Hour},
+		{5, 6 * time.Hour},
+		{6, 24 * time.Hour},
+		{7, 24 * time.Hour},
+		{100, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.level); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+func TestLockoutEscalationSequence(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var lockout *models.LoginLockout
+	want := []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour, 24 * time.Hour}
+	for i, duration := range want {
+		level := nextLockoutLevel(lockout, now)
+		if got := lockoutDuration(level); got != duration {
+			t.Fatalf("lockout %d: duration %v, want %v", i+1, got, duration)
+		}
+		lockout = &models.LoginLockout{Level: level, LockedUntil: now.Add(duration)}
+		now = lockout.LockedUntil.Add(time.Minute)
+	}
+	now = lockout.LockedUntil.Add(loginLockoutDecay)
+	if level := nextLockoutLevel(lockout, now); level != 1 {
+		t.Errorf("after decay: level %d, want 1", level)
+	}
+}
@@ -0,0 +1,401 @@
+package api
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"terraria-panel/config"
+	"terraria-panel/models"
+	"terraria-panel/services"
+	"terraria-panel/storage"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+const (
+	networkBanSyncInterval     = time.Minute
+	tshockPermanentBanTicks    = int64(3155378975999999999)
+	networkBanSystemUser       = "system"
+	networkBanDefaultBanningBy = "panel"
+)
+var (
+	networkBanTargetStorage storage.NetworkBanTargetStorage
+	networkBanMu            sync.Mutex
+	networkBanSyncMu        sync.Mutex
+	networkBanInFlight      = make(map[string]bool)
+)
+type tshockInstance struct {
+	roomID   int
+	roomName string
+	dbPath   string
+}
+type NetworkBanSync struct {
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+func NewNetworkBanSync() *NetworkBanSync {
+	return &NetworkBanSync{stopChan: make(chan struct{})}
+}
+func (s *NetworkBanSync) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+func (s *NetworkBanSync) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+func (s *NetworkBanSync) run() {
+	defer s.wg.Done()
+	syncNetworkBans()
+	ticker := time.NewTicker(networkBanSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			syncNetworkBans()
+		}
+	}
+}
+func timeToTicks(t time.Time) int64 {
+	return t.Unix()*10000000 + 621355968000000000
+}
+func tshockInstances() ([]tshockInstance, error) {
+	instances := []tshockInstance{{
+		roomID:   services.PluginServerID,
+		roomName: services.PluginServerName,
+		dbPath:   tshockDBPath(services.PluginServerID),
+	}}
+	rooms, err := roomStorage.GetAll()
+	if err != nil {
+		return instances, err
+	}
+	for _, room := range rooms {
+		if room.ServerType != "tshock" {
+			continue
+		}
+		instances = append(instances, tshockInstance{
+			roomID:   room.ID,
+			roomName: room.Name,
+			dbPath:   tshockDBPath(room.ID),
+		})
+	}
+	return instances, nil
+}
+func tshockDBPath(roomID int) string {
+	if roomID == services.PluginServerID {
+		return getTShockDBPath()
+	}
+	return filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", roomID), "tshock", "tshock.sqlite")
+}
+func canPropagateNetworkBan(userID int, role string) bool {
+	if role == "admin" {
+		return true
+	}
+	instances, err := tshockInstances()
+	if err != nil {
+		return false
+	}
+	for _, instance := range instances {
+		if !hasRoomPermission(userID, role, instance.roomID, models.RoomPermissionOperate) {
+			return false
+		}
+	}
+	return true
+}
+func claimNetworkBanTarget(banID, roomID int) bool {
+	networkBanMu.Lock()
+	defer networkBanMu.Unlock()
+	key := fmt.Sprintf("%d:%d", banID, roomID)
+	if networkBanInFlight[key] {
+		return false
+	}
+	networkBanInFlight[key] = true
+	return true
+}
+func releaseNetworkBanClaim(banID, roomID int) {
+	networkBanMu.Lock()
+	defer networkBanMu.Unlock()
+	delete(networkBanInFlight, fmt.Sprintf("%d:%d", banID, roomID))
+}
+func syncNetworkBans() map[string]int {
+	networkBanSyncMu.Lock()
+	defer networkBanSyncMu.Unlock()
+	summary := map[string]int{"expired": 0, "applied": 0, "failed": 0, "removed": 0}
+	expired, err := playerBanStorage.GetExpired()
+	if err != nil {
+		log.Printf("[NetworkBans] Failed to load expired bans: %v", err)
+	}
+	for _, ban := range expired {
+		if err := playerBanStorage.Lift(ban.ID, networkBanSystemUser); err != nil {
+			log.Printf("[NetworkBans] Failed to lift expired ban %d: %v", ban.ID, err)
+			continue
+		}
+		clearPlayerBanFlag(ban)
+		LogPlayerUnban(ban.PlayerName)
+		summary["expired"]++
+	}
+	instances, err := tshockInstances()
+	if err != nil {
+		log.Printf("[NetworkBans] Failed to list TShock rooms: %v", err)
+	}
+	active, err := playerBanStorage.GetActive()
+	if err != nil {
+		log.Printf("[NetworkBans] Failed to load active bans: %v", err)
+	}
+	for _, ban := range active {
+		if !ban.Network {
+			continue
+		}
+		for _, target := range applyNetworkBan(ban, instances) {
+			summary[target.Status]++
+		}
+	}
+	pending, err := networkBanTargetStorage.GetPendingRemoval()
+	if err != nil {
+		log.Printf("[NetworkBans] Failed to load lifted ban targets: %v", err)
+	}
+	bans := make(map[int]*models.PlayerBan)
+	for _, target := range pending {
+		ban, exists := bans[target.BanID]
+		if !exists {
+			if ban, err = playerBanStorage.GetByID(target.BanID); err != nil || ban == nil {
+				continue
+			}
+			bans[target.BanID] = ban
+		}
+		if releaseNetworkBanTarget(ban, target, instances) {
+			summary["removed"]++
+		}
+	}
+	return summary
+}
+func clearPlayerBanFlag(ban *models.PlayerBan) {
+	if ban.PlayerID == 0 {
+		return
+	}
+	if active, err := playerBanStorage.GetActiveByPlayerID(ban.PlayerID); err == nil && active == nil {
+		moderationDB.Exec("UPDATE players SET is_banned = 0 WHERE id = ?", ban.PlayerID)
+	}
+}
+func recordBanTarget(ban *models.PlayerBan, console *roomConsole) {
+	target := &models.NetworkBanTarget{
+		BanID:   ban.ID,
+		RoomID:  console.roomID,
+		Method:  models.NetworkBanMethodBanList,
+		Tickets: ban.ExternalRef,
+		Status:  models.NetworkBanStatusApplied,
+	}
+	if console.serverType == "tshock" {
+		target.Method = models.NetworkBanMethodConsole
+	}
+	now := time.Now()
+	target.AppliedAt = &now
+	target.Attempts = 1
+	if err := networkBanTargetStorage.Save(target); err != nil {
+		log.Printf("[NetworkBans] Failed to record ban %d on room %d: %v", ban.ID, console.roomID, err)
+	}
+}
+func applyNetworkBan(ban *models.PlayerBan, instances []tshockInstance) []*models.NetworkBanTarget {
+	changed := []*models.NetworkBanTarget{}
+	for _, instance := range instances {
+		if target := applyNetworkBanTarget(ban, instance); target != nil {
+			changed = append(changed, target)
+		}
+	}
+	return changed
+}
+func applyNetworkBanTarget(ban *models.PlayerBan, instance tshockInstance) *models.NetworkBanTarget {
+	if !claimNetworkBanTarget(ban.ID, instance.roomID) {
+		return nil
+	}
+	defer releaseNetworkBanClaim(ban.ID, instance.roomID)
+	target, err := networkBanTargetStorage.Get(ban.ID, instance.roomID)
+	if err != nil {
+		log.Printf("[NetworkBans] Failed to load target for ban %d on %s: %v", ban.ID, instance.roomName, err)
+		return nil
+	}
+	if target != nil && target.Status != models.NetworkBanStatusFailed {
+		return nil
+	}
+	if target == nil {
+		target = &models.NetworkBanTarget{BanID: ban.ID, RoomID: instance.roomID}
+	}
+	console, consoleErr := getRoomConsole(instance.roomID)
+	switch {
+	case consoleErr == nil:
+		target.Method = models.NetworkBanMethodConsole
+		target.Tickets, err = pushConsoleBan(console, ban)
+	case fileExists(instance.dbPath):
+		target.Method = models.NetworkBanMethodDatabase
+		target.Tickets, err = insertTShockBan(instance.dbPath, ban)
+	default:
+		return nil
+	}
+	target.Attempts++
+	if err != nil {
+		target.Status = models.NetworkBanStatusFailed
+		target.Error = err.Error()
+		log.Printf("[NetworkBans] Failed to push ban %d to %s: %v", ban.ID, instance.roomName, err)
+	} else {
+		now := time.Now()
+		target.Status = models.NetworkBanStatusApplied
+		target.Error = ""
+		target.AppliedAt = &now
+	}
+	if err := networkBanTargetStorage.Save(target); err != nil {
+		log.Printf("[NetworkBans] Failed to save target for ban %d on %s: %v", ban.ID, instance.roomName, err)
+	}
+	target.RoomName = instance.roomName
+	return target
+}
+func pushConsoleBan(console *roomConsole, ban *models.PlayerBan) (string, error) {
+	var duration time.Duration
+	if ban.ExpiresAt != nil {
+		duration = time.Until(*ban.ExpiresAt).Round(time.Second)
+		if duration <= 0 {
+			return "", fmt.Errorf("封禁已过期")
+		}
+	}
+	command := buildBanCommand("tshock", sanitizeConsoleArg(ban.PlayerName), sanitizeConsoleArg(ban.Reason), false, duration)
+	output, err := sendModerationCommand(console, command)
+	if err != nil {
+		return "", err
+	}
+	if matches := tshockTicketPattern.FindStringSubmatch(output); len(matches) > 1 {
+		return matches[1], nil
+	}
+	return "", nil
+}
+func insertTShockBan(dbPath string, ban *models.PlayerBan) (string, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	expiration := tshockPermanentBanTicks
+	if ban.ExpiresAt != nil {
+		expiration = timeToTicks(*ban.ExpiresAt)
+	}
+	bannedBy := ban.BannedBy
+	if bannedBy == "" {
+		bannedBy = networkBanDefaultBanningBy
+	}
+	result, err := db.Exec("INSERT INTO PlayerBans (Identifier, Reason, BanningUser, Date, Expiration) VALUES (?, ?, ?, ?, ?)",
+		"name:"+ban.PlayerName, ban.Reason, bannedBy, timeToTicks(ban.CreatedAt), expiration)
+	if err != nil {
+		return "", err
+	}
+	ticket, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d", ticket), nil
+}
+func releaseNetworkBan(ban *models.PlayerBan) []*models.NetworkBanTarget {
+	targets, err := networkBanTargetStorage.GetByBanID(ban.ID)
+	if err != nil {
+		log.Printf("[NetworkBans] Failed to load targets for ban %d: %v", ban.ID, err)
+		return nil
+	}
+	instances, _ := tshockInstances()
+	released := []*models.NetworkBanTarget{}
+	for _, target := range targets {
+		if target.Status == models.NetworkBanStatusApplied {
+			releaseNetworkBanTarget(ban, target, instances)
+			released = append(released, target)
+		}
+	}
+	return released
+}
+func releaseNetworkBanTarget(ban *models.PlayerBan, target *models.NetworkBanTarget, instances []tshockInstance) bool {
+	if !claimNetworkBanTarget(ban.ID, target.RoomID) {
+		return false
+	}
+	defer releaseNetworkBanClaim(ban.ID, target.RoomID)
+	current, err := networkBanTargetStorage.Get(ban.ID, target.RoomID)
+	if err != nil || current == nil || current.Status != models.NetworkBanStatusApplied {
+		return false
+	}
+	*target = *current
+	if target.Method == models.NetworkBanMethodBanList {
+		err = removeFromBanList(target.RoomID, ban.PlayerName)
+	} else if console, consoleErr := getRoomConsole(target.RoomID); consoleErr == nil {
+		err = removeConsoleBan(console, target.Tickets)
+	} else {
+		for _, instance := range instances {
+			if instance.roomID == target.RoomID && fileExists(instance.dbPath) {
+				err = expireTShockBan(instance.dbPath, ban.PlayerName, target.Tickets)
+			}
+		}
+	}
+	if err != nil {
+		target.Error = err.Error()
+		log.Printf("[NetworkBans] Failed to remove ban %d from room %d: %v", ban.ID, target.RoomID, err)
+	} else {
+		now := time.Now()
+		target.Status = models.NetworkBanStatusRemoved
+		target.Error = ""
+		target.RemovedAt = &now
+	}
+	if err := networkBanTargetStorage.Save(target); err != nil {
+		log.Printf("[NetworkBans] Failed to save target for ban %d on room %d: %v", ban.ID, target.RoomID, err)
+	}
+	return err == nil
+}
+func removeConsoleBan(console *roomConsole, tickets string) error {
+	if tickets == "" {
+		return fmt.Errorf("缺少 TShock 封禁编号，无法在线解除")
+	}
+	for _, ticket := range strings.Split(tickets, ",") {
+		if _, err := sendModerationCommand(console, "ban del "+strings.TrimSpace(ticket)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func expireTShockBan(dbPath, playerName, tickets string) error {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	now := timeToTicks(time.Now())
+	if tickets == "" {
+		_, err = db.Exec("UPDATE PlayerBans SET Expiration = ? WHERE Identifier = ? AND Expiration > ?", now, "name:"+playerName, now)
+		return err
+	}
+	for _, ticket := range strings.Split(tickets, ",") {
+		if _, err := db.Exec("UPDATE PlayerBans SET Expiration = ? WHERE TicketNumber = ?", now, strings.TrimSpace(ticket)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func GetNetworkBans(c *gin.Context) {
+	bans, err := playerBanStorage.GetActive()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取封禁列表失败: "+err.Error()))
+		return
+	}
+	names := playerProfileRoomNames()
+	result := make([]*models.NetworkBan, 0, len(bans))
+	for _, ban := range bans {
+		targets, err := networkBanTargetStorage.GetByBanID(ban.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取封禁同步状态失败: "+err.Error()))
+			return
+		}
+		for _, target := range targets {
+			target.RoomName = names[target.RoomID]
+		}
+		result = append(result, &models.NetworkBan{PlayerBan: ban, Active: ban.IsActive(), Targets: targets})
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(result))
+}
+func SyncNetworkBans(c *gin.Context) {
+	c.JSON(http.StatusOK, models.SuccessResponse(syncNetworkBans()))
+}
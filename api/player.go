@@ -1,98 +1,227 @@
 package api
 import (
+	"database/sql"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"terraria-panel/config"
 	"terraria-panel/models"
+	"terraria-panel/services"
+	"terraria-panel/storage"
 	"terraria-panel/utils"
+	"time"
 	"github.com/gin-gonic/gin"
 )
+var (
+	moderationDB            *sql.DB
+	playerBanStorage        storage.PlayerBanStorage
+	playerInfractionStorage storage.PlayerInfractionStorage
+)
+var tshockTicketPattern = regexp.MustCompile(`(?i)ticket\s*(?:number)?\s*#?\s*(\d+)`)
+const consoleResponseTimeout = 3 * time.Second
 type BannedPlayer struct {
 	ID     int    `json:"id"`
 	Name   string `json:"name"`
 	IP     string `json:"ip"`
 	Reason string `json:"reason"`
 }
-func GetPlayers(c *gin.Context) {
-	players := parseOnlinePlayersFromLogs()
-	c.JSON(http.StatusOK, models.SuccessResponse(players))
+type playerBanResult struct {
+	ban     *models.PlayerBan
+	command string
+	output  string
+	network []*models.NetworkBanTarget
 }
-func parseOnlinePlayersFromLogs() []models.Player {
-	players := []models.Player{}
-	playerID := 1
-	rooms, err := roomStorage.GetAll()
-	if err != nil {
-		return players
+type roomConsole struct {
+	roomID     int
+	roomName   string
+	serverType string
+	process    *utils.Process
+}
+func InitModerationStorage(database *sql.DB) {
+	moderationDB = database
+	playerBanStorage = storage.NewSQLitePlayerBanStorage(database)
+	playerInfractionStorage = storage.NewSQLitePlayerInfractionStorage(database)
+	networkBanTargetStorage = storage.NewSQLiteNetworkBanTargetStorage(database)
+	importLegacyBans()
+}
+func importLegacyBans() {
+	banFile := filepath.Join(config.DataDir, "banned.json")
+	if _, err := os.Stat(banFile); err != nil {
+		return
 	}
-	for _, room := range rooms {
-		if room.Status != "running" {
+	var bannedList []BannedPlayer
+	if err := utils.ReadJSON(banFile, &bannedList); err != nil {
+		log.Printf("[WARN] 读取旧封禁列表失败: %v", err)
+		return
+	}
+	imported := 0
+	for _, banned := range bannedList {
+		if banned.Name == "" {
 			continue
 		}
-		logFile := filepath.Join(config.DataDir, "logs", "room-"+strconv.Itoa(room.ID)+".log")
-		content, err := os.ReadFile(logFile)
-		if err != nil {
+		if existing, err := playerBanStorage.GetActiveByName(banned.Name); err != nil || existing != nil {
 			continue
 		}
-		lines := string(content)
-		playerMap := make(map[string]bool)
-		for _, line := range splitLines(lines) {
-			if contains(line, "has joined") {
-				playerName := extractPlayerName(line, "has joined")
-				if playerName != "" {
-					playerMap[playerName] = true
-				}
-			} else if contains(line, "has left") || contains(line, "disconnected") {
-				playerName := extractPlayerName(line, "has left")
-				if playerName != "" {
-					playerMap[playerName] = false
-				}
-			}
+		ban := &models.PlayerBan{
+			PlayerName: banned.Name,
+			IP:         banned.IP,
+			Reason:     banned.Reason,
+			BannedBy:   "banned.json",
 		}
-		for name, isOnline := range playerMap {
-			if isOnline {
-				players = append(players, models.Player{
-					ID:       playerID,
-					Name:     name,
-					IP:       "未知",
-					RoomID:   room.ID,
-					RoomName: room.Name,
-					Status:   "在线",
-					IsBanned: false,
-				})
-				playerID++
-			}
+		moderationDB.QueryRow("SELECT id FROM players WHERE name = ?", banned.Name).Scan(&ban.PlayerID)
+		if err := playerBanStorage.Create(ban); err != nil {
+			log.Printf("[WARN] 导入旧封禁记录失败 (%s): %v", banned.Name, err)
+			continue
 		}
+		imported++
+	}
+	if err := os.Rename(banFile, banFile+".migrated"); err != nil {
+		log.Printf("[WARN] 重命名旧封禁列表失败: %v", err)
 	}
-	return players
+	log.Printf("[INFO] 已从 banned.json 导入 %d 条封禁记录", imported)
 }
-func splitLines(s string) []string {
-	return strings.Split(s, "\n")
+func GetPlayers(c *gin.Context) {
+	query := `
+		SELECT p.id, p.name, COALESCE(p.ip, ''), p.room_id, COALESCE(r.name, ''), p.status,
+		       p.team, p.is_banned, p.last_seen, p.created_at
+		FROM players p
+		LEFT JOIN rooms r ON p.room_id = r.id
+		WHERE p.status = 'online'
+		ORDER BY p.last_seen DESC
+	`
+	rows, err := moderationDB.Query(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取玩家列表失败: "+err.Error()))
+		return
+	}
+	defer rows.Close()
+	players := []models.Player{}
+	for rows.Next() {
+		var player models.Player
+		if err := rows.Scan(&player.ID, &player.Name, &player.IP, &player.RoomID, &player.RoomName, &player.Status,
+			&player.Team, &player.IsBanned, &player.LastSeen, &player.CreatedAt); err != nil {
+			continue
+		}
+		if player.RoomID == services.PluginServerID {
+			player.RoomName = services.PluginServerName
+		}
+		players = append(players, player)
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(players))
 }
-func contains(s, substr string) bool {
-	return strings.Contains(s, substr)
+func getPlayerByID(id int) (*models.Player, error) {
+	query := `
+		SELECT id, name, COALESCE(ip, ''), room_id, status, team, is_banned, last_seen, created_at
+		FROM players
+		WHERE id = ?
+	`
+	var player models.Player
+	err := moderationDB.QueryRow(query, id).Scan(&player.ID, &player.Name, &player.IP, &player.RoomID,
+		&player.Status, &player.Team, &player.IsBanned, &player.LastSeen, &player.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &player, nil
 }
-func extractPlayerName(line, keyword string) string {
-	idx := strings.Index(line, keyword)
-	if idx == -1 {
-		return ""
+func loadPlayerParam(c *gin.Context) (*models.Player, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的玩家ID"))
+		return nil, false
 	}
-	colonIdx := strings.Index(line, ":")
-	if colonIdx == -1 {
-		return ""
+	player, err := getPlayerByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取玩家信息失败: "+err.Error()))
+		return nil, false
 	}
-	nameStart := colonIdx + 1
-	nameEnd := idx
-	if nameStart >= nameEnd {
-		return ""
+	if player == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("玩家不存在"))
+		return nil, false
 	}
-	name := strings.TrimSpace(line[nameStart:nameEnd])
-	if parenIdx := strings.Index(name, "("); parenIdx != -1 {
-		name = strings.TrimSpace(name[:parenIdx])
+	return player, true
+}
+func findOnlineRoomID(player *models.Player) (int, bool) {
+	if player.Status == "online" {
+		return player.RoomID, true
+	}
+	var roomID int
+	err := moderationDB.QueryRow(`
+		SELECT room_id FROM player_sessions
+		WHERE player_id = ? AND leave_time IS NULL
+		ORDER BY join_time DESC LIMIT 1
+	`, player.ID).Scan(&roomID)
+	if err != nil {
+		return 0, false
 	}
-	return name
+	return roomID, true
+}
+func getRoomConsole(roomID int) (*roomConsole, error) {
+	console := &roomConsole{roomID: roomID}
+	if roomID == services.PluginServerID {
+		console.roomName = services.PluginServerName
+		console.serverType = "tshock"
+	} else {
+		room, err := roomStorage.GetByID(roomID)
+		if err != nil {
+			return nil, fmt.Errorf("读取房间失败: %v", err)
+		}
+		if room == nil {
+			return nil, fmt.Errorf("房间 %d 不存在", roomID)
+		}
+		console.roomName = room.Name
+		console.serverType = room.ServerType
+	}
+	p, exists := utils.GetProcess(roomID)
+	if !exists || !p.IsRunning() {
+		return nil, fmt.Errorf("房间 \"%s\" 未运行", console.roomName)
+	}
+	console.process = p
+	return console, nil
+}
+func sanitizeConsoleArg(value string) string {
+	value = strings.NewReplacer("\r", " ", "\n", " ", "\"", "").Replace(value)
+	return strings.TrimSpace(value)
+}
+func buildKickCommand(serverType, name, reason string) string {
+	if serverType == "tshock" {
+		if reason == "" {
+			return fmt.Sprintf(`kick "%s"`, name)
+		}
+		return fmt.Sprintf(`kick "%s" %s`, name, reason)
+	}
+	return "kick " + name
+}
+func buildBanCommand(serverType, name, reason string, online bool, duration time.Duration) string {
+	if serverType == "tshock" {
+		target := name
+		if !online {
+			target = "n:" + name
+		}
+		if duration > 0 {
+			return fmt.Sprintf(`ban add "%s" "%s" "%ds"`, target, reason, int(duration.Seconds()))
+		}
+		if reason == "" {
+			return fmt.Sprintf(`ban add "%s"`, target)
+		}
+		return fmt.Sprintf(`ban add "%s" "%s"`, target, reason)
+	}
+	return "ban " + name
+}
+func sendModerationCommand(console *roomConsole, command string) (string, error) {
+	output, err := console.process.SendCommandWithOutput(command, consoleResponseTimeout)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("[INFO] 房间 %d 执行管理命令: %s", console.roomID, command)
+	return strings.TrimSpace(output), nil
 }
 func KickPlayer(c *gin.Context) {
 	idStr := c.Param("id")
@@ -101,30 +230,63 @@ func KickPlayer(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的玩家ID"))
 		return
 	}
-	var players []models.Player
-	if err := utils.ReadJSON(config.PlayersFile, &players); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取玩家列表失败"))
-		return
+	var req struct {
+		Reason      string `json:"reason"`
+		EvidenceURL string `json:"evidenceUrl"`
 	}
-	var playerName string
-	for _, p := range players {
-		if p.ID == id {
-			playerName = p.Name
-			break
-		}
+	c.ShouldBindJSON(&req)
+	player, err := getPlayerByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取玩家失败: "+err.Error()))
+		return
 	}
-	if playerName == "" {
+	if player == nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse("玩家不存在"))
 		return
 	}
-	commandFile := filepath.Join(config.DataDir, "commands.txt")
-	command := "kick " + playerName + "\n"
-	f, err := os.OpenFile(commandFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err == nil {
-		f.WriteString(command)
-		f.Close()
+	roomID, online := findOnlineRoomID(player)
+	if !online {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("玩家 "+player.Name+" 当前不在线"))
+		return
+	}
+	if !checkRoomPermission(c, roomID, models.RoomPermissionOperate) {
+		return
+	}
+	console, err := getRoomConsole(roomID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		return
+	}
+	reason := sanitizeConsoleArg(req.Reason)
+	command := buildKickCommand(console.serverType, sanitizeConsoleArg(player.Name), reason)
+	output, err := sendModerationCommand(console, command)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("发送踢出命令失败: "+err.Error()))
+		return
 	}
-	c.JSON(http.StatusOK, models.MessageResponse("已发送踢出命令: "+playerName))
+	LogPlayerKick(console.roomID, console.roomName, player.Name, reason)
+	recordInfraction(&models.PlayerInfraction{
+		PlayerID:    player.ID,
+		PlayerName:  player.Name,
+		Type:        models.InfractionKick,
+		Reason:      reason,
+		EvidenceURL: strings.TrimSpace(req.EvidenceURL),
+		RoomID:      &console.roomID,
+		CreatedBy:   c.GetString("username"),
+	})
+	setAuditRoom(c, console.roomID)
+	setAuditTarget(c, player.Name)
+	setAuditDetails(c, reason)
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "已踢出玩家: " + player.Name,
+		Data: gin.H{
+			"roomId":   console.roomID,
+			"roomName": console.roomName,
+			"command":  command,
+			"output":   output,
+		},
+	})
 }
 func BanPlayer(c *gin.Context) {
 	idStr := c.Param("id")
@@ -134,65 +296,151 @@ func BanPlayer(c *gin.Context) {
 		return
 	}
 	var req struct {
-		Reason string `json:"reason"`
+		Reason          string `json:"reason"`
+		EvidenceURL     string `json:"evidenceUrl"`
+		DurationMinutes int    `json:"durationMinutes"`
 	}
 	c.ShouldBindJSON(&req)
-	var players []models.Player
-	if err := utils.ReadJSON(config.PlayersFile, &players); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取玩家列表失败"))
+	if req.DurationMinutes < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("封禁时长不能为负数"))
 		return
 	}
-	var targetPlayer *models.Player
-	for i := range players {
-		if players[i].ID == id {
-			targetPlayer = &players[i]
-			players[i].IsBanned = true
-			break
-		}
+	player, err := getPlayerByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取玩家失败: "+err.Error()))
+		return
 	}
-	if targetPlayer == nil {
+	if player == nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse("玩家不存在"))
 		return
 	}
-	if err := utils.WriteJSON(config.PlayersFile, players); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("保存失败"))
+	if existing, err := playerBanStorage.GetActiveByPlayerID(player.ID); err == nil && existing != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("玩家 "+player.Name+" 已被封禁"))
 		return
 	}
-	banFile := filepath.Join(config.DataDir, "banned.json")
-	var bannedList []BannedPlayer
-	utils.ReadJSON(banFile, &bannedList)
-	exists := false
-	for _, banned := range bannedList {
-		if banned.ID == id {
-			exists = true
-			break
+	roomID, _ := banTargetRoom(player)
+	if !checkRoomPermission(c, roomID, models.RoomPermissionOperate) {
+		return
+	}
+	var expiresAt *time.Time
+	if req.DurationMinutes > 0 {
+		expiry := time.Now().Add(time.Duration(req.DurationMinutes) * time.Minute)
+		expiresAt = &expiry
+	}
+	reason := sanitizeConsoleArg(req.Reason)
+	result, err := issuePlayerBan(player, reason, c.GetString("username"), expiresAt, canPropagateNetworkBan(c.GetInt("user_id"), c.GetString("role")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(err.Error()))
+		return
+	}
+	ban := result.ban
+	recordInfraction(&models.PlayerInfraction{
+		PlayerID:    player.ID,
+		PlayerName:  player.Name,
+		Type:        models.InfractionBan,
+		Reason:      reason,
+		EvidenceURL: strings.TrimSpace(req.EvidenceURL),
+		RoomID:      &ban.RoomID,
+		BanID:       ban.ID,
+		CreatedBy:   ban.BannedBy,
+		ExpiresAt:   ban.ExpiresAt,
+	})
+	setAuditRoom(c, ban.RoomID)
+	setAuditTarget(c, player.Name)
+	setAuditChange(c, gin.H{"isBanned": player.IsBanned}, ban)
+	message := "玩家 " + player.Name + " 已封禁"
+	synced := 0
+	for _, target := range result.network {
+		if target.Status == models.NetworkBanStatusApplied {
+			synced++
 		}
 	}
-	if !exists {
-		bannedList = append(bannedList, BannedPlayer{
-			ID:     targetPlayer.ID,
-			Name:   targetPlayer.Name,
-			IP:     targetPlayer.IP,
-			Reason: req.Reason,
-		})
-		utils.WriteJSON(banFile, bannedList)
+	switch {
+	case synced > 0:
+		message += fmt.Sprintf("，已同步到 %d 个 TShock 实例", synced)
+	case result.command == "":
+		message += "（没有可用的运行中房间，封禁仅记录在面板中）"
 	}
-	commandFile := filepath.Join(config.DataDir, "commands.txt")
-	command := "ban " + targetPlayer.Name + " " + req.Reason + "\n"
-	f, err := os.OpenFile(commandFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err == nil {
-		f.WriteString(command)
-		f.Close()
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: message,
+		Data: gin.H{
+			"ban":     ban,
+			"roomId":  ban.RoomID,
+			"command": result.command,
+			"output":  result.output,
+			"network": result.network,
+		},
+	})
+}
+func banTargetRoom(player *models.Player) (int, bool) {
+	roomID, online := findOnlineRoomID(player)
+	if !online {
+		roomID = player.RoomID
 	}
-	c.JSON(http.StatusOK, models.MessageResponse("玩家 "+targetPlayer.Name+" 已封禁"))
+	return roomID, online
+}
+func issuePlayerBan(player *models.Player, reason, bannedBy string, expiresAt *time.Time, network bool) (*playerBanResult, error) {
+	result := &playerBanResult{
+		ban: &models.PlayerBan{
+			PlayerID:   player.ID,
+			PlayerName: player.Name,
+			IP:         player.IP,
+			Reason:     reason,
+			RoomID:     player.RoomID,
+			BannedBy:   bannedBy,
+			Network:    network,
+			ExpiresAt:  expiresAt,
+		},
+	}
+	ban := result.ban
+	roomID, online := banTargetRoom(player)
+	console, consoleErr := getRoomConsole(roomID)
+	if consoleErr == nil && (online || console.serverType == "tshock") {
+		var duration time.Duration
+		if expiresAt != nil {
+			duration = time.Until(*expiresAt).Round(time.Second)
+		}
+		ban.RoomID = console.roomID
+		result.command = buildBanCommand(console.serverType, sanitizeConsoleArg(player.Name), reason, online, duration)
+		output, err := sendModerationCommand(console, result.command)
+		if err != nil {
+			return nil, fmt.Errorf("发送封禁命令失败: %v", err)
+		}
+		result.output = output
+		if console.serverType == "tshock" {
+			if matches := tshockTicketPattern.FindStringSubmatch(output); len(matches) > 1 {
+				ban.ExternalRef = matches[1]
+			}
+		}
+	}
+	networkBanMu.Lock()
+	if err := playerBanStorage.Create(ban); err != nil {
+		networkBanMu.Unlock()
+		return nil, fmt.Errorf("保存封禁记录失败: %v", err)
+	}
+	if result.command != "" {
+		recordBanTarget(ban, console)
+	}
+	networkBanMu.Unlock()
+	moderationDB.Exec("UPDATE players SET is_banned = 1 WHERE id = ?", player.ID)
+	if network {
+		instances, err := tshockInstances()
+		if err != nil {
+			log.Printf("[NetworkBans] Failed to list TShock rooms: %v", err)
+		}
+		result.network = applyNetworkBan(ban, instances)
+	}
+	LogPlayerBan(player.Name, reason)
+	return result, nil
 }
 func GetBannedPlayers(c *gin.Context) {
-	banFile := filepath.Join(config.DataDir, "banned.json")
-	var bannedList []BannedPlayer
-	if err := utils.ReadJSON(banFile, &bannedList); err != nil {
-		bannedList = []BannedPlayer{}
+	bans, err := playerBanStorage.GetActive()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取封禁列表失败: "+err.Error()))
+		return
 	}
-	c.JSON(http.StatusOK, models.SuccessResponse(bannedList))
+	c.JSON(http.StatusOK, models.SuccessResponse(bans))
 }
 func UnbanPlayer(c *gin.Context) {
 	idStr := c.Param("id")
@@ -201,37 +449,105 @@ func UnbanPlayer(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的玩家ID"))
 		return
 	}
-	var players []models.Player
-	if err := utils.ReadJSON(config.PlayersFile, &players); err == nil {
-		for i := range players {
-			if players[i].ID == id {
-				players[i].IsBanned = false
-				break
-			}
+	ban, err := playerBanStorage.GetActiveByPlayerID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取封禁记录失败: "+err.Error()))
+		return
+	}
+	if ban == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("该玩家没有生效中的封禁"))
+		return
+	}
+	if !checkRoomPermission(c, ban.RoomID, models.RoomPermissionOperate) {
+		return
+	}
+	targets, err := networkBanTargetStorage.GetByBanID(ban.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取封禁同步状态失败: "+err.Error()))
+		return
+	}
+	var command, output string
+	if len(targets) == 0 {
+		if command, output, err = liftLocalBan(ban); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("解除服务器封禁失败: "+err.Error()))
+			return
 		}
-		utils.WriteJSON(config.PlayersFile, players)
 	}
-	banFile := filepath.Join(config.DataDir, "banned.json")
-	var bannedList []BannedPlayer
-	utils.ReadJSON(banFile, &bannedList)
-	newList := []BannedPlayer{}
-	var playerName string
-	for _, banned := range bannedList {
-		if banned.ID != id {
-			newList = append(newList, banned)
-		} else {
-			playerName = banned.Name
+	if err := playerBanStorage.Lift(ban.ID, c.GetString("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("解除封禁失败: "+err.Error()))
+		return
+	}
+	released := releaseNetworkBan(ban)
+	moderationDB.Exec("UPDATE players SET is_banned = 0 WHERE id = ?", id)
+	if err := playerInfractionStorage.RevokeByBanID(ban.ID, c.GetString("username")); err != nil {
+		log.Printf("[Infractions] Failed to revoke ban infraction for ban %d: %v", ban.ID, err)
+	}
+	LogPlayerUnban(ban.PlayerName)
+	setAuditRoom(c, ban.RoomID)
+	setAuditTarget(c, ban.PlayerName)
+	setAuditChange(c, ban, gin.H{"isBanned": false})
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "玩家已解封",
+		Data: gin.H{
+			"roomId":  ban.RoomID,
+			"command": command,
+			"output":  output,
+			"network": released,
+		},
+	})
+}
+func liftLocalBan(ban *models.PlayerBan) (string, string, error) {
+	serverType := "tshock"
+	if ban.RoomID != services.PluginServerID {
+		room, err := roomStorage.GetByID(ban.RoomID)
+		if err != nil {
+			return "", "", err
+		}
+		if room == nil {
+			return "", "", nil
+		}
+		serverType = room.ServerType
+	}
+	if serverType != "tshock" {
+		return "", "", removeFromBanList(ban.RoomID, ban.PlayerName)
+	}
+	console, err := getRoomConsole(ban.RoomID)
+	if err != nil {
+		dbPath := tshockDBPath(ban.RoomID)
+		if !fileExists(dbPath) {
+			return "", "", nil
 		}
+		return "", "", expireTShockBan(dbPath, ban.PlayerName, ban.ExternalRef)
+	}
+	if ban.ExternalRef == "" {
+		return "", "", nil
+	}
+	command := "ban del " + ban.ExternalRef
+	output, err := sendModerationCommand(console, command)
+	return command, output, err
+}
+func removeFromBanList(roomID int, playerName string) error {
+	room, err := roomStorage.GetByID(roomID)
+	if err != nil || room == nil {
+		return err
 	}
-	utils.WriteJSON(banFile, newList)
-	if playerName != "" {
-		commandFile := filepath.Join(config.DataDir, "commands.txt")
-		command := "unban " + playerName + "\n"
-		f, err := os.OpenFile(commandFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err == nil {
-			f.WriteString(command)
-			f.Close()
+	banListPath := filepath.Join(roomWorkDir(room), "banlist.txt")
+	data, err := os.ReadFile(banListPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	kept := []string{}
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "//"+playerName {
+			i++
+			continue
 		}
+		kept = append(kept, lines[i])
 	}
-	c.JSON(http.StatusOK, models.MessageResponse("玩家已解封"))
+	return os.WriteFile(banListPath, []byte(strings.Join(kept, "\n")), 0644)
 }
@@ -0,0 +1,445 @@
+package api
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"terraria-panel/models"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+const (
+	playerLinkDefaultDepth = 2
+	playerLinkMaxDepth     = 3
+	playerLinkMaxNodes     = 100
+	playerLinkSourcePanel  = "panel"
+	playerLinkSourceTShock = "tshock"
+)
+var tshockTimeLayouts = []string{"2006-01-02T15:04:05", time.RFC3339, "2006-01-02 15:04:05"}
+type identityWindow struct {
+	kind    string
+	value   string
+	first   time.Time
+	last    time.Time
+	sources map[string]bool
+}
+type identityIndex struct {
+	byName        map[string]map[string]*identityWindow
+	byValue       map[string]map[string]bool
+	playerIDs     map[string]int
+	banned        map[string]bool
+	loadedNames   map[string]bool
+	loadedIPs     map[string]bool
+	loadedPlayers map[string]bool
+}
+func newIdentityIndex() *identityIndex {
+	index := &identityIndex{
+		byName:        make(map[string]map[string]*identityWindow),
+		byValue:       make(map[string]map[string]bool),
+		playerIDs:     make(map[string]int),
+		banned:        make(map[string]bool),
+		loadedNames:   make(map[string]bool),
+		loadedIPs:     make(map[string]bool),
+		loadedPlayers: make(map[string]bool),
+	}
+	index.loadTShockUsers()
+	return index
+}
+func (x *identityIndex) add(name, kind, value, source string, first, last time.Time) {
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if name == "" || value == "" {
+		return
+	}
+	key := kind + ":" + value
+	if x.byName[name] == nil {
+		x.byName[name] = make(map[string]*identityWindow)
+	}
+	window := x.byName[name][key]
+	if window == nil {
+		window = &identityWindow{kind: kind, value: value, sources: make(map[string]bool)}
+		x.byName[name][key] = window
+	}
+	window.sources[source] = true
+	if !first.IsZero() && (window.first.IsZero() || first.Before(window.first)) {
+		window.first = first
+	}
+	if last.After(window.last) {
+		window.last = last
+	}
+	if x.byValue[key] == nil {
+		x.byValue[key] = make(map[string]bool)
+	}
+	x.byValue[key][name] = true
+}
+func (x *identityIndex) loadTShockUsers() {
+	dbPath := getTShockDBPath()
+	if !fileExists(dbPath) {
+		return
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT Username, COALESCE(UUID, ''), COALESCE(KnownIPs, ''), COALESCE(Registered, ''), COALESCE(LastAccessed, '') FROM Users")
+	if err != nil {
+		log.Printf("[PlayerLinks] Failed to read TShock users: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var username, uuid, knownIPs, registered, lastAccessed string
+		if err := rows.Scan(&username, &uuid, &knownIPs, &registered, &lastAccessed); err != nil {
+			continue
+		}
+		first, last := parseTShockTime(registered), parseTShockTime(lastAccessed)
+		x.add(username, models.PlayerLinkUUID, uuid, playerLinkSourceTShock, first, last)
+		for _, ip := range parseKnownIPs(knownIPs) {
+			x.add(username, models.PlayerLinkIP, ip, playerLinkSourceTShock, first, last)
+		}
+	}
+}
+func (x *identityIndex) ensureNames(names []string) error {
+	pending := pendingKeys(names, x.loadedNames)
+	if len(pending) == 0 {
+		return nil
+	}
+	return x.loadPanelSightings("p.name", "name", pending)
+}
+func (x *identityIndex) ensureIPs(ips []string) error {
+	pending := pendingKeys(ips, x.loadedIPs)
+	if len(pending) == 0 {
+		return nil
+	}
+	return x.loadPanelSightings("s.ip_address", "ip", pending)
+}
+func (x *identityIndex) loadPanelSightings(sessionColumn, playerColumn string, values []string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	rows, err := moderationDB.Query(`
+		SELECT p.id, p.name, p.is_banned, s.ip_address, s.join_time, s.leave_time
+		FROM player_sessions s
+		JOIN players p ON p.id = s.player_id
+		WHERE s.ip_address IS NOT NULL AND s.ip_address != '' AND `+sessionColumn+` IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var name, ip string
+		var banned bool
+		var joinTime time.Time
+		var leaveTime sql.NullTime
+		if err := rows.Scan(&id, &name, &banned, &ip, &joinTime, &leaveTime); err != nil {
+			rows.Close()
+			return err
+		}
+		last := joinTime
+		if leaveTime.Valid {
+			last = leaveTime.Time
+		}
+		x.setPlayer(name, id, banned)
+		x.add(name, models.PlayerLinkIP, ip, playerLinkSourcePanel, joinTime, last)
+	}
+	rows.Close()
+	rows, err = moderationDB.Query(`
+		SELECT id, name, is_banned, ip, created_at
+		FROM players
+		WHERE ip IS NOT NULL AND ip != '' AND `+playerColumn+` IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var name, ip string
+		var banned bool
+		var createdAt time.Time
+		if err := rows.Scan(&id, &name, &banned, &ip, &createdAt); err != nil {
+			return err
+		}
+		x.setPlayer(name, id, banned)
+		x.add(name, models.PlayerLinkIP, ip, playerLinkSourcePanel, createdAt, createdAt)
+	}
+	return rows.Err()
+}
+func (x *identityIndex) ensurePlayers(names []string) error {
+	pending := pendingKeys(names, x.loadedPlayers)
+	if len(pending) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(pending))
+	for i, name := range pending {
+		args[i] = name
+	}
+	rows, err := moderationDB.Query("SELECT id, name, is_banned FROM players WHERE name IN ("+strings.TrimSuffix(strings.Repeat("?,", len(pending)), ",")+")", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var name string
+		var banned bool
+		if err := rows.Scan(&id, &name, &banned); err != nil {
+			return err
+		}
+		x.setPlayer(name, id, banned)
+	}
+	return rows.Err()
+}
+func (x *identityIndex) setPlayer(name string, id int, banned bool) {
+	x.loadedPlayers[name] = true
+	if _, exists := x.playerIDs[name]; !exists || id < x.playerIDs[name] {
+		x.playerIDs[name] = id
+	}
+	x.banned[name] = x.banned[name] || banned
+}
+func (x *identityIndex) links(name string) ([]*models.LinkedAccount, error) {
+	if err := x.ensureNames([]string{name}); err != nil {
+		return nil, err
+	}
+	ips := []string{}
+	for _, window := range x.byName[name] {
+		if window.kind == models.PlayerLinkIP {
+			ips = append(ips, window.value)
+		}
+	}
+	if err := x.ensureIPs(ips); err != nil {
+		return nil, err
+	}
+	accounts := make(map[string]*models.LinkedAccount)
+	for key, own := range x.byName[name] {
+		for other := range x.byValue[key] {
+			if other == name {
+				continue
+			}
+			account := accounts[other]
+			if account == nil {
+				account = &models.LinkedAccount{Name: other, SharedIPs: []string{}}
+				accounts[other] = account
+			}
+			evidence := linkEvidence(own, x.byName[other][key])
+			if evidence.Kind == models.PlayerLinkIP {
+				account.SharedIPs = append(account.SharedIPs, evidence.Value)
+			} else {
+				account.SharedUUID = true
+			}
+			account.FirstOverlap = earlierTime(account.FirstOverlap, evidence.FirstOverlap)
+			account.LastOverlap = laterTime(account.LastOverlap, evidence.LastOverlap)
+			account.Evidence = append(account.Evidence, evidence)
+		}
+	}
+	names := make([]string, 0, len(accounts))
+	for other := range accounts {
+		names = append(names, other)
+	}
+	if err := x.ensurePlayers(names); err != nil {
+		return nil, err
+	}
+	result := make([]*models.LinkedAccount, 0, len(accounts))
+	for _, account := range accounts {
+		account.PlayerID = x.playerIDs[account.Name]
+		account.Banned = x.banned[account.Name]
+		sort.Strings(account.SharedIPs)
+		sort.Slice(account.Evidence, func(i, j int) bool {
+			if account.Evidence[i].Kind != account.Evidence[j].Kind {
+				return account.Evidence[i].Kind > account.Evidence[j].Kind
+			}
+			return account.Evidence[i].Value < account.Evidence[j].Value
+		})
+		result = append(result, account)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SharedUUID != result[j].SharedUUID {
+			return result[i].SharedUUID
+		}
+		if len(result[i].Evidence) != len(result[j].Evidence) {
+			return len(result[i].Evidence) > len(result[j].Evidence)
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+func linkEvidence(own, other *identityWindow) models.PlayerLinkEvidence {
+	evidence := models.PlayerLinkEvidence{Kind: own.kind, Value: own.value}
+	sources := make(map[string]bool)
+	for source := range own.sources {
+		sources[source] = true
+	}
+	for source := range other.sources {
+		sources[source] = true
+	}
+	for source := range sources {
+		evidence.Sources = append(evidence.Sources, source)
+	}
+	sort.Strings(evidence.Sources)
+	if own.first.IsZero() || other.first.IsZero() || own.last.IsZero() || other.last.IsZero() {
+		return evidence
+	}
+	first := own.first
+	if other.first.After(first) {
+		first = other.first
+	}
+	last := own.last
+	if other.last.Before(last) {
+		last = other.last
+	}
+	if !last.Before(first) {
+		evidence.FirstOverlap = &first
+		evidence.LastOverlap = &last
+	}
+	return evidence
+}
+func (x *identityIndex) graph(root string, maxDepth int) (*models.PlayerLinkGraph, error) {
+	graph := &models.PlayerLinkGraph{Root: root, Nodes: []models.PlayerLinkNode{}, Edges: []models.PlayerLinkEdge{}}
+	depths := map[string]int{root: 0}
+	order := []string{root}
+	edges := make(map[string]bool)
+	for i := 0; i < len(order); i++ {
+		name := order[i]
+		if depths[name] >= maxDepth {
+			continue
+		}
+		accounts, err := x.links(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, account := range accounts {
+			if _, exists := depths[account.Name]; !exists {
+				if len(order) >= playerLinkMaxNodes {
+					graph.Truncated = true
+					continue
+				}
+				depths[account.Name] = depths[name] + 1
+				order = append(order, account.Name)
+			}
+			pair := []string{name, account.Name}
+			sort.Strings(pair)
+			if edges[pair[0]+"\x00"+pair[1]] {
+				continue
+			}
+			edges[pair[0]+"\x00"+pair[1]] = true
+			graph.Edges = append(graph.Edges, models.PlayerLinkEdge{
+				Source:       name,
+				Target:       account.Name,
+				SharedUUID:   account.SharedUUID,
+				SharedIPs:    account.SharedIPs,
+				FirstOverlap: account.FirstOverlap,
+				LastOverlap:  account.LastOverlap,
+				Evidence:     account.Evidence,
+			})
+		}
+	}
+	if err := x.ensurePlayers(order); err != nil {
+		return nil, err
+	}
+	for _, name := range order {
+		graph.Nodes = append(graph.Nodes, models.PlayerLinkNode{
+			Name:     name,
+			PlayerID: x.playerIDs[name],
+			Banned:   x.banned[name],
+			Depth:    depths[name],
+		})
+	}
+	return graph, nil
+}
+func GetPlayerLinks(c *gin.Context) {
+	player, ok := loadPlayerParam(c)
+	if !ok {
+		return
+	}
+	index := newIdentityIndex()
+	accounts, err := index.links(player.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("关联账号分析失败: "+err.Error()))
+		return
+	}
+	ips, uuids := []string{}, []string{}
+	for _, window := range index.byName[player.Name] {
+		if window.kind == models.PlayerLinkIP {
+			ips = append(ips, window.value)
+		} else {
+			uuids = append(uuids, window.value)
+		}
+	}
+	sort.Strings(ips)
+	sort.Strings(uuids)
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"playerId":   player.ID,
+		"playerName": player.Name,
+		"ips":        ips,
+		"uuids":      uuids,
+		"accounts":   accounts,
+	}))
+}
+func GetPlayerLinkGraph(c *gin.Context) {
+	player, ok := loadPlayerParam(c)
+	if !ok {
+		return
+	}
+	depth, err := strconv.Atoi(c.DefaultQuery("depth", strconv.Itoa(playerLinkDefaultDepth)))
+	if err != nil || depth <= 0 || depth > playerLinkMaxDepth {
+		depth = playerLinkDefaultDepth
+	}
+	graph, err := newIdentityIndex().graph(player.Name, depth)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("关联账号分析失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(graph))
+}
+func pendingKeys(values []string, loaded map[string]bool) []string {
+	pending := []string{}
+	for _, value := range values {
+		if value != "" && !loaded[value] {
+			loaded[value] = true
+			pending = append(pending, value)
+		}
+	}
+	return pending
+}
+func parseKnownIPs(value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	var ips []string
+	if err := json.Unmarshal([]byte(value), &ips); err == nil {
+		return ips
+	}
+	for _, ip := range strings.Split(value, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+func parseTShockTime(value string) time.Time {
+	for _, layout := range tshockTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+func earlierTime(current, candidate *time.Time) *time.Time {
+	if candidate == nil || (current != nil && !candidate.Before(*current)) {
+		return current
+	}
+	return candidate
+}
+func laterTime(current, candidate *time.Time) *time.Time {
+	if candidate == nil || (current != nil && !candidate.After(*current)) {
+		return current
+	}
+	return candidate
+}
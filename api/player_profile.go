@@ -0,0 +1,343 @@
+package api
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"terraria-panel/models"
+	"terraria-panel/services"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+const playerProfileRecentSessions = 20
+func GetPlayerProfile(c *gin.Context) {
+	key := strings.TrimSpace(c.Param("id"))
+	if key == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("玩家名不能为空"))
+		return
+	}
+	player, err := getProfilePlayer(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取玩家信息失败: "+err.Error()))
+		return
+	}
+	name := key
+	if player != nil {
+		name = player.Name
+	}
+	uuid := strings.TrimSpace(c.Query("uuid"))
+	account, err := findTShockAccount(name, uuid)
+	if err != nil {
+		log.Printf("[PlayerProfile] Failed to read TShock account for %s: %v", name, err)
+	}
+	if player == nil && account != nil && account.Username != name {
+		name = account.Username
+		if player, err = getPlayerByName(name); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取玩家信息失败: "+err.Error()))
+			return
+		}
+	}
+	if player == nil && account == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("玩家不存在"))
+		return
+	}
+	if account != nil && account.UUID != "" {
+		uuid = account.UUID
+	}
+	var stats *models.PlayerStats
+	sessions := []*models.PlayerSession{}
+	if player != nil {
+		if stats, err = statsStorage.GetByPlayerID(player.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取玩家统计失败: "+err.Error()))
+			return
+		}
+		if sessions, _, err = sessionStorage.GetByPlayerID(player.ID, -1, 0); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取会话记录失败: "+err.Error()))
+			return
+		}
+	}
+	roomNames := playerProfileRoomNames()
+	for _, session := range sessions {
+		session.PlayerName = name
+		session.RoomName = roomNames[session.RoomID]
+	}
+	ipHistory := playerIPHistory(player, sessions, account)
+	panelBans, err := playerBanStorage.GetByName(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取封禁记录失败: "+err.Error()))
+		return
+	}
+	tshockBans, err := findTShockBans(name, account, uuid, ipHistory)
+	if err != nil {
+		log.Printf("[PlayerProfile] Failed to read TShock bans for %s: %v", name, err)
+	}
+	banned := false
+	for _, ban := range panelBans {
+		banned = banned || ban.IsActive()
+	}
+	for _, ban := range tshockBans {
+		banned = banned || ban.IsActive
+	}
+	infractions, _, err := playerInfractionStorage.Query(models.PlayerInfractionFilter{PlayerName: name}, -1, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取违规记录失败: "+err.Error()))
+		return
+	}
+	notes := []*models.PlayerInfraction{}
+	warnings := 0
+	for _, infraction := range infractions {
+		switch {
+		case infraction.Type == models.InfractionNote:
+			notes = append(notes, infraction)
+		case infraction.Type == models.InfractionWarning && infraction.IsActive():
+			warnings++
+		}
+	}
+	recent := sessions
+	if len(recent) > playerProfileRecentSessions {
+		recent = recent[:playerProfileRecentSessions]
+	}
+	visits := playerRoomVisits(sessions, roomNames)
+	playTime := 0
+	for _, visit := range visits {
+		playTime += visit.PlayTime
+	}
+	if stats != nil && stats.TotalPlayTime > playTime {
+		playTime = stats.TotalPlayTime
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"name":           name,
+		"uuid":           uuid,
+		"player":         player,
+		"stats":          stats,
+		"playTime":       playTime,
+		"sessionCount":   len(sessions),
+		"recentSessions": recent,
+		"roomsVisited":   visits,
+		"ipHistory":      ipHistory,
+		"tshock":         account,
+		"banned":         banned,
+		"bans": gin.H{
+			"panel":  panelBans,
+			"tshock": tshockBans,
+		},
+		"notes":          notes,
+		"infractions":    infractions,
+		"activeWarnings": warnings,
+	}))
+}
+func getProfilePlayer(key string) (*models.Player, error) {
+	if id, err := strconv.Atoi(key); err == nil {
+		player, err := getPlayerByID(id)
+		if err != nil || player != nil {
+			return player, err
+		}
+	}
+	return getPlayerByName(key)
+}
+func getPlayerByName(name string) (*models.Player, error) {
+	query := `
+		SELECT id FROM players
+		WHERE name = ?
+		ORDER BY id LIMIT 1
+	`
+	var id int
+	err := moderationDB.QueryRow(query, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return getPlayerByID(id)
+}
+func playerProfileRoomNames() map[int]string {
+	names := map[int]string{services.PluginServerID: services.PluginServerName}
+	if rooms, err := roomStorage.GetAll(); err == nil {
+		for _, room := range rooms {
+			names[room.ID] = room.Name
+		}
+	}
+	return names
+}
+func playerRoomVisits(sessions []*models.PlayerSession, roomNames map[int]string) []*models.PlayerRoomVisit {
+	now := time.Now()
+	byRoom := make(map[int]*models.PlayerRoomVisit)
+	for _, session := range sessions {
+		visit := byRoom[session.RoomID]
+		if visit == nil {
+			visit = &models.PlayerRoomVisit{
+				RoomID:     session.RoomID,
+				RoomName:   roomNames[session.RoomID],
+				FirstVisit: session.JoinTime,
+				LastVisit:  session.JoinTime,
+			}
+			byRoom[session.RoomID] = visit
+		}
+		visit.Sessions++
+		duration := session.Duration
+		if session.LeaveTime == nil {
+			duration = int(now.Sub(session.JoinTime).Seconds())
+		}
+		if duration > 0 {
+			visit.PlayTime += duration
+		}
+		if session.JoinTime.Before(visit.FirstVisit) {
+			visit.FirstVisit = session.JoinTime
+		}
+		if session.JoinTime.After(visit.LastVisit) {
+			visit.LastVisit = session.JoinTime
+		}
+	}
+	visits := make([]*models.PlayerRoomVisit, 0, len(byRoom))
+	for _, visit := range byRoom {
+		visits = append(visits, visit)
+	}
+	sort.Slice(visits, func(i, j int) bool {
+		if visits[i].PlayTime != visits[j].PlayTime {
+			return visits[i].PlayTime > visits[j].PlayTime
+		}
+		return visits[i].RoomID < visits[j].RoomID
+	})
+	return visits
+}
+func playerIPHistory(player *models.Player, sessions []*models.PlayerSession, account *models.TShockAccount) []*models.PlayerIPRecord {
+	byIP := make(map[string]*models.PlayerIPRecord)
+	record := func(ip, source string, first, last *time.Time) *models.PlayerIPRecord {
+		ip = strings.TrimSpace(ip)
+		if ip == "" {
+			return nil
+		}
+		entry := byIP[ip]
+		if entry == nil {
+			entry = &models.PlayerIPRecord{IP: ip, Sources: []string{}}
+			byIP[ip] = entry
+		}
+		found := false
+		for _, existing := range entry.Sources {
+			found = found || existing == source
+		}
+		if !found {
+			entry.Sources = append(entry.Sources, source)
+		}
+		entry.FirstSeen = earlierTime(entry.FirstSeen, first)
+		entry.LastSeen = laterTime(entry.LastSeen, last)
+		return entry
+	}
+	for _, session := range sessions {
+		joinTime := session.JoinTime
+		last := &joinTime
+		if session.LeaveTime != nil {
+			last = session.LeaveTime
+		}
+		if entry := record(session.IPAddress, playerLinkSourcePanel, &joinTime, last); entry != nil {
+			entry.Sessions++
+		}
+	}
+	if player != nil {
+		createdAt := player.CreatedAt
+		record(player.IP, playerLinkSourcePanel, &createdAt, &createdAt)
+	}
+	if account != nil {
+		for _, ip := range account.KnownIPs {
+			record(ip, playerLinkSourceTShock, nil, nil)
+		}
+	}
+	history := make([]*models.PlayerIPRecord, 0, len(byIP))
+	for _, entry := range byIP {
+		history = append(history, entry)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		a, b := history[i].LastSeen, history[j].LastSeen
+		if (a == nil) != (b == nil) {
+			return a != nil
+		}
+		if a != nil && !a.Equal(*b) {
+			return a.After(*b)
+		}
+		return history[i].IP < history[j].IP
+	})
+	return history
+}
+func findTShockAccount(name, uuid string) (*models.TShockAccount, error) {
+	dbPath := getTShockDBPath()
+	if !fileExists(dbPath) {
+		return nil, nil
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	query := `SELECT ID, Username, COALESCE(UUID, ''), COALESCE(Usergroup, ''), COALESCE(Registered, ''),
+		COALESCE(LastAccessed, ''), COALESCE(KnownIPs, '') FROM Users WHERE Username = ?`
+	args := []interface{}{name}
+	if uuid != "" {
+		query += " OR UUID = ?"
+		args = append(args, uuid)
+	}
+	query += " ORDER BY CASE WHEN Username = ? THEN 0 ELSE 1 END LIMIT 1"
+	args = append(args, name)
+	account := &models.TShockAccount{}
+	var registered, lastAccessed, knownIPs string
+	err = db.QueryRow(query, args...).Scan(&account.ID, &account.Username, &account.UUID, &account.Group,
+		&registered, &lastAccessed, &knownIPs)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t := parseTShockTime(registered); !t.IsZero() {
+		account.Registered = &t
+	}
+	if t := parseTShockTime(lastAccessed); !t.IsZero() {
+		account.LastAccessed = &t
+	}
+	account.KnownIPs = parseKnownIPs(knownIPs)
+	if account.KnownIPs == nil {
+		account.KnownIPs = []string{}
+	}
+	return account, nil
+}
+func findTShockBans(name string, account *models.TShockAccount, uuid string, ipHistory []*models.PlayerIPRecord) ([]TShockBan, error) {
+	bans := []TShockBan{}
+	dbPath := getTShockDBPath()
+	if !fileExists(dbPath) {
+		return bans, nil
+	}
+	identifiers := []interface{}{"name:" + name}
+	if account != nil {
+		identifiers = append(identifiers, "acc:"+account.Username)
+	}
+	if uuid != "" {
+		identifiers = append(identifiers, "uuid:"+uuid)
+	}
+	for _, entry := range ipHistory {
+		identifiers = append(identifiers, "ip:"+entry.IP)
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return bans, err
+	}
+	defer db.Close()
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(identifiers)), ",")
+	rows, err := db.Query(`SELECT TicketNumber, Identifier, Reason, BanningUser, Date, Expiration
+		FROM PlayerBans WHERE Identifier IN (`+placeholders+`) ORDER BY Date DESC`, identifiers...)
+	if err != nil {
+		return bans, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ban TShockBan
+		if err := rows.Scan(&ban.TicketNumber, &ban.Identifier, &ban.Reason,
+			&ban.BanningUser, &ban.Date, &ban.Expiration); err != nil {
+			continue
+		}
+		formatTShockBan(&ban)
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
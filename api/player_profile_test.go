@@ -0,0 +1,85 @@
+package api
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"terraria-panel/db"
+	"terraria-panel/services"
+	"github.com/gin-gonic/gin"
+)
+func createTestTShockAccount(t *testing.T, username, uuid, group string) {
+	dbPath := filepath.Join(services.GetGlobalTShockDir(), "tshock.sqlite")
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tshockDB, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tshockDB.Close()
+	_, err = tshockDB.Exec(`CREATE TABLE IF NOT EXISTS Users (ID INTEGER PRIMARY KEY AUTOINCREMENT, Username TEXT, UUID TEXT, Usergroup TEXT, Registered TEXT, LastAccessed TEXT, KnownIPs TEXT);
+		CREATE TABLE IF NOT EXISTS PlayerBans (TicketNumber INTEGER PRIMARY KEY AUTOINCREMENT, Identifier TEXT, Reason TEXT, BanningUser TEXT, Date INTEGER, Expiration INTEGER);
+		INSERT INTO Users (Username, UUID, Usergroup, Registered, LastAccessed, KnownIPs) VALUES (?, ?, ?, '2026-01-02T03:04:05', '', '["10.0.0.9"]')`, username, uuid, group)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+func getTestProfile(t *testing.T, key, uuid string) (int, string, bool, string) {
+	t.Helper()
+	path := "/"
+	if uuid != "" {
+		path += "?uuid=" + uuid
+	}
+	w := performTestRequest(GetPlayerProfile, http.MethodGet, path, gin.Params{{Key: "id", Value: key}}, nil, nil)
+	var response struct {
+		Data struct {
+			Name   string           `json:"name"`
+			Player *json.RawMessage `json:"player"`
+			TShock *struct {
+				Group string `json:"group"`
+			} `json:"tshock"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	group := ""
+	if response.Data.TShock != nil {
+		group = response.Data.TShock.Group
+	}
+	return w.Code, response.Data.Name, response.Data.Player != nil, group
+}
+func TestGetPlayerProfileResolvesIDNameAndTShockAccount(t *testing.T) {
+	setupTestDB(t)
+	room := createTestRoom(t, "profile-room", "tshock")
+	result, err := db.DB.Exec("INSERT INTO players (name, ip, room_id) VALUES ('Alice', '10.0.0.1', ?)", room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceID, _ := result.LastInsertId()
+	createTestTShockAccount(t, "Bob", "bob-uuid", "vip")
+	tests := []struct {
+		name      string
+		key       string
+		uuid      string
+		status    int
+		wantName  string
+		panelRow  bool
+		wantGroup string
+	}{
+		{"numeric id", fmt.Sprint(aliceID), "", http.StatusOK, "Alice", true, ""},
+		{"panel name", "Alice", "", http.StatusOK, "Alice", true, ""},
+		{"tshock account without panel row", "Bob", "", http.StatusOK, "Bob", false, "vip"},
+		{"uuid fallback", "Bobby", "bob-uuid", http.StatusOK, "Bob", false, "vip"},
+		{"unknown player", "Nobody", "", http.StatusNotFound, "", false, ""},
+	}
+	for _, tt := range tests {
+		status, name, panelRow, group := getTestProfile(t, tt.key, tt.uuid)
+		if status != tt.status || name != tt.wantName || panelRow != tt.panelRow || group != tt.wantGroup {
+			t.Errorf("%s: got status %d, name %q, panel row %v, group %q; want %d, %q, %v, %q",
+				tt.name, status, name, panelRow, group, tt.status, tt.wantName, tt.panelRow, tt.wantGroup)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package api
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"terraria-panel/db"
+	"terraria-panel/models"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+func createTestBan(t *testing.T, room *models.Room, name, externalRef string) *models.PlayerBan {
+	result, err := db.DB.Exec("INSERT INTO players (name, room_id, is_banned) VALUES (?, ?, 1)", name, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playerID, _ := result.LastInsertId()
+	ban := &models.PlayerBan{PlayerID: int(playerID), PlayerName: name, RoomID: room.ID, Reason: "grief", ExternalRef: externalRef, CreatedAt: time.Now()}
+	if err := playerBanStorage.Create(ban); err != nil {
+		t.Fatal(err)
+	}
+	return ban
+}
+func unbanTestPlayer(ban *models.PlayerBan, role string) int {
+	w := performTestRequest(UnbanPlayer, "POST", "/", gin.Params{{Key: "id", Value: fmt.Sprint(ban.PlayerID)}}, nil, asTestUser(1, role))
+	return w.Code
+}
+func TestUnbanPlayerRemovesBanListEntryFromRoomWorkDir(t *testing.T) {
+	setupTestDB(t)
+	for _, serverType := range []string{"vanilla", "tmodloader"} {
+		room := createTestRoom(t, serverType+"-room", serverType)
+		workDir := roomWorkDir(room)
+		if err := os.MkdirAll(workDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		banList := filepath.Join(workDir, "banlist.txt")
+		if err := os.WriteFile(banList, []byte("//Griefer\n1.2.3.4\n//Keeper\n5.6.7.8\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ban := createTestBan(t, room, "Griefer", "")
+		if code := unbanTestPlayer(ban, models.RoleViewer); code != http.StatusForbidden {
+			t.Errorf("%s: viewer unban status %d, want %d", serverType, code, http.StatusForbidden)
+		}
+		if code := unbanTestPlayer(ban, models.RoleAdmin); code != http.StatusOK {
+			t.Fatalf("%s: unban status %d, want %d", serverType, code, http.StatusOK)
+		}
+		data, err := os.ReadFile(banList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "//Keeper\n5.6.7.8\n" {
+			t.Errorf("%s: banlist.txt = %q, want only the other entry", serverType, data)
+		}
+		if active, _ := playerBanStorage.GetActiveByPlayerID(ban.PlayerID); active != nil {
+			t.Errorf("%s: ban is still active after unban", serverType)
+		}
+	}
+}
+func TestUnbanPlayerExpiresTShockBanOfStoppedRoom(t *testing.T) {
+	setupTestDB(t)
+	room := createTestRoom(t, "tshock-room", "tshock")
+	dbPath := tshockDBPath(room.ID)
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tshockDB, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tshockDB.Close()
+	far := timeToTicks(time.Now().Add(24 * time.Hour))
+	_, err = tshockDB.Exec(`CREATE TABLE PlayerBans (TicketNumber INTEGER PRIMARY KEY AUTOINCREMENT, Identifier TEXT, Reason TEXT, BanningUser TEXT, Date INTEGER, Expiration INTEGER);
+		INSERT INTO PlayerBans (TicketNumber, Identifier, Reason, BanningUser, Date, Expiration) VALUES (7, 'name:Griefer', 'grief', 'panel', 0, ?), (8, 'name:Keeper', 'spam', 'panel', 0, ?)`, far, far)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ban := createTestBan(t, room, "Griefer", "7")
+	if code := unbanTestPlayer(ban, models.RoleAdmin); code != http.StatusOK {
+		t.Fatalf("unban status %d, want %d", code, http.StatusOK)
+	}
+	now := timeToTicks(time.Now())
+	rows, err := tshockDB.Query("SELECT Identifier, Expiration FROM PlayerBans ORDER BY TicketNumber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var identifier string
+		var expiration int64
+		if err := rows.Scan(&identifier, &expiration); err != nil {
+			t.Fatal(err)
+		}
+		if lifted := expiration <= now; lifted != strings.HasSuffix(identifier, "Griefer") {
+			t.Errorf("%s: expiration lifted = %v, want %v", identifier, lifted, !lifted)
+		}
+	}
+}
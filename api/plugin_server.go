@@ -15,6 +15,7 @@ import (
 	"terraria-panel/models"
 	"terraria-panel/services"
 	"terraria-panel/utils"
+	wshandler "terraria-panel/websocket"
 	"time"
 	"github.com/gin-gonic/gin"
 )
@@ -405,7 +406,7 @@ func SendPluginServerCommand(c *gin.Context) {
 		return
 	}
 	log.Printf("[INFO] Sending command to TShock via PTY: %s", req.Command)
-	if err := p.SendCommand(req.Command); err != nil {
+	if err := wshandler.SendConsoleCommand(services.PluginServerID, c.GetInt("user_id"), c.GetString("username"), req.Command); err != nil {
 		log.Printf("[ERROR] Failed to send command via PTY: %v", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("命令发送失败: "+err.Error()))
 		return
@@ -0,0 +1,129 @@
+package api
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"terraria-panel/middleware"
+	"terraria-panel/models"
+	"terraria-panel/services"
+	"terraria-panel/storage"
+	wshandler "terraria-panel/websocket"
+	"github.com/gin-gonic/gin"
+)
+var (
+	roomPermissionStorage storage.RoomPermissionStorage
+	invitationStorage     storage.InvitationStorage
+)
+var backupRoomPattern = regexp.MustCompile(`^room-(\d+)_`)
+func InitAccessControl(db *sql.DB) {
+	roomPermissionStorage = storage.NewSQLiteRoomPermissionStorage(db)
+	invitationStorage = storage.NewSQLiteInvitationStorage(db)
+	wshandler.SetConsoleAuthorizer(func(userID, roomID int, permission string) bool {
+		user, err := userStorage.GetByID(userID)
+		if err != nil || user == nil {
+			return false
+		}
+		return hasRoomPermission(user.ID, user.Role, roomID, permission)
+	})
+}
+func CurrentUserMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := userStorage.GetByID(c.GetInt("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取用户信息失败"})
+			c.Abort()
+			return
+		}
+		if user == nil || user.Username != c.GetString("username") {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在或已被删除"})
+			c.Abort()
+			return
+		}
+		c.Set("role", user.Role)
+		if !enforceTwoFactorSetup(c, user) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+func requireRole(role string) gin.HandlerFunc {
+	return middleware.RequireRole(role)
+}
+func requireRoomPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Next()
+			return
+		}
+		if !checkRoomPermission(c, roomID, permission) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+func requirePluginServerPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkRoomPermission(c, services.PluginServerID, permission) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+func checkRoomPermission(c *gin.Context, roomID int, permission string) bool {
+	if hasRoomPermission(c.GetInt("user_id"), c.GetString("role"), roomID, permission) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, models.ErrorResponse("没有该房间的 "+permission+" 权限"))
+	return false
+}
+func hasRoomPermission(userID int, role string, roomID int, permission string) bool {
+	return models.RoomPermissionLevel(effectiveRoomPermission(userID, role, roomID)) >= models.RoomPermissionLevel(permission)
+}
+func effectiveRoomPermission(userID int, role string, roomID int) string {
+	permission := models.DefaultRoomPermission(role)
+	if roomPermissionStorage == nil {
+		return permission
+	}
+	granted, err := roomPermissionStorage.Get(userID, roomID)
+	if err != nil {
+		log.Printf("[RBAC] Failed to load room permission (user %d, room %d): %v", userID, roomID, err)
+		return permission
+	}
+	if models.RoomPermissionLevel(granted) > models.RoomPermissionLevel(permission) {
+		return granted
+	}
+	return permission
+}
+func backupRoomID(backupID string) (int, bool) {
+	matches := backupRoomPattern.FindStringSubmatch(backupID)
+	if len(matches) < 2 {
+		return 0, false
+	}
+	roomID, err := strconv.Atoi(matches[1])
+	return roomID, err == nil
+}
+func requireBackupPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID, ok := backupRoomID(c.Param("id"))
+		if !ok {
+			if !models.HasRole(c.GetString("role"), models.RoleAdmin) {
+				c.JSON(http.StatusForbidden, models.ErrorResponse("权限不足"))
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+		if !checkRoomPermission(c, roomID, permission) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -2,6 +2,7 @@ package api
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,15 +16,20 @@ import (
 	"terraria-panel/config"
 	"terraria-panel/db"
 	"terraria-panel/models"
+	"terraria-panel/services"
 	"terraria-panel/storage"
 	"terraria-panel/utils"
 	"time"
 	"github.com/gin-gonic/gin"
 )
 var roomStorage storage.RoomStorage
+var roomSupervisor *services.RoomSupervisor
 func SetRoomStorage(s storage.RoomStorage) {
 	roomStorage = s
 }
+func SetRoomSupervisor(s *services.RoomSupervisor) {
+	roomSupervisor = s
+}
 type WorldInfo struct {
 	Name   string `json:"name"`
 	Source string `json:"source"`
@@ -93,13 +99,23 @@ func GetRooms(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取房间列表失败: "+err.Error()))
 		return
 	}
+	visible := rooms[:0]
+	for _, room := range rooms {
+		if hasRoomPermission(c.GetInt("user_id"), c.GetString("role"), room.ID, models.RoomPermissionView) {
+			visible = append(visible, room)
+		}
+	}
+	rooms = visible
 	for i := range rooms {
 		if p, exists := utils.GetProcess(rooms[i].ID); exists && p.IsRunning() {
 			rooms[i].Status = "running"
 			rooms[i].PID = p.GetPID()
+			rooms[i].Adopted = p.IsAdopted()
 			roomStorage.UpdateStatus(rooms[i].ID, "running", p.GetPID())
 		} else {
-			rooms[i].Status = "stopped"
+			if rooms[i].Status != "crashed" && rooms[i].Status != "restarting" {
+				rooms[i].Status = "stopped"
+			}
 			rooms[i].PID = 0
 		}
 	}
@@ -122,6 +138,9 @@ func CreateRoom(c *gin.Context) {
 		return
 	}
 	fmt.Printf("[DEBUG] 房间创建成功: ID=%d\n", room.ID)
+	setAuditRoom(c, room.ID)
+	setAuditTarget(c, room.Name)
+	setAuditChange(c, nil, roomAuditRecord(&room))
 	roomDir := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", room.ID))
 	if err := os.MkdirAll(roomDir, 0755); err != nil {
 		log.Printf("[ERROR] 创建房间目录失败: %v", err)
@@ -147,10 +166,23 @@ func UpdateRoom(c *gin.Context) {
 		return
 	}
 	updatedRoom.ID = id
+	if updatedRoom.RestartPolicy != "" && !models.IsValidRestartPolicy(updatedRoom.RestartPolicy) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的重启策略，可选值: never, on-failure, always"))
+		return
+	}
+	if (updatedRoom.MaxRestarts != nil && *updatedRoom.MaxRestarts < 0) || updatedRoom.RestartWindow < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("重启次数和时间窗口不能为负数"))
+		return
+	}
+	before, _ := roomStorage.GetByID(id)
 	if err := roomStorage.Update(&updatedRoom); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("更新失败: "+err.Error()))
 		return
 	}
+	if after, err := roomStorage.GetByID(id); err == nil && after != nil {
+		setAuditTarget(c, after.Name)
+		setAuditChange(c, roomAuditRecord(before), roomAuditRecord(after))
+	}
 	c.JSON(http.StatusOK, models.MessageResponse("房间更新成功"))
 }
 func DeleteRoom(c *gin.Context) {
@@ -172,6 +204,11 @@ func DeleteRoom(c *gin.Context) {
 	}
 	log.Printf("[INFO] 开始删除房间: ID=%d, Name=%s, Type=%s, World=%s",
 		room.ID, room.Name, room.ServerType, room.WorldFile)
+	setAuditTarget(c, room.Name)
+	setAuditChange(c, roomAuditRecord(room), nil)
+	if roomSupervisor != nil {
+		roomSupervisor.Reset(id)
+	}
 	if p, exists := utils.GetProcess(id); exists && p.IsRunning() {
 		log.Printf("[INFO] 停止房间进程: PID=%d", p.GetPID())
 		utils.StopProcess(id)
@@ -191,6 +228,9 @@ func DeleteRoom(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除失败: "+err.Error()))
 		return
 	}
+	if err := roomPermissionStorage.DeleteByRoom(id); err != nil {
+		log.Printf("[WARN] 删除房间权限记录失败: %v", err)
+	}
 	log.Printf("[INFO] 房间删除成功: ID=%d", id)
 	c.JSON(http.StatusOK, models.MessageResponse("房间删除成功"))
 }
@@ -301,25 +341,59 @@ func StartRoom(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的房间ID"))
 		return
 	}
+	if roomSupervisor != nil {
+		roomSupervisor.Reset(id)
+	}
+	before, _ := roomStorage.GetByID(id)
+	if status, err := startRoom(id); err != nil {
+		c.JSON(status, models.ErrorResponse(err.Error()))
+		return
+	}
+	if after, err := roomStorage.GetByID(id); err == nil && after != nil {
+		setAuditTarget(c, after.Name)
+		setAuditChange(c, roomAuditState(before), roomAuditState(after))
+	}
+	c.JSON(http.StatusOK, models.MessageResponse("房间启动成功"))
+}
+func roomAuditRecord(room *models.Room) *models.Room {
+	if room == nil {
+		return nil
+	}
+	record := *room
+	if record.Password != "" {
+		record.Password = auditRedacted
+	}
+	if record.AdminToken != "" {
+		record.AdminToken = auditRedacted
+	}
+	return &record
+}
+func roomAuditState(room *models.Room) gin.H {
+	if room == nil {
+		return nil
+	}
+	return gin.H{"status": room.Status, "pid": room.PID}
+}
+func LaunchRoom(id int) error {
+	_, err := startRoom(id)
+	return err
+}
+func startRoom(id int) (int, error) {
 	if p, exists := utils.GetProcess(id); exists && p.IsRunning() {
 		log.Printf("[WARN] 启动房间 %d 失败 - 房间已在运行中 (PID: %d)", id, p.GetPID())
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("房间已在运行中"))
-		return
+		return http.StatusBadRequest, errors.New("房间已在运行中")
 	}
 	room, err := roomStorage.GetByID(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取房间失败: "+err.Error()))
-		return
+		return http.StatusInternalServerError, errors.New("读取房间失败: "+err.Error())
 	}
 	if room == nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse("房间不存在"))
-		return
+		return http.StatusNotFound, errors.New("房间不存在")
 	}
 	roomDir := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", room.ID))
 	if err := os.MkdirAll(roomDir, 0755); err != nil {
 		log.Printf("[ERROR] 创建房间目录失败: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建房间目录失败"))
-		return
+		return http.StatusInternalServerError, errors.New("创建房间目录失败")
 	}
 	roomTshockDir := filepath.Join(roomDir, "tshock")
 	var worldExt string
@@ -364,9 +438,8 @@ func StartRoom(c *gin.Context) {
 		dllPath := filepath.Join(tmodDir, "tModLoader.dll")
 		if _, err := os.Stat(dllPath); os.IsNotExist(err) {
 			log.Printf("[ERROR] tModLoader服务器文件不存在: %s", dllPath)
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse(
-				"tModLoader服务器未安装。请先在【游戏安装】页面安装tModLoader服务器"))
-			return
+			return http.StatusInternalServerError, errors.New(
+				"tModLoader服务器未安装。请先在【游戏安装】页面安装tModLoader服务器")
 		}
 		if err := os.Chmod(dllPath, 0755); err != nil {
 			log.Printf("[WARN] 无法设置文件权限: %v", err)
@@ -516,8 +589,7 @@ func StartRoom(c *gin.Context) {
 			log.Printf("[INFO] 房间 #%d 应用模组配置: %s", room.ID, room.ModProfile)
 			if err := applyModConfigToRoom(room.ID, room.ModProfile, roomDir); err != nil {
 				log.Printf("[ERROR] 应用模组配置失败: %v", err)
-				c.JSON(http.StatusInternalServerError, models.ErrorResponse("应用模组配置失败: "+err.Error()))
-				return
+				return http.StatusInternalServerError, errors.New("应用模组配置失败: "+err.Error())
 			}
 		} else {
 			log.Printf("[INFO] 房间 #%d 使用纯净版（无模组）", room.ID)
@@ -557,9 +629,8 @@ func StartRoom(c *gin.Context) {
 		serverBin := filepath.Join(vanillaDir, "TerrariaServer.bin.x86_64")
 		if _, err := os.Stat(serverBin); os.IsNotExist(err) {
 			log.Printf("[ERROR] Vanilla服务器文件不存在: %s", serverBin)
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse(
-				"Vanilla服务器未安装。请先在【游戏安装】页面安装Vanilla服务器"))
-			return
+			return http.StatusInternalServerError, errors.New(
+				"Vanilla服务器未安装。请先在【游戏安装】页面安装Vanilla服务器")
 		}
 		if err := os.Chmod(serverBin, 0755); err != nil {
 			log.Printf("[WARN] 无法设置执行权限: %v", err)
@@ -587,8 +658,7 @@ seed=
 `, room.MaxPlayers, worldPath, roomDir, room.Port, room.Password, worldName, autocreateValue)
 		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
 			log.Printf("[ERROR] 创建配置文件失败: %v", err)
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建配置文件失败"))
-			return
+			return http.StatusInternalServerError, errors.New("创建配置文件失败")
 		}
 		log.Printf("[INFO] 配置文件已创建: %s", configPath)
 		command = serverBin
@@ -613,17 +683,15 @@ seed=
 		}
 		if _, err := os.Stat(exePath); os.IsNotExist(err) {
 			log.Printf("[ERROR] TShock服务器文件不存在: %s", exePath)
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse(
-				"TShock服务器未安装。请先在【游戏安装】页面安装TShock服务器"))
-			return
+			return http.StatusInternalServerError, errors.New(
+				"TShock服务器未安装。请先在【游戏安装】页面安装TShock服务器")
 		}
 		if useDotNet {
 			hasNet6, allRuntimes, err := utils.CheckDotNetRuntime6()
 			if err != nil {
 				errMsg := fmt.Sprintf("无法检测 .NET Runtime: %v", err)
 				log.Printf("[ERROR] %s", errMsg)
-				c.JSON(http.StatusInternalServerError, models.ErrorResponse(errMsg))
-				return
+				return http.StatusInternalServerError, errors.New(errMsg)
 			}
 			if !hasNet6 {
 				installedRuntimes, _ := utils.GetInstalledDotNetRuntimes()
@@ -639,8 +707,7 @@ seed=
 					formatRuntimeList(installedRuntimes),
 					strings.Join(installCommands, "\n"))
 				log.Printf("[ERROR] %s", errMsg)
-				c.JSON(http.StatusInternalServerError, models.ErrorResponse(errMsg))
-				return
+				return http.StatusInternalServerError, errors.New(errMsg)
 			}
 			log.Printf("[INFO] .NET 6.0 Runtime 检查通过")
 			log.Printf("[DEBUG] 已安装的 Runtime:\n%s", allRuntimes)
@@ -687,8 +754,7 @@ seed=
 			})
 			if err != nil {
 				log.Printf("[ERROR] 复制 TShock 目录失败: %v", err)
-				c.JSON(http.StatusInternalServerError, models.ErrorResponse("初始化房间 TShock 目录失败: "+err.Error()))
-				return
+				return http.StatusInternalServerError, errors.New("初始化房间 TShock 目录失败: "+err.Error())
 			}
 			log.Printf("[INFO] TShock 目录已完整复制到房间目录: %s", roomTshockDir)
 			log.Printf("[INFO] 房间现在拥有独立的 TShock 实例（完全隔离）")
@@ -707,6 +773,9 @@ seed=
 				log.Printf("[WARN] 无法复制默认配置: %v", err)
 			}
 		}
+		if err := applyNativeWhitelist(room.ID); err != nil {
+			log.Printf("[WARN] 同步房间白名单失败: %v", err)
+		}
 		configDir := filepath.Join(config.DataDir, "configs")
 		os.MkdirAll(configDir, 0755)
 		configPath := filepath.Join(configDir, fmt.Sprintf("room-%d-tshock.properties", room.ID))
@@ -734,8 +803,7 @@ motd=%s/motd.txt
 			room.Password, worldName, autocreateValue, roomTshockDir)
 		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
 			log.Printf("[ERROR] 创建配置文件失败: %v", err)
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建配置文件失败"))
-			return
+			return http.StatusInternalServerError, errors.New("创建配置文件失败")
 		}
 		log.Printf("[INFO] TShock 配置文件已创建: %s", configPath)
 		roomPluginsDir := filepath.Join(roomTshockDir, "ServerPlugins")
@@ -793,27 +861,21 @@ motd=%s/motd.txt
 		log.Printf("[INFO] TShock 可执行文件: %s", exePath)
 		log.Printf("[INFO] TShock 启动命令: %s %v", command, args)
 	default:
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("不支持的服务器类型"))
-		return
+		return http.StatusBadRequest, errors.New("不支持的服务器类型")
 	}
 	logFile := filepath.Join(config.LogsDir, fmt.Sprintf("room-%d.log", id))
 	log.Printf("[DEBUG] 创建日志文件: %s", logFile)
-	logWriter, err := os.Create(logFile)
+	logWriter, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0644)
 	if err != nil {
 		log.Printf("[ERROR] 创建日志文件失败: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建日志文件失败: "+err.Error()))
-		return
+		return http.StatusInternalServerError, errors.New("创建日志文件失败: "+err.Error())
 	}
-	var workDir string
 	envVars := make(map[string]string)
+	workDir := roomWorkDir(room)
 	switch room.ServerType {
 	case "tmodloader":
-		workDir = filepath.Join(config.ServersDir, "tModLoader")
 		log.Printf("[INFO] tModLoader 工作目录: %s", workDir)
-	case "vanilla":
-		workDir = filepath.Join(config.ServersDir, "vanilla")
 	case "tshock":
-		workDir = roomTshockDir
 		log.Printf("[INFO] TShock 工作目录: %s (房间独立 tshock 目录)", workDir)
 	}
 	log.Printf("[DEBUG] 启动命令: %s %v", command, args)
@@ -822,22 +884,32 @@ motd=%s/motd.txt
 	process, err := utils.StartProcess(id, command, args, workDir, envVars, logWriter, room.ServerType)
 	if err != nil {
 		log.Printf("[ERROR] 启动进程失败: %v", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("启动失败: "+err.Error()))
-		return
+		return http.StatusInternalServerError, errors.New("启动失败: "+err.Error())
 	}
 	time.Sleep(500 * time.Millisecond)
 	if !process.IsRunning() {
 		log.Printf("[ERROR] 房间 %d 进程启动后立即退出，请检查日志文件: %s", id, logFile)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse("服务器启动失败，进程立即退出。请检查游戏文件是否完整，世界文件是否存在"))
-		return
+		return http.StatusInternalServerError, errors.New("服务器启动失败，进程立即退出。请检查游戏文件是否完整，世界文件是否存在")
 	}
 	log.Printf("[DEBUG] 房间 %d 启动成功，PID: %d", id, process.GetPID())
 	if room.ServerType == "tshock" {
 		go captureAdminToken(id, logFile)
 		go captureWorldGenerationProgress(id, logFile)
 	}
+	roomStorage.UpdateStatus(id, "running", process.GetPID())
 	LogRoomStart(id, room.Name, room.ServerType, room.Port)
-	c.JSON(http.StatusOK, models.MessageResponse("房间启动成功"))
+	return http.StatusOK, nil
+}
+func roomWorkDir(room *models.Room) string {
+	switch room.ServerType {
+	case "tmodloader":
+		return filepath.Join(config.ServersDir, "tModLoader")
+	case "vanilla":
+		return filepath.Join(config.ServersDir, "vanilla")
+	case "tshock":
+		return filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", room.ID), "tshock")
+	}
+	return ""
 }
 func StopRoom(c *gin.Context) {
 	idStr := c.Param("id")
@@ -847,17 +919,56 @@ func StopRoom(c *gin.Context) {
 		return
 	}
 	room, err := roomStorage.GetByID(id)
-	if err != nil {
+	if err != nil || room == nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse("房间不存在"))
 		return
 	}
+	if roomSupervisor != nil {
+		roomSupervisor.Reset(id)
+	}
+	setAuditTarget(c, room.Name)
+	setAuditChange(c, roomAuditState(room), gin.H{"status": "stopped", "pid": 0})
+	if room.Status == "crashed" || room.Status == "restarting" {
+		if p, exists := utils.GetProcess(id); !exists || !p.IsRunning() {
+			roomStorage.UpdateStatus(id, "stopped", 0)
+			LogRoomStop(id, room.Name)
+			c.JSON(http.StatusOK, models.MessageResponse("房间停止成功"))
+			return
+		}
+	}
 	if err := utils.StopProcess(id); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("停止失败: "+err.Error()))
 		return
 	}
+	roomStorage.UpdateStatus(id, "stopped", 0)
 	LogRoomStop(id, room.Name)
 	c.JSON(http.StatusOK, models.MessageResponse("房间停止成功"))
 }
+func KillRoom(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的房间ID"))
+		return
+	}
+	room, err := roomStorage.GetByID(id)
+	if err != nil || room == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("房间不存在"))
+		return
+	}
+	if roomSupervisor != nil {
+		roomSupervisor.Reset(id)
+	}
+	setAuditTarget(c, room.Name)
+	setAuditChange(c, roomAuditState(room), gin.H{"status": "stopped", "pid": 0})
+	if err := utils.KillProcess(id); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("强制终止失败: "+err.Error()))
+		return
+	}
+	roomStorage.UpdateStatus(id, "stopped", 0)
+	LogRoomStop(id, room.Name)
+	c.JSON(http.StatusOK, models.MessageResponse("房间已强制终止"))
+}
 func RestartRoom(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -870,6 +981,7 @@ func RestartRoom(c *gin.Context) {
 		c.JSON(http.StatusNotFound, models.ErrorResponse("房间不存在"))
 		return
 	}
+	setAuditChange(c, roomAuditState(room), nil)
 	if p, exists := utils.GetProcess(id); exists && p.IsRunning() {
 		if err := utils.StopProcess(id); err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse("停止失败"))
@@ -0,0 +1,65 @@
+package api
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"terraria-panel/db"
+	"terraria-panel/models"
+	"github.com/gin-gonic/gin"
+)
+func TestRoomAuditRedactsSecrets(t *testing.T) {
+	setupTestDB(t)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		asTestUser(1, models.RoleOwner)(c)
+		c.Next()
+	}, AuditMiddleware())
+	r.POST("/api/rooms", CreateRoom)
+	r.PUT("/api/rooms/:id", UpdateRoom)
+	send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	room := models.Room{Name: "secret-room", ServerType: "tshock", WorldFile: "w.wld", Port: 7777, Password: "hunter2", AdminToken: "/setup 424242"}
+	w := send(http.MethodPost, "/api/rooms", room)
+	testResponseStatus(t, "create", w, http.StatusOK)
+	var created struct {
+		Data models.Room `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	room.Password = "correct-horse"
+	w = send(http.MethodPut, fmt.Sprintf("/api/rooms/%d", created.Data.ID), room)
+	testResponseStatus(t, "update", w, http.StatusOK)
+	rows, err := db.DB.Query("SELECT action, COALESCE(before_value, ''), COALESCE(after_value, '') FROM operation_logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	logged := 0
+	for rows.Next() {
+		var action, before, after string
+		if err := rows.Scan(&action, &before, &after); err != nil {
+			t.Fatal(err)
+		}
+		logged++
+		for _, secret := range []string{"hunter2", "correct-horse", "424242"} {
+			if strings.Contains(before+after, secret) {
+				t.Errorf("%s: audit log contains secret %q", action, secret)
+			}
+		}
+		if !strings.Contains(after, auditRedacted) {
+			t.Errorf("%s: audit log after value %s does not mark redacted fields", action, after)
+		}
+	}
+	if logged != 2 {
+		t.Errorf("recorded %d operations, want 2", logged)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io/fs"
 	"net/http"
 	"terraria-panel/middleware"
+	"terraria-panel/models"
 	"github.com/gin-gonic/gin"
 )
 func SetupRouter(webFS embed.FS) *gin.Engine {
@@ -17,126 +18,227 @@ func SetupRouter(webFS embed.FS) *gin.Engine {
 		{
 			authGroup.GET("/check-users", CheckHasUsers)
 			authGroup.POST("/login", Login)
+			authGroup.POST("/login/2fa", LoginTwoFactor)
 			authGroup.POST("/register", Register)
+			authGroup.POST("/refresh", RefreshToken)
 		}
 		apiGroup.GET("/system/info", GetSystemInfo)
 		apiGroup.GET("/system/cpu", GetCPU)
 		apiGroup.GET("/system/memory", GetMemory)
 		apiGroup.GET("/system/detail", GetSystemInfoDetail)
-		apiGroup.GET("/game/check", CheckGameInstalled)
-		apiGroup.GET("/game/install-info", GetGameInstallInfo)
-		apiGroup.POST("/game/install", InstallGame)
-		apiGroup.POST("/game/uninstall", UninstallGame)
-		apiGroup.GET("/game/install-progress", GetInstallProgress)
-		apiGroup.GET("/rooms", GetRooms)
-		apiGroup.GET("/rooms/worlds", GetWorldsForRoom)
-		apiGroup.POST("/rooms", CreateRoom)
-		apiGroup.GET("/mods", GetMods)
-		apiGroup.GET("/mods/search", SearchWorkshopMods)
-		apiGroup.GET("/mods/downloading", GetDownloadingMods)
-		apiGroup.POST("/mods", InstallMod)
-		apiGroup.GET("/modconfig/profiles", GetModProfiles)
-		apiGroup.POST("/modconfig/profiles", CreateModProfile)
-		apiGroup.PUT("/modconfig/profiles/:id", UpdateModProfile)
-		apiGroup.DELETE("/modconfig/profiles/:id", DeleteModProfile)
-		apiGroup.GET("/steamcmd/check", CheckSteamCMD)
-		apiGroup.GET("/steamcmd/status", GetSteamCMDStatus)
-		apiGroup.POST("/steamcmd/install", InstallSteamCMDAPI)
-		apiGroup.GET("/logs/panel", GetPanelLogs)
-		apiGroup.GET("/logs/server/:id", GetServerLogs)
-		apiGroup.GET("/logs/server/:id/files", GetServerLogFiles)
-		apiGroup.GET("/logs/activity", GetRecentActivities)
-		apiGroup.GET("/tasks", GetTasks)
-		apiGroup.GET("/tasks/:id", GetTask)
-		apiGroup.GET("/tasks/:id/logs", GetTaskLogs)
-		apiGroup.GET("/stats/overview", GetStatsOverview)
-		apiGroup.GET("/stats/rankings", GetRankings)
-		apiGroup.GET("/stats/players", GetPlayerList)
-		apiGroup.GET("/stats/trends", GetTrends)
-		apiGroup.GET("/stats/distribution", GetDistribution)
-		apiGroup.GET("/stats/sessions/:id", GetPlayerSessions)
-		apiGroup.GET("/tshock-db/stats", GetTShockStats)
+		publicGroup := apiGroup.Group("/public")
+		{
+			publicGroup.GET("/status", requireAPIToken(models.APITokenScopeStatus), GetPublicStatus)
+			publicGroup.GET("/players", requireAPIToken(models.APITokenScopePlayers), GetPublicPlayers)
+			publicGroup.GET("/stats/overview", requireAPIToken(models.APITokenScopeStats), GetStatsOverview)
+			publicGroup.GET("/stats/rankings", requireAPIToken(models.APITokenScopeStats), GetRankings)
+			publicGroup.GET("/stats/trends", requireAPIToken(models.APITokenScopeStats), GetTrends)
+		}
 		protected := apiGroup.Group("")
-		protected.Use(middleware.AuthMiddleware())
+		protected.Use(middleware.AuthMiddleware(), CurrentUserMiddleware(), AuditMiddleware())
 		{
+			admin := requireRole(models.RoleAdmin)
+			operator := requireRole(models.RoleOperator)
+			roomView := requireRoomPermission(models.RoomPermissionView)
+			roomOperate := requireRoomPermission(models.RoomPermissionOperate)
+			roomManage := requireRoomPermission(models.RoomPermissionManage)
+			pluginServerView := requirePluginServerPermission(models.RoomPermissionView)
+			pluginServerOperate := requirePluginServerPermission(models.RoomPermissionOperate)
+			pluginServerManage := requirePluginServerPermission(models.RoomPermissionManage)
+			protected.GET("/user/permissions", GetMyPermissions)
+			protected.PUT("/user/password", ChangePassword)
+			protected.GET("/user/2fa", GetTwoFactorStatus)
+			protected.POST("/user/2fa/setup", SetupTwoFactor)
+			protected.POST("/user/2fa/enable", EnableTwoFactor)
+			protected.POST("/user/2fa/disable", DisableTwoFactor)
+			protected.POST("/user/2fa/recovery-codes", RegenerateRecoveryCodes)
+			protected.POST("/auth/logout", Logout)
+			protected.POST("/auth/logout-all", LogoutEverywhere)
+			protected.GET("/auth/sessions", GetSessions)
+			protected.DELETE("/auth/sessions/:id", RevokeSession)
+			protected.GET("/users", admin, GetUsers)
+			protected.POST("/users", admin, CreateUser)
+			protected.PUT("/users/:id", admin, UpdateUser)
+			protected.DELETE("/users/:id", admin, DeleteUser)
+			protected.PUT("/users/:id/permissions", admin, SetUserPermissions)
+			protected.DELETE("/users/:id/permissions/:roomId", admin, DeleteUserPermission)
+			protected.GET("/invitations", admin, GetInvitations)
+			protected.POST("/invitations", admin, CreateInvitation)
+			protected.DELETE("/invitations/:id", admin, DeleteInvitation)
+			protected.GET("/operation-logs", admin, GetOperationLogs)
+			protected.GET("/security/2fa-policy", admin, GetTwoFactorPolicy)
+			protected.PUT("/security/2fa-policy", requireRole(models.RoleOwner), UpdateTwoFactorPolicy)
+			protected.DELETE("/users/:id/2fa", admin, ResetUserTwoFactor)
+			protected.GET("/security/lockouts", admin, GetLoginLockouts)
+			protected.DELETE("/security/lockouts/:id", admin, DeleteLoginLockout)
+			protected.GET("/security/login-attempts", admin, GetLoginAttempts)
+			protected.GET("/api-tokens", admin, GetAPITokens)
+			protected.POST("/api-tokens", admin, CreateAPIToken)
+			protected.DELETE("/api-tokens/:id", admin, RevokeAPIToken)
+			protected.GET("/game/check", CheckGameInstalled)
+			protected.GET("/game/install-info", GetGameInstallInfo)
+			protected.POST("/game/install", admin, InstallGame)
+			protected.POST("/game/uninstall", admin, UninstallGame)
+			protected.GET("/game/install-progress", GetInstallProgress)
+			protected.GET("/steamcmd/check", CheckSteamCMD)
+			protected.GET("/steamcmd/status", GetSteamCMDStatus)
+			protected.POST("/steamcmd/install", admin, InstallSteamCMDAPI)
+			protected.GET("/logs/panel", admin, GetPanelLogs)
+			protected.GET("/logs/server/:id", roomView, GetServerLogs)
+			protected.GET("/logs/server/:id/files", roomView, GetServerLogFiles)
+			protected.GET("/logs/activity", GetRecentActivities)
+			protected.GET("/stats/overview", GetStatsOverview)
+			protected.GET("/stats/rankings", GetRankings)
+			protected.GET("/stats/players", GetPlayerList)
+			protected.GET("/stats/trends", GetTrends)
+			protected.GET("/stats/distribution", GetDistribution)
+			protected.GET("/stats/sessions/:id", GetPlayerSessions)
+			protected.GET("/stats/rooms", GetRoomStats)
+			protected.GET("/stats/concurrency", GetConcurrencyStats)
+			protected.GET("/stats/heatmap", GetActivityHeatmap)
+			protected.GET("/stats/new-returning", GetNewReturningStats)
+			protected.GET("/stats/retention", GetRetentionStats)
+			protected.GET("/chat", SearchChatMessages)
 			protected.GET("/worlds", ListWorlds)
-			protected.POST("/worlds", CreateWorld)
-			protected.DELETE("/worlds/:filename", DeleteWorld)
-			protected.PUT("/rooms/:id", UpdateRoom)
-			protected.DELETE("/rooms/:id", DeleteRoom)
-			protected.POST("/rooms/:id/start", StartRoom)
-			protected.POST("/rooms/:id/stop", StopRoom)
-			protected.POST("/rooms/:id/restart", RestartRoom)
-			protected.DELETE("/rooms/:id/admin-token", DeleteAdminToken)
-			protected.POST("/rooms/:id/admin-token/regenerate", RegenerateAdminToken)
-			protected.GET("/rooms/:id/plugins", GetRoomPlugins)
-			protected.POST("/rooms/:id/plugins", AddRoomPlugin)
-			protected.DELETE("/rooms/:id/plugins/:plugin", DeleteRoomPlugin)
-			protected.POST("/rooms/:id/plugins/copy", CopyPluginFromShared)
+			protected.POST("/worlds", admin, CreateWorld)
+			protected.DELETE("/worlds/:filename", admin, DeleteWorld)
+			protected.GET("/rooms", GetRooms)
+			protected.GET("/rooms/worlds", GetWorldsForRoom)
+			protected.POST("/rooms", admin, CreateRoom)
+			protected.PUT("/rooms/:id", roomManage, UpdateRoom)
+			protected.DELETE("/rooms/:id", roomManage, DeleteRoom)
+			protected.POST("/rooms/:id/start", roomOperate, StartRoom)
+			protected.POST("/rooms/:id/stop", roomOperate, StopRoom)
+			protected.POST("/rooms/:id/restart", roomOperate, RestartRoom)
+			protected.POST("/rooms/:id/kill", roomOperate, KillRoom)
+			protected.POST("/rooms/:id/command", roomOperate, SendRoomCommand)
+			protected.GET("/rooms/:id/console/history", roomOperate, GetConsoleHistory)
+			protected.DELETE("/rooms/:id/admin-token", roomManage, DeleteAdminToken)
+			protected.POST("/rooms/:id/admin-token/regenerate", roomManage, RegenerateAdminToken)
+			protected.GET("/rooms/:id/whitelist", roomView, GetRoomWhitelist)
+			protected.PUT("/rooms/:id/whitelist", roomManage, UpdateRoomWhitelist)
+			protected.POST("/rooms/:id/whitelist/entries", roomManage, AddRoomWhitelistEntry)
+			protected.DELETE("/rooms/:id/whitelist/entries/:entryId", roomManage, DeleteRoomWhitelistEntry)
+			protected.POST("/rooms/:id/whitelist/import", roomManage, ImportRoomWhitelist)
+			protected.GET("/rooms/:id/backup-retention", roomView, GetBackupRetention)
+			protected.PUT("/rooms/:id/backup-retention", roomManage, UpdateBackupRetention)
+			protected.POST("/rooms/:id/backup-retention/dry-run", roomView, DryRunBackupRetention)
+			protected.POST("/rooms/:id/backup-retention/apply", roomManage, ApplyBackupRetention)
+			protected.GET("/rooms/:id/backup-targets", roomView, GetRoomBackupTargets)
+			protected.PUT("/rooms/:id/backup-targets", roomManage, UpdateRoomBackupTargets)
+			protected.GET("/rooms/:id/plugins", roomView, GetRoomPlugins)
+			protected.POST("/rooms/:id/plugins", roomManage, AddRoomPlugin)
+			protected.DELETE("/rooms/:id/plugins/:plugin", roomManage, DeleteRoomPlugin)
+			protected.POST("/rooms/:id/plugins/copy", roomManage, CopyPluginFromShared)
 			protected.GET("/plugins/shared", GetSharedPlugins)
-			protected.GET("/plugin-server", GetPluginServer)
-			protected.POST("/plugin-server/start", StartPluginServer)
-			protected.POST("/plugin-server/stop", StopPluginServer)
-			protected.POST("/plugin-server/restart", RestartPluginServer)
-			protected.POST("/plugin-server/command", SendPluginServerCommand)
-			protected.GET("/plugin-server/logs", GetPluginServerLogs)
-			protected.PUT("/plugin-server/config", UpdatePluginServerConfig)
-			protected.GET("/plugin-server/tshock-config/check", CheckPluginServerConfig)
-			protected.POST("/plugin-server/tshock-config/initialize", InitializePluginServerConfig)
-			protected.GET("/plugin-server/tshock-config", GetPluginServerConfig)
-			protected.PUT("/plugin-server/tshock-config", SavePluginServerConfig)
-			protected.GET("/plugins", GetPluginServerPlugins)
-			protected.POST("/plugins", UploadPluginToServer)
-			protected.DELETE("/plugins/:name", DeletePluginFromServer)
-			protected.PUT("/plugins/:name/toggle", TogglePluginServer)
-			protected.POST("/plugins/:name/copy-to-room", CopyPluginToRoom)
+			protected.GET("/plugin-server", pluginServerView, GetPluginServer)
+			protected.POST("/plugin-server/start", pluginServerOperate, StartPluginServer)
+			protected.POST("/plugin-server/stop", pluginServerOperate, StopPluginServer)
+			protected.POST("/plugin-server/restart", pluginServerOperate, RestartPluginServer)
+			protected.POST("/plugin-server/command", pluginServerOperate, SendPluginServerCommand)
+			protected.GET("/plugin-server/logs", pluginServerView, GetPluginServerLogs)
+			protected.PUT("/plugin-server/config", pluginServerManage, UpdatePluginServerConfig)
+			protected.GET("/plugin-server/tshock-config/check", pluginServerView, CheckPluginServerConfig)
+			protected.POST("/plugin-server/tshock-config/initialize", pluginServerManage, InitializePluginServerConfig)
+			protected.GET("/plugin-server/tshock-config", pluginServerManage, GetPluginServerConfig)
+			protected.PUT("/plugin-server/tshock-config", pluginServerManage, SavePluginServerConfig)
+			protected.GET("/plugins", pluginServerView, GetPluginServerPlugins)
+			protected.POST("/plugins", pluginServerManage, UploadPluginToServer)
+			protected.DELETE("/plugins/:name", pluginServerManage, DeletePluginFromServer)
+			protected.PUT("/plugins/:name/toggle", pluginServerManage, TogglePluginServer)
+			protected.POST("/plugins/:name/copy-to-room", admin, CopyPluginToRoom)
 			protected.GET("/players", GetPlayers)
 			protected.GET("/players/banned", GetBannedPlayers)
-			protected.POST("/players/:id/kick", KickPlayer)
-			protected.POST("/players/:id/ban", BanPlayer)
-			protected.POST("/players/:id/unban", UnbanPlayer)
-			protected.GET("/tshock-db/users", GetTShockUsers)
-			protected.PUT("/tshock-db/users", UpdateTShockUser)
-			protected.DELETE("/tshock-db/users/:id", DeleteTShockUser)
-			protected.GET("/tshock-db/bans", GetTShockBans)
-			protected.POST("/tshock-db/bans", AddTShockBan)
-			protected.DELETE("/tshock-db/bans/:ticketNumber", RemoveTShockBan)
-			protected.GET("/tshock-db/regions", GetTShockRegions)
-			protected.GET("/tshock-db/warps", GetTShockWarps)
-			protected.GET("/tshock-db/logs", GetTShockLogs)
+			protected.GET("/players/:id/profile", operator, GetPlayerProfile)
+			protected.GET("/players/:id/infractions", operator, GetPlayerInfractions)
+			protected.POST("/players/:id/infractions", operator, CreatePlayerInfraction)
+			protected.GET("/players/:id/links", operator, GetPlayerLinks)
+			protected.GET("/players/:id/links/graph", operator, GetPlayerLinkGraph)
+			protected.POST("/players/:id/kick", operator, KickPlayer)
+			protected.POST("/players/:id/ban", operator, BanPlayer)
+			protected.POST("/players/:id/unban", operator, UnbanPlayer)
+			protected.GET("/whitelist-groups", operator, GetWhitelistGroups)
+			protected.POST("/whitelist-groups", admin, CreateWhitelistGroup)
+			protected.DELETE("/whitelist-groups/:id", admin, DeleteWhitelistGroup)
+			protected.GET("/whitelist-groups/:id/entries", operator, GetWhitelistGroupEntries)
+			protected.POST("/whitelist-groups/:id/entries", admin, AddWhitelistGroupEntry)
+			protected.DELETE("/whitelist-groups/:id/entries/:entryId", admin, DeleteWhitelistGroupEntry)
+			protected.POST("/whitelist-groups/:id/import", admin, ImportWhitelistGroup)
+			protected.GET("/network-bans", operator, GetNetworkBans)
+			protected.POST("/network-bans/sync", admin, SyncNetworkBans)
+			protected.GET("/infractions", operator, GetInfractions)
+			protected.POST("/infractions", operator, CreateInfraction)
+			protected.GET("/infractions/policy", operator, GetInfractionPolicy)
+			protected.PUT("/infractions/policy", admin, UpdateInfractionPolicy)
+			protected.PUT("/infractions/:id", operator, UpdateInfraction)
+			protected.POST("/infractions/:id/revoke", operator, RevokeInfraction)
+			protected.DELETE("/infractions/:id", operator, DeleteInfraction)
+			protected.GET("/tshock-db/stats", pluginServerView, GetTShockStats)
+			protected.GET("/tshock-db/users", pluginServerView, GetTShockUsers)
+			protected.PUT("/tshock-db/users", admin, UpdateTShockUser)
+			protected.DELETE("/tshock-db/users/:id", admin, DeleteTShockUser)
+			protected.GET("/tshock-db/bans", pluginServerView, GetTShockBans)
+			protected.POST("/tshock-db/bans", admin, AddTShockBan)
+			protected.DELETE("/tshock-db/bans/:ticketNumber", admin, RemoveTShockBan)
+			protected.GET("/tshock-db/regions", pluginServerView, GetTShockRegions)
+			protected.GET("/tshock-db/warps", pluginServerView, GetTShockWarps)
+			protected.GET("/tshock-db/logs", pluginServerView, GetTShockLogs)
 			protected.GET("/user/server-mode", GetServerMode)
 			protected.PUT("/user/server-mode", UpdateServerMode)
-			protected.GET("/plugin-server/tshock-version", DetectTShockVersion)
-			protected.GET("/files", ListFiles)
-			protected.GET("/files/read", ReadFile)
-			protected.POST("/files/write", WriteFile)
-			protected.POST("/files/upload", UploadFile)
-			protected.DELETE("/files", DeleteFile)
+			protected.GET("/plugin-server/tshock-version", pluginServerView, DetectTShockVersion)
+			protected.GET("/files", admin, ListFiles)
+			protected.GET("/files/read", admin, ReadFile)
+			protected.POST("/files/write", admin, WriteFile)
+			protected.POST("/files/upload", admin, UploadFile)
+			protected.DELETE("/files", admin, DeleteFile)
 			protected.GET("/backups", GetBackups)
 			protected.POST("/backups", CreateBackup)
-			protected.POST("/backups/:id/restore", RestoreBackup)
-			protected.DELETE("/backups/:id", DeleteBackup)
-			protected.GET("/backups/:id/download", DownloadBackup)
-			protected.POST("/tasks", CreateTask)
-			protected.PUT("/tasks/:id", UpdateTask)
-			protected.DELETE("/tasks/:id", DeleteTask)
-			protected.POST("/tasks/:id/toggle", ToggleTask)
-			protected.POST("/tasks/:id/execute", ExecuteTask)
-			protected.DELETE("/tasks/:id/logs", DeleteTaskLogs)
-			protected.POST("/mods/upload", UploadMod)
-			protected.POST("/mods/:name/enable", EnableMod)
-			protected.POST("/mods/:name/disable", DisableMod)
-			protected.DELETE("/mods/:name", DeleteMod)
+			protected.GET("/backups/check", admin, CheckBackups)
+			protected.POST("/backups/orphans/import", admin, ImportOrphanBackups)
+			protected.POST("/backups/gc", admin, CollectBackupGarbage)
+			protected.POST("/backups/:id/restore", requireBackupPermission(models.RoomPermissionManage), RestoreBackup)
+			protected.DELETE("/backups/:id", requireBackupPermission(models.RoomPermissionManage), DeleteBackup)
+			protected.PUT("/backups/:id/pin", requireBackupPermission(models.RoomPermissionManage), PinBackup)
+			protected.POST("/backups/:id/replicate", requireBackupPermission(models.RoomPermissionManage), ReplicateBackup)
+			protected.GET("/backups/:id/download", requireBackupPermission(models.RoomPermissionManage), DownloadBackup)
+			protected.GET("/backup-targets", admin, GetBackupTargets)
+			protected.POST("/backup-targets", admin, CreateBackupTarget)
+			protected.PUT("/backup-targets/:id", admin, UpdateBackupTarget)
+			protected.DELETE("/backup-targets/:id", admin, DeleteBackupTarget)
+			protected.POST("/backup-targets/:id/test", admin, ProbeBackupTarget)
+			protected.GET("/tasks", GetTasks)
+			protected.GET("/tasks/:id", GetTask)
+			protected.GET("/tasks/:id/logs", GetTaskLogs)
+			protected.POST("/tasks", admin, CreateTask)
+			protected.PUT("/tasks/:id", admin, UpdateTask)
+			protected.DELETE("/tasks/:id", admin, DeleteTask)
+			protected.POST("/tasks/:id/toggle", admin, ToggleTask)
+			protected.POST("/tasks/:id/execute", admin, ExecuteTask)
+			protected.DELETE("/tasks/:id/logs", admin, DeleteTaskLogs)
+			protected.GET("/mods", GetMods)
+			protected.GET("/mods/search", SearchWorkshopMods)
+			protected.GET("/mods/downloading", GetDownloadingMods)
+			protected.POST("/mods", admin, InstallMod)
+			protected.POST("/mods/upload", admin, UploadMod)
+			protected.POST("/mods/:name/enable", admin, EnableMod)
+			protected.POST("/mods/:name/disable", admin, DisableMod)
+			protected.DELETE("/mods/:name", admin, DeleteMod)
+			protected.GET("/modconfig/profiles", GetModProfiles)
+			protected.POST("/modconfig/profiles", admin, CreateModProfile)
+			protected.PUT("/modconfig/profiles/:id", admin, UpdateModProfile)
+			protected.DELETE("/modconfig/profiles/:id", admin, DeleteModProfile)
 			protected.GET("/plugins/store", GetPluginStore)
-			protected.POST("/rooms/:id/plugins/store/:pluginId/install", InstallPluginFromStore)
+			protected.POST("/rooms/:id/plugins/store/:pluginId/install", roomManage, InstallPluginFromStore)
 			protected.GET("/plugins/install-progress/:progressId", GetPluginInstallProgress)
-			protected.GET("/plugin-configs", GetPluginConfigs)
-			protected.GET("/plugin-configs/:filename", GetPluginConfigContent)
-			protected.PUT("/plugin-configs/:filename", SavePluginConfig)
+			protected.GET("/plugin-configs", pluginServerView, GetPluginConfigs)
+			protected.GET("/plugin-configs/:filename", pluginServerManage, GetPluginConfigContent)
+			protected.PUT("/plugin-configs/:filename", pluginServerManage, SavePluginConfig)
 		}
 		apiGroup.GET("/ws", HandleWebSocket)
 		apiGroup.GET("/ws/rooms/:id/logs", HandleRoomLogsWS)
 		apiGroup.GET("/ws/logs/:id", HandleRoomLogsWS)
+		apiGroup.GET("/ws/rooms/:id/console", HandleRoomLogsWS)
+		apiGroup.GET("/ws/chat", HandleChatStreamWS)
 	}
 	distFS, err := fs.Sub(webFS, "web/dist")
 	if err != nil {
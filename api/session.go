@@ -0,0 +1,273 @@
+package api
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"terraria-panel/middleware"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"time"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+var (
+	userSessionStorage storage.UserSessionStorage
+	refreshTokenTTL    = 30 * 24 * time.Hour
+)
+func InitSessionStorage(db *sql.DB, ttl time.Duration) {
+	userSessionStorage = storage.NewSQLiteUserSessionStorage(db)
+	if ttl > 0 {
+		refreshTokenTTL = ttl
+	}
+	if removed, err := userSessionStorage.DeleteExpired(time.Now().Add(-7 * 24 * time.Hour)); err != nil {
+		log.Printf("[Auth] Failed to clean up expired sessions: %v", err)
+	} else if removed > 0 {
+		log.Printf("[Auth] Removed %d expired sessions", removed)
+	}
+	middleware.SetSessionValidator(func(claims *middleware.Claims) bool {
+		if claims.SessionID == 0 {
+			return false
+		}
+		session, err := userSessionStorage.GetByID(claims.SessionID)
+		if err != nil || session == nil {
+			return false
+		}
+		return session.UserID == claims.UserID && session.IsActive()
+	})
+}
+func generateRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(buf)
+	return token, hashAPIToken(token), nil
+}
+func issueSession(c *gin.Context, user *models.User) (gin.H, error) {
+	refreshToken, refreshHash, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	userAgent := c.GetHeader("User-Agent")
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	session := &models.UserSession{
+		UserID:      user.ID,
+		RefreshHash: refreshHash,
+		Device:      describeDevice(userAgent),
+		UserAgent:   userAgent,
+		IPAddress:   c.ClientIP(),
+		ExpiresAt:   time.Now().Add(refreshTokenTTL),
+	}
+	if err := userSessionStorage.Create(session); err != nil {
+		return nil, err
+	}
+	return sessionTokens(user, session.ID, refreshToken)
+}
+func sessionTokens(user *models.User, sessionID int, refreshToken string) (gin.H, error) {
+	token, err := middleware.GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+		"expiresIn":    int(middleware.AccessTokenTTL().Seconds()),
+		"sessionId":    sessionID,
+		"user": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"role":     user.Role,
+		},
+	}, nil
+}
+func describeDevice(userAgent string) string {
+	if userAgent == "" {
+		return "未知设备"
+	}
+	ua := strings.ToLower(userAgent)
+	browser := "未知浏览器"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "curl/"):
+		browser = "curl"
+	}
+	system := "未知系统"
+	switch {
+	case strings.Contains(ua, "android"):
+		system = "Android"
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		system = "iOS"
+	case strings.Contains(ua, "windows"):
+		system = "Windows"
+	case strings.Contains(ua, "mac os"):
+		system = "macOS"
+	case strings.Contains(ua, "linux"):
+		system = "Linux"
+	}
+	return browser + " / " + system
+}
+func revokeUserSessions(userID int) {
+	if userSessionStorage == nil {
+		return
+	}
+	revoked, err := userSessionStorage.RevokeByUser(userID)
+	if err != nil {
+		log.Printf("[Auth] Failed to revoke sessions for user %d: %v", userID, err)
+		return
+	}
+	log.Printf("[Auth] Revoked %d sessions for user %d", revoked, userID)
+}
+func RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误"))
+		return
+	}
+	session, err := userSessionStorage.GetByRefreshHash(hashAPIToken(req.RefreshToken))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("服务器错误"))
+		return
+	}
+	if session == nil || !session.IsActive() {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("刷新令牌无效或已过期，请重新登录"))
+		return
+	}
+	user, err := userStorage.GetByID(session.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("服务器错误"))
+		return
+	}
+	if user == nil {
+		userSessionStorage.Revoke(session.ID)
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("用户不存在或已被删除"))
+		return
+	}
+	refreshToken, refreshHash, err := generateRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成令牌失败"))
+		return
+	}
+	if err := userSessionStorage.Rotate(session.ID, refreshHash, c.ClientIP(), time.Now().Add(refreshTokenTTL)); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("刷新会话失败"))
+		return
+	}
+	data, err := sessionTokens(user, session.ID, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成令牌失败"))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(data))
+}
+func GetSessions(c *gin.Context) {
+	sessions, err := userSessionStorage.GetActiveByUser(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取会话列表失败: "+err.Error()))
+		return
+	}
+	current := c.GetInt("session_id")
+	for _, session := range sessions {
+		session.Current = session.ID == current
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(sessions))
+}
+func RevokeSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的会话ID"))
+		return
+	}
+	session, err := userSessionStorage.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取会话失败: "+err.Error()))
+		return
+	}
+	if session == nil || session.UserID != c.GetInt("user_id") {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("会话不存在"))
+		return
+	}
+	if err := userSessionStorage.Revoke(id); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("注销会话失败: "+err.Error()))
+		return
+	}
+	setAuditTarget(c, session.Device+" ("+session.IPAddress+")")
+	c.JSON(http.StatusOK, models.MessageResponse("会话已注销"))
+}
+func Logout(c *gin.Context) {
+	if err := userSessionStorage.Revoke(c.GetInt("session_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("退出登录失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.MessageResponse("已退出登录"))
+}
+func LogoutEverywhere(c *gin.Context) {
+	revoked, err := userSessionStorage.RevokeByUser(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("注销全部会话失败: "+err.Error()))
+		return
+	}
+	setAuditDetails(c, fmt.Sprintf("注销了 %d 个会话", revoked))
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: fmt.Sprintf("已在所有设备上退出登录（%d 个会话）", revoked),
+		Data:    gin.H{"revoked": revoked},
+	})
+}
+func ChangePassword(c *gin.Context) {
+	var req struct {
+		OldPassword string `json:"oldPassword" binding:"required"`
+		NewPassword string `json:"newPassword" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误"))
+		return
+	}
+	user, err := userStorage.GetByID(c.GetInt("user_id"))
+	if err != nil || user == nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取用户信息失败"))
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword)); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("原密码错误"))
+		return
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("密码加密失败"))
+		return
+	}
+	user.Password = string(hashedPassword)
+	if err := userStorage.Update(user); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("修改密码失败: "+err.Error()))
+		return
+	}
+	revokeUserSessions(user.ID)
+	setAuditTarget(c, user.Username)
+	data, err := issueSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusOK, models.MessageResponse("密码已修改，所有会话已失效，请重新登录"))
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "密码已修改，其他设备上的会话已全部失效",
+		Data:    data,
+	})
+}
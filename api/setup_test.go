@@ -0,0 +1,77 @@
+package api
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"terraria-panel/config"
+	"terraria-panel/db"
+	"terraria-panel/middleware"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+func setupTestDB(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	dataDir, logsDir, serversDir := config.DataDir, config.LogsDir, config.ServersDir
+	config.DataDir, config.LogsDir, config.ServersDir = dir, filepath.Join(dir, "logs"), filepath.Join(dir, "servers")
+	if err := db.Init(filepath.Join(dir, "panel.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		config.DataDir, config.LogsDir, config.ServersDir = dataDir, logsDir, serversDir
+	})
+	SetRoomStorage(storage.NewSQLiteRoomStorage(db.DB))
+	SetUserStorage(storage.NewSQLiteUserStorage(db.DB))
+	InitModerationStorage(db.DB)
+	InitAccessControl(db.DB)
+	InitAuditStorage(db.DB)
+	InitStatsStorage(db.DB)
+	InitSessionStorage(db.DB, 0)
+	if err := middleware.InitJWT("api-test-secret-0123456789abcdef", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+func createTestRoom(t *testing.T, name, serverType string) *models.Room {
+	room := &models.Room{Name: name, ServerType: serverType, WorldFile: name + ".wld", Port: 7777, Status: "stopped"}
+	if err := roomStorage.Create(room); err != nil {
+		t.Fatal(err)
+	}
+	return room
+}
+func performTestRequest(handler gin.HandlerFunc, method, path string, params gin.Params, body interface{}, setup func(c *gin.Context)) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, path, reader)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	if setup != nil {
+		setup(c)
+	}
+	handler(c)
+	return w
+}
+func asTestUser(userID int, role string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("role", role)
+		c.Set("username", "tester")
+	}
+}
+func testResponseStatus(t *testing.T, name string, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Errorf("%s: status %d, want %d (body %s)", name, w.Code, want, w.Body.String())
+	}
+}
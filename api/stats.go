@@ -2,7 +2,9 @@ package api
 import (
 	"database/sql"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"terraria-panel/models"
 	"terraria-panel/storage"
 	"time"
@@ -20,15 +22,33 @@ func InitStatsStorage(database *sql.DB) {
 	statsStorage = storage.NewSQLitePlayerStatsStorage(database)
 	dailyStatsStorage = storage.NewSQLitePlayerDailyStatsStorage(database)
 }
+func statsRoomIDs(c *gin.Context) ([]int, bool) {
+	if token := currentAPIToken(c); token != nil {
+		return token.RoomIDs, len(token.RoomIDs) == 0
+	}
+	return viewableRoomIDs(c)
+}
+func statsRoomScope(c *gin.Context, column string) (string, []interface{}) {
+	roomIDs, all := statsRoomIDs(c)
+	if all {
+		return "", nil
+	}
+	args := make([]interface{}, len(roomIDs))
+	for i, roomID := range roomIDs {
+		args[i] = roomID
+	}
+	return " AND " + column + " IN (" + strings.TrimSuffix(strings.Repeat("?,", len(args)), ",") + ")", args
+}
 func GetStatsOverview(c *gin.Context) {
+	scope, scopeArgs := statsRoomScope(c, "room_id")
 	var totalPlayers int
-	err := statsDB.QueryRow("SELECT COUNT(*) FROM players").Scan(&totalPlayers)
+	err := statsDB.QueryRow("SELECT COUNT(*) FROM players WHERE 1 = 1"+scope, scopeArgs...).Scan(&totalPlayers)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to get total players"))
 		return
 	}
 	var onlinePlayers int
-	err = statsDB.QueryRow("SELECT COUNT(*) FROM players WHERE status = 'online'").Scan(&onlinePlayers)
+	err = statsDB.QueryRow("SELECT COUNT(*) FROM players WHERE status = 'online'"+scope, scopeArgs...).Scan(&onlinePlayers)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to get online players"))
 		return
@@ -39,8 +59,8 @@ func GetStatsOverview(c *gin.Context) {
 		SELECT COUNT(DISTINCT player_id)
 		FROM player_sessions
 		WHERE DATE(join_time) = ?
-	`
-	err = statsDB.QueryRow(query, today).Scan(&todayActive)
+	` + scope
+	err = statsDB.QueryRow(query, append([]interface{}{today}, scopeArgs...)...).Scan(&todayActive)
 	if err != nil {
 		todayActive = 0
 	}
@@ -50,8 +70,8 @@ func GetStatsOverview(c *gin.Context) {
 		SELECT COUNT(DISTINCT player_id)
 		FROM player_sessions
 		WHERE DATE(join_time) >= ?
-	`
-	err = statsDB.QueryRow(query, weekAgo).Scan(&weekActive)
+	` + scope
+	err = statsDB.QueryRow(query, append([]interface{}{weekAgo}, scopeArgs...)...).Scan(&weekActive)
 	if err != nil {
 		weekActive = 0
 	}
@@ -61,13 +81,13 @@ func GetStatsOverview(c *gin.Context) {
 		SELECT COUNT(DISTINCT player_id)
 		FROM player_sessions
 		WHERE DATE(join_time) >= ?
-	`
-	err = statsDB.QueryRow(query, monthAgo).Scan(&monthActive)
+	` + scope
+	err = statsDB.QueryRow(query, append([]interface{}{monthAgo}, scopeArgs...)...).Scan(&monthActive)
 	if err != nil {
 		monthActive = 0
 	}
 	var bannedPlayers int
-	err = statsDB.QueryRow("SELECT COUNT(*) FROM players WHERE is_banned = 1").Scan(&bannedPlayers)
+	err = statsDB.QueryRow("SELECT COUNT(*) FROM players WHERE is_banned = 1"+scope, scopeArgs...).Scan(&bannedPlayers)
 	if err != nil {
 		bannedPlayers = 0
 	}
@@ -81,6 +101,57 @@ func GetStatsOverview(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, models.SuccessResponse(overview))
 }
+func loadScopedRankingStats(rankType string, limit int, scope string, scopeArgs []interface{}) ([]*models.PlayerStats, error) {
+	rows, err := statsDB.Query(`
+		SELECT s.player_id, p.name, COALESCE(s.duration, 0), s.join_time
+		FROM player_sessions s
+		JOIN players p ON p.id = s.player_id
+		WHERE 1 = 1
+	`+scope, scopeArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byPlayer := make(map[int]*models.PlayerStats)
+	statsList := []*models.PlayerStats{}
+	for rows.Next() {
+		var playerID, duration int
+		var name string
+		var joinTime time.Time
+		if err := rows.Scan(&playerID, &name, &duration, &joinTime); err != nil {
+			return nil, err
+		}
+		stats, exists := byPlayer[playerID]
+		if !exists {
+			stats = &models.PlayerStats{PlayerID: playerID, PlayerName: name}
+			byPlayer[playerID] = stats
+			statsList = append(statsList, stats)
+		}
+		stats.TotalPlayTime += duration
+		stats.LoginCount++
+		if stats.LastLoginTime == nil || joinTime.After(*stats.LastLoginTime) {
+			lastLogin := joinTime
+			stats.LastLoginTime = &lastLogin
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(statsList, func(i, j int) bool {
+		switch rankType {
+		case "logincount":
+			return statsList[i].LoginCount > statsList[j].LoginCount
+		case "recent":
+			return statsList[i].LastLoginTime.After(*statsList[j].LastLoginTime)
+		default:
+			return statsList[i].TotalPlayTime > statsList[j].TotalPlayTime
+		}
+	})
+	if len(statsList) > limit {
+		statsList = statsList[:limit]
+	}
+	return statsList, nil
+}
 func GetRankings(c *gin.Context) {
 	rankType := c.DefaultQuery("type", "playtime")
 	limitStr := c.DefaultQuery("limit", "10")
@@ -96,64 +167,47 @@ func GetRankings(c *gin.Context) {
 		}))
 		return
 	}
-	if rankType == "playtime" {
-		statsList, err := statsStorage.GetTopByPlayTime(limit)
-		if err != nil {
-			c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
-				"rankings": rankings,
-				"type":     rankType,
-			}))
-			return
-		}
-		for i, stats := range statsList {
-			rankings = append(rankings, &models.PlayerRanking{
-				Rank:       i + 1,
-				PlayerID:   stats.PlayerID,
-				PlayerName: stats.PlayerName,
-				Value:      stats.TotalPlayTime,
-				ValueStr:   stats.GetPlayTimeString(),
-			})
-		}
-	} else if rankType == "logincount" {
-		statsList, err := statsStorage.GetTopByLoginCount(limit)
-		if err != nil {
-			c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
-				"rankings": rankings,
-				"type":     rankType,
-			}))
-			return
-		}
-		for i, stats := range statsList {
-			rankings = append(rankings, &models.PlayerRanking{
-				Rank:       i + 1,
-				PlayerID:   stats.PlayerID,
-				PlayerName: stats.PlayerName,
-				Value:      stats.LoginCount,
-				ValueStr:   strconv.Itoa(stats.LoginCount) + " 次",
-			})
-		}
-	} else if rankType == "recent" {
-		statsList, err := statsStorage.GetRecentActive(limit)
-		if err != nil {
-			c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
-				"rankings": rankings,
-				"type":     rankType,
-			}))
-			return
+	var statsList []*models.PlayerStats
+	scope, scopeArgs := statsRoomScope(c, "s.room_id")
+	switch {
+	case scope != "":
+		statsList, err = loadScopedRankingStats(rankType, limit, scope, scopeArgs)
+	case rankType == "playtime":
+		statsList, err = statsStorage.GetTopByPlayTime(limit)
+	case rankType == "logincount":
+		statsList, err = statsStorage.GetTopByLoginCount(limit)
+	case rankType == "recent":
+		statsList, err = statsStorage.GetRecentActive(limit)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+			"rankings": rankings,
+			"type":     rankType,
+		}))
+		return
+	}
+	for i, stats := range statsList {
+		ranking := &models.PlayerRanking{
+			Rank:       i + 1,
+			PlayerID:   stats.PlayerID,
+			PlayerName: stats.PlayerName,
 		}
-		for i, stats := range statsList {
-			valueStr := "从未登录"
+		switch rankType {
+		case "playtime":
+			ranking.Value = stats.TotalPlayTime
+			ranking.ValueStr = stats.GetPlayTimeString()
+		case "logincount":
+			ranking.Value = stats.LoginCount
+			ranking.ValueStr = strconv.Itoa(stats.LoginCount) + " 次"
+		case "recent":
+			ranking.ValueStr = "从未登录"
 			if stats.LastLoginTime != nil {
-				valueStr = stats.LastLoginTime.Format("2006-01-02 15:04:05")
+				ranking.ValueStr = stats.LastLoginTime.Format("2006-01-02 15:04:05")
 			}
-			rankings = append(rankings, &models.PlayerRanking{
-				Rank:       i + 1,
-				PlayerID:   stats.PlayerID,
-				PlayerName: stats.PlayerName,
-				Value:      0,
-				ValueStr:   valueStr,
-			})
+		default:
+			continue
 		}
+		rankings = append(rankings, ranking)
 	}
 	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
 		"rankings": rankings,
@@ -186,7 +240,10 @@ func GetPlayerList(c *gin.Context) {
 		FROM players p
 		LEFT JOIN rooms r ON p.room_id = r.id
 		LEFT JOIN player_stats ps ON p.id = ps.player_id
+		WHERE 1 = 1
 	`
+	scope, scopeArgs := statsRoomScope(c, "p.room_id")
+	query += scope
 	orderClause := " ORDER BY "
 	switch sortBy {
 	case "totalPlayTime":
@@ -207,13 +264,13 @@ func GetPlayerList(c *gin.Context) {
 	}
 	query += orderClause + " LIMIT ? OFFSET ?"
 	var total int
-	countQuery := `SELECT COUNT(*) FROM players`
-	err = statsDB.QueryRow(countQuery).Scan(&total)
+	countQuery := `SELECT COUNT(*) FROM players p WHERE 1 = 1` + scope
+	err = statsDB.QueryRow(countQuery, scopeArgs...).Scan(&total)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to get total count"))
 		return
 	}
-	rows, err := statsDB.Query(query, pageSize, offset)
+	rows, err := statsDB.Query(query, append(scopeArgs, pageSize, offset)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to get players"))
 		return
@@ -269,7 +326,12 @@ func GetTrends(c *gin.Context) {
 		c.JSON(http.StatusOK, models.SuccessResponse(trend))
 		return
 	}
-	dailyStats, err := dailyStatsStorage.GetRecent(days)
+	var dailyStats []*models.PlayerDailyStats
+	if scope, scopeArgs := statsRoomScope(c, "room_id"); scope != "" {
+		dailyStats, err = scopedDailyStats(days, scope, scopeArgs)
+	} else {
+		dailyStats, err = dailyStatsStorage.GetRecent(days)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, models.SuccessResponse(trend))
 		return
@@ -293,15 +355,48 @@ func GetTrends(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, models.SuccessResponse(trend))
 }
+func scopedDailyStats(days int, scope string, scopeArgs []interface{}) ([]*models.PlayerDailyStats, error) {
+	now := time.Now()
+	spans, err := loadSessionSpans(dayStart(now).AddDate(0, 0, -(days-1)), now, scope, scopeArgs)
+	if err != nil {
+		return nil, err
+	}
+	playTime := make(map[string]time.Duration)
+	for _, span := range spans {
+		for day := dayStart(span.start); day.Before(span.end); day = day.AddDate(0, 0, 1) {
+			start, end := span.start, span.end
+			if start.Before(day) {
+				start = day
+			}
+			if next := day.AddDate(0, 0, 1); end.After(next) {
+				end = next
+			}
+			playTime[day.Format("2006-01-02")] += end.Sub(start)
+		}
+	}
+	dailyStats := []*models.PlayerDailyStats{}
+	for date, players := range activeDays(spans) {
+		dailyStats = append(dailyStats, &models.PlayerDailyStats{
+			Date:          date,
+			ActivePlayers: len(players),
+			TotalPlayTime: int(playTime[date].Seconds()),
+		})
+	}
+	return dailyStats, nil
+}
 func GetDistribution(c *gin.Context) {
 	query := `
 		SELECT r.id, r.name, COUNT(p.id) as player_count
 		FROM rooms r
 		LEFT JOIN players p ON r.id = p.room_id AND p.status != 'offline'
+		WHERE 1 = 1
+	`
+	scope, scopeArgs := statsRoomScope(c, "r.id")
+	query += scope + `
 		GROUP BY r.id, r.name
 		ORDER BY player_count DESC
 	`
-	rows, err := statsDB.Query(query)
+	rows, err := statsDB.Query(query, scopeArgs...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse("Failed to get distribution"))
 		return
@@ -319,14 +414,16 @@ func GetDistribution(c *gin.Context) {
 	c.JSON(http.StatusOK, models.SuccessResponse(distribution))
 }
 func GetPlayerSessions(c *gin.Context) {
-	playerIDStr := c.Param("id")
 	pageStr := c.DefaultQuery("page", "1")
 	pageSizeStr := c.DefaultQuery("pageSize", "20")
-	playerID, err := strconv.Atoi(playerIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse("Invalid player ID"))
+	player, ok := loadPlayerParam(c)
+	if !ok {
+		return
+	}
+	if !checkRoomPermission(c, player.RoomID, models.RoomPermissionView) {
 		return
 	}
+	playerID := player.ID
 	page, err := strconv.Atoi(pageStr)
 	if err != nil || page <= 0 {
 		page = 1
@@ -0,0 +1,99 @@
+package api
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"terraria-panel/db"
+	"terraria-panel/models"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+func seedRoomActivity(t *testing.T, room *models.Room) int {
+	result, err := db.DB.Exec("INSERT INTO players (name, ip, room_id, status) VALUES (?, '10.0.0.1', ?, 'online')", room.Name+"-player", room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playerID, _ := result.LastInsertId()
+	if _, err := db.DB.Exec("INSERT INTO player_sessions (player_id, room_id, join_time, duration, ip_address) VALUES (?, ?, ?, 0, '10.0.0.1')", playerID, room.ID, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	roomID := room.ID
+	if err := LogActivity(models.ActivityTypeSystem, room.Name+" started", "", &roomID, "", models.ColorBlue); err != nil {
+		t.Fatal(err)
+	}
+	return int(playerID)
+}
+func statsTestData(t *testing.T, handler gin.HandlerFunc, userID int, role string, params gin.Params, out interface{}) int {
+	t.Helper()
+	w := performTestRequest(handler, http.MethodGet, "/", params, nil, asTestUser(userID, role))
+	if w.Code == http.StatusOK && out != nil {
+		var response struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(response.Data, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code
+}
+func TestStatsAndActivityAreFilteredByRoomPermission(t *testing.T) {
+	setupTestDB(t)
+	visible := createTestRoom(t, "visible", "vanilla")
+	hidden := createTestRoom(t, "hidden", "vanilla")
+	seedRoomActivity(t, visible)
+	hiddenPlayer := seedRoomActivity(t, hidden)
+	const guest = 5
+	if err := roomPermissionStorage.Set(&models.RoomGrant{UserID: guest, RoomID: visible.ID, Permission: models.RoomPermissionView, GrantedBy: "owner"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		role string
+		want int
+	}{{"guest", 1}, {models.RoleAdmin, 2}} {
+		var overview models.StatsOverview
+		statsTestData(t, GetStatsOverview, guest, tt.role, nil, &overview)
+		if overview.TotalPlayers != tt.want || overview.OnlinePlayers != tt.want {
+			t.Errorf("%s: overview counts %d players (%d online), want %d", tt.role, overview.TotalPlayers, overview.OnlinePlayers, tt.want)
+		}
+		var list struct {
+			Total int `json:"total"`
+		}
+		statsTestData(t, GetPlayerList, guest, tt.role, nil, &list)
+		if list.Total != tt.want {
+			t.Errorf("%s: player list has %d players, want %d", tt.role, list.Total, tt.want)
+		}
+		var distribution []models.RoomDistribution
+		statsTestData(t, GetDistribution, guest, tt.role, nil, &distribution)
+		if len(distribution) != tt.want {
+			t.Errorf("%s: distribution covers %d rooms, want %d", tt.role, len(distribution), tt.want)
+		}
+		var activities []models.ActivityLog
+		statsTestData(t, GetRecentActivities, guest, tt.role, nil, &activities)
+		if len(activities) != tt.want {
+			t.Errorf("%s: %d recent activities, want %d", tt.role, len(activities), tt.want)
+		}
+		for _, activity := range activities {
+			if tt.role == "guest" && (activity.RoomID == nil || *activity.RoomID != visible.ID) {
+				t.Errorf("guest sees activity %q of another room", activity.Title)
+			}
+		}
+		var trend models.TrendData
+		statsTestData(t, GetTrends, guest, tt.role, nil, &trend)
+		if active := trend.ActivePlayers[len(trend.ActivePlayers)-1]; tt.role == "guest" && active != 1 {
+			t.Errorf("guest: today's trend counts %d active players, want 1", active)
+		}
+	}
+	params := gin.Params{{Key: "id", Value: fmt.Sprint(hiddenPlayer)}}
+	if code := statsTestData(t, GetPlayerSessions, guest, "guest", params, nil); code != http.StatusForbidden {
+		t.Errorf("guest: sessions of a hidden room's player status %d, want %d", code, http.StatusForbidden)
+	}
+	if code := statsTestData(t, GetPlayerSessions, guest, models.RoleAdmin, params, nil); code != http.StatusOK {
+		t.Errorf("admin: player sessions status %d, want %d", code, http.StatusOK)
+	}
+	w := performTestRequest(CreateBackup, http.MethodPost, "/", nil, gin.H{"roomId": hidden.ID}, asTestUser(guest, "guest"))
+	testResponseStatus(t, "guest backup of a hidden room", w, http.StatusForbidden)
+}
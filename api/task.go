@@ -54,7 +54,7 @@ func CreateTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误: "+err.Error()))
 		return
 	}
-	if req.Type != "backup" && req.Type != "restart" {
+	if !isValidTaskType(req.Type) {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的任务类型"))
 		return
 	}
@@ -88,6 +88,8 @@ func CreateTask(c *gin.Context) {
 		}
 	}
 	log.Printf("[Task API] Task created successfully: %d (%s)", task.ID, task.Name)
+	setAuditTarget(c, task.Name)
+	setAuditChange(c, nil, task)
 	c.JSON(http.StatusOK, models.SuccessResponse(task))
 }
 func UpdateTask(c *gin.Context) {
@@ -113,11 +115,12 @@ func UpdateTask(c *gin.Context) {
 		c.JSON(http.StatusNotFound, models.ErrorResponse("任务不存在"))
 		return
 	}
+	before := *task
 	if req.Name != "" {
 		task.Name = req.Name
 	}
 	if req.Type != "" {
-		if req.Type != "backup" && req.Type != "restart" {
+		if !isValidTaskType(req.Type) {
 			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的任务类型"))
 			return
 		}
@@ -151,6 +154,8 @@ func UpdateTask(c *gin.Context) {
 		return
 	}
 	log.Printf("[Task API] Task updated successfully: %d (%s)", task.ID, task.Name)
+	setAuditTarget(c, task.Name)
+	setAuditChange(c, before, task)
 	c.JSON(http.StatusOK, models.SuccessResponse(task))
 }
 func DeleteTask(c *gin.Context) {
@@ -159,6 +164,10 @@ func DeleteTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的任务 ID"))
 		return
 	}
+	if task, err := taskStorage.GetByID(id); err == nil && task != nil {
+		setAuditTarget(c, task.Name)
+		setAuditChange(c, task, nil)
+	}
 	taskScheduler.RemoveTask(id)
 	if err := taskStorage.Delete(id); err != nil {
 		log.Printf("[Task API] Failed to delete task: %v", err)
@@ -186,6 +195,8 @@ func ToggleTask(c *gin.Context) {
 		c.JSON(http.StatusNotFound, models.ErrorResponse("任务不存在"))
 		return
 	}
+	setAuditTarget(c, task.Name)
+	setAuditChange(c, gin.H{"enabled": task.Enabled}, gin.H{"enabled": req.Enabled})
 	task.Enabled = req.Enabled
 	if err := taskStorage.Update(task); err != nil {
 		log.Printf("[Task API] Failed to update task: %v", err)
@@ -260,3 +271,6 @@ func DeleteTaskLogs(c *gin.Context) {
 	log.Printf("[Task API] Task logs deleted successfully: %d", id)
 	c.JSON(http.StatusOK, models.MessageResponse("任务日志已清空"))
 }
+func isValidTaskType(taskType string) bool {
+	return taskType == "backup" || taskType == "restart" || taskType == "backup_retention"
+}
@@ -199,25 +199,7 @@ func GetTShockBans(c *gin.Context) {
 		if err != nil {
 			continue
 		}
-		ban.DateStr = ticksToTime(ban.Date).Format("2006-01-02 15:04:05")
-		expirationTime := ticksToTime(ban.Expiration)
-		if expirationTime.Year() > 9000 {
-			ban.ExpirationStr = "永久"
-		} else {
-			ban.ExpirationStr = expirationTime.Format("2006-01-02 15:04:05")
-		}
-		ban.IsActive = time.Now().Before(expirationTime)
-		if len(ban.Identifier) > 0 {
-			if ban.Identifier[0:3] == "ip:" {
-				ban.BanType = "ip"
-			} else if ban.Identifier[0:5] == "uuid:" {
-				ban.BanType = "uuid"
-			} else if ban.Identifier[0:5] == "name:" {
-				ban.BanType = "name"
-			} else if ban.Identifier[0:4] == "acc:" {
-				ban.BanType = "acc"
-			}
-		}
+		formatTShockBan(&ban)
 		bans = append(bans, ban)
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -388,12 +370,18 @@ func UpdateTShockUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
 		return
 	}
+	before := tshockUserAuditState(db, req.ID)
 	_, err = db.Exec("UPDATE Users SET UUID = ?, Usergroup = ? WHERE ID = ?", 
 		req.UUID, req.Usergroup, req.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败: " + err.Error()})
 		return
 	}
+	after := tshockUserAuditState(db, req.ID)
+	if username, ok := after["username"].(string); ok {
+		setAuditTarget(c, username)
+	}
+	setAuditChange(c, before, after)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "更新成功",
@@ -408,6 +396,13 @@ func DeleteTShockUser(c *gin.Context) {
 	}
 	defer db.Close()
 	id := c.Param("id")
+	if userID, err := strconv.Atoi(id); err == nil {
+		before := tshockUserAuditState(db, userID)
+		if username, ok := before["username"].(string); ok {
+			setAuditTarget(c, username)
+		}
+		setAuditChange(c, before, nil)
+	}
 	_, err = db.Exec("DELETE FROM Users WHERE ID = ?", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败: " + err.Error()})
@@ -427,6 +422,12 @@ func RemoveTShockBan(c *gin.Context) {
 	}
 	defer db.Close()
 	ticketNumber := c.Param("ticketNumber")
+	var identifier string
+	var expiration int64
+	if err := db.QueryRow("SELECT Identifier, Expiration FROM PlayerBans WHERE TicketNumber = ?", ticketNumber).Scan(&identifier, &expiration); err == nil {
+		setAuditTarget(c, identifier)
+		setAuditChange(c, gin.H{"ticketNumber": ticketNumber, "identifier": identifier, "expiration": ticksToTime(expiration)}, nil)
+	}
 	now := time.Now().Unix() * 10000000
 	_, err = db.Exec("UPDATE PlayerBans SET Expiration = ? WHERE TicketNumber = ?", now, ticketNumber)
 	if err != nil {
@@ -471,11 +472,47 @@ func AddTShockBan(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加封禁失败: " + err.Error()})
 		return
 	}
+	setAuditTarget(c, req.Identifier)
+	setAuditChange(c, nil, gin.H{"identifier": req.Identifier, "reason": req.Reason, "durationMinutes": req.Duration})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "封禁成功",
 	})
 }
+func tshockUserAuditState(db *sql.DB, id int) gin.H {
+	var username, uuid, usergroup sql.NullString
+	err := db.QueryRow("SELECT Username, UUID, Usergroup FROM Users WHERE ID = ?", id).Scan(&username, &uuid, &usergroup)
+	if err != nil {
+		return nil
+	}
+	return gin.H{
+		"id":        id,
+		"username":  username.String,
+		"uuid":      uuid.String,
+		"usergroup": usergroup.String,
+	}
+}
+func formatTShockBan(ban *TShockBan) {
+	ban.DateStr = ticksToTime(ban.Date).Format("2006-01-02 15:04:05")
+	expirationTime := ticksToTime(ban.Expiration)
+	if expirationTime.Year() > 9000 {
+		ban.ExpirationStr = "永久"
+	} else {
+		ban.ExpirationStr = expirationTime.Format("2006-01-02 15:04:05")
+	}
+	ban.IsActive = time.Now().Before(expirationTime)
+	if len(ban.Identifier) > 0 {
+		if ban.Identifier[0:3] == "ip:" {
+			ban.BanType = "ip"
+		} else if ban.Identifier[0:5] == "uuid:" {
+			ban.BanType = "uuid"
+		} else if ban.Identifier[0:5] == "name:" {
+			ban.BanType = "name"
+		} else if ban.Identifier[0:4] == "acc:" {
+			ban.BanType = "acc"
+		}
+	}
+}
 func ticksToTime(ticks int64) time.Time {
 	const ticksToUnixEpoch = 621355968000000000
 	unixSeconds := (ticks - ticksToUnixEpoch) / 10000000
@@ -0,0 +1,376 @@
+package api
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"terraria-panel/middleware"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"terraria-panel/utils"
+	"time"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+const (
+	twoFactorIssuer        = "Terraria Panel"
+	twoFactorChallenge     = "2fa"
+	twoFactorChallengeTTL  = 5 * time.Minute
+	twoFactorRecoveryCount = 10
+)
+var (
+	twoFactorStorage      storage.TwoFactorStorage
+	settingStorage        storage.SettingStorage
+	twoFactorRequiredRole string
+	twoFactorPolicyMu     sync.RWMutex
+)
+var twoFactorSetupPaths = map[string]bool{
+	"/api/user/2fa":         true,
+	"/api/user/2fa/setup":   true,
+	"/api/user/2fa/enable":  true,
+	"/api/user/permissions": true,
+	"/api/auth/logout":      true,
+	"/api/auth/logout-all":  true,
+	"/api/auth/sessions":    true,
+}
+func InitTwoFactor(db *sql.DB) {
+	twoFactorStorage = storage.NewSQLiteTwoFactorStorage(db)
+	settingStorage = storage.NewSQLiteSettingStorage(db)
+	role, err := settingStorage.Get(models.SettingTwoFactorRequiredRole)
+	if err != nil {
+		log.Printf("[Auth] Failed to load 2FA policy: %v", err)
+		return
+	}
+	twoFactorRequiredRole = role
+	if role != "" {
+		log.Printf("[Auth] Two-factor authentication required for role %s and above", role)
+	}
+}
+func twoFactorRequired(role string) bool {
+	twoFactorPolicyMu.RLock()
+	defer twoFactorPolicyMu.RUnlock()
+	return twoFactorRequiredRole != "" && models.HasRole(role, twoFactorRequiredRole)
+}
+func twoFactorEnabled(userID int) bool {
+	if twoFactorStorage == nil {
+		return false
+	}
+	tf, err := twoFactorStorage.Get(userID)
+	if err != nil {
+		log.Printf("[Auth] Failed to load 2FA state for user %d: %v", userID, err)
+		return false
+	}
+	return tf != nil && tf.Enabled
+}
+func enforceTwoFactorSetup(c *gin.Context, user *models.User) bool {
+	if !twoFactorRequired(user.Role) || twoFactorSetupPaths[c.FullPath()] || twoFactorEnabled(user.ID) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": "你的角色要求启用两步验证，请先完成两步验证设置",
+		"code":  "2FA_SETUP_REQUIRED",
+	})
+	return false
+}
+func verifyTwoFactorCode(userID int, code string) (bool, bool, error) {
+	tf, err := twoFactorStorage.Get(userID)
+	if err != nil || tf == nil || !tf.Enabled {
+		return false, false, err
+	}
+	if step, ok := utils.ValidateTOTP(tf.Secret, code, time.Now()); ok {
+		consumed, err := twoFactorStorage.ConsumeStep(userID, step)
+		return consumed, false, err
+	}
+	used, err := twoFactorStorage.UseRecoveryCode(userID, hashAPIToken(normalizeRecoveryCode(code)))
+	return used, used, err
+}
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+func generateRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, 0, twoFactorRecoveryCount)
+	hashes := make([]string, 0, twoFactorRecoveryCount)
+	for i := 0; i < twoFactorRecoveryCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(buf)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashAPIToken(code))
+	}
+	if err := twoFactorStorage.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+func LoginTwoFactor(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challengeToken" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误"))
+		return
+	}
+	claims, err := middleware.ParseChallengeToken(req.ChallengeToken, twoFactorChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(err.Error()))
+		return
+	}
+	ip := c.ClientIP()
+	if lockout := activeLoginLockout(claims.Username, ip); lockout != nil {
+		respondLoginLocked(c, lockout)
+		return
+	}
+	user, err := userStorage.GetByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("服务器错误"))
+		return
+	}
+	if user == nil || user.Username != claims.Username {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("用户不存在或已被删除"))
+		return
+	}
+	ok, recovery, err := verifyTwoFactorCode(user.ID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("验证失败: "+err.Error()))
+		return
+	}
+	if !ok {
+		if lockout := recordLoginFailure(user.Username, ip); lockout != nil {
+			respondLoginLocked(c, lockout)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse("验证码错误或已被使用"))
+		return
+	}
+	clearLoginFailures(user.Username, ip)
+	data, err := issueSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成令牌失败"))
+		return
+	}
+	if recovery {
+		remaining, _ := twoFactorStorage.CountRecoveryCodes(user.ID)
+		data["recoveryCodesRemaining"] = remaining
+		LogActivity(models.ActivityTypeSystem, "使用恢复码登录", fmt.Sprintf("用户 %s 使用恢复码完成两步验证，剩余 %d 个恢复码", user.Username, remaining), nil, "", models.ColorOrange)
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(data))
+}
+func GetTwoFactorStatus(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	tf, err := twoFactorStorage.Get(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取两步验证状态失败: "+err.Error()))
+		return
+	}
+	status := gin.H{
+		"enabled":  false,
+		"required": twoFactorRequired(c.GetString("role")),
+	}
+	if tf != nil && tf.Enabled {
+		remaining, _ := twoFactorStorage.CountRecoveryCodes(userID)
+		status["enabled"] = true
+		status["enabledAt"] = tf.EnabledAt
+		status["recoveryCodesRemaining"] = remaining
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(status))
+}
+func SetupTwoFactor(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if twoFactorEnabled(userID) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("两步验证已启用，如需更换设备请先关闭"))
+		return
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成密钥失败"))
+		return
+	}
+	if err := twoFactorStorage.SetPendingSecret(userID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("保存密钥失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"secret":          secret,
+		"provisioningUri": utils.TOTPProvisioningURI(twoFactorIssuer, c.GetString("username"), secret),
+		"issuer":          twoFactorIssuer,
+		"digits":          6,
+		"period":          30,
+	}))
+}
+func EnableTwoFactor(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误"))
+		return
+	}
+	userID := c.GetInt("user_id")
+	tf, err := twoFactorStorage.Get(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取两步验证状态失败: "+err.Error()))
+		return
+	}
+	if tf == nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请先生成两步验证密钥"))
+		return
+	}
+	if tf.Enabled {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("两步验证已启用"))
+		return
+	}
+	step, ok := utils.ValidateTOTP(tf.Secret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("验证码错误，请检查设备时间是否准确"))
+		return
+	}
+	if err := twoFactorStorage.Enable(userID, step); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("启用两步验证失败: "+err.Error()))
+		return
+	}
+	codes, err := generateRecoveryCodes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成恢复码失败: "+err.Error()))
+		return
+	}
+	setAuditTarget(c, c.GetString("username"))
+	LogActivity(models.ActivityTypeSystem, "启用两步验证", fmt.Sprintf("用户 %s 启用了两步验证", c.GetString("username")), nil, "", models.ColorGreen)
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "两步验证已启用，请妥善保存恢复码，它们只会显示一次",
+		Data:    gin.H{"recoveryCodes": codes},
+	})
+}
+func DisableTwoFactor(c *gin.Context) {
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误"))
+		return
+	}
+	if twoFactorRequired(c.GetString("role")) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse("你的角色要求启用两步验证，无法关闭"))
+		return
+	}
+	user, err := userStorage.GetByID(c.GetInt("user_id"))
+	if err != nil || user == nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取用户信息失败"))
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("密码错误"))
+		return
+	}
+	ok, _, err := verifyTwoFactorCode(user.ID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("验证失败: "+err.Error()))
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("验证码错误或已被使用"))
+		return
+	}
+	if err := twoFactorStorage.Delete(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("关闭两步验证失败: "+err.Error()))
+		return
+	}
+	setAuditTarget(c, user.Username)
+	LogActivity(models.ActivityTypeSystem, "关闭两步验证", fmt.Sprintf("用户 %s 关闭了两步验证", user.Username), nil, "", models.ColorOrange)
+	c.JSON(http.StatusOK, models.MessageResponse("两步验证已关闭"))
+}
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误"))
+		return
+	}
+	userID := c.GetInt("user_id")
+	tf, err := twoFactorStorage.Get(userID)
+	if err != nil || tf == nil || !tf.Enabled {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("尚未启用两步验证"))
+		return
+	}
+	step, ok := utils.ValidateTOTP(tf.Secret, req.Code, time.Now())
+	if ok {
+		ok, err = twoFactorStorage.ConsumeStep(userID, step)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("验证失败: "+err.Error()))
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("验证码错误或已被使用"))
+		return
+	}
+	codes, err := generateRecoveryCodes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成恢复码失败: "+err.Error()))
+		return
+	}
+	setAuditTarget(c, c.GetString("username"))
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "已生成新的恢复码，旧恢复码全部失效",
+		Data:    gin.H{"recoveryCodes": codes},
+	})
+}
+func ResetUserTwoFactor(c *gin.Context) {
+	target, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	if target.ID == c.GetInt("user_id") {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请在个人设置中关闭自己的两步验证"))
+		return
+	}
+	if err := twoFactorStorage.Delete(target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("重置两步验证失败: "+err.Error()))
+		return
+	}
+	revokeUserSessions(target.ID)
+	setAuditTarget(c, target.Username)
+	LogActivity(models.ActivityTypeSystem, "重置两步验证", fmt.Sprintf("%s 重置了用户 %s 的两步验证", c.GetString("username"), target.Username), nil, "", models.ColorOrange)
+	c.JSON(http.StatusOK, models.MessageResponse("已重置该用户的两步验证，其所有会话已失效"))
+}
+func GetTwoFactorPolicy(c *gin.Context) {
+	twoFactorPolicyMu.RLock()
+	role := twoFactorRequiredRole
+	twoFactorPolicyMu.RUnlock()
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{"requiredRole": role}))
+}
+func UpdateTwoFactorPolicy(c *gin.Context) {
+	var req struct {
+		RequiredRole string `json:"requiredRole"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误: "+err.Error()))
+		return
+	}
+	if req.RequiredRole != "" && !models.IsValidRole(req.RequiredRole) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的角色，可选值: owner, admin, operator, viewer，留空表示不强制"))
+		return
+	}
+	twoFactorPolicyMu.Lock()
+	before := twoFactorRequiredRole
+	twoFactorPolicyMu.Unlock()
+	if err := settingStorage.Set(models.SettingTwoFactorRequiredRole, req.RequiredRole, c.GetString("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("保存两步验证策略失败: "+err.Error()))
+		return
+	}
+	twoFactorPolicyMu.Lock()
+	twoFactorRequiredRole = req.RequiredRole
+	twoFactorPolicyMu.Unlock()
+	setAuditChange(c, gin.H{"requiredRole": before}, gin.H{"requiredRole": req.RequiredRole})
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{"requiredRole": req.RequiredRole}))
+}
@@ -0,0 +1,368 @@
+package api
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"terraria-panel/models"
+	"time"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+type userView struct {
+	ID        int                `json:"id"`
+	Username  string             `json:"username"`
+	Role      string             `json:"role"`
+	Grants    []models.RoomGrant `json:"grants"`
+	TwoFactor bool               `json:"twoFactorEnabled"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+func newUserView(user *models.User) userView {
+	grants, err := roomPermissionStorage.GetByUser(user.ID)
+	if err != nil {
+		grants = []models.RoomGrant{}
+	}
+	return userView{
+		ID:        user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		Grants:    grants,
+		TwoFactor: twoFactorEnabled(user.ID),
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+func canManageRole(actorRole, targetRole string) bool {
+	if actorRole == models.RoleOwner {
+		return true
+	}
+	return models.RoleLevel(actorRole) > models.RoleLevel(targetRole)
+}
+func GetMyPermissions(c *gin.Context) {
+	user, err := userStorage.GetByID(c.GetInt("user_id"))
+	if err != nil || user == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("用户不存在"))
+		return
+	}
+	view := newUserView(user)
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"user":                  view,
+		"defaultRoomPermission": models.DefaultRoomPermission(user.Role),
+	}))
+}
+func GetUsers(c *gin.Context) {
+	users, err := userStorage.GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取用户列表失败: "+err.Error()))
+		return
+	}
+	views := []userView{}
+	for i := range users {
+		views = append(views, newUserView(&users[i]))
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(views))
+}
+func CreateUser(c *gin.Context) {
+	var req struct {
+		Username string             `json:"username" binding:"required"`
+		Password string             `json:"password" binding:"required"`
+		Role     string             `json:"role"`
+		Grants   []models.RoomGrant `json:"grants"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误: "+err.Error()))
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleViewer
+	}
+	if !models.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的角色，可选值: owner, admin, operator, viewer"))
+		return
+	}
+	if !canManageRole(c.GetString("role"), req.Role) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse("不能创建与自己同级或更高级别的用户"))
+		return
+	}
+	if err := validateGrants(req.Grants); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		return
+	}
+	existing, err := userStorage.GetByUsername(req.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("服务器错误"))
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("用户名已存在"))
+		return
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("密码加密失败"))
+		return
+	}
+	user := &models.User{
+		Username: req.Username,
+		Password: string(hashedPassword),
+		Role:     req.Role,
+	}
+	if err := userStorage.Create(user); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建用户失败: "+err.Error()))
+		return
+	}
+	applyGrants(user.ID, req.Grants, c.GetString("username"))
+	view := newUserView(user)
+	setAuditTarget(c, user.Username)
+	setAuditChange(c, nil, view)
+	c.JSON(http.StatusOK, models.SuccessResponse(view))
+}
+func UpdateUser(c *gin.Context) {
+	target, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Role     string `json:"role"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误: "+err.Error()))
+		return
+	}
+	before := newUserView(target)
+	if req.Role != "" && req.Role != target.Role {
+		if !models.IsValidRole(req.Role) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的角色，可选值: owner, admin, operator, viewer"))
+			return
+		}
+		if !canManageRole(c.GetString("role"), req.Role) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse("不能授予与自己同级或更高级别的角色"))
+			return
+		}
+		if target.Role == models.RoleOwner && isLastOwner() {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("至少需要保留一个 owner"))
+			return
+		}
+		target.Role = req.Role
+	}
+	if req.Password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("密码加密失败"))
+			return
+		}
+		target.Password = string(hashedPassword)
+	}
+	if err := userStorage.Update(target); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("更新用户失败: "+err.Error()))
+		return
+	}
+	if req.Password != "" {
+		revokeUserSessions(target.ID)
+	}
+	after := newUserView(target)
+	setAuditTarget(c, target.Username)
+	setAuditChange(c, before, after)
+	c.JSON(http.StatusOK, models.SuccessResponse(after))
+}
+func DeleteUser(c *gin.Context) {
+	target, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	if target.ID == c.GetInt("user_id") {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("不能删除自己"))
+		return
+	}
+	if target.Role == models.RoleOwner && isLastOwner() {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("至少需要保留一个 owner"))
+		return
+	}
+	before := newUserView(target)
+	if err := roomPermissionStorage.DeleteByUser(target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除用户权限失败: "+err.Error()))
+		return
+	}
+	if err := userStorage.Delete(target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除用户失败: "+err.Error()))
+		return
+	}
+	revokeUserSessions(target.ID)
+	if twoFactorStorage != nil {
+		twoFactorStorage.Delete(target.ID)
+	}
+	setAuditTarget(c, target.Username)
+	setAuditChange(c, before, nil)
+	c.JSON(http.StatusOK, models.MessageResponse("用户已删除"))
+}
+func SetUserPermissions(c *gin.Context) {
+	target, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Grants []models.RoomGrant `json:"grants"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误: "+err.Error()))
+		return
+	}
+	if err := validateGrants(req.Grants); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		return
+	}
+	before := newUserView(target)
+	if err := roomPermissionStorage.DeleteByUser(target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("更新权限失败: "+err.Error()))
+		return
+	}
+	applyGrants(target.ID, req.Grants, c.GetString("username"))
+	after := newUserView(target)
+	setAuditTarget(c, target.Username)
+	setAuditChange(c, before.Grants, after.Grants)
+	c.JSON(http.StatusOK, models.SuccessResponse(after))
+}
+func DeleteUserPermission(c *gin.Context) {
+	target, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+	roomID, err := strconv.Atoi(c.Param("roomId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的房间ID"))
+		return
+	}
+	permission, _ := roomPermissionStorage.Get(target.ID, roomID)
+	if err := roomPermissionStorage.Delete(target.ID, roomID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("撤销权限失败: "+err.Error()))
+		return
+	}
+	setAuditRoom(c, roomID)
+	setAuditTarget(c, target.Username)
+	setAuditChange(c, gin.H{"roomId": roomID, "permission": permission}, nil)
+	c.JSON(http.StatusOK, models.MessageResponse("权限已撤销"))
+}
+func GetInvitations(c *gin.Context) {
+	invitations, err := invitationStorage.GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取邀请列表失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(invitations))
+}
+func CreateInvitation(c *gin.Context) {
+	var req struct {
+		Role           string             `json:"role"`
+		Grants         []models.RoomGrant `json:"grants"`
+		ExpiresInHours int                `json:"expiresInHours"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("参数错误: "+err.Error()))
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleViewer
+	}
+	if !models.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的角色，可选值: owner, admin, operator, viewer"))
+		return
+	}
+	if !canManageRole(c.GetString("role"), req.Role) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse("不能邀请与自己同级或更高级别的用户"))
+		return
+	}
+	if err := validateGrants(req.Grants); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(err.Error()))
+		return
+	}
+	if req.ExpiresInHours <= 0 {
+		req.ExpiresInHours = 72
+	}
+	code, err := generateInviteCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("生成邀请码失败"))
+		return
+	}
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+	invitation := &models.Invitation{
+		Code:      code,
+		Role:      req.Role,
+		Grants:    req.Grants,
+		CreatedBy: c.GetString("username"),
+		ExpiresAt: &expiresAt,
+	}
+	if invitation.Grants == nil {
+		invitation.Grants = []models.RoomGrant{}
+	}
+	if err := invitationStorage.Create(invitation); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建邀请失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, nil, gin.H{"role": invitation.Role, "grants": invitation.Grants, "expiresAt": expiresAt})
+	c.JSON(http.StatusOK, models.SuccessResponse(invitation))
+}
+func DeleteInvitation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的邀请ID"))
+		return
+	}
+	if err := invitationStorage.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除邀请失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.MessageResponse("邀请已撤销"))
+}
+func loadManagedUser(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的用户ID"))
+		return nil, false
+	}
+	target, err := userStorage.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取用户失败: "+err.Error()))
+		return nil, false
+	}
+	if target == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("用户不存在"))
+		return nil, false
+	}
+	if target.ID != c.GetInt("user_id") && !canManageRole(c.GetString("role"), target.Role) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse("不能管理与自己同级或更高级别的用户"))
+		return nil, false
+	}
+	return target, true
+}
+func isLastOwner() bool {
+	count, err := userStorage.CountByRole(models.RoleOwner)
+	return err != nil || count <= 1
+}
+func validateGrants(grants []models.RoomGrant) error {
+	for _, grant := range grants {
+		if !models.IsValidRoomPermission(grant.Permission) {
+			return fmt.Errorf("房间 %d 的权限无效，可选值: view, operate, manage", grant.RoomID)
+		}
+		if grant.RoomID < 0 {
+			return fmt.Errorf("无效的房间ID: %d", grant.RoomID)
+		}
+	}
+	return nil
+}
+func applyGrants(userID int, grants []models.RoomGrant, grantedBy string) {
+	for _, grant := range grants {
+		grant.UserID = userID
+		grant.GrantedBy = grantedBy
+		roomPermissionStorage.Set(&grant)
+	}
+}
+func generateInviteCode() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
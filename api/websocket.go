@@ -3,6 +3,7 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"terraria-panel/middleware"
 	wshandler "terraria-panel/websocket"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -56,14 +57,22 @@ func (manager *WebSocketManager) Run() {
 	}
 }
 func HandleWebSocket(c *gin.Context) {
+	claims, err := middleware.ParseToken(wshandler.SocketToken(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录或登录已过期"})
+		return
+	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("[WebSocket] 升级失败: %v", err)
 		return
 	}
 	wsManager.register <- conn
+	done := make(chan struct{})
+	go wshandler.WatchSession(conn, claims, done, nil)
 	go func() {
 		defer func() {
+			close(done)
 			wsManager.unregister <- conn
 		}()
 		conn.SetCloseHandler(func(code int, text string) error {
@@ -94,5 +103,5 @@ func init() {
 	log.Println("[WebSocket] 管理器已启动")
 }
 func HandleRoomLogsWS(c *gin.Context) {
-	wshandler.HandleRoomLogs(c)
+	wshandler.HandleRoomConsole(c)
 }
@@ -0,0 +1,474 @@
+package api
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"terraria-panel/config"
+	"terraria-panel/models"
+	"terraria-panel/services"
+	"terraria-panel/storage"
+	"github.com/gin-gonic/gin"
+)
+const whitelistKickReason = "不在白名单中"
+var whitelistStorage storage.WhitelistStorage
+func InitWhitelist(db *sql.DB, pipeline *services.LogPipeline) {
+	whitelistStorage = storage.NewSQLiteWhitelistStorage(db)
+	pipeline.Subscribe("whitelist", enforceWhitelist)
+}
+func enforceWhitelist(event *models.GameEvent) {
+	if event.Type != models.GameEventJoin || event.PlayerName == "" {
+		return
+	}
+	settings, err := whitelistStorage.GetRoomSettings(event.RoomID)
+	if err != nil {
+		log.Printf("[Whitelist] Failed to load settings for room %d: %v", event.RoomID, err)
+		return
+	}
+	if settings.Enabled {
+		listed, err := whitelistStorage.IsListed(event.RoomID, event.PlayerName)
+		if err != nil {
+			log.Printf("[Whitelist] Failed to check %s in room %d: %v", event.PlayerName, event.RoomID, err)
+			return
+		}
+		if !listed {
+			kickUnlistedPlayer(event)
+		}
+	}
+}
+func kickUnlistedPlayer(event *models.GameEvent) {
+	console, err := getRoomConsole(event.RoomID)
+	if err != nil {
+		log.Printf("[Whitelist] Cannot kick %s from room %d: %v", event.PlayerName, event.RoomID, err)
+		return
+	}
+	command := buildKickCommand(console.serverType, sanitizeConsoleArg(event.PlayerName), whitelistKickReason)
+	if _, err := sendModerationCommand(console, command); err != nil {
+		log.Printf("[Whitelist] Failed to kick %s from room %d: %v", event.PlayerName, event.RoomID, err)
+		return
+	}
+	log.Printf("[Whitelist] Kicked unlisted player %s from room %d", event.PlayerName, event.RoomID)
+	LogPlayerKick(console.roomID, console.roomName, event.PlayerName, whitelistKickReason)
+}
+func roomTShockDir(roomID int) string {
+	return filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", roomID), "tshock")
+}
+func applyWhitelistScope(scope string, scopeID int) {
+	if scope == models.WhitelistScopeRoom {
+		applyNativeWhitelist(scopeID)
+		return
+	}
+	roomIDs, err := whitelistStorage.GetGroupRooms(scopeID)
+	if err != nil {
+		log.Printf("[Whitelist] Failed to list rooms of group %d: %v", scopeID, err)
+		return
+	}
+	for _, roomID := range roomIDs {
+		applyNativeWhitelist(roomID)
+	}
+}
+func applyNativeWhitelist(roomID int) error {
+	room, err := roomStorage.GetByID(roomID)
+	if err != nil || room == nil || room.ServerType != "tshock" {
+		return err
+	}
+	tshockDir := roomTShockDir(roomID)
+	if _, err := os.Stat(tshockDir); err != nil {
+		return nil
+	}
+	settings, err := whitelistStorage.GetRoomSettings(roomID)
+	if err != nil {
+		return err
+	}
+	entries, err := whitelistStorage.GetRoomEntries(roomID)
+	if err != nil {
+		return err
+	}
+	ips, complete := whitelistIPs(entries)
+	content := "# Managed by Terraria Panel, edit the room whitelist in the panel instead\n"
+	for _, ip := range ips {
+		content += ip + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(tshockDir, "whitelist.txt"), []byte(content), 0644); err != nil {
+		log.Printf("[Whitelist] Failed to write whitelist.txt for room %d: %v", roomID, err)
+		return err
+	}
+	if settings.Enabled && !complete {
+		log.Printf("[Whitelist] Room %d has entries without an IP, enforcing by name through the panel instead of TShock", roomID)
+	}
+	changed, err := setTShockWhitelistEnabled(tshockDir, settings.Enabled && complete)
+	if err != nil {
+		log.Printf("[Whitelist] Failed to update EnableWhitelist for room %d: %v", roomID, err)
+		return err
+	}
+	if changed {
+		if console, err := getRoomConsole(roomID); err == nil {
+			if _, err := sendModerationCommand(console, "reload"); err != nil {
+				log.Printf("[Whitelist] Failed to reload TShock config for room %d: %v", roomID, err)
+			}
+		}
+	}
+	return nil
+}
+func setTShockWhitelistEnabled(tshockDir string, enabled bool) (bool, error) {
+	configService := services.NewConfigService(tshockDir)
+	if !configService.CheckConfigExists() {
+		return false, nil
+	}
+	tshockConfig, err := configService.GetConfig()
+	if err != nil {
+		return false, err
+	}
+	settings, ok := tshockConfig["Settings"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("invalid config format: Settings not found")
+	}
+	if current, _ := settings["EnableWhitelist"].(bool); current == enabled {
+		return false, nil
+	}
+	settings["EnableWhitelist"] = enabled
+	return true, configService.SaveConfig(tshockConfig)
+}
+func whitelistIPs(entries []*models.WhitelistEntry) ([]string, bool) {
+	seen := make(map[string]bool)
+	complete := true
+	for _, entry := range entries {
+		ip := strings.TrimSpace(entry.IP)
+		if ip == "" {
+			complete = false
+			continue
+		}
+		seen[ip] = true
+	}
+	ips := make([]string, 0, len(seen))
+	for ip := range seen {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips, complete
+}
+func whitelistRoomID(c *gin.Context) (int, bool) {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的房间ID"))
+		return 0, false
+	}
+	room, err := roomStorage.GetByID(roomID)
+	if err != nil || room == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("房间不存在"))
+		return 0, false
+	}
+	setAuditRoom(c, roomID)
+	return roomID, true
+}
+func whitelistGroupID(c *gin.Context) (int, bool) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的分组ID"))
+		return 0, false
+	}
+	group, err := whitelistStorage.GetGroup(groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取白名单分组失败: "+err.Error()))
+		return 0, false
+	}
+	if group == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse("白名单分组不存在"))
+		return 0, false
+	}
+	setAuditTarget(c, group.Name)
+	return groupID, true
+}
+func GetRoomWhitelist(c *gin.Context) {
+	roomID, ok := whitelistRoomID(c)
+	if !ok {
+		return
+	}
+	settings, err := whitelistStorage.GetRoomSettings(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取白名单设置失败: "+err.Error()))
+		return
+	}
+	entries, err := whitelistStorage.GetRoomEntries(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取白名单失败: "+err.Error()))
+		return
+	}
+	var group *models.WhitelistGroup
+	if settings.GroupID != nil {
+		if group, err = whitelistStorage.GetGroup(*settings.GroupID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取白名单分组失败: "+err.Error()))
+			return
+		}
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"settings": settings,
+		"group":    group,
+		"entries":  entries,
+	}))
+}
+func UpdateRoomWhitelist(c *gin.Context) {
+	roomID, ok := whitelistRoomID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Enabled *bool `json:"enabled"`
+		GroupID *int  `json:"groupId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	settings, err := whitelistStorage.GetRoomSettings(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取白名单设置失败: "+err.Error()))
+		return
+	}
+	before := *settings
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.GroupID != nil {
+		if *req.GroupID <= 0 {
+			settings.GroupID = nil
+		} else if group, err := whitelistStorage.GetGroup(*req.GroupID); err != nil || group == nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("白名单分组不存在"))
+			return
+		} else {
+			settings.GroupID = &group.ID
+		}
+	}
+	settings.UpdatedBy = c.GetString("username")
+	if err := whitelistStorage.SaveRoomSettings(settings); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("保存白名单设置失败: "+err.Error()))
+		return
+	}
+	if err := applyNativeWhitelist(roomID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("白名单设置已保存，但同步到 TShock 失败: "+err.Error()))
+		return
+	}
+	setAuditChange(c, before, settings)
+	c.JSON(http.StatusOK, models.SuccessResponse(settings))
+}
+func AddRoomWhitelistEntry(c *gin.Context) {
+	if roomID, ok := whitelistRoomID(c); ok {
+		addWhitelistEntry(c, models.WhitelistScopeRoom, roomID)
+	}
+}
+func DeleteRoomWhitelistEntry(c *gin.Context) {
+	if roomID, ok := whitelistRoomID(c); ok {
+		deleteWhitelistEntry(c, models.WhitelistScopeRoom, roomID)
+	}
+}
+func ImportRoomWhitelist(c *gin.Context) {
+	if roomID, ok := whitelistRoomID(c); ok {
+		importWhitelist(c, models.WhitelistScopeRoom, roomID)
+	}
+}
+func GetWhitelistGroups(c *gin.Context) {
+	groups, err := whitelistStorage.ListGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取白名单分组失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(groups))
+}
+func CreateWhitelistGroup(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	group := &models.WhitelistGroup{
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		CreatedBy:   c.GetString("username"),
+	}
+	if group.Name == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("分组名称不能为空"))
+		return
+	}
+	if err := whitelistStorage.CreateGroup(group); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse("分组名称已存在"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("创建白名单分组失败: "+err.Error()))
+		return
+	}
+	setAuditTarget(c, group.Name)
+	setAuditChange(c, nil, group)
+	c.JSON(http.StatusOK, models.SuccessResponse(group))
+}
+func DeleteWhitelistGroup(c *gin.Context) {
+	groupID, ok := whitelistGroupID(c)
+	if !ok {
+		return
+	}
+	roomIDs, err := whitelistStorage.GetGroupRooms(groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取白名单分组失败: "+err.Error()))
+		return
+	}
+	if err := whitelistStorage.DeleteGroup(groupID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除白名单分组失败: "+err.Error()))
+		return
+	}
+	for _, roomID := range roomIDs {
+		applyNativeWhitelist(roomID)
+	}
+	c.JSON(http.StatusOK, models.MessageResponse("白名单分组已删除"))
+}
+func GetWhitelistGroupEntries(c *gin.Context) {
+	groupID, ok := whitelistGroupID(c)
+	if !ok {
+		return
+	}
+	entries, err := whitelistStorage.GetEntries(models.WhitelistScopeGroup, groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("读取白名单失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(entries))
+}
+func AddWhitelistGroupEntry(c *gin.Context) {
+	if groupID, ok := whitelistGroupID(c); ok {
+		addWhitelistEntry(c, models.WhitelistScopeGroup, groupID)
+	}
+}
+func DeleteWhitelistGroupEntry(c *gin.Context) {
+	if groupID, ok := whitelistGroupID(c); ok {
+		deleteWhitelistEntry(c, models.WhitelistScopeGroup, groupID)
+	}
+}
+func ImportWhitelistGroup(c *gin.Context) {
+	if groupID, ok := whitelistGroupID(c); ok {
+		importWhitelist(c, models.WhitelistScopeGroup, groupID)
+	}
+}
+func addWhitelistEntry(c *gin.Context, scope string, scopeID int) {
+	var req struct {
+		PlayerName string `json:"playerName" binding:"required"`
+		IP         string `json:"ip"`
+		Note       string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	entry := &models.WhitelistEntry{
+		Scope:      scope,
+		ScopeID:    scopeID,
+		PlayerName: strings.TrimSpace(req.PlayerName),
+		IP:         strings.TrimSpace(req.IP),
+		Note:       strings.TrimSpace(req.Note),
+		AddedBy:    c.GetString("username"),
+	}
+	if entry.PlayerName == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("玩家名不能为空"))
+		return
+	}
+	if err := whitelistStorage.SaveEntry(entry); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("添加白名单失败: "+err.Error()))
+		return
+	}
+	applyWhitelistScope(scope, scopeID)
+	setAuditChange(c, nil, entry)
+	c.JSON(http.StatusOK, models.SuccessResponse(entry))
+}
+func deleteWhitelistEntry(c *gin.Context, scope string, scopeID int) {
+	entryID, err := strconv.Atoi(c.Param("entryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("无效的白名单条目ID"))
+		return
+	}
+	if err := whitelistStorage.DeleteEntry(entryID, scope, scopeID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse("白名单条目不存在"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse("删除白名单条目失败: "+err.Error()))
+		return
+	}
+	applyWhitelistScope(scope, scopeID)
+	c.JSON(http.StatusOK, models.MessageResponse("已移出白名单"))
+}
+func importWhitelist(c *gin.Context, scope string, scopeID int) {
+	var req struct {
+		Text    string   `json:"text"`
+		Players []string `json:"players"`
+		Replace bool     `json:"replace"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("请求参数错误: "+err.Error()))
+		return
+	}
+	entries := parseWhitelistImport(req.Text, req.Players)
+	if len(entries) == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse("没有可导入的玩家"))
+		return
+	}
+	if req.Replace {
+		if err := whitelistStorage.ClearEntries(scope, scopeID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse("清空白名单失败: "+err.Error()))
+			return
+		}
+	}
+	imported := 0
+	for _, entry := range entries {
+		entry.Scope = scope
+		entry.ScopeID = scopeID
+		entry.AddedBy = c.GetString("username")
+		if err := whitelistStorage.SaveEntry(entry); err != nil {
+			log.Printf("[Whitelist] Failed to import %s: %v", entry.PlayerName, err)
+			continue
+		}
+		imported++
+	}
+	applyWhitelistScope(scope, scopeID)
+	setAuditDetails(c, fmt.Sprintf("imported %d players (replace=%t)", imported, req.Replace))
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"imported": imported,
+		"total":    len(entries),
+	}))
+}
+func parseWhitelistImport(text string, players []string) []*models.WhitelistEntry {
+	entries := []*models.WhitelistEntry{}
+	seen := make(map[string]bool)
+	add := func(name, ip string) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		entries = append(entries, &models.WhitelistEntry{PlayerName: name, IP: strings.TrimSpace(ip)})
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == '\t' })
+		if len(fields) == 0 {
+			continue
+		}
+		ip := ""
+		if len(fields) > 1 {
+			ip = fields[1]
+		}
+		add(fields[0], ip)
+	}
+	for _, name := range players {
+		add(name, "")
+	}
+	return entries
+}
@@ -12,6 +12,9 @@ type Config struct {
 	DownloadRetries   int
 	DownloadTimeout   int
 	EnableMultiThread bool
+	JWTSecret         string
+	AccessTokenTTL    int
+	RefreshTokenTTL   int
 }
 func Load() *Config {
 	_ = godotenv.Load()
@@ -29,6 +32,14 @@ func Load() *Config {
 			timeout = val
 		}
 	}
+	accessTokenTTL := 15
+	if val, err := strconv.Atoi(getEnv("ACCESS_TOKEN_TTL_MINUTES", "15")); err == nil && val > 0 {
+		accessTokenTTL = val
+	}
+	refreshTokenTTL := 30
+	if val, err := strconv.Atoi(getEnv("REFRESH_TOKEN_TTL_DAYS", "30")); err == nil && val > 0 {
+		refreshTokenTTL = val
+	}
 	return &Config{
 		Port:              getEnv("PORT", "8800"),
 		Env:               getEnv("ENV", "development"),
@@ -37,6 +48,9 @@ func Load() *Config {
 		DownloadRetries:   retries,
 		DownloadTimeout:   timeout,
 		EnableMultiThread: enableMultiThread,
+		JWTSecret:         getEnv("JWT_SECRET", ""),
+		AccessTokenTTL:    accessTokenTTL,
+		RefreshTokenTTL:   refreshTokenTTL,
 	}
 }
 func getEnv(key, defaultValue string) string {
@@ -43,8 +43,26 @@ func migrateDatabase() error {
 		"ALTER TABLE rooms ADD COLUMN evil_type TEXT DEFAULT 'corruption'",
 		"ALTER TABLE rooms ADD COLUMN start_time DATETIME",
 		"ALTER TABLE rooms ADD COLUMN admin_token TEXT",
+		"ALTER TABLE rooms ADD COLUMN restart_policy TEXT DEFAULT 'on-failure'",
+		"ALTER TABLE rooms ADD COLUMN max_restarts INTEGER DEFAULT 5",
+		"ALTER TABLE rooms ADD COLUMN restart_window INTEGER DEFAULT 600",
 		"ALTER TABLE players ADD COLUMN room_id INTEGER DEFAULT 0",
 		"ALTER TABLE players ADD COLUMN status TEXT DEFAULT 'offline'",
+		"ALTER TABLE operation_logs ADD COLUMN username TEXT",
+		"ALTER TABLE operation_logs ADD COLUMN method TEXT",
+		"ALTER TABLE operation_logs ADD COLUMN path TEXT",
+		"ALTER TABLE operation_logs ADD COLUMN target_name TEXT",
+		"ALTER TABLE operation_logs ADD COLUMN room_id INTEGER",
+		"ALTER TABLE operation_logs ADD COLUMN before_value TEXT",
+		"ALTER TABLE operation_logs ADD COLUMN after_value TEXT",
+		"ALTER TABLE operation_logs ADD COLUMN status_code INTEGER DEFAULT 0",
+		"ALTER TABLE player_sessions ADD COLUMN closed_by_system INTEGER DEFAULT 0",
+		"ALTER TABLE backups ADD COLUMN stored_size INTEGER DEFAULT 0",
+		"ALTER TABLE backups ADD COLUMN save_status TEXT",
+		"ALTER TABLE backups ADD COLUMN save_detail TEXT",
+		"ALTER TABLE backups ADD COLUMN pinned INTEGER DEFAULT 0",
+		"ALTER TABLE player_infractions ADD COLUMN lifted_at DATETIME",
+		"ALTER TABLE player_bans ADD COLUMN network INTEGER DEFAULT 0",
 	}
 	for _, migration := range migrations {
 		if _, err := DB.Exec(migration); err != nil {
@@ -60,6 +78,9 @@ func migrateDatabase() error {
 	if err := addServerModeColumn(); err != nil {
 		log.Printf("⚠️ server_mode 字段添加失败: %v", err)
 	}
+	if err := migrateUserRoles(); err != nil {
+		log.Printf("⚠️ 用户角色迁移失败: %v", err)
+	}
 	log.Println("✅ 数据库迁移检查完成")
 	return nil
 }
@@ -71,6 +92,29 @@ func addServerModeColumn() error {
 	log.Println("✅ users.server_mode 字段检查完成")
 	return nil
 }
+func migrateUserRoles() error {
+	if _, err := DB.Exec("UPDATE users SET role = 'viewer' WHERE role IS NULL OR role NOT IN ('owner', 'admin', 'operator', 'viewer')"); err != nil {
+		return err
+	}
+	var ownerCount int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'owner'").Scan(&ownerCount); err != nil {
+		return err
+	}
+	if ownerCount > 0 {
+		return nil
+	}
+	result, err := DB.Exec(`
+		UPDATE users SET role = 'owner', updated_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT id FROM users ORDER BY CASE WHEN role = 'admin' THEN 0 ELSE 1 END, id LIMIT 1)
+	`)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		log.Println("✅ 已将最早的管理员账户升级为 owner")
+	}
+	return nil
+}
 func ensurePluginServerTable() error {
 	var tableName string
 	err := DB.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='plugin_server'").Scan(&tableName)
@@ -157,6 +201,8 @@ func applyPerformanceIndexes() error {
 		"CREATE INDEX IF NOT EXISTS idx_player_stats_updated ON player_stats(updated_at DESC)",
 		"CREATE INDEX IF NOT EXISTS idx_activity_logs_type_time ON activity_logs(type, created_at DESC)",
 		"CREATE INDEX IF NOT EXISTS idx_task_execution_status ON task_execution_logs(status, started_at DESC)",
+		"CREATE INDEX IF NOT EXISTS idx_operation_logs_room_time ON operation_logs(room_id, created_at DESC)",
+		"CREATE INDEX IF NOT EXISTS idx_operation_logs_action ON operation_logs(action)",
 	}
 	for _, indexSQL := range indexes {
 		if _, err := DB.Exec(indexSQL); err != nil {
@@ -3,7 +3,7 @@ CREATE TABLE IF NOT EXISTS users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     username TEXT NOT NULL UNIQUE,
     password TEXT NOT NULL,
-    role TEXT DEFAULT 'user',
+    role TEXT DEFAULT 'viewer',
     server_mode TEXT DEFAULT 'rooms',
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
@@ -26,6 +26,9 @@ CREATE TABLE IF NOT EXISTS rooms (
     pid INTEGER DEFAULT 0,
     start_time DATETIME,
     admin_token TEXT,
+    restart_policy TEXT DEFAULT 'on-failure',
+    max_restarts INTEGER DEFAULT 5,
+    restart_window INTEGER DEFAULT 600,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
@@ -52,6 +55,7 @@ CREATE TABLE IF NOT EXISTS player_sessions (
     leave_time DATETIME,
     duration INTEGER DEFAULT 0,
     ip_address TEXT,
+    closed_by_system INTEGER DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (player_id) REFERENCES players(id) ON DELETE CASCADE,
     FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE
@@ -85,10 +89,18 @@ CREATE TABLE IF NOT EXISTS player_daily_stats (
 CREATE TABLE IF NOT EXISTS operation_logs (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER,
+    username TEXT,
     action TEXT NOT NULL,
+    method TEXT,
+    path TEXT,
     target_type TEXT,
     target_id INTEGER,
+    target_name TEXT,
+    room_id INTEGER,
+    before_value TEXT,
+    after_value TEXT,
     details TEXT,
+    status_code INTEGER DEFAULT 0,
     ip_address TEXT,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id)
@@ -102,6 +114,21 @@ CREATE TABLE IF NOT EXISTS login_attempts (
     failed_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
+-- 登录锁定记录（账号 / IP / 账号+IP）
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scope TEXT NOT NULL,
+    lock_key TEXT NOT NULL,
+    username TEXT,
+    ip_address TEXT,
+    level INTEGER DEFAULT 1,
+    failed_count INTEGER DEFAULT 0,
+    locked_until DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(scope, lock_key)
+);
+
 -- 定时任务表
 CREATE TABLE IF NOT EXISTS scheduled_tasks (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -144,6 +171,7 @@ CREATE INDEX IF NOT EXISTS idx_operation_logs_user_id ON operation_logs(user_id)
 CREATE INDEX IF NOT EXISTS idx_operation_logs_created_at ON operation_logs(created_at);
 CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username);
 CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_failed_at ON login_attempts(failed_at);
 CREATE INDEX IF NOT EXISTS idx_scheduled_tasks_enabled ON scheduled_tasks(enabled);
 CREATE INDEX IF NOT EXISTS idx_task_execution_logs_task_id ON task_execution_logs(task_id);
 CREATE INDEX IF NOT EXISTS idx_task_execution_logs_started_at ON task_execution_logs(started_at);
@@ -174,6 +202,300 @@ CREATE INDEX IF NOT EXISTS idx_activity_logs_created_at ON activity_logs(created
 CREATE INDEX IF NOT EXISTS idx_activity_logs_type ON activity_logs(type);
 CREATE INDEX IF NOT EXISTS idx_activity_logs_room_id ON activity_logs(room_id);
 
+-- 玩家封禁表
+CREATE TABLE IF NOT EXISTS player_bans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    player_id INTEGER DEFAULT 0,
+    player_name TEXT NOT NULL,
+    ip TEXT,
+    reason TEXT,
+    room_id INTEGER DEFAULT 0,
+    banned_by TEXT,
+    external_ref TEXT,
+    network INTEGER DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    lifted_at DATETIME,
+    lifted_by TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_player_bans_player_id ON player_bans(player_id);
+CREATE INDEX IF NOT EXISTS idx_player_bans_player_name ON player_bans(player_name);
+CREATE INDEX IF NOT EXISTS idx_player_bans_lifted_at ON player_bans(lifted_at);
+
+-- 玩家违规记录表（警告、备注、禁言、踢出、封禁）
+CREATE TABLE IF NOT EXISTS player_infractions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    player_id INTEGER DEFAULT 0,
+    player_name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    reason TEXT,
+    evidence_url TEXT,
+    room_id INTEGER,
+    ban_id INTEGER,
+    escalated INTEGER DEFAULT 0,
+    created_by TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    revoked_at DATETIME,
+    revoked_by TEXT,
+    lifted_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_player_infractions_player_name ON player_infractions(player_name, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_player_infractions_type ON player_infractions(type, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_player_infractions_ban_id ON player_infractions(ban_id);
+
+-- 全网封禁同步状态表（每个封禁在每个 TShock 实例上的下发情况）
+CREATE TABLE IF NOT EXISTS network_ban_targets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ban_id INTEGER NOT NULL,
+    room_id INTEGER NOT NULL,
+    method TEXT NOT NULL,
+    tickets TEXT,
+    status TEXT NOT NULL,
+    error TEXT,
+    attempts INTEGER DEFAULT 0,
+    applied_at DATETIME,
+    removed_at DATETIME,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(ban_id, room_id),
+    FOREIGN KEY (ban_id) REFERENCES player_bans(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_network_ban_targets_status ON network_ban_targets(status);
+
+-- 白名单分组表
+CREATE TABLE IF NOT EXISTS whitelist_groups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    created_by TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 房间白名单设置表
+CREATE TABLE IF NOT EXISTS room_whitelists (
+    room_id INTEGER PRIMARY KEY,
+    enabled INTEGER DEFAULT 0,
+    group_id INTEGER,
+    updated_by TEXT,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES whitelist_groups(id) ON DELETE SET NULL
+);
+
+-- 白名单条目表（scope 为 room 或 group）
+CREATE TABLE IF NOT EXISTS whitelist_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scope TEXT NOT NULL,
+    scope_id INTEGER NOT NULL,
+    player_name TEXT NOT NULL,
+    ip TEXT,
+    note TEXT,
+    added_by TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(scope, scope_id, player_name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_whitelist_entries_player_name ON whitelist_entries(player_name);
+
+-- 备份目录表（name 为备份文件名去掉 .zip 后缀）
+CREATE TABLE IF NOT EXISTS backups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    file_name TEXT NOT NULL,
+    room_id INTEGER NOT NULL,
+    room_name TEXT,
+    trigger_type TEXT NOT NULL DEFAULT 'manual',
+    type TEXT NOT NULL DEFAULT 'full',
+    note TEXT,
+    sha256 TEXT,
+    size INTEGER DEFAULT 0,
+    stored_size INTEGER DEFAULT 0,
+    file_count INTEGER DEFAULT 0,
+    created_by TEXT,
+    duration_ms INTEGER DEFAULT 0,
+    save_status TEXT,
+    save_detail TEXT,
+    pinned INTEGER DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'completed',
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_backups_room_created ON backups(room_id, created_at);
+
+-- 备份保留策略表（祖父-父-子轮换）
+CREATE TABLE IF NOT EXISTS backup_retention_policies (
+    room_id INTEGER PRIMARY KEY,
+    enabled INTEGER DEFAULT 0,
+    keep_last INTEGER DEFAULT 0,
+    keep_hourly INTEGER DEFAULT 0,
+    keep_daily INTEGER DEFAULT 0,
+    keep_weekly INTEGER DEFAULT 0,
+    keep_monthly INTEGER DEFAULT 0,
+    max_size_mb INTEGER DEFAULT 0,
+    updated_by TEXT,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 备份远程目标表（local 为其他本地路径或挂载点，sftp，s3 为 S3 兼容对象存储）
+CREATE TABLE IF NOT EXISTS backup_targets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    type TEXT NOT NULL,
+    enabled INTEGER DEFAULT 1,
+    path TEXT,
+    host TEXT,
+    bucket TEXT,
+    region TEXT,
+    username TEXT,
+    secret TEXT,
+    private_key TEXT,
+    host_key TEXT,
+    created_by TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 房间备份复制目标表
+CREATE TABLE IF NOT EXISTS room_backup_targets (
+    room_id INTEGER NOT NULL,
+    target_id INTEGER NOT NULL,
+    PRIMARY KEY (room_id, target_id)
+);
+
+-- 备份远程副本表
+CREATE TABLE IF NOT EXISTS backup_copies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    backup_id INTEGER NOT NULL,
+    target_id INTEGER NOT NULL,
+    remote_name TEXT NOT NULL,
+    location TEXT,
+    sha256 TEXT,
+    size INTEGER DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER DEFAULT 0,
+    error TEXT,
+    verified_at DATETIME,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(backup_id, target_id)
+);
+
+-- 控制台命令历史表
+CREATE TABLE IF NOT EXISTS console_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    username TEXT,
+    room_id INTEGER NOT NULL,
+    command TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_console_history_user_room ON console_history(user_id, room_id, created_at);
+
+-- 房间权限授权表
+CREATE TABLE IF NOT EXISTS room_permissions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    room_id INTEGER NOT NULL,
+    permission TEXT NOT NULL,
+    granted_by TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, room_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_permissions_room_id ON room_permissions(room_id);
+
+-- 用户邀请表
+CREATE TABLE IF NOT EXISTS user_invitations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    role TEXT NOT NULL DEFAULT 'viewer',
+    room_grants TEXT,
+    created_by TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    used_at DATETIME,
+    used_by TEXT
+);
+
+-- 用户登录会话表（刷新令牌）
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    refresh_token_hash TEXT NOT NULL UNIQUE,
+    device TEXT,
+    user_agent TEXT,
+    ip_address TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_active_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
+
+-- 两步验证（TOTP）
+CREATE TABLE IF NOT EXISTS user_two_factor (
+    user_id INTEGER PRIMARY KEY,
+    secret TEXT NOT NULL,
+    enabled BOOLEAN DEFAULT 0,
+    enabled_at DATETIME,
+    last_step INTEGER DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- 两步验证恢复码
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
+
+-- 面板设置
+CREATE TABLE IF NOT EXISTS panel_settings (
+    key TEXT PRIMARY KEY,
+    value TEXT,
+    updated_by TEXT,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 公开只读 API 令牌表
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_prefix TEXT NOT NULL,
+    scopes TEXT,
+    room_ids TEXT,
+    created_by TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    last_used_at DATETIME,
+    revoked_at DATETIME
+);
+
+-- 聊天记录表
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    room_id INTEGER NOT NULL,
+    player_name TEXT NOT NULL,
+    message TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_room_time ON chat_messages(room_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_chat_messages_player_time ON chat_messages(player_name, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_chat_messages_time ON chat_messages(created_at DESC);
+
 -- 插件服表（全局唯一的TShock插件服）
 CREATE TABLE IF NOT EXISTS plugin_server (
     id INTEGER PRIMARY KEY CHECK (id = 1),  -- Only one record allowed (global unique)
@@ -8,10 +8,12 @@ import (
 	"terraria-panel/api"
 	"terraria-panel/config"
 	"terraria-panel/db"
+	"terraria-panel/middleware"
 	"terraria-panel/scheduler"
 	"terraria-panel/services"
 	"terraria-panel/storage"
 	"terraria-panel/utils"
+	"time"
 	"github.com/gin-gonic/gin"
 )
 //go:embed all:web/dist
@@ -36,6 +38,9 @@ func main() {
 		log.Fatal("❌ 数据库初始化失败:", err)
 	}
 	defer db.Close()
+	if err := middleware.InitJWT(cfg.JWTSecret, time.Duration(cfg.AccessTokenTTL)*time.Minute); err != nil {
+		log.Fatal("❌ JWT 密钥初始化失败:", err)
+	}
 	roomStorage := storage.NewSQLiteRoomStorage(db.DB)
 	userStorage := storage.NewSQLiteUserStorage(db.DB)
 	taskStorage := storage.NewSQLiteTaskStorage(db.DB)
@@ -45,6 +50,14 @@ func main() {
 	api.SetRoomStorage(roomStorage)
 	api.SetUserStorage(userStorage)
 	api.InitStatsStorage(db.DB)
+	api.InitModerationStorage(db.DB)
+	api.InitConsoleStorage(db.DB)
+	api.InitAuditStorage(db.DB)
+	api.InitAccessControl(db.DB)
+	api.InitAPITokens(db.DB)
+	api.InitLoginProtection(db.DB)
+	api.InitTwoFactor(db.DB)
+	api.InitSessionStorage(db.DB, time.Duration(cfg.RefreshTokenTTL)*24*time.Hour)
 	var userCount int
 	db.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&userCount)
 	log.Printf("👥 数据库用户数: %d", userCount)
@@ -63,9 +76,15 @@ func main() {
 	log.Println("📊 初始化系统监控...")
 	api.InitSystemMonitoring()
 	log.Println("⏰ 初始化定时任务调度器...")
-	backupHandler := scheduler.NewBackupHandler(roomStorage)
+	backupStorage := storage.NewSQLiteBackupStorage(db.DB)
+	backupTargetStorage := storage.NewSQLiteBackupTargetStorage(db.DB)
+	backupService := services.NewBackupService(backupStorage, backupTargetStorage, roomStorage)
+	api.InitBackups(backupStorage, backupTargetStorage, backupService)
+	backupService.StartReplication()
+	defer backupService.StopReplication()
+	backupHandler := scheduler.NewBackupHandler(backupService)
 	restartHandler := scheduler.NewRestartHandler(roomStorage)
-	cleanupBackupHandler := scheduler.NewCleanupBackupHandler(roomStorage)
+	cleanupBackupHandler := scheduler.NewCleanupBackupHandler(backupService)
 	cleanupLogHandler := scheduler.NewCleanupLogHandler(roomStorage)
 	broadcastHandler := scheduler.NewBroadcastHandler(roomStorage)
 	customCommandHandler := scheduler.NewCustomCommandHandler(roomStorage)
@@ -86,10 +105,27 @@ func main() {
 	} else {
 		log.Println("✅ 定时任务调度器启动成功")
 	}
+	log.Println("🛡️ 初始化房间崩溃守护...")
+	roomSupervisor := services.NewRoomSupervisor(db.DB, roomStorage, api.LaunchRoom)
+	roomSupervisor.Start()
+	defer roomSupervisor.Stop()
+	api.SetRoomSupervisor(roomSupervisor)
+	log.Println("✅ 房间崩溃守护启动成功")
 	log.Println("📊 初始化玩家统计服务...")
-	logMonitor := services.NewLogMonitor(db.DB, roomStorage, sessionStorage, statsStorage, dailyStatsStorage)
+	logPipeline := services.NewLogPipeline()
+	logMonitor := services.NewLogMonitor(db.DB, roomStorage, sessionStorage, statsStorage, dailyStatsStorage, logPipeline)
 	logMonitor.Start()
-	defer logMonitor.Stop()
+	api.InitGameEvents(logPipeline)
+	api.InitChat(db.DB, logPipeline)
+	api.InitWhitelist(db.DB, logPipeline)
+	logPipeline.Subscribe("backup", backupService.HandleGameEvent)
+	logPipeline.Start()
+	defer logPipeline.Stop()
+	services.NewProcessReconciler(db.DB, roomStorage).Reconcile()
+	logMonitor.ReconcileSessions()
+	dailyStatsAggregator := services.NewDailyStatsAggregator(db.DB, dailyStatsStorage)
+	dailyStatsAggregator.Start()
+	defer dailyStatsAggregator.Stop()
 	log.Println("✅ 玩家统计服务启动成功")
 	log.Println("🔌 初始化插件服...")
 	if err := api.InitializePluginServerOnStartup(db.DB); err != nil {
@@ -97,6 +133,13 @@ func main() {
 	} else {
 		log.Println("✅ 插件服初始化成功")
 	}
+	log.Println("🚫 初始化全网封禁同步...")
+	networkBanSync := api.NewNetworkBanSync()
+	networkBanSync.Start()
+	defer networkBanSync.Stop()
+	muteExpiry := api.NewMuteExpiry()
+	muteExpiry.Start()
+	defer muteExpiry.Stop()
 	log.Println("⚙️  初始化配置服务...")
 	tshockPath := filepath.Join(config.ServersDir, "tshock")
 	api.InitConfigService(tshockPath)
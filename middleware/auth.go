@@ -1,26 +1,75 @@
 package middleware
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"terraria-panel/config"
 	"terraria-panel/models"
 	"time"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
-var jwtSecret = []byte("terraria-panel-secret-key-change-me")
+var (
+	jwtSecret        []byte
+	accessTokenTTL   = 15 * time.Minute
+	sessionValidator func(claims *Claims) bool
+)
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID int    `json:"sid"`
+	Purpose   string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
-func GenerateToken(user *models.User) (string, error) {
+func InitJWT(secret string, ttl time.Duration) error {
+	if ttl > 0 {
+		accessTokenTTL = ttl
+	}
+	if secret != "" {
+		jwtSecret = []byte(secret)
+		log.Printf("[Auth] Using JWT secret from configuration")
+		return nil
+	}
+	secretFile := filepath.Join(config.DataDir, "jwt_secret")
+	if data, err := os.ReadFile(secretFile); err == nil && len(strings.TrimSpace(string(data))) >= 32 {
+		jwtSecret = []byte(strings.TrimSpace(string(data)))
+		return nil
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("生成 JWT 密钥失败: %v", err)
+	}
+	generated := hex.EncodeToString(buf)
+	if err := os.WriteFile(secretFile, []byte(generated), 0600); err != nil {
+		return fmt.Errorf("保存 JWT 密钥失败: %v", err)
+	}
+	jwtSecret = []byte(generated)
+	log.Printf("[Auth] Generated new JWT secret at %s", secretFile)
+	return nil
+}
+func SetSessionValidator(validator func(claims *Claims) bool) {
+	sessionValidator = validator
+}
+func AccessTokenTTL() time.Duration {
+	return accessTokenTTL
+}
+func GenerateToken(user *models.User, sessionID int) (string, error) {
+	if len(jwtSecret) == 0 {
+		return "", fmt.Errorf("JWT 密钥未初始化")
+	}
 	claims := Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Role:     user.Role,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -41,28 +90,85 @@ func AuthMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		tokenString := parts[1]
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的认证令牌"})
+		claims, err := ParseToken(parts[1])
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
-		if claims, ok := token.Claims.(*Claims); ok {
-			c.Set("user_id", claims.UserID)
-			c.Set("username", claims.Username)
-			c.Set("role", claims.Role)
-		}
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
+func GenerateChallengeToken(user *models.User, purpose string, ttl time.Duration) (string, error) {
+	if len(jwtSecret) == 0 {
+		return "", fmt.Errorf("JWT 密钥未初始化")
+	}
+	claims := Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Purpose:  purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+func ParseChallengeToken(tokenString, purpose string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil || claims.Purpose != purpose {
+		return nil, fmt.Errorf("验证请求无效或已过期，请重新登录")
+	}
+	return claims, nil
+}
+func ParseToken(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("无效的认证令牌")
+	}
+	if !ValidateSession(claims) {
+		return nil, fmt.Errorf("会话已失效，请重新登录")
+	}
+	return claims, nil
+}
+func ValidateSession(claims *Claims) bool {
+	return sessionValidator == nil || sessionValidator(claims)
+}
+func parseClaims(tokenString string) (*Claims, error) {
+	if len(jwtSecret) == 0 {
+		return nil, fmt.Errorf("JWT 密钥未初始化")
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("不支持的签名算法")
+		}
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("无效的认证令牌")
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok {
+		return nil, fmt.Errorf("无效的认证令牌")
+	}
+	return claims, nil
+}
 func AdminMiddleware() gin.HandlerFunc {
+	return RequireRole(models.RoleAdmin)
+}
+func RequireRole(role string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+		if !models.HasRole(c.GetString("role"), role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足，需要 " + role + " 或更高角色"})
 			c.Abort()
 			return
 		}
@@ -14,15 +14,18 @@ const (
 	ActivityTypeRoomStart    = "room_start"
 	ActivityTypeRoomStop     = "room_stop"
 	ActivityTypeRoomRestart  = "room_restart"
+	ActivityTypeRoomCrash    = "room_crash"
 	ActivityTypePlayerJoin   = "player_join"
 	ActivityTypePlayerLeave  = "player_leave"
 	ActivityTypePlayerBan    = "player_ban"
 	ActivityTypePlayerUnban  = "player_unban"
 	ActivityTypePlayerKick   = "player_kick"
+	ActivityTypePlayerWarn   = "player_warn"
 	ActivityTypeBackup       = "backup"
 	ActivityTypeSystem       = "system"
 	ActivityTypeModInstall   = "mod_install"
 	ActivityTypeModDelete    = "mod_delete"
+	ActivityTypeBoss         = "boss"
 )
 const (
 	ColorGreen  = "green"
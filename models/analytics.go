@@ -0,0 +1,44 @@
+package models
+import "time"
+type RoomAnalytics struct {
+	RoomID         int        `json:"roomId"`
+	RoomName       string     `json:"roomName"`
+	UniquePlayers  int        `json:"uniquePlayers"`
+	Sessions       int        `json:"sessions"`
+	TotalPlayTime  int        `json:"totalPlayTime"`
+	AvgSessionTime int        `json:"avgSessionTime"`
+	PeakConcurrent int        `json:"peakConcurrent"`
+	PeakAt         *time.Time `json:"peakAt,omitempty"`
+}
+type DailyConcurrency struct {
+	Date          string     `json:"date"`
+	Peak          int        `json:"peak"`
+	PeakAt        *time.Time `json:"peakAt,omitempty"`
+	AvgConcurrent float64    `json:"avgConcurrent"`
+}
+type ActivityHeatmap struct {
+	From          string         `json:"from"`
+	To            string         `json:"to"`
+	AvgPlayers    [7][24]float64 `json:"avgPlayers"`
+	UniquePlayers [7][24]int     `json:"uniquePlayers"`
+	PeakWeekday   int            `json:"peakWeekday"`
+	PeakHour      int            `json:"peakHour"`
+	QuietWeekday  int            `json:"quietWeekday"`
+	QuietHour     int            `json:"quietHour"`
+}
+type NewReturningDay struct {
+	Date             string `json:"date"`
+	NewPlayers       int    `json:"newPlayers"`
+	ReturningPlayers int    `json:"returningPlayers"`
+}
+type RetentionPoint struct {
+	Retained int     `json:"retained"`
+	Rate     float64 `json:"rate"`
+}
+type RetentionCohort struct {
+	Date  string          `json:"date"`
+	Size  int             `json:"size"`
+	Day1  *RetentionPoint `json:"day1"`
+	Day7  *RetentionPoint `json:"day7"`
+	Day30 *RetentionPoint `json:"day30"`
+}
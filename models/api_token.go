@@ -0,0 +1,54 @@
+package models
+import "time"
+const (
+	APITokenScopeStatus  = "status"
+	APITokenScopePlayers = "players"
+	APITokenScopeStats   = "stats"
+)
+var APITokenScopes = []string{APITokenScopeStatus, APITokenScopePlayers, APITokenScopeStats}
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	RoomIDs    []int      `json:"roomIds"`
+	CreatedBy  string     `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+func IsValidAPITokenScope(scope string) bool {
+	for _, s := range APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+func (t *APIToken) IsActive() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || t.ExpiresAt.After(time.Now())
+}
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+func (t *APIToken) AllowsRoom(roomID int) bool {
+	if len(t.RoomIDs) == 0 {
+		return true
+	}
+	for _, id := range t.RoomIDs {
+		if id == roomID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package models
+import "time"
+const (
+	BackupTriggerManual     = "manual"
+	BackupTriggerScheduled  = "scheduled"
+	BackupTriggerPreRestore = "pre-restore"
+	BackupTriggerImported   = "imported"
+)
+const (
+	BackupStatusCompleted = "completed"
+	BackupStatusFailed    = "failed"
+	BackupStatusMissing   = "missing"
+	BackupStatusOffsite   = "offsite"
+)
+const (
+	BackupSaveOffline     = "offline"
+	BackupSaveConfirmed   = "confirmed"
+	BackupSaveUnconfirmed = "unconfirmed"
+)
+const (
+	BackupTypeFull        = "full"
+	BackupTypeIncremental = "incremental"
+)
+type Backup struct {
+	ID         int           `json:"backupId"`
+	Name       string        `json:"id"`
+	FileName   string        `json:"name"`
+	RoomID     int           `json:"roomId"`
+	RoomName   string        `json:"roomName"`
+	Trigger    string        `json:"trigger"`
+	Type       string        `json:"type"`
+	Note       string        `json:"note,omitempty"`
+	SHA256     string        `json:"sha256,omitempty"`
+	Size       int64         `json:"size"`
+	StoredSize int64         `json:"storedSize"`
+	FileCount  int           `json:"fileCount"`
+	CreatedBy  string        `json:"createdBy,omitempty"`
+	DurationMs int64         `json:"durationMs"`
+	SaveStatus string        `json:"saveStatus,omitempty"`
+	SaveDetail string        `json:"saveDetail,omitempty"`
+	Pinned     bool          `json:"pinned"`
+	Status     string        `json:"status"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	Copies     []*BackupCopy `json:"copies,omitempty"`
+}
+type BackupFilter struct {
+	RoomID     *int
+	RoomIDs    []int
+	Trigger    string
+	Status     string
+	SaveStatus string
+	Before     *time.Time
+}
+type OrphanBackup struct {
+	FileName  string    `json:"name"`
+	Type      string    `json:"type"`
+	RoomID    int       `json:"roomId"`
+	Size      int64     `json:"size"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+type BackupManifest struct {
+	Version   int                   `json:"version"`
+	Backup    string                `json:"backup"`
+	RoomID    int                   `json:"roomId"`
+	RoomName  string                `json:"roomName"`
+	CreatedAt time.Time             `json:"createdAt"`
+	Dirs      []string              `json:"dirs"`
+	Files     []*BackupManifestFile `json:"files"`
+}
+type BackupManifestFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Mode    uint32    `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+	Chunks  []string  `json:"chunks"`
+}
+type BackupRetentionPolicy struct {
+	RoomID      int        `json:"roomId"`
+	Enabled     bool       `json:"enabled"`
+	KeepLast    int        `json:"keepLast"`
+	KeepHourly  int        `json:"keepHourly"`
+	KeepDaily   int        `json:"keepDaily"`
+	KeepWeekly  int        `json:"keepWeekly"`
+	KeepMonthly int        `json:"keepMonthly"`
+	MaxSizeMB   int64      `json:"maxSizeMb"`
+	UpdatedBy   string     `json:"updatedBy,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
+}
+type BackupRetentionDecision struct {
+	Backup  *Backup  `json:"backup"`
+	Reasons []string `json:"reasons"`
+}
+type BackupRetentionPlan struct {
+	RoomID    int                        `json:"roomId"`
+	Policy    *BackupRetentionPolicy     `json:"policy"`
+	Keep      []*BackupRetentionDecision `json:"keep"`
+	Delete    []*BackupRetentionDecision `json:"delete"`
+	KeptSize  int64                      `json:"keptSize"`
+	FreedSize int64                      `json:"freedSize"`
+	DryRun    bool                       `json:"dryRun"`
+	Failed    []string                   `json:"failed,omitempty"`
+}
+type BackupGCResult struct {
+	ReferencedChunks int   `json:"referencedChunks"`
+	RemovedChunks    int   `json:"removedChunks"`
+	FreedBytes       int64 `json:"freedBytes"`
+}
+func IsValidBackupType(backupType string) bool {
+	return backupType == BackupTypeFull || backupType == BackupTypeIncremental
+}
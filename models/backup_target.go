@@ -0,0 +1,50 @@
+package models
+import "time"
+const (
+	BackupTargetLocal = "local"
+	BackupTargetSFTP  = "sftp"
+	BackupTargetS3    = "s3"
+)
+const (
+	BackupCopyPending  = "pending"
+	BackupCopyVerified = "verified"
+	BackupCopyFailed   = "failed"
+)
+type BackupTarget struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	Enabled       bool      `json:"enabled"`
+	Path          string    `json:"path"`
+	Host          string    `json:"host,omitempty"`
+	Bucket        string    `json:"bucket,omitempty"`
+	Region        string    `json:"region,omitempty"`
+	Username      string    `json:"username,omitempty"`
+	Secret        string    `json:"-"`
+	PrivateKey    string    `json:"-"`
+	HostKey       string    `json:"hostKey,omitempty"`
+	HasSecret     bool      `json:"hasSecret"`
+	HasPrivateKey bool      `json:"hasPrivateKey"`
+	CreatedBy     string    `json:"createdBy,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+type BackupCopy struct {
+	ID         int        `json:"id"`
+	BackupID   int        `json:"backupId"`
+	TargetID   int        `json:"targetId"`
+	TargetName string     `json:"targetName"`
+	TargetType string     `json:"targetType"`
+	RemoteName string     `json:"remoteName"`
+	Location   string     `json:"location"`
+	SHA256     string     `json:"sha256,omitempty"`
+	Size       int64      `json:"size"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	Error      string     `json:"error,omitempty"`
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+func IsValidBackupTargetType(targetType string) bool {
+	return targetType == BackupTargetLocal || targetType == BackupTargetSFTP || targetType == BackupTargetS3
+}
@@ -0,0 +1,17 @@
+package models
+import "time"
+type ChatMessage struct {
+	ID         int       `json:"id"`
+	RoomID     int       `json:"roomId"`
+	PlayerName string    `json:"playerName"`
+	Message    string    `json:"message"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+type ChatMessageFilter struct {
+	PlayerName string
+	RoomID     *int
+	RoomIDs    []int
+	Keyword    string
+	Since      *time.Time
+	Until      *time.Time
+}
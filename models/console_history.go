@@ -0,0 +1,10 @@
+package models
+import "time"
+type ConsoleCommand struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userId"`
+	Username  string    `json:"username"`
+	RoomID    int       `json:"roomId"`
+	Command   string    `json:"command"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,33 @@
+package models
+import "time"
+const (
+	GameEventJoin      = "join"
+	GameEventLeave     = "leave"
+	GameEventChat      = "chat"
+	GameEventDeath     = "death"
+	GameEventBoss      = "boss"
+	GameEventWorldSave = "world_save"
+	GameEventError     = "error"
+	GameEventStop      = "server_stop"
+)
+const (
+	BossEventAwoken   = "awoken"
+	BossEventDefeated = "defeated"
+	WorldSaveStarted  = "started"
+	WorldSaveFinished = "finished"
+	ServerStopped     = "stopped"
+	ServerCrashed     = "crashed"
+)
+type GameEvent struct {
+	Type       string    `json:"type"`
+	RoomID     int       `json:"roomId"`
+	ServerType string    `json:"serverType"`
+	PID        int       `json:"pid"`
+	PlayerName string    `json:"playerName,omitempty"`
+	IPAddress  string    `json:"ipAddress,omitempty"`
+	Target     string    `json:"target,omitempty"`
+	Action     string    `json:"action,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Line       string    `json:"line"`
+	Time       time.Time `json:"time"`
+}
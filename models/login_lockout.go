@@ -0,0 +1,29 @@
+package models
+import "time"
+const (
+	LockoutScopeAccount   = "account"
+	LockoutScopeIP        = "ip"
+	LockoutScopeAccountIP = "account_ip"
+)
+type LoginLockout struct {
+	ID          int       `json:"id"`
+	Scope       string    `json:"scope"`
+	Key         string    `json:"key"`
+	Username    string    `json:"username,omitempty"`
+	IPAddress   string    `json:"ipAddress,omitempty"`
+	Level       int       `json:"level"`
+	FailedCount int       `json:"failedCount"`
+	LockedUntil time.Time `json:"lockedUntil"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Active      bool      `json:"active"`
+}
+func (l *LoginLockout) IsActive() bool {
+	return l.LockedUntil.After(time.Now())
+}
+type LoginAttempt struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	IPAddress string    `json:"ipAddress"`
+	FailedAt  time.Time `json:"failedAt"`
+}
@@ -0,0 +1,31 @@
+package models
+import "time"
+const (
+	NetworkBanMethodConsole  = "console"
+	NetworkBanMethodDatabase = "database"
+	NetworkBanMethodBanList  = "banlist"
+)
+const (
+	NetworkBanStatusApplied = "applied"
+	NetworkBanStatusFailed  = "failed"
+	NetworkBanStatusRemoved = "removed"
+)
+type NetworkBanTarget struct {
+	ID        int        `json:"id"`
+	BanID     int        `json:"banId"`
+	RoomID    int        `json:"roomId"`
+	RoomName  string     `json:"roomName,omitempty"`
+	Method    string     `json:"method"`
+	Tickets   string     `json:"tickets,omitempty"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	Attempts  int        `json:"attempts"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+	RemovedAt *time.Time `json:"removedAt,omitempty"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+type NetworkBan struct {
+	*PlayerBan
+	Active  bool                `json:"active"`
+	Targets []*NetworkBanTarget `json:"targets"`
+}
@@ -0,0 +1,23 @@
+package models
+import "time"
+type PlayerBan struct {
+	ID          int        `json:"id"`
+	PlayerID    int        `json:"playerId"`
+	PlayerName  string     `json:"playerName"`
+	IP          string     `json:"ip,omitempty"`
+	Reason      string     `json:"reason"`
+	RoomID      int        `json:"roomId"`
+	BannedBy    string     `json:"bannedBy,omitempty"`
+	ExternalRef string     `json:"externalRef,omitempty"`
+	Network     bool       `json:"network"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	LiftedAt    *time.Time `json:"liftedAt,omitempty"`
+	LiftedBy    string     `json:"liftedBy,omitempty"`
+}
+func (b *PlayerBan) IsActive() bool {
+	if b.LiftedAt != nil {
+		return false
+	}
+	return b.ExpiresAt == nil || b.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,62 @@
+package models
+import "time"
+const (
+	InfractionWarning = "warning"
+	InfractionNote    = "note"
+	InfractionMute    = "mute"
+	InfractionKick    = "kick"
+	InfractionBan     = "ban"
+)
+const SettingInfractionPolicy = "infraction_escalation_policy"
+type PlayerInfraction struct {
+	ID          int        `json:"id"`
+	PlayerID    int        `json:"playerId,omitempty"`
+	PlayerName  string     `json:"playerName"`
+	Type        string     `json:"type"`
+	Reason      string     `json:"reason"`
+	EvidenceURL string     `json:"evidenceUrl,omitempty"`
+	RoomID      *int       `json:"roomId,omitempty"`
+	BanID       int        `json:"banId,omitempty"`
+	Escalated   bool       `json:"escalated"`
+	CreatedBy   string     `json:"createdBy"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+	RevokedBy   string     `json:"revokedBy,omitempty"`
+	LiftedAt    *time.Time `json:"liftedAt,omitempty"`
+}
+func (i *PlayerInfraction) IsActive() bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	return i.ExpiresAt == nil || i.ExpiresAt.After(time.Now())
+}
+type PlayerInfractionFilter struct {
+	PlayerName string
+	Type       string
+	RoomID     *int
+	CreatedBy  string
+	ActiveOnly bool
+	Since      *time.Time
+}
+type InfractionPolicy struct {
+	Enabled          bool `json:"enabled"`
+	WarningThreshold int  `json:"warningThreshold"`
+	WindowDays       int  `json:"windowDays"`
+	BanDurationHours int  `json:"banDurationHours"`
+}
+func DefaultInfractionPolicy() InfractionPolicy {
+	return InfractionPolicy{
+		Enabled:          true,
+		WarningThreshold: 3,
+		WindowDays:       30,
+		BanDurationHours: 24,
+	}
+}
+func IsValidInfractionType(infractionType string) bool {
+	switch infractionType {
+	case InfractionWarning, InfractionNote, InfractionMute, InfractionKick, InfractionBan:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package models
+import "time"
+const (
+	PlayerLinkIP   = "ip"
+	PlayerLinkUUID = "uuid"
+)
+type PlayerLinkEvidence struct {
+	Kind         string     `json:"kind"`
+	Value        string     `json:"value"`
+	Sources      []string   `json:"sources"`
+	FirstOverlap *time.Time `json:"firstOverlap,omitempty"`
+	LastOverlap  *time.Time `json:"lastOverlap,omitempty"`
+}
+type LinkedAccount struct {
+	Name         string               `json:"name"`
+	PlayerID     int                  `json:"playerId,omitempty"`
+	Banned       bool                 `json:"banned"`
+	SharedIPs    []string             `json:"sharedIps"`
+	SharedUUID   bool                 `json:"sharedUuid"`
+	FirstOverlap *time.Time           `json:"firstOverlap,omitempty"`
+	LastOverlap  *time.Time           `json:"lastOverlap,omitempty"`
+	Evidence     []PlayerLinkEvidence `json:"evidence"`
+}
+type PlayerLinkNode struct {
+	Name     string `json:"name"`
+	PlayerID int    `json:"playerId,omitempty"`
+	Banned   bool   `json:"banned"`
+	Depth    int    `json:"depth"`
+}
+type PlayerLinkEdge struct {
+	Source       string               `json:"source"`
+	Target       string               `json:"target"`
+	SharedUUID   bool                 `json:"sharedUuid"`
+	SharedIPs    []string             `json:"sharedIps"`
+	FirstOverlap *time.Time           `json:"firstOverlap,omitempty"`
+	LastOverlap  *time.Time           `json:"lastOverlap,omitempty"`
+	Evidence     []PlayerLinkEvidence `json:"evidence"`
+}
+type PlayerLinkGraph struct {
+	Root      string           `json:"root"`
+	Nodes     []PlayerLinkNode `json:"nodes"`
+	Edges     []PlayerLinkEdge `json:"edges"`
+	Truncated bool             `json:"truncated"`
+}
@@ -0,0 +1,26 @@
+package models
+import "time"
+type PlayerRoomVisit struct {
+	RoomID     int       `json:"roomId"`
+	RoomName   string    `json:"roomName"`
+	Sessions   int       `json:"sessions"`
+	PlayTime   int       `json:"playTime"`
+	FirstVisit time.Time `json:"firstVisit"`
+	LastVisit  time.Time `json:"lastVisit"`
+}
+type PlayerIPRecord struct {
+	IP        string     `json:"ip"`
+	Sources   []string   `json:"sources"`
+	Sessions  int        `json:"sessions"`
+	FirstSeen *time.Time `json:"firstSeen,omitempty"`
+	LastSeen  *time.Time `json:"lastSeen,omitempty"`
+}
+type TShockAccount struct {
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	UUID         string     `json:"uuid"`
+	Group        string     `json:"group"`
+	Registered   *time.Time `json:"registered,omitempty"`
+	LastAccessed *time.Time `json:"lastAccessed,omitempty"`
+	KnownIPs     []string   `json:"knownIps"`
+}
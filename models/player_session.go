@@ -1,16 +1,17 @@
 package models
 import "time"
 type PlayerSession struct {
-	ID         int       `json:"id"`
-	PlayerID   int       `json:"playerId"`
-	PlayerName string    `json:"playerName,omitempty"`
-	RoomID     int       `json:"roomId"`
-	RoomName   string    `json:"roomName,omitempty"`
-	JoinTime   time.Time `json:"joinTime"`
-	LeaveTime  *time.Time `json:"leaveTime,omitempty"`
-	Duration   int       `json:"duration"`
-	IPAddress  string    `json:"ipAddress,omitempty"`
-	CreatedAt  time.Time `json:"createdAt"`
+	ID             int        `json:"id"`
+	PlayerID       int        `json:"playerId"`
+	PlayerName     string     `json:"playerName,omitempty"`
+	RoomID         int        `json:"roomId"`
+	RoomName       string     `json:"roomName,omitempty"`
+	JoinTime       time.Time  `json:"joinTime"`
+	LeaveTime      *time.Time `json:"leaveTime,omitempty"`
+	Duration       int        `json:"duration"`
+	IPAddress      string     `json:"ipAddress,omitempty"`
+	ClosedBySystem bool       `json:"closedBySystem"`
+	CreatedAt      time.Time  `json:"createdAt"`
 }
 func (s *PlayerSession) IsOnline() bool {
 	return s.LeaveTime == nil
@@ -0,0 +1,75 @@
+package models
+import "time"
+const (
+	RoleOwner    = "owner"
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+const (
+	RoomPermissionView    = "view"
+	RoomPermissionOperate = "operate"
+	RoomPermissionManage  = "manage"
+)
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+	RoleOwner:    4,
+}
+var roomPermissionLevels = map[string]int{
+	RoomPermissionView:    1,
+	RoomPermissionOperate: 2,
+	RoomPermissionManage:  3,
+}
+func RoleLevel(role string) int {
+	return roleLevels[role]
+}
+func IsValidRole(role string) bool {
+	return RoleLevel(role) > 0
+}
+func HasRole(role, required string) bool {
+	return RoleLevel(required) > 0 && RoleLevel(role) >= RoleLevel(required)
+}
+func RoomPermissionLevel(permission string) int {
+	return roomPermissionLevels[permission]
+}
+func IsValidRoomPermission(permission string) bool {
+	return RoomPermissionLevel(permission) > 0
+}
+func DefaultRoomPermission(role string) string {
+	switch role {
+	case RoleOwner, RoleAdmin:
+		return RoomPermissionManage
+	case RoleOperator:
+		return RoomPermissionOperate
+	case RoleViewer:
+		return RoomPermissionView
+	}
+	return ""
+}
+type RoomGrant struct {
+	ID         int       `json:"id,omitempty"`
+	UserID     int       `json:"userId,omitempty"`
+	RoomID     int       `json:"roomId"`
+	Permission string    `json:"permission"`
+	GrantedBy  string    `json:"grantedBy,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+type Invitation struct {
+	ID        int         `json:"id"`
+	Code      string      `json:"code"`
+	Role      string      `json:"role"`
+	Grants    []RoomGrant `json:"grants"`
+	CreatedBy string      `json:"createdBy"`
+	CreatedAt time.Time   `json:"createdAt"`
+	ExpiresAt *time.Time  `json:"expiresAt,omitempty"`
+	UsedAt    *time.Time  `json:"usedAt,omitempty"`
+	UsedBy    string      `json:"usedBy,omitempty"`
+}
+func (i *Invitation) IsUsable() bool {
+	if i.UsedAt != nil {
+		return false
+	}
+	return i.ExpiresAt == nil || i.ExpiresAt.After(time.Now())
+}
@@ -16,10 +16,30 @@ type Room struct {
 	PID         int        `json:"pid,omitempty" db:"pid"`
 	StartTime   *time.Time `json:"startTime,omitempty" db:"start_time"`
 	AdminToken  string     `json:"adminToken,omitempty" db:"admin_token"`
+	RestartPolicy string   `json:"restartPolicy,omitempty" db:"restart_policy"`
+	MaxRestarts   *int     `json:"maxRestarts,omitempty" db:"max_restarts"`
+	RestartWindow int      `json:"restartWindow,omitempty" db:"restart_window"`
 	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
 	UpdatedAt   time.Time  `json:"updatedAt" db:"updated_at"`
+	Adopted     bool       `json:"adopted,omitempty" db:"-"`
 	CustomHome  string     `json:"-" db:"-"`
 }
+const (
+	RestartPolicyNever     = "never"
+	RestartPolicyOnFailure = "on-failure"
+	RestartPolicyAlways    = "always"
+)
+const (
+	DefaultMaxRestarts   = 5
+	DefaultRestartWindow = 600
+)
+func IsValidRestartPolicy(policy string) bool {
+	switch policy {
+	case RestartPolicyNever, RestartPolicyOnFailure, RestartPolicyAlways:
+		return true
+	}
+	return false
+}
 type Player struct {
 	ID        int       `json:"id" db:"id"`
 	Name      string    `json:"name" db:"name"`
@@ -43,10 +63,30 @@ type User struct {
 type OperationLog struct {
 	ID         int       `json:"id" db:"id"`
 	UserID     int       `json:"userId" db:"user_id"`
+	Username   string    `json:"username" db:"username"`
 	Action     string    `json:"action" db:"action"`
+	Method     string    `json:"method" db:"method"`
+	Path       string    `json:"path" db:"path"`
 	TargetType string    `json:"targetType" db:"target_type"`
 	TargetID   int       `json:"targetId" db:"target_id"`
+	TargetName string    `json:"targetName,omitempty" db:"target_name"`
+	RoomID     *int      `json:"roomId,omitempty" db:"room_id"`
+	Before     string    `json:"before,omitempty" db:"before_value"`
+	After      string    `json:"after,omitempty" db:"after_value"`
 	Details    string    `json:"details" db:"details"`
+	StatusCode int       `json:"statusCode" db:"status_code"`
 	IPAddress  string    `json:"ipAddress" db:"ip_address"`
 	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
 }
+type OperationLogFilter struct {
+	UserID     int
+	Username   string
+	Action     string
+	TargetType string
+	TargetID   int
+	RoomID     *int
+	IPAddress  string
+	Since      *time.Time
+	Until      *time.Time
+	FailedOnly bool
+}
@@ -0,0 +1,10 @@
+package models
+import "time"
+const SettingTwoFactorRequiredRole = "two_factor_required_role"
+type TwoFactor struct {
+	UserID    int        `json:"userId"`
+	Secret    string     `json:"-"`
+	Enabled   bool       `json:"enabled"`
+	EnabledAt *time.Time `json:"enabledAt,omitempty"`
+	LastStep  int64      `json:"-"`
+}
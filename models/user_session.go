@@ -0,0 +1,18 @@
+package models
+import "time"
+type UserSession struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"userId"`
+	RefreshHash  string     `json:"-"`
+	Device       string     `json:"device"`
+	UserAgent    string     `json:"userAgent"`
+	IPAddress    string     `json:"ipAddress"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastActiveAt time.Time  `json:"lastActiveAt"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	RevokedAt    *time.Time `json:"revokedAt,omitempty"`
+	Current      bool       `json:"current"`
+}
+func (s *UserSession) IsActive() bool {
+	return s.RevokedAt == nil && s.ExpiresAt.After(time.Now())
+}
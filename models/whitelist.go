@@ -0,0 +1,32 @@
+package models
+import "time"
+const (
+	WhitelistScopeRoom  = "room"
+	WhitelistScopeGroup = "group"
+)
+type WhitelistGroup struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedBy   string    `json:"createdBy,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	RoomIDs     []int     `json:"roomIds"`
+	EntryCount  int       `json:"entryCount"`
+}
+type RoomWhitelist struct {
+	RoomID    int        `json:"roomId"`
+	Enabled   bool       `json:"enabled"`
+	GroupID   *int       `json:"groupId,omitempty"`
+	UpdatedBy string     `json:"updatedBy,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+type WhitelistEntry struct {
+	ID         int       `json:"id"`
+	Scope      string    `json:"scope"`
+	ScopeID    int       `json:"scopeId"`
+	PlayerName string    `json:"playerName"`
+	IP         string    `json:"ip,omitempty"`
+	Note       string    `json:"note,omitempty"`
+	AddedBy    string    `json:"addedBy,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
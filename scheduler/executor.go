@@ -17,13 +17,14 @@ type TaskExecutor struct {
 	customCommandHandler   CustomCommandHandler
 }
 type BackupHandler interface {
-	CreateBackup(roomID int, backupType string, note string) error
+	CreateBackup(roomID int, backupType string, note string, targetIDs []int) error
 }
 type RestartHandler interface {
 	RestartRoom(roomID int) error
 }
 type CleanupBackupHandler interface {
 	CleanupOldBackups(roomID int, daysToKeep int) error
+	ApplyRetention(roomID int) error
 }
 type CleanupLogHandler interface {
 	CleanupOldLogs(roomID int, daysToKeep int) error
@@ -68,6 +69,8 @@ func (e *TaskExecutor) Execute(task *models.ScheduledTask) error {
 		return e.executeRestart(params)
 	case "cleanup_backup":
 		return e.executeCleanupBackup(params)
+	case "backup_retention":
+		return e.executeBackupRetention(params)
 	case "cleanup_log":
 		return e.executeCleanupLog(params)
 	case "broadcast":
@@ -96,6 +99,14 @@ func (e *TaskExecutor) executeBackup(params map[string]interface{}) error {
 	if n, ok := params["note"].(string); ok {
 		note = n
 	}
+	targetIDs := []int{}
+	if targetIDsRaw, ok := params["targetIds"].([]interface{}); ok {
+		for _, idRaw := range targetIDsRaw {
+			if id, ok := idRaw.(float64); ok {
+				targetIDs = append(targetIDs, int(id))
+			}
+		}
+	}
 	if len(roomIDs) == 0 {
 		log.Println("[Executor] Backing up all rooms...")
 		rooms, err := e.roomStorage.GetAll()
@@ -108,7 +119,7 @@ func (e *TaskExecutor) executeBackup(params map[string]interface{}) error {
 	}
 	for _, roomID := range roomIDs {
 		log.Printf("[Executor] Backing up room %d...", roomID)
-		if err := e.backupHandler.CreateBackup(roomID, backupType, note); err != nil {
+		if err := e.backupHandler.CreateBackup(roomID, backupType, note, targetIDs); err != nil {
 			log.Printf("[Executor] Failed to backup room %d: %v", roomID, err)
 			return fmt.Errorf("failed to backup room %d: %w", roomID, err)
 		}
@@ -150,6 +161,18 @@ func (e *TaskExecutor) executeCleanupBackup(params map[string]interface{}) error
 	log.Println("[Executor] Cleanup backup task completed successfully")
 	return nil
 }
+func (e *TaskExecutor) executeBackupRetention(params map[string]interface{}) error {
+	log.Println("[Executor] Executing backup retention task...")
+	roomID := 0
+	if id, ok := params["roomId"].(float64); ok {
+		roomID = int(id)
+	}
+	if err := e.cleanupBackupHandler.ApplyRetention(roomID); err != nil {
+		return fmt.Errorf("failed to apply backup retention: %w", err)
+	}
+	log.Println("[Executor] Backup retention task completed successfully")
+	return nil
+}
 func (e *TaskExecutor) executeCleanupLog(params map[string]interface{}) error {
 	log.Println("[Executor] Executing cleanup log task...")
 	roomID := 0
@@ -7,79 +7,35 @@ import (
 	"path/filepath"
 	"strings"
 	"terraria-panel/config"
+	"terraria-panel/models"
+	"terraria-panel/services"
 	"terraria-panel/storage"
 	"terraria-panel/utils"
 	"time"
-	"archive/zip"
 )
 type BackupHandlerImpl struct {
-	roomStorage storage.RoomStorage
+	backupService *services.BackupService
 }
-func NewBackupHandler(roomStorage storage.RoomStorage) BackupHandler {
+func NewBackupHandler(backupService *services.BackupService) BackupHandler {
 	return &BackupHandlerImpl{
-		roomStorage: roomStorage,
+		backupService: backupService,
 	}
 }
-func (h *BackupHandlerImpl) CreateBackup(roomID int, backupType string, note string) error {
+func (h *BackupHandlerImpl) CreateBackup(roomID int, backupType string, note string, targetIDs []int) error {
 	log.Printf("[BackupHandler] Creating backup for room %d...", roomID)
-	room, err := h.roomStorage.GetByID(roomID)
-	if err != nil {
-		return fmt.Errorf("failed to get room: %w", err)
-	}
-	timestamp := time.Now().Format("20060102_150405")
-	zipName := fmt.Sprintf("room-%d_%s_%s.zip", room.ID, room.Name, timestamp)
-	zipPath := filepath.Join(config.BackupDir, zipName)
-	log.Printf("[BackupHandler] Creating backup file: %s", zipName)
-	zipFile, err := os.Create(zipPath)
-	if err != nil {
-		return fmt.Errorf("failed to create ZIP file: %w", err)
-	}
-	defer zipFile.Close()
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
-	roomDir := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", room.ID))
-	if _, err := os.Stat(roomDir); os.IsNotExist(err) {
-		return fmt.Errorf("room directory does not exist: %s", roomDir)
-	}
-	if err := addDirToZip(zipWriter, roomDir, ""); err != nil {
-		return fmt.Errorf("failed to add room directory to ZIP: %w", err)
-	}
-	log.Printf("[BackupHandler] Backup created successfully: %s", zipName)
-	return nil
-}
-func addDirToZip(zipWriter *zip.Writer, sourceDir string, baseInZip string) error {
-	entries, err := os.ReadDir(sourceDir)
+	backup, err := h.backupService.Create(roomID, services.BackupOptions{
+		Trigger:   models.BackupTriggerScheduled,
+		Type:      backupType,
+		Note:      note,
+		CreatedBy: "scheduler",
+		TargetIDs: targetIDs,
+	})
 	if err != nil {
 		return err
 	}
-	for _, entry := range entries {
-		sourcePath := filepath.Join(sourceDir, entry.Name())
-		zipPath := filepath.Join(baseInZip, entry.Name())
-		if entry.IsDir() {
-			if err := addDirToZip(zipWriter, sourcePath, zipPath); err != nil {
-				return err
-			}
-		} else {
-			if err := addFileToZip(zipWriter, sourcePath, zipPath); err != nil {
-				return err
-			}
-		}
-	}
+	log.Printf("[BackupHandler] Backup created successfully: %s", backup.FileName)
 	return nil
 }
-func addFileToZip(zipWriter *zip.Writer, filePath string, zipPath string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	writer, err := zipWriter.Create(zipPath)
-	if err != nil {
-		return err
-	}
-	_, err = file.WriteTo(writer)
-	return err
-}
 type RestartHandlerImpl struct {
 	roomStorage storage.RoomStorage
 }
@@ -129,14 +85,13 @@ func (h *RestartHandlerImpl) RestartRoom(roomID int) error {
 		return fmt.Errorf("unsupported server type: %s", room.ServerType)
 	}
 	logFile, err := os.OpenFile(
-		filepath.Join(roomDir, "server.log"),
+		filepath.Join(config.LogsDir, fmt.Sprintf("room-%d.log", roomID)),
 		os.O_CREATE|os.O_WRONLY|os.O_APPEND,
 		0644,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create log file: %w", err)
 	}
-	defer logFile.Close()
 	process, err := utils.StartProcess(
 		roomID,
 		cmd,
@@ -147,6 +102,7 @@ func (h *RestartHandlerImpl) RestartRoom(roomID int) error {
 		room.ServerType,
 	)
 	if err != nil {
+		logFile.Close()
 		return fmt.Errorf("failed to start room: %w", err)
 	}
 	h.roomStorage.UpdateStatus(roomID, "running", process.GetPID())
@@ -154,47 +110,39 @@ func (h *RestartHandlerImpl) RestartRoom(roomID int) error {
 	return nil
 }
 type CleanupBackupHandlerImpl struct {
-	roomStorage storage.RoomStorage
+	backupService *services.BackupService
 }
-func NewCleanupBackupHandler(roomStorage storage.RoomStorage) CleanupBackupHandler {
+func NewCleanupBackupHandler(backupService *services.BackupService) CleanupBackupHandler {
 	return &CleanupBackupHandlerImpl{
-		roomStorage: roomStorage,
+		backupService: backupService,
 	}
 }
 func (h *CleanupBackupHandlerImpl) CleanupOldBackups(roomID int, daysToKeep int) error {
 	log.Printf("[CleanupBackupHandler] Cleaning up backups older than %d days for room %d...", daysToKeep, roomID)
-	backupDir := filepath.Join(config.DataDir, "backups")
-	if roomID > 0 {
-		backupDir = filepath.Join(backupDir, fmt.Sprintf("room-%d", roomID))
+	deletedCount, err := h.backupService.DeleteOlderThan(roomID, time.Now().AddDate(0, 0, -daysToKeep))
+	if err != nil {
+		return fmt.Errorf("failed to list old backups: %w", err)
 	}
-	if _, err := os.Stat(backupDir); os.IsNotExist(err) {
-		log.Printf("[CleanupBackupHandler] Backup directory does not exist: %s", backupDir)
-		return nil
+	log.Printf("[CleanupBackupHandler] Cleanup completed. Deleted %d old backup files.", deletedCount)
+	return nil
+}
+func (h *CleanupBackupHandlerImpl) ApplyRetention(roomID int) error {
+	if roomID <= 0 {
+		log.Println("[CleanupBackupHandler] Applying retention policies to all rooms...")
+		return h.backupService.ApplyAllRetention()
 	}
-	cutoffTime := time.Now().AddDate(0, 0, -daysToKeep)
-	files, err := ioutil.ReadDir(backupDir)
+	log.Printf("[CleanupBackupHandler] Applying retention policy to room %d...", roomID)
+	plan, err := h.backupService.ApplyRetention(roomID)
 	if err != nil {
-		return fmt.Errorf("failed to read backup directory: %w", err)
+		return err
 	}
-	deletedCount := 0
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		if !strings.HasSuffix(file.Name(), ".zip") {
-			continue
-		}
-		if file.ModTime().Before(cutoffTime) {
-			filePath := filepath.Join(backupDir, file.Name())
-			if err := os.Remove(filePath); err != nil {
-				log.Printf("[CleanupBackupHandler] Failed to delete backup file %s: %v", filePath, err)
-				continue
-			}
-			log.Printf("[CleanupBackupHandler] Deleted old backup: %s", file.Name())
-			deletedCount++
-		}
+	if plan == nil {
+		log.Printf("[CleanupBackupHandler] Room %d has no enabled retention policy", roomID)
+		return nil
+	}
+	if len(plan.Failed) > 0 {
+		return fmt.Errorf("failed to delete %d backups", len(plan.Failed))
 	}
-	log.Printf("[CleanupBackupHandler] Cleanup completed. Deleted %d old backup files.", deletedCount)
 	return nil
 }
 type CleanupLogHandlerImpl struct {
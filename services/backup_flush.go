@@ -0,0 +1,119 @@
+package services
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"terraria-panel/models"
+	"terraria-panel/utils"
+	"time"
+)
+const (
+	backupSaveTimeout      = 60 * time.Second
+	backupStableInterval   = time.Second
+	backupStableMaxSamples = 10
+)
+type worldFileState struct {
+	Size    int64
+	ModTime time.Time
+}
+func (s *BackupService) HandleGameEvent(event *models.GameEvent) {
+	if event.Type != models.GameEventWorldSave || event.Action != models.WorldSaveFinished {
+		return
+	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	for _, waiter := range s.saveWaiters[event.RoomID] {
+		close(waiter)
+	}
+	delete(s.saveWaiters, event.RoomID)
+}
+func (s *BackupService) addSaveWaiter(roomID int) chan struct{} {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	waiter := make(chan struct{})
+	s.saveWaiters[roomID] = append(s.saveWaiters[roomID], waiter)
+	return waiter
+}
+func (s *BackupService) removeSaveWaiter(roomID int, waiter chan struct{}) {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	waiters := s.saveWaiters[roomID]
+	for i, w := range waiters {
+		if w == waiter {
+			s.saveWaiters[roomID] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(s.saveWaiters[roomID]) == 0 {
+		delete(s.saveWaiters, roomID)
+	}
+}
+func (s *BackupService) flushWorld(roomID int, roomDir string) (string, string) {
+	process, exists := utils.GetProcess(roomID)
+	if !exists || !process.IsRunning() {
+		return models.BackupSaveOffline, ""
+	}
+	waiter := s.addSaveWaiter(roomID)
+	defer s.removeSaveWaiter(roomID, waiter)
+	log.Printf("[Backup] Saving world of room #%d before backup...", roomID)
+	if err := process.SendCommand("save"); err != nil {
+		return models.BackupSaveUnconfirmed, "failed to send save command: " + err.Error()
+	}
+	if serverType := process.GetServerType(); !confirmsWorldSave(serverType) {
+		waitWorldFilesStable(roomDir)
+		return models.BackupSaveUnconfirmed, fmt.Sprintf("%s servers do not report when a world save has finished", serverType)
+	}
+	select {
+	case <-waiter:
+	case <-time.After(backupSaveTimeout):
+		return models.BackupSaveUnconfirmed, fmt.Sprintf("world save was not confirmed within %s", backupSaveTimeout)
+	}
+	if !waitWorldFilesStable(roomDir) {
+		return models.BackupSaveUnconfirmed, "world file size did not settle after save"
+	}
+	log.Printf("[Backup] World of room #%d saved", roomID)
+	return models.BackupSaveConfirmed, ""
+}
+func waitWorldFilesStable(roomDir string) bool {
+	previous := worldFileSnapshot(roomDir)
+	for i := 0; i < backupStableMaxSamples; i++ {
+		time.Sleep(backupStableInterval)
+		current := worldFileSnapshot(roomDir)
+		if sameWorldFiles(previous, current) {
+			return true
+		}
+		previous = current
+	}
+	return false
+}
+func worldFileSnapshot(roomDir string) map[string]worldFileState {
+	snapshot := make(map[string]worldFileState)
+	filepath.Walk(roomDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		name := info.Name()
+		if !strings.HasSuffix(name, ".wld") && !strings.HasSuffix(name, ".twld") {
+			return nil
+		}
+		if relPath, err := filepath.Rel(roomDir, path); err == nil {
+			snapshot[filepath.ToSlash(relPath)] = worldFileState{Size: info.Size(), ModTime: info.ModTime()}
+		}
+		return nil
+	})
+	return snapshot
+}
+func sameWorldFiles(a, b map[string]worldFileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, state := range a {
+		other, ok := b[name]
+		if !ok || other.Size != state.Size || !other.ModTime.Equal(state.ModTime) {
+			return false
+		}
+	}
+	return true
+}
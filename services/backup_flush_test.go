@@ -0,0 +1,41 @@
+package services
+import (
+	"testing"
+	"terraria-panel/models"
+	"terraria-panel/utils"
+	"time"
+)
+func TestFlushWorldOnlyConfirmsSavesTheServerReports(t *testing.T) {
+	for i, serverType := range []string{"vanilla", "tmodloader", "tshock"} {
+		roomID := 91000 + i
+		p, err := utils.StartProcess(roomID, "sh", []string{"-c", "cat > /dev/null"}, "", nil, nil, serverType)
+		if err != nil {
+			t.Fatalf("%s: StartProcess: %v", serverType, err)
+		}
+		s := &BackupService{saveWaiters: make(map[int][]chan struct{})}
+		if confirmsWorldSave(serverType) {
+			go func() {
+				for {
+					s.saveMu.Lock()
+					waiting := len(s.saveWaiters[roomID]) > 0
+					s.saveMu.Unlock()
+					if waiting {
+						break
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				s.HandleGameEvent(&models.GameEvent{RoomID: roomID, Type: models.GameEventWorldSave, Action: models.WorldSaveFinished})
+			}()
+		}
+		status, detail := s.flushWorld(roomID, t.TempDir())
+		want := models.BackupSaveUnconfirmed
+		if serverType == "tshock" {
+			want = models.BackupSaveConfirmed
+		}
+		if status != want {
+			t.Errorf("%s: save status %q (%s), want %q", serverType, status, detail, want)
+		}
+		utils.StopProcess(roomID)
+		<-p.Done()
+	}
+}
@@ -0,0 +1,365 @@
+package services
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"terraria-panel/config"
+	"terraria-panel/models"
+	"time"
+)
+const (
+	backupReplicationQueueSize     = 256
+	backupReplicationSweepInterval = 30 * time.Second
+	backupReplicationBackoff       = time.Minute
+	backupReplicationMaxAttempts   = 6
+)
+func backupTempDir() string {
+	return filepath.Join(config.BackupDir, "tmp")
+}
+func backupCopyName(backup *models.Backup) string {
+	return backup.Name + ".zip"
+}
+func (s *BackupService) StartReplication() {
+	s.wg.Add(1)
+	go s.runReplication()
+}
+func (s *BackupService) StopReplication() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+func (s *BackupService) runReplication() {
+	defer s.wg.Done()
+	s.queueRetryableCopies()
+	ticker := time.NewTicker(backupReplicationSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case copyID := <-s.replicationQueue:
+			s.replicateCopy(copyID)
+		case <-ticker.C:
+			s.queueRetryableCopies()
+		}
+	}
+}
+func (s *BackupService) replicationTargets(roomID int, extra []int) []int {
+	targetIDs, err := s.targetStorage.GetRoomTargets(roomID)
+	if err != nil {
+		log.Printf("[Backup] Failed to load backup targets of room #%d: %v", roomID, err)
+		targetIDs = []int{}
+	}
+	seen := make(map[int]bool)
+	for _, targetID := range targetIDs {
+		seen[targetID] = true
+	}
+	for _, targetID := range extra {
+		if !seen[targetID] {
+			seen[targetID] = true
+			targetIDs = append(targetIDs, targetID)
+		}
+	}
+	return targetIDs
+}
+func (s *BackupService) Replicate(backup *models.Backup, targetIDs []int) ([]*models.BackupCopy, error) {
+	if len(targetIDs) == 0 {
+		targetIDs = s.replicationTargets(backup.RoomID, nil)
+	}
+	copies := []*models.BackupCopy{}
+	for _, targetID := range targetIDs {
+		target, err := s.targetStorage.Get(targetID)
+		if err != nil {
+			return copies, err
+		}
+		if target == nil || !target.Enabled {
+			log.Printf("[Backup] Skipping replication of %s to missing or disabled target #%d", backup.Name, targetID)
+			continue
+		}
+		backupCopy, err := s.targetStorage.FindCopy(backup.ID, target.ID)
+		if err != nil {
+			return copies, err
+		}
+		if backupCopy == nil {
+			backupCopy = &models.BackupCopy{BackupID: backup.ID, TargetID: target.ID, RemoteName: backupCopyName(backup)}
+		} else if backupCopy.Status == models.BackupCopyVerified {
+			copies = append(copies, backupCopy)
+			continue
+		}
+		backupCopy.TargetName = target.Name
+		backupCopy.TargetType = target.Type
+		backupCopy.Status = models.BackupCopyPending
+		backupCopy.Attempts = 0
+		backupCopy.Error = ""
+		if err := s.targetStorage.SaveCopy(backupCopy); err != nil {
+			return copies, err
+		}
+		copies = append(copies, backupCopy)
+		s.queueCopy(backupCopy.ID)
+	}
+	return copies, nil
+}
+func (s *BackupService) queueCopy(copyID int) {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	if s.queuedCopies[copyID] {
+		return
+	}
+	select {
+	case s.replicationQueue <- copyID:
+		s.queuedCopies[copyID] = true
+	default:
+	}
+}
+func (s *BackupService) queueRetryableCopies() {
+	copies, err := s.targetStorage.GetRetryableCopies(backupReplicationMaxAttempts)
+	if err != nil {
+		log.Printf("[Backup] Failed to load pending backup copies: %v", err)
+		return
+	}
+	for _, backupCopy := range copies {
+		if backupCopy.Status == models.BackupCopyFailed && backupCopy.Attempts > 0 &&
+			time.Since(backupCopy.UpdatedAt) < backupReplicationBackoff<<(backupCopy.Attempts-1) {
+			continue
+		}
+		s.queueCopy(backupCopy.ID)
+	}
+}
+func (s *BackupService) replicateCopy(copyID int) {
+	s.queueMu.Lock()
+	delete(s.queuedCopies, copyID)
+	s.queueMu.Unlock()
+	backupCopy, err := s.targetStorage.GetCopy(copyID)
+	if err != nil {
+		log.Printf("[Backup] Failed to load backup copy #%d: %v", copyID, err)
+		return
+	}
+	if backupCopy == nil || backupCopy.Status == models.BackupCopyVerified {
+		return
+	}
+	backup, err := s.backupStorage.GetByID(backupCopy.BackupID)
+	if err != nil {
+		log.Printf("[Backup] Failed to load backup #%d for replication: %v", backupCopy.BackupID, err)
+		return
+	}
+	if backup == nil {
+		return
+	}
+	target, err := s.targetStorage.Get(backupCopy.TargetID)
+	if err != nil {
+		log.Printf("[Backup] Failed to load backup target #%d: %v", backupCopy.TargetID, err)
+		return
+	}
+	start := time.Now()
+	backupCopy.Attempts++
+	if err := s.uploadCopy(backup, target, backupCopy); err != nil {
+		backupCopy.Status = models.BackupCopyFailed
+		backupCopy.Error = err.Error()
+		log.Printf("[Backup] Replication of %s to %s failed (attempt %d/%d): %v",
+			backup.Name, backupCopy.TargetName, backupCopy.Attempts, backupReplicationMaxAttempts, err)
+	} else {
+		now := time.Now()
+		backupCopy.Status = models.BackupCopyVerified
+		backupCopy.Error = ""
+		backupCopy.VerifiedAt = &now
+		log.Printf("[Backup] Replicated %s to %s (%d bytes, %s)",
+			backup.Name, backupCopy.Location, backupCopy.Size, time.Since(start).Round(time.Millisecond))
+	}
+	if current, err := s.backupStorage.GetByID(backup.ID); err == nil && current == nil {
+		log.Printf("[Backup] Backup %s was deleted during replication, removing its copy on %s", backup.Name, backupCopy.TargetName)
+		s.deleteRemoteCopy(backupCopy)
+		return
+	}
+	if err := s.targetStorage.SaveCopy(backupCopy); err != nil {
+		log.Printf("[Backup] Failed to record copy of %s on %s: %v", backup.Name, backupCopy.TargetName, err)
+	}
+}
+func (s *BackupService) uploadCopy(backup *models.Backup, target *models.BackupTarget, backupCopy *models.BackupCopy) error {
+	if target == nil {
+		return errors.New("backup target no longer exists")
+	}
+	backupCopy.TargetName = target.Name
+	backupCopy.TargetType = target.Type
+	if !target.Enabled {
+		return errors.New("backup target is disabled")
+	}
+	if backup.Status != models.BackupStatusCompleted {
+		return fmt.Errorf("local backup is %s", backup.Status)
+	}
+	if err := s.Verify(backup); err != nil {
+		return fmt.Errorf("local backup failed verification: %w", err)
+	}
+	sourcePath := s.Path(backup)
+	checksum, size := backup.SHA256, backup.Size
+	if backup.Type == models.BackupTypeIncremental {
+		zipPath, zipChecksum, zipSize, err := s.writeTempZip(backup)
+		if err != nil {
+			return fmt.Errorf("failed to build snapshot archive: %w", err)
+		}
+		defer os.Remove(zipPath)
+		sourcePath, checksum, size = zipPath, zipChecksum, zipSize
+	} else if checksum == "" {
+		var err error
+		if checksum, size, err = fileSHA256(sourcePath); err != nil {
+			return err
+		}
+	}
+	remote, err := s.openTarget(target)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer remote.Close()
+	backupCopy.RemoteName = backupCopyName(backup)
+	backupCopy.Location = remote.Location(backupCopy.RemoteName)
+	backupCopy.SHA256 = checksum
+	backupCopy.Size = size
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := remote.Put(backupCopy.RemoteName, file, size, checksum); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	if err := remote.Verify(backupCopy.RemoteName, size, checksum); err != nil {
+		return fmt.Errorf("upload verification failed: %w", err)
+	}
+	return nil
+}
+func (s *BackupService) openTarget(target *models.BackupTarget) (BackupTarget, error) {
+	pinned := target.HostKey
+	remote, err := OpenBackupTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if pinned == "" && target.HostKey != "" {
+		if err := s.targetStorage.PinHostKey(target.ID, target.HostKey); err != nil {
+			remote.Close()
+			return nil, fmt.Errorf("failed to pin host key %s: %w", target.HostKey, err)
+		}
+	}
+	return remote, nil
+}
+func (s *BackupService) writeTempZip(backup *models.Backup) (string, string, int64, error) {
+	if err := os.MkdirAll(backupTempDir(), 0755); err != nil {
+		return "", "", 0, err
+	}
+	tmp, err := os.CreateTemp(backupTempDir(), backup.Name+"-*.zip")
+	if err != nil {
+		return "", "", 0, err
+	}
+	hash := sha256.New()
+	counter := &countingWriter{}
+	err = s.WriteZip(backup, io.MultiWriter(tmp, hash, counter))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", "", 0, err
+	}
+	return tmp.Name(), hex.EncodeToString(hash.Sum(nil)), counter.n, nil
+}
+type countingWriter struct {
+	n int64
+}
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+func (s *BackupService) FetchCopy(backupCopy *models.BackupCopy) (string, error) {
+	target, err := s.targetStorage.Get(backupCopy.TargetID)
+	if err != nil {
+		return "", err
+	}
+	if target == nil {
+		return "", errors.New("backup target no longer exists")
+	}
+	remote, err := s.openTarget(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect: %w", err)
+	}
+	defer remote.Close()
+	if err := os.MkdirAll(backupTempDir(), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(backupTempDir(), "restore-*.zip")
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	err = remote.Get(backupCopy.RemoteName, io.MultiWriter(tmp, hash))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && backupCopy.SHA256 != "" && hex.EncodeToString(hash.Sum(nil)) != backupCopy.SHA256 {
+		err = ErrBackupChecksumMismatch
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	log.Printf("[Backup] Downloaded copy of backup #%d from %s", backupCopy.BackupID, backupCopy.Location)
+	return tmp.Name(), nil
+}
+func (s *BackupService) deleteCopies(backup *models.Backup) {
+	copies, err := s.targetStorage.GetCopies([]int{backup.ID})
+	if err != nil {
+		log.Printf("[Backup] Failed to load copies of backup %s: %v", backup.Name, err)
+		return
+	}
+	for _, backupCopy := range copies {
+		if backupCopy.Status != models.BackupCopyPending {
+			s.deleteRemoteCopy(backupCopy)
+		}
+	}
+	if err := s.targetStorage.DeleteCopies(backup.ID); err != nil {
+		log.Printf("[Backup] Failed to remove copy records of backup %s: %v", backup.Name, err)
+	}
+}
+func (s *BackupService) keepVerifiedCopies(backup *models.Backup) (int, error) {
+	copies, err := s.targetStorage.GetCopies([]int{backup.ID})
+	if err != nil {
+		return 0, err
+	}
+	kept := 0
+	for _, backupCopy := range copies {
+		if backupCopy.Status == models.BackupCopyVerified {
+			kept++
+		}
+	}
+	if kept == 0 {
+		return 0, nil
+	}
+	for _, backupCopy := range copies {
+		if backupCopy.Status == models.BackupCopyVerified {
+			continue
+		}
+		if backupCopy.Status != models.BackupCopyPending {
+			s.deleteRemoteCopy(backupCopy)
+		}
+		if err := s.targetStorage.DeleteCopy(backupCopy.ID); err != nil {
+			log.Printf("[Backup] Failed to remove copy record of backup %s on %s: %v", backup.Name, backupCopy.TargetName, err)
+		}
+	}
+	return kept, nil
+}
+func (s *BackupService) deleteRemoteCopy(backupCopy *models.BackupCopy) {
+	target, err := s.targetStorage.Get(backupCopy.TargetID)
+	if err != nil || target == nil {
+		return
+	}
+	remote, err := s.openTarget(target)
+	if err != nil {
+		log.Printf("[Backup] Failed to connect to %s to delete %s: %v", target.Name, backupCopy.RemoteName, err)
+		return
+	}
+	defer remote.Close()
+	if err := remote.Delete(backupCopy.RemoteName); err != nil {
+		log.Printf("[Backup] Failed to delete %s: %v", backupCopy.Location, err)
+	}
+}
@@ -0,0 +1,183 @@
+package services
+import (
+	"fmt"
+	"log"
+	"terraria-panel/models"
+	"time"
+)
+type retentionRule struct {
+	reason string
+	keep   int
+	bucket func(t time.Time) string
+}
+func retentionRules(policy *models.BackupRetentionPolicy) []retentionRule {
+	return []retentionRule{
+		{"hourly", policy.KeepHourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{"daily", policy.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", policy.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{"monthly", policy.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+}
+func backupDiskSize(backup *models.Backup) int64 {
+	if backup.StoredSize > 0 {
+		return backup.StoredSize
+	}
+	return backup.Size
+}
+func (s *BackupService) PlanRetention(roomID int, policy *models.BackupRetentionPolicy) (*models.BackupRetentionPlan, error) {
+	if policy == nil {
+		var err error
+		if policy, err = s.backupStorage.GetRetentionPolicy(roomID); err != nil {
+			return nil, err
+		}
+	}
+	backups, _, err := s.backupStorage.List(models.BackupFilter{RoomID: &roomID}, -1, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, backup := range backups {
+		s.RefreshStatus(backup)
+	}
+	return buildRetentionPlan(roomID, policy, backups), nil
+}
+func buildRetentionPlan(roomID int, policy *models.BackupRetentionPolicy, backups []*models.Backup) *models.BackupRetentionPlan {
+	plan := &models.BackupRetentionPlan{
+		RoomID: roomID,
+		Policy: policy,
+		Keep:   []*models.BackupRetentionDecision{},
+		Delete: []*models.BackupRetentionDecision{},
+	}
+	reasons := make(map[int][]string)
+	candidates := []*models.Backup{}
+	for _, backup := range backups {
+		if backup.Pinned {
+			reasons[backup.ID] = append(reasons[backup.ID], "pinned")
+		}
+		if backup.Trigger == models.BackupTriggerPreRestore {
+			reasons[backup.ID] = append(reasons[backup.ID], "pre-restore")
+		}
+		if backup.Status == models.BackupStatusOffsite {
+			reasons[backup.ID] = append(reasons[backup.ID], "offsite")
+		}
+		if backup.Status != models.BackupStatusCompleted {
+			if len(reasons[backup.ID]) == 0 {
+				plan.Delete = append(plan.Delete, &models.BackupRetentionDecision{Backup: backup, Reasons: []string{backup.Status}})
+			}
+			continue
+		}
+		if len(reasons[backup.ID]) == 0 {
+			candidates = append(candidates, backup)
+		}
+	}
+	for i, backup := range candidates {
+		if i < policy.KeepLast {
+			reasons[backup.ID] = append(reasons[backup.ID], "last")
+		}
+	}
+	limited := policy.KeepLast > 0
+	for _, rule := range retentionRules(policy) {
+		if rule.keep <= 0 {
+			continue
+		}
+		limited = true
+		kept := 0
+		lastBucket := ""
+		for _, backup := range candidates {
+			if kept >= rule.keep {
+				break
+			}
+			bucket := rule.bucket(backup.CreatedAt.Local())
+			if bucket == lastBucket {
+				continue
+			}
+			lastBucket = bucket
+			reasons[backup.ID] = append(reasons[backup.ID], rule.reason)
+			kept++
+		}
+	}
+	kept := []*models.Backup{}
+	for _, backup := range backups {
+		if backup.Status != models.BackupStatusCompleted && len(reasons[backup.ID]) == 0 {
+			continue
+		}
+		if !limited && len(reasons[backup.ID]) == 0 {
+			reasons[backup.ID] = []string{"unlimited"}
+		}
+		if len(reasons[backup.ID]) == 0 {
+			plan.Delete = append(plan.Delete, &models.BackupRetentionDecision{Backup: backup, Reasons: []string{"expired"}})
+			continue
+		}
+		kept = append(kept, backup)
+		if backup.Status == models.BackupStatusCompleted {
+			plan.KeptSize += backupDiskSize(backup)
+		}
+	}
+	if maxSize := policy.MaxSizeMB << 20; maxSize > 0 {
+		for i := len(kept) - 1; i > 0 && plan.KeptSize > maxSize; i-- {
+			if kept[i].Pinned || kept[i].Trigger == models.BackupTriggerPreRestore || kept[i].Status != models.BackupStatusCompleted {
+				continue
+			}
+			plan.KeptSize -= backupDiskSize(kept[i])
+			plan.Delete = append(plan.Delete, &models.BackupRetentionDecision{Backup: kept[i], Reasons: []string{"size-cap"}})
+			reasons[kept[i].ID] = nil
+		}
+	}
+	for _, backup := range kept {
+		if len(reasons[backup.ID]) > 0 {
+			plan.Keep = append(plan.Keep, &models.BackupRetentionDecision{Backup: backup, Reasons: reasons[backup.ID]})
+		}
+	}
+	for _, decision := range plan.Delete {
+		if decision.Backup.Status == models.BackupStatusCompleted {
+			plan.FreedSize += backupDiskSize(decision.Backup)
+		}
+	}
+	return plan
+}
+func (s *BackupService) ApplyRetention(roomID int) (*models.BackupRetentionPlan, error) {
+	policy, err := s.backupStorage.GetRetentionPolicy(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !policy.Enabled {
+		return nil, nil
+	}
+	plan, err := s.PlanRetention(roomID, policy)
+	if err != nil {
+		return nil, err
+	}
+	incremental := false
+	for _, decision := range plan.Delete {
+		if err := s.Delete(decision.Backup, false); err != nil {
+			log.Printf("[Backup] Retention failed to delete backup %s: %v", decision.Backup.Name, err)
+			plan.Failed = append(plan.Failed, decision.Backup.Name)
+			continue
+		}
+		incremental = incremental || decision.Backup.Type == models.BackupTypeIncremental
+	}
+	if incremental {
+		if _, err := s.GarbageCollect(); err != nil {
+			log.Printf("[Backup] Garbage collection failed: %v", err)
+		}
+	}
+	if len(plan.Delete) > 0 {
+		log.Printf("[Backup] Retention for room #%d kept %d backups and deleted %d (%d bytes)",
+			roomID, len(plan.Keep), len(plan.Delete)-len(plan.Failed), plan.FreedSize)
+	}
+	return plan, nil
+}
+func (s *BackupService) ApplyAllRetention() error {
+	roomIDs, err := s.backupStorage.GetEnabledRetentionRooms()
+	if err != nil {
+		return err
+	}
+	for _, roomID := range roomIDs {
+		if _, err := s.ApplyRetention(roomID); err != nil {
+			log.Printf("[Backup] Retention for room #%d failed: %v", roomID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package services
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"terraria-panel/models"
+	"time"
+)
+var retentionTestNow = time.Date(2024, 3, 31, 12, 0, 0, 0, time.Local)
+func retentionTestTime(dayOffset, hour int) time.Time {
+	day := time.Date(retentionTestNow.Year(), retentionTestNow.Month(), retentionTestNow.Day(), 0, 0, 0, 0, time.Local)
+	return day.AddDate(0, 0, dayOffset).Add(time.Duration(hour) * time.Hour)
+}
+func retentionTestBackups() []*models.Backup {
+	backups := []*models.Backup{}
+	for i := 0; i < 70*4; i++ {
+		backups = append(backups, &models.Backup{
+			ID:        i + 1,
+			Status:    models.BackupStatusCompleted,
+			Trigger:   models.BackupTriggerScheduled,
+			Size:      1 << 20,
+			CreatedAt: retentionTestNow.Add(-time.Duration(i) * 6 * time.Hour),
+		})
+	}
+	return backups
+}
+func retentionDecisions(decisions []*models.BackupRetentionDecision) map[time.Time]string {
+	result := make(map[time.Time]string)
+	for _, decision := range decisions {
+		reasons := append([]string{}, decision.Reasons...)
+		sort.Strings(reasons)
+		result[decision.Backup.CreatedAt] = strings.Join(reasons, ",")
+	}
+	return result
+}
+func TestBuildRetentionPlanBuckets(t *testing.T) {
+	at := retentionTestTime
+	tests := []struct {
+		name   string
+		policy models.BackupRetentionPolicy
+		keep   map[time.Time]string
+	}{
+		{"keep last", models.BackupRetentionPolicy{KeepLast: 3}, map[time.Time]string{
+			at(0, 12): "last", at(0, 6): "last", at(0, 0): "last",
+		}},
+		{"hourly", models.BackupRetentionPolicy{KeepHourly: 4}, map[time.Time]string{
+			at(0, 12): "hourly", at(0, 6): "hourly", at(0, 0): "hourly", at(-1, 18): "hourly",
+		}},
+		{"daily keeps newest per day", models.BackupRetentionPolicy{KeepDaily: 3}, map[time.Time]string{
+			at(0, 12): "daily", at(-1, 18): "daily", at(-2, 18): "daily",
+		}},
+		{"weekly follows ISO weeks", models.BackupRetentionPolicy{KeepWeekly: 2}, map[time.Time]string{
+			at(0, 12): "weekly", at(-7, 18): "weekly",
+		}},
+		{"monthly", models.BackupRetentionPolicy{KeepMonthly: 3}, map[time.Time]string{
+			at(0, 12): "monthly", at(-31, 18): "monthly", at(-60, 18): "monthly",
+		}},
+		{"rules overlap", models.BackupRetentionPolicy{KeepLast: 1, KeepDaily: 2, KeepWeekly: 2}, map[time.Time]string{
+			at(0, 12): "daily,last,weekly", at(-1, 18): "daily", at(-7, 18): "weekly",
+		}},
+		{"more slots than buckets", models.BackupRetentionPolicy{KeepMonthly: 12}, map[time.Time]string{
+			at(0, 12): "monthly", at(-31, 18): "monthly", at(-60, 18): "monthly",
+		}},
+	}
+	for _, tt := range tests {
+		backups := retentionTestBackups()
+		policy := tt.policy
+		plan := buildRetentionPlan(1, &policy, backups)
+		if got := retentionDecisions(plan.Keep); !reflect.DeepEqual(got, tt.keep) {
+			t.Errorf("%s: kept %v, want %v", tt.name, got, tt.keep)
+		}
+		if len(plan.Keep)+len(plan.Delete) != len(backups) {
+			t.Errorf("%s: %d kept + %d deleted, want %d backups", tt.name, len(plan.Keep), len(plan.Delete), len(backups))
+		}
+	}
+}
+func TestBuildRetentionPlanUnlimited(t *testing.T) {
+	plan := buildRetentionPlan(1, &models.BackupRetentionPolicy{}, retentionTestBackups())
+	if len(plan.Delete) != 0 || len(plan.Keep) != 70*4 {
+		t.Errorf("empty policy kept %d and deleted %d, want everything kept", len(plan.Keep), len(plan.Delete))
+	}
+}
+func TestBuildRetentionPlanExemptions(t *testing.T) {
+	at := retentionTestTime
+	backups := []*models.Backup{
+		{ID: 1, Status: models.BackupStatusCompleted, Trigger: models.BackupTriggerPreRestore, Size: 1 << 20, CreatedAt: at(0, 12)},
+		{ID: 2, Status: models.BackupStatusCompleted, Trigger: models.BackupTriggerScheduled, Size: 1 << 20, CreatedAt: at(0, 6)},
+		{ID: 3, Status: models.BackupStatusFailed, Trigger: models.BackupTriggerScheduled, Size: 1 << 20, CreatedAt: at(0, 3)},
+		{ID: 4, Status: models.BackupStatusCompleted, Trigger: models.BackupTriggerScheduled, Size: 1 << 20, CreatedAt: at(0, 0)},
+		{ID: 5, Status: models.BackupStatusMissing, Trigger: models.BackupTriggerManual, Size: 1 << 20, CreatedAt: at(-1, 12)},
+		{ID: 6, Status: models.BackupStatusMissing, Trigger: models.BackupTriggerManual, Pinned: true, Size: 1 << 20, CreatedAt: at(-1, 6)},
+		{ID: 7, Status: models.BackupStatusCompleted, Trigger: models.BackupTriggerManual, Pinned: true, Size: 1 << 20, CreatedAt: at(-5, 0)},
+		{ID: 8, Status: models.BackupStatusCompleted, Trigger: models.BackupTriggerPreRestore, Size: 1 << 20, CreatedAt: at(-40, 0)},
+		{ID: 9, Status: models.BackupStatusCompleted, Trigger: models.BackupTriggerScheduled, Size: 1 << 20, CreatedAt: at(-41, 0)},
+		{ID: 10, Status: models.BackupStatusOffsite, Trigger: models.BackupTriggerScheduled, Size: 1 << 20, CreatedAt: at(-2, 0)},
+	}
+	tests := []struct {
+		name   string
+		policy models.BackupRetentionPolicy
+		keep   map[time.Time]string
+		delete map[time.Time]string
+	}{
+		{"exempt backups do not use slots", models.BackupRetentionPolicy{KeepLast: 1, KeepDaily: 1}, map[time.Time]string{
+			at(0, 12): "pre-restore", at(0, 6): "daily,last", at(-1, 6): "pinned", at(-5, 0): "pinned", at(-40, 0): "pre-restore", at(-2, 0): "offsite",
+		}, map[time.Time]string{
+			at(0, 3): "failed", at(0, 0): "expired", at(-1, 12): "missing", at(-41, 0): "expired",
+		}},
+		{"failed rows are cleaned without limits", models.BackupRetentionPolicy{}, map[time.Time]string{
+			at(0, 12): "pre-restore", at(0, 6): "unlimited", at(0, 0): "unlimited", at(-1, 6): "pinned",
+			at(-5, 0): "pinned", at(-40, 0): "pre-restore", at(-41, 0): "unlimited", at(-2, 0): "offsite",
+		}, map[time.Time]string{
+			at(0, 3): "failed", at(-1, 12): "missing",
+		}},
+		{"size cap spares exempt backups", models.BackupRetentionPolicy{KeepLast: 3, MaxSizeMB: 4}, map[time.Time]string{
+			at(0, 12): "pre-restore", at(0, 6): "last", at(-1, 6): "pinned", at(-5, 0): "pinned", at(-40, 0): "pre-restore", at(-2, 0): "offsite",
+		}, map[time.Time]string{
+			at(0, 3): "failed", at(0, 0): "size-cap", at(-1, 12): "missing", at(-41, 0): "size-cap",
+		}},
+	}
+	for _, tt := range tests {
+		policy := tt.policy
+		plan := buildRetentionPlan(1, &policy, backups)
+		if got := retentionDecisions(plan.Keep); !reflect.DeepEqual(got, tt.keep) {
+			t.Errorf("%s: kept %v, want %v", tt.name, got, tt.keep)
+		}
+		if got := retentionDecisions(plan.Delete); !reflect.DeepEqual(got, tt.delete) {
+			t.Errorf("%s: deleted %v, want %v", tt.name, got, tt.delete)
+		}
+	}
+}
@@ -0,0 +1,586 @@
+package services
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"terraria-panel/config"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"time"
+)
+var ErrBackupChecksumMismatch = errors.New("backup checksum mismatch")
+var backupFilePattern = regexp.MustCompile(`^room-(\d+)_(.+)_(\d{8}_\d{6})(?:_\d+)?\.zip$`)
+type BackupOptions struct {
+	Trigger   string
+	Type      string
+	Note      string
+	CreatedBy string
+	TargetIDs []int
+}
+type BackupService struct {
+	backupStorage    storage.BackupStorage
+	targetStorage    storage.BackupTargetStorage
+	roomStorage      storage.RoomStorage
+	mu               sync.Mutex
+	storeMu          sync.RWMutex
+	saveWaiters      map[int][]chan struct{}
+	saveMu           sync.Mutex
+	replicationQueue chan int
+	queuedCopies     map[int]bool
+	queueMu          sync.Mutex
+	stopChan         chan struct{}
+	wg               sync.WaitGroup
+}
+func NewBackupService(backupStorage storage.BackupStorage, targetStorage storage.BackupTargetStorage, roomStorage storage.RoomStorage) *BackupService {
+	return &BackupService{
+		backupStorage:    backupStorage,
+		targetStorage:    targetStorage,
+		roomStorage:      roomStorage,
+		saveWaiters:      make(map[int][]chan struct{}),
+		replicationQueue: make(chan int, backupReplicationQueueSize),
+		queuedCopies:     make(map[int]bool),
+		stopChan:         make(chan struct{}),
+	}
+}
+func (s *BackupService) Path(backup *models.Backup) string {
+	if backup.Type == models.BackupTypeIncremental {
+		return filepath.Join(backupManifestDir(), backup.FileName)
+	}
+	return filepath.Join(config.BackupDir, backup.FileName)
+}
+func (s *BackupService) Create(roomID int, opts BackupOptions) (*models.Backup, error) {
+	room, err := s.roomStorage.GetByID(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	roomDir := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", room.ID))
+	if _, err := os.Stat(roomDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("room directory does not exist: %s", roomDir)
+	}
+	if opts.Trigger == "" {
+		opts.Trigger = models.BackupTriggerManual
+	}
+	if opts.Type == "" {
+		opts.Type = models.BackupTypeFull
+	}
+	if !models.IsValidBackupType(opts.Type) {
+		return nil, fmt.Errorf("unsupported backup type: %s", opts.Type)
+	}
+	start := time.Now()
+	saveStatus, saveDetail := s.flushWorld(room.ID, roomDir)
+	worldFiles := worldFileSnapshot(roomDir)
+	s.mu.Lock()
+	name := fmt.Sprintf("room-%d_%s_%s", room.ID, room.Name, start.Format("20060102_150405"))
+	for i := 2; s.nameTaken(name); i++ {
+		name = fmt.Sprintf("room-%d_%s_%s_%d", room.ID, room.Name, start.Format("20060102_150405"), i)
+	}
+	fileName := name + ".zip"
+	if opts.Type == models.BackupTypeIncremental {
+		fileName = name + ".json"
+	}
+	backup := &models.Backup{
+		Name:       name,
+		FileName:   fileName,
+		RoomID:     room.ID,
+		RoomName:   room.Name,
+		Trigger:    opts.Trigger,
+		Type:       opts.Type,
+		Note:       opts.Note,
+		CreatedBy:  opts.CreatedBy,
+		SaveStatus: saveStatus,
+		SaveDetail: saveDetail,
+		Status:     models.BackupStatusCompleted,
+		CreatedAt:  start,
+	}
+	path := s.Path(backup)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	placeholder, err := os.Create(path)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	placeholder.Close()
+	log.Printf("[Backup] Creating %s %s backup for room #%d: %s", opts.Trigger, opts.Type, room.ID, backup.FileName)
+	if opts.Type == models.BackupTypeIncremental {
+		err = s.writeIncremental(backup, path, roomDir)
+	} else {
+		err = s.writeFull(backup, path, roomDir)
+	}
+	backup.DurationMs = time.Since(start).Milliseconds()
+	if err == nil && !sameWorldFiles(worldFiles, worldFileSnapshot(roomDir)) {
+		backup.SaveStatus = models.BackupSaveUnconfirmed
+		backup.SaveDetail = "world file changed while the backup was being written"
+	}
+	if backup.SaveStatus == models.BackupSaveUnconfirmed {
+		log.Printf("[Backup] Backup %s of room #%d is not a confirmed consistent snapshot: %s", backup.Name, room.ID, backup.SaveDetail)
+	}
+	if err != nil {
+		os.Remove(path)
+		backup.Status = models.BackupStatusFailed
+		backup.Error = err.Error()
+		backup.FileCount = 0
+		backup.SHA256 = ""
+		backup.Size = 0
+		backup.StoredSize = 0
+		if recordErr := s.backupStorage.Create(backup); recordErr != nil {
+			log.Printf("[Backup] Failed to record failed backup %s: %v", backup.Name, recordErr)
+		}
+		return backup, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := s.backupStorage.Create(backup); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to record backup: %w", err)
+	}
+	log.Printf("[Backup] Backup created: %s (%d files, %d bytes, %d bytes stored, %dms)",
+		backup.FileName, backup.FileCount, backup.Size, backup.StoredSize, backup.DurationMs)
+	if _, err := s.Replicate(backup, s.replicationTargets(room.ID, opts.TargetIDs)); err != nil {
+		log.Printf("[Backup] Failed to queue replication of backup %s: %v", backup.Name, err)
+	}
+	if opts.Trigger != models.BackupTriggerPreRestore {
+		if _, err := s.ApplyRetention(room.ID); err != nil {
+			log.Printf("[Backup] Retention for room #%d failed: %v", room.ID, err)
+		}
+	}
+	return backup, nil
+}
+func (s *BackupService) writeFull(backup *models.Backup, zipPath, roomDir string) error {
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		return fmt.Errorf("failed to create ZIP file: %w", err)
+	}
+	backup.FileCount, err = writeBackupZip(zipFile, roomDir)
+	if closeErr := zipFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	backup.SHA256, backup.Size, err = fileSHA256(zipPath)
+	backup.StoredSize = backup.Size
+	return err
+}
+func (s *BackupService) writeIncremental(backup *models.Backup, manifestPath, roomDir string) error {
+	s.storeMu.RLock()
+	defer s.storeMu.RUnlock()
+	manifest := &models.BackupManifest{
+		Version:   1,
+		Backup:    backup.Name,
+		RoomID:    backup.RoomID,
+		RoomName:  backup.RoomName,
+		CreatedAt: backup.CreatedAt,
+		Dirs:      []string{},
+		Files:     []*models.BackupManifestFile{},
+	}
+	stored, err := writeBackupManifest(manifestPath, roomDir, manifest)
+	if err != nil {
+		return err
+	}
+	backup.FileCount = len(manifest.Files)
+	for _, file := range manifest.Files {
+		backup.Size += file.Size
+	}
+	backup.StoredSize = stored
+	backup.SHA256, _, err = fileSHA256(manifestPath)
+	return err
+}
+func (s *BackupService) nameTaken(name string) bool {
+	if _, err := os.Stat(filepath.Join(config.BackupDir, name+".zip")); err == nil {
+		return true
+	}
+	existing, err := s.backupStorage.GetByName(name)
+	return err == nil && existing != nil
+}
+func (s *BackupService) Verify(backup *models.Backup) error {
+	if backup.SHA256 != "" {
+		sum, _, err := fileSHA256(s.Path(backup))
+		if err != nil {
+			return err
+		}
+		if sum != backup.SHA256 {
+			return ErrBackupChecksumMismatch
+		}
+	}
+	if backup.Type != models.BackupTypeIncremental {
+		return nil
+	}
+	manifest, err := readBackupManifest(s.Path(backup))
+	if err != nil {
+		return err
+	}
+	for _, file := range manifest.Files {
+		for _, hash := range file.Chunks {
+			if _, err := os.Stat(backupObjectPath(hash)); err != nil {
+				return fmt.Errorf("%s: chunk %s is missing", file.Path, hash)
+			}
+		}
+	}
+	return nil
+}
+func (s *BackupService) WriteZip(backup *models.Backup, w io.Writer) error {
+	manifest, err := readBackupManifest(s.Path(backup))
+	if err != nil {
+		return err
+	}
+	s.storeMu.RLock()
+	defer s.storeMu.RUnlock()
+	return writeManifestZip(w, manifest)
+}
+func (s *BackupService) Restore(backup *models.Backup, roomID int) (int, int, error) {
+	if backup.Type != models.BackupTypeIncremental {
+		return s.RestoreZip(backup, s.Path(backup), roomID)
+	}
+	roomDir := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", roomID))
+	if err := os.MkdirAll(roomDir, 0755); err != nil {
+		return 0, 0, fmt.Errorf("failed to create room directory: %w", err)
+	}
+	manifest, err := readBackupManifest(s.Path(backup))
+	if err != nil {
+		return 0, 0, err
+	}
+	s.storeMu.RLock()
+	defer s.storeMu.RUnlock()
+	restored, err := restoreManifest(manifest, roomDir)
+	return restored, len(manifest.Files), err
+}
+func (s *BackupService) RestoreZip(backup *models.Backup, zipPath string, roomID int) (int, int, error) {
+	roomDir := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", roomID))
+	if err := os.MkdirAll(roomDir, 0755); err != nil {
+		return 0, 0, fmt.Errorf("failed to create room directory: %w", err)
+	}
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer zipReader.Close()
+	restored := 0
+	for _, file := range zipReader.File {
+		destPath, ok := safeJoin(roomDir, file.Name)
+		if !ok {
+			log.Printf("[Backup] Skipping unsafe path in backup %s: %s", backup.Name, file.Name)
+			continue
+		}
+		if file.FileInfo().IsDir() {
+			os.MkdirAll(destPath, 0755)
+			continue
+		}
+		if err := extractZipFile(file, destPath); err != nil {
+			log.Printf("[Backup] Failed to restore %s: %v", file.Name, err)
+			continue
+		}
+		restored++
+	}
+	return restored, len(zipReader.File), nil
+}
+func (s *BackupService) Delete(backup *models.Backup, deleteCopies bool) error {
+	if err := os.Remove(s.Path(backup)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !deleteCopies {
+		kept, err := s.keepVerifiedCopies(backup)
+		if err != nil {
+			return err
+		}
+		if kept > 0 {
+			log.Printf("[Backup] Removed local files of backup %s, keeping %d offsite copies", backup.Name, kept)
+			if err := s.backupStorage.UpdateStatus(backup.ID, models.BackupStatusOffsite, ""); err != nil {
+				return err
+			}
+			backup.Status = models.BackupStatusOffsite
+			return nil
+		}
+	}
+	s.deleteCopies(backup)
+	return s.backupStorage.Delete(backup.ID)
+}
+func (s *BackupService) DeleteOlderThan(roomID int, cutoff time.Time) (int, error) {
+	filter := models.BackupFilter{Before: &cutoff}
+	if roomID > 0 {
+		filter.RoomID = &roomID
+	}
+	backups, _, err := s.backupStorage.List(filter, -1, 0)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	incremental := false
+	for _, backup := range backups {
+		if backup.Pinned || backup.Trigger == models.BackupTriggerPreRestore || backup.Status == models.BackupStatusOffsite {
+			continue
+		}
+		if err := s.Delete(backup, false); err != nil {
+			log.Printf("[Backup] Failed to delete backup %s: %v", backup.Name, err)
+			continue
+		}
+		incremental = incremental || backup.Type == models.BackupTypeIncremental
+		deleted++
+	}
+	if incremental {
+		if _, err := s.GarbageCollect(); err != nil {
+			log.Printf("[Backup] Garbage collection failed: %v", err)
+		}
+	}
+	return deleted, nil
+}
+func (s *BackupService) GarbageCollect() (*models.BackupGCResult, error) {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+	result := &models.BackupGCResult{}
+	entries, err := os.ReadDir(backupManifestDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	referenced := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		if info, err := entry.Info(); err != nil || info.Size() == 0 {
+			continue
+		}
+		manifest, err := readBackupManifest(filepath.Join(backupManifestDir(), entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %w", entry.Name(), err)
+		}
+		for _, file := range manifest.Files {
+			for _, hash := range file.Chunks {
+				referenced[hash] = true
+			}
+		}
+	}
+	result.ReferencedChunks = len(referenced)
+	objectsDir := filepath.Join(backupStoreDir(), "objects")
+	err = filepath.Walk(objectsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || referenced[info.Name()] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("[Backup] Failed to remove chunk %s: %v", info.Name(), err)
+			return nil
+		}
+		result.RemovedChunks++
+		result.FreedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Backup] Garbage collection removed %d chunks (%d bytes), %d still referenced",
+		result.RemovedChunks, result.FreedBytes, result.ReferencedChunks)
+	return result, nil
+}
+func (s *BackupService) RefreshStatus(backup *models.Backup) {
+	if backup.Status != models.BackupStatusCompleted && backup.Status != models.BackupStatusMissing {
+		return
+	}
+	status := models.BackupStatusCompleted
+	if _, err := os.Stat(s.Path(backup)); os.IsNotExist(err) {
+		status = models.BackupStatusMissing
+	}
+	if status == backup.Status {
+		return
+	}
+	if err := s.backupStorage.UpdateStatus(backup.ID, status, ""); err != nil {
+		log.Printf("[Backup] Failed to update status of backup %s: %v", backup.Name, err)
+		return
+	}
+	backup.Status = status
+}
+func (s *BackupService) Check() ([]*models.OrphanBackup, []*models.Backup, error) {
+	backups, _, err := s.backupStorage.List(models.BackupFilter{}, -1, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	cataloged := make(map[string]bool)
+	missing := []*models.Backup{}
+	for _, backup := range backups {
+		cataloged[backup.FileName] = true
+		s.RefreshStatus(backup)
+		if backup.Status == models.BackupStatusMissing {
+			missing = append(missing, backup)
+		}
+	}
+	entries, err := os.ReadDir(config.BackupDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	orphans := []*models.OrphanBackup{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".zip") || cataloged[entry.Name()] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		orphan := &models.OrphanBackup{FileName: entry.Name(), Type: models.BackupTypeFull, Size: info.Size(), UpdatedAt: info.ModTime()}
+		if matches := backupFilePattern.FindStringSubmatch(entry.Name()); matches != nil {
+			orphan.RoomID, _ = strconv.Atoi(matches[1])
+		}
+		orphans = append(orphans, orphan)
+	}
+	manifests, err := os.ReadDir(backupManifestDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	for _, entry := range manifests {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") || cataloged[entry.Name()] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		orphan := &models.OrphanBackup{FileName: entry.Name(), Type: models.BackupTypeIncremental, Size: info.Size(), UpdatedAt: info.ModTime()}
+		if manifest, err := readBackupManifest(filepath.Join(backupManifestDir(), entry.Name())); err == nil {
+			orphan.RoomID = manifest.RoomID
+		}
+		orphans = append(orphans, orphan)
+	}
+	return orphans, missing, nil
+}
+func (s *BackupService) ImportOrphans(createdBy string) ([]*models.Backup, error) {
+	orphans, _, err := s.Check()
+	if err != nil {
+		return nil, err
+	}
+	imported := []*models.Backup{}
+	for _, orphan := range orphans {
+		backup := &models.Backup{
+			Name:      strings.TrimSuffix(strings.TrimSuffix(orphan.FileName, ".zip"), ".json"),
+			FileName:  orphan.FileName,
+			RoomID:    orphan.RoomID,
+			Trigger:   models.BackupTriggerImported,
+			Type:      orphan.Type,
+			CreatedBy: createdBy,
+			Status:    models.BackupStatusCompleted,
+			CreatedAt: orphan.UpdatedAt,
+		}
+		if matches := backupFilePattern.FindStringSubmatch(orphan.FileName); matches != nil {
+			backup.RoomName = matches[2]
+			if t, err := time.ParseInLocation("20060102_150405", matches[3], time.Local); err == nil {
+				backup.CreatedAt = t
+			}
+		}
+		path := s.Path(backup)
+		if backup.SHA256, backup.Size, err = fileSHA256(path); err != nil {
+			log.Printf("[Backup] Failed to hash orphan backup %s: %v", orphan.FileName, err)
+			continue
+		}
+		backup.StoredSize = backup.Size
+		if backup.Type == models.BackupTypeIncremental {
+			if manifest, err := readBackupManifest(path); err == nil {
+				backup.RoomName = manifest.RoomName
+				backup.CreatedAt = manifest.CreatedAt
+				backup.FileCount = len(manifest.Files)
+				backup.Size = 0
+				for _, file := range manifest.Files {
+					backup.Size += file.Size
+				}
+			} else {
+				backup.Status = models.BackupStatusFailed
+				backup.Error = err.Error()
+			}
+		} else if zipReader, err := zip.OpenReader(path); err == nil {
+			for _, file := range zipReader.File {
+				if !file.FileInfo().IsDir() {
+					backup.FileCount++
+				}
+			}
+			zipReader.Close()
+		} else {
+			backup.Status = models.BackupStatusFailed
+			backup.Error = err.Error()
+		}
+		if err := s.backupStorage.Create(backup); err != nil {
+			log.Printf("[Backup] Failed to catalog orphan backup %s: %v", orphan.FileName, err)
+			continue
+		}
+		imported = append(imported, backup)
+	}
+	return imported, nil
+}
+func writeBackupZip(w io.Writer, roomDir string) (int, error) {
+	zipWriter := zip.NewWriter(w)
+	fileCount := 0
+	err := filepath.Walk(roomDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(roomDir, path)
+		if err != nil {
+			return err
+		}
+		zipPath := filepath.ToSlash(relPath)
+		if zipPath == "." {
+			return nil
+		}
+		if info.IsDir() {
+			_, err := zipWriter.Create(zipPath + "/")
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer, err := zipWriter.Create(zipPath)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(writer, file); err != nil {
+			return err
+		}
+		fileCount++
+		return nil
+	})
+	if closeErr := zipWriter.Close(); err == nil {
+		err = closeErr
+	}
+	return fileCount, err
+}
+func extractZipFile(file *zip.File, destPath string) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return err
+	}
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	_, err = io.Copy(dst, src)
+	return err
+}
+func fileSHA256(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
@@ -0,0 +1,243 @@
+package services
+import (
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"terraria-panel/config"
+	"terraria-panel/models"
+	"time"
+)
+const backupChunkSize = 1 << 20
+func backupStoreDir() string {
+	return filepath.Join(config.BackupDir, "store")
+}
+func backupManifestDir() string {
+	return filepath.Join(backupStoreDir(), "manifests")
+}
+func backupObjectPath(hash string) string {
+	return filepath.Join(backupStoreDir(), "objects", hash[:2], hash)
+}
+func writeBackupManifest(manifestPath string, roomDir string, manifest *models.BackupManifest) (int64, error) {
+	var stored int64
+	err := filepath.Walk(roomDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(roomDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "." {
+			return nil
+		}
+		if info.IsDir() {
+			manifest.Dirs = append(manifest.Dirs, relPath)
+			return nil
+		}
+		file, written, err := storeBackupFile(path, info)
+		if err != nil {
+			return fmt.Errorf("%s: %w", relPath, err)
+		}
+		file.Path = relPath
+		stored += written
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	})
+	if err != nil {
+		return stored, err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return stored, err
+	}
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0755); err != nil {
+		return stored, err
+	}
+	return stored + int64(len(data)), os.WriteFile(manifestPath, data, 0644)
+}
+func storeBackupFile(path string, info os.FileInfo) (*models.BackupManifestFile, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	entry := &models.BackupManifestFile{
+		Size:    info.Size(),
+		Mode:    uint32(info.Mode().Perm()),
+		ModTime: info.ModTime(),
+		Chunks:  []string{},
+	}
+	fileHash := sha256.New()
+	buf := make([]byte, backupChunkSize)
+	var stored int64
+	for {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			fileHash.Write(buf[:n])
+			hash, written, storeErr := storeBackupChunk(buf[:n])
+			if storeErr != nil {
+				return nil, 0, storeErr
+			}
+			entry.Chunks = append(entry.Chunks, hash)
+			stored += written
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	entry.SHA256 = hex.EncodeToString(fileHash.Sum(nil))
+	return entry, stored, nil
+}
+func storeBackupChunk(data []byte) (string, int64, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	objectPath := backupObjectPath(hash)
+	if _, err := os.Stat(objectPath); err == nil {
+		return hash, 0, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), hash+".tmp*")
+	if err != nil {
+		return "", 0, err
+	}
+	gz := gzip.NewWriter(tmp)
+	_, err = gz.Write(data)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), objectPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	return hash, getStoredSize(objectPath), nil
+}
+func getStoredSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+func readBackupManifest(manifestPath string) (*models.BackupManifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &models.BackupManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return manifest, nil
+}
+func copyBackupFile(w io.Writer, file *models.BackupManifestFile) error {
+	fileHash := sha256.New()
+	for _, hash := range file.Chunks {
+		if err := copyBackupChunk(io.MultiWriter(w, fileHash), hash); err != nil {
+			return err
+		}
+	}
+	if file.SHA256 != "" && hex.EncodeToString(fileHash.Sum(nil)) != file.SHA256 {
+		return ErrBackupChecksumMismatch
+	}
+	return nil
+}
+func copyBackupChunk(w io.Writer, hash string) error {
+	object, err := os.Open(backupObjectPath(hash))
+	if err != nil {
+		return fmt.Errorf("chunk %s: %w", hash, err)
+	}
+	defer object.Close()
+	gz, err := gzip.NewReader(object)
+	if err != nil {
+		return fmt.Errorf("chunk %s: %w", hash, err)
+	}
+	defer gz.Close()
+	_, err = io.Copy(w, gz)
+	return err
+}
+func restoreManifest(manifest *models.BackupManifest, roomDir string) (int, error) {
+	for _, dir := range manifest.Dirs {
+		destPath, ok := safeJoin(roomDir, dir)
+		if ok {
+			os.MkdirAll(destPath, 0755)
+		}
+	}
+	restored := 0
+	for _, file := range manifest.Files {
+		destPath, ok := safeJoin(roomDir, file.Path)
+		if !ok {
+			continue
+		}
+		if err := restoreManifestFile(file, destPath); err != nil {
+			return restored, fmt.Errorf("%s: %w", file.Path, err)
+		}
+		restored++
+	}
+	return restored, nil
+}
+func restoreManifestFile(file *models.BackupManifestFile, destPath string) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return err
+	}
+	tmpPath := destPath + ".restoring"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(file.Mode)|0200)
+	if err != nil {
+		return err
+	}
+	err = copyBackupFile(dst, file)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, destPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	os.Chtimes(destPath, time.Now(), file.ModTime)
+	return nil
+}
+func writeManifestZip(w io.Writer, manifest *models.BackupManifest) error {
+	zipWriter := zip.NewWriter(w)
+	for _, dir := range manifest.Dirs {
+		if _, err := zipWriter.Create(dir + "/"); err != nil {
+			return err
+		}
+	}
+	for _, file := range manifest.Files {
+		header := &zip.FileHeader{Name: file.Path, Method: zip.Deflate, Modified: file.ModTime}
+		header.SetMode(os.FileMode(file.Mode))
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := copyBackupFile(writer, file); err != nil {
+			return fmt.Errorf("%s: %w", file.Path, err)
+		}
+	}
+	return zipWriter.Close()
+}
+func safeJoin(root, name string) (string, bool) {
+	destPath := filepath.Join(root, filepath.FromSlash(name))
+	return destPath, destPath == root || strings.HasPrefix(destPath, root+string(os.PathSeparator))
+}
@@ -0,0 +1,228 @@
+package services
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"terraria-panel/config"
+	"terraria-panel/models"
+)
+func useTempBackupDir(t *testing.T) {
+	previous := config.BackupDir
+	config.BackupDir = t.TempDir()
+	t.Cleanup(func() { config.BackupDir = previous })
+}
+func writeTestRoom(t *testing.T, files map[string][]byte) string {
+	roomDir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(roomDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return roomDir
+}
+func countBackupObjects(t *testing.T) int {
+	count := 0
+	err := filepath.Walk(filepath.Join(backupStoreDir(), "objects"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			count++
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return count
+}
+func snapshotTestRoom(t *testing.T, name, roomDir string) *models.BackupManifest {
+	manifest := &models.BackupManifest{Version: 1, Backup: name}
+	if _, err := writeBackupManifest(filepath.Join(backupManifestDir(), name+".json"), roomDir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+func TestStoreBackupChunkDedup(t *testing.T) {
+	useTempBackupDir(t)
+	first, written, err := storeBackupChunk([]byte("world data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written == 0 {
+		t.Errorf("first store wrote 0 bytes")
+	}
+	second, written, err := storeBackupChunk([]byte("world data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first || written != 0 {
+		t.Errorf("second store = (%s, %d), want (%s, 0)", second, written, first)
+	}
+	if _, _, err := storeBackupChunk([]byte("other data")); err != nil {
+		t.Fatal(err)
+	}
+	if got := countBackupObjects(t); got != 2 {
+		t.Errorf("store holds %d objects, want 2", got)
+	}
+}
+func TestWriteBackupManifestDedup(t *testing.T) {
+	useTempBackupDir(t)
+	large := bytes.Repeat([]byte("0123456789abcdef"), backupChunkSize/16+100)
+	roomDir := writeTestRoom(t, map[string][]byte{
+		"world.wld":             large,
+		"copy.wld":              large,
+		"Worlds/modded.twld":    []byte("tmod world"),
+		"tshock/config.json":    []byte("{}"),
+		"tshock/empty/.gitkeep": {},
+	})
+	first := snapshotTestRoom(t, "first", roomDir)
+	if len(first.Files) != 5 {
+		t.Fatalf("manifest lists %d files, want 5", len(first.Files))
+	}
+	for _, file := range first.Files {
+		if file.Path == "world.wld" && len(file.Chunks) != 2 {
+			t.Errorf("world.wld has %d chunks, want 2", len(file.Chunks))
+		}
+	}
+	objects := countBackupObjects(t)
+	if objects != 4 {
+		t.Errorf("store holds %d objects after first snapshot, want 4", objects)
+	}
+	manifest := &models.BackupManifest{Version: 1, Backup: "second"}
+	stored, err := writeBackupManifest(filepath.Join(backupManifestDir(), "second.json"), roomDir, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestInfo, err := os.Stat(filepath.Join(backupManifestDir(), "second.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != manifestInfo.Size() {
+		t.Errorf("unchanged snapshot stored %d bytes, want only the %d byte manifest", stored, manifestInfo.Size())
+	}
+	if got := countBackupObjects(t); got != objects {
+		t.Errorf("unchanged snapshot added objects: %d, want %d", got, objects)
+	}
+}
+func TestRestoreManifest(t *testing.T) {
+	useTempBackupDir(t)
+	files := map[string][]byte{
+		"world.wld":          bytes.Repeat([]byte{0xAB}, backupChunkSize+1),
+		"Worlds/modded.twld": []byte("tmod world"),
+		"empty.txt":          {},
+	}
+	manifest := snapshotTestRoom(t, "snap", writeTestRoom(t, files))
+	loaded, err := readBackupManifest(filepath.Join(backupManifestDir(), "snap.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	destDir := t.TempDir()
+	restored, err := restoreManifest(loaded, destDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != len(files) {
+		t.Errorf("restored %d files, want %d", restored, len(files))
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(destDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: restored %d bytes that differ from the original %d bytes", name, len(got), len(want))
+		}
+	}
+	var buf bytes.Buffer
+	if err := writeManifestZip(&buf, manifest); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range reader.File {
+		want, listed := files[entry.Name]
+		if !listed {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("zip entry %s does not match the original (err %v)", entry.Name, err)
+		}
+		delete(files, entry.Name)
+	}
+	if len(files) != 0 {
+		t.Errorf("zip is missing %d files", len(files))
+	}
+}
+func TestRestoreManifestDetectsCorruptChunk(t *testing.T) {
+	useTempBackupDir(t)
+	manifest := snapshotTestRoom(t, "snap", writeTestRoom(t, map[string][]byte{"world.wld": []byte("original")}))
+	replacement, _, err := storeBackupChunk([]byte("tampered"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Files[0].Chunks = []string{replacement}
+	if _, err := restoreManifest(manifest, t.TempDir()); !errors.Is(err, ErrBackupChecksumMismatch) {
+		t.Errorf("restoreManifest() error = %v, want %v", err, ErrBackupChecksumMismatch)
+	}
+	manifest.Files[0].Chunks = []string{"00" + replacement[2:]}
+	if _, err := restoreManifest(manifest, t.TempDir()); err == nil {
+		t.Errorf("restoreManifest() with a missing chunk succeeded")
+	}
+}
+func TestGarbageCollect(t *testing.T) {
+	useTempBackupDir(t)
+	roomDir := writeTestRoom(t, map[string][]byte{
+		"world.wld":   []byte("shared world"),
+		"plugins.txt": []byte("old plugins"),
+	})
+	snapshotTestRoom(t, "old", roomDir)
+	if err := os.WriteFile(filepath.Join(roomDir, "plugins.txt"), []byte("new plugins"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	current := snapshotTestRoom(t, "current", roomDir)
+	if got := countBackupObjects(t); got != 3 {
+		t.Fatalf("store holds %d objects, want 3", got)
+	}
+	service := &BackupService{}
+	result, err := service.GarbageCollect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RemovedChunks != 0 || result.ReferencedChunks != 3 {
+		t.Errorf("GC with every manifest present = %+v, want 0 removed and 3 referenced", result)
+	}
+	if err := os.Remove(filepath.Join(backupManifestDir(), "old.json")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = service.GarbageCollect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RemovedChunks != 1 || result.ReferencedChunks != 2 || result.FreedBytes == 0 {
+		t.Errorf("GC after dropping a manifest = %+v, want 1 removed and 2 referenced", result)
+	}
+	if got := countBackupObjects(t); got != 2 {
+		t.Errorf("store holds %d objects after GC, want 2", got)
+	}
+	if _, err := restoreManifest(current, t.TempDir()); err != nil {
+		t.Errorf("restoring the surviving snapshot after GC: %v", err)
+	}
+}
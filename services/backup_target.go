@@ -0,0 +1,180 @@
+package services
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"terraria-panel/config"
+	"terraria-panel/models"
+	"time"
+	"golang.org/x/crypto/ssh"
+)
+var ErrBackupCopyNotFound = errors.New("remote copy not found")
+type BackupTarget interface {
+	Location(name string) string
+	Put(name string, r io.Reader, size int64, checksum string) error
+	Verify(name string, size int64, checksum string) error
+	Get(name string, w io.Writer) error
+	Delete(name string) error
+	Close() error
+}
+func OpenBackupTarget(target *models.BackupTarget) (BackupTarget, error) {
+	switch target.Type {
+	case models.BackupTargetLocal:
+		return &localBackupTarget{dir: target.Path}, nil
+	case models.BackupTargetSFTP:
+		return openSFTPBackupTarget(target)
+	case models.BackupTargetS3:
+		return newS3BackupTarget(target)
+	default:
+		return nil, fmt.Errorf("unsupported backup target type: %s", target.Type)
+	}
+}
+func ValidateBackupTarget(target *models.BackupTarget) error {
+	if strings.TrimSpace(target.Name) == "" {
+		return errors.New("name is required")
+	}
+	switch target.Type {
+	case models.BackupTargetLocal:
+		if !filepath.IsAbs(target.Path) {
+			return errors.New("path must be an absolute directory")
+		}
+		backupDir, err := filepath.Abs(config.BackupDir)
+		if err != nil {
+			return err
+		}
+		if dir := filepath.Clean(target.Path); dir == backupDir || strings.HasPrefix(dir, backupDir+string(os.PathSeparator)) {
+			return errors.New("path must be outside the local backup directory")
+		}
+	case models.BackupTargetSFTP:
+		if target.Host == "" || target.Username == "" {
+			return errors.New("host and username are required")
+		}
+		if target.Secret == "" && target.PrivateKey == "" {
+			return errors.New("password or private key is required")
+		}
+		if target.PrivateKey != "" {
+			if _, err := ssh.ParsePrivateKey([]byte(target.PrivateKey)); err != nil {
+				return fmt.Errorf("invalid private key: %w", err)
+			}
+		}
+	case models.BackupTargetS3:
+		endpoint, err := url.Parse(target.Host)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return errors.New("endpoint must be an http or https URL")
+		}
+		if target.Bucket == "" || target.Username == "" || target.Secret == "" {
+			return errors.New("bucket, access key and secret key are required")
+		}
+	default:
+		return fmt.Errorf("unsupported backup target type: %s", target.Type)
+	}
+	return nil
+}
+func ProbeBackupTarget(target *models.BackupTarget) error {
+	remote, err := OpenBackupTarget(target)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	name := fmt.Sprintf(".panel-probe-%d", time.Now().UnixNano())
+	data := []byte("terraria-panel backup target probe " + name)
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	if err := remote.Put(name, bytes.NewReader(data), int64(len(data)), checksum); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	defer remote.Delete(name)
+	if err := remote.Verify(name, int64(len(data)), checksum); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := remote.Get(name, &buf); err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		return errors.New("downloaded probe does not match uploaded data")
+	}
+	return nil
+}
+type localBackupTarget struct {
+	dir string
+}
+func (t *localBackupTarget) path(name string) string {
+	return filepath.Join(t.dir, filepath.Base(name))
+}
+func (t *localBackupTarget) Location(name string) string {
+	return t.path(name)
+}
+func (t *localBackupTarget) Put(name string, r io.Reader, size int64, checksum string) error {
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(t.dir, filepath.Base(name)+".part*")
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), t.path(name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+func (t *localBackupTarget) Verify(name string, size int64, checksum string) error {
+	sum, written, err := fileSHA256(t.path(name))
+	if os.IsNotExist(err) {
+		return ErrBackupCopyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return checkBackupCopy(written, sum, size, checksum)
+}
+func (t *localBackupTarget) Get(name string, w io.Writer) error {
+	file, err := os.Open(t.path(name))
+	if os.IsNotExist(err) {
+		return ErrBackupCopyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+func (t *localBackupTarget) Delete(name string) error {
+	if err := os.Remove(t.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+func (t *localBackupTarget) Close() error {
+	return nil
+}
+func checkBackupCopy(size int64, checksum string, expectedSize int64, expectedChecksum string) error {
+	if size != expectedSize {
+		return fmt.Errorf("remote size %d does not match %d", size, expectedSize)
+	}
+	if expectedChecksum != "" && !strings.EqualFold(checksum, expectedChecksum) {
+		return ErrBackupChecksumMismatch
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package services
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"terraria-panel/models"
+	"time"
+)
+const (
+	s3DefaultRegion      = "us-east-1"
+	s3RequestTimeout     = 30 * time.Minute
+	s3EmptyPayloadHash   = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3UnsignedPayload    = "UNSIGNED-PAYLOAD"
+	s3ChecksumMetaHeader = "X-Amz-Meta-Sha256"
+)
+var (
+	s3MultipartThreshold int64 = 64 << 20
+	s3PartSize           int64 = 16 << 20
+)
+type s3BackupTarget struct {
+	target   *models.BackupTarget
+	endpoint *url.URL
+	region   string
+	client   *http.Client
+}
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+type s3InitiateMultipartResult struct {
+	UploadID string `xml:"UploadId"`
+}
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+func newS3BackupTarget(target *models.BackupTarget) (*s3BackupTarget, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(target.Host, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	region := target.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	return &s3BackupTarget{
+		target:   target,
+		endpoint: endpoint,
+		region:   region,
+		client:   &http.Client{Timeout: s3RequestTimeout},
+	}, nil
+}
+func (t *s3BackupTarget) key(name string) string {
+	return strings.TrimPrefix(path.Join(t.target.Path, path.Base(name)), "/")
+}
+func (t *s3BackupTarget) Location(name string) string {
+	return fmt.Sprintf("s3://%s/%s", t.target.Bucket, t.key(name))
+}
+func (t *s3BackupTarget) Put(name string, r io.Reader, size int64, checksum string) error {
+	if size > s3MultipartThreshold {
+		return t.putMultipart(name, r, size, checksum)
+	}
+	payloadHash := s3UnsignedPayload
+	if checksum != "" {
+		payloadHash = strings.ToLower(checksum)
+	}
+	resp, err := t.do(http.MethodPut, name, nil, r, size, payloadHash, map[string]string{s3ChecksumMetaHeader: checksum})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s3ResponseError(resp)
+}
+func (t *s3BackupTarget) putMultipart(name string, r io.Reader, size int64, checksum string) error {
+	var initiated s3InitiateMultipartResult
+	err := t.call(http.MethodPost, name, url.Values{"uploads": {""}}, nil, map[string]string{s3ChecksumMetaHeader: checksum}, &initiated)
+	if err != nil {
+		return fmt.Errorf("initiate multipart upload: %w", err)
+	}
+	if initiated.UploadID == "" {
+		return fmt.Errorf("initiate multipart upload: missing upload id")
+	}
+	complete, err := t.uploadParts(name, initiated.UploadID, r, size)
+	if err == nil {
+		var body []byte
+		if body, err = xml.Marshal(complete); err == nil {
+			err = t.call(http.MethodPost, name, url.Values{"uploadId": {initiated.UploadID}}, body, nil, nil)
+		}
+		if err != nil {
+			err = fmt.Errorf("complete multipart upload: %w", err)
+		}
+	}
+	if err != nil {
+		if resp, abortErr := t.do(http.MethodDelete, name, url.Values{"uploadId": {initiated.UploadID}}, nil, 0, s3EmptyPayloadHash, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+func (t *s3BackupTarget) uploadParts(name, uploadID string, r io.Reader, size int64) (*s3CompleteMultipartUpload, error) {
+	complete := &s3CompleteMultipartUpload{}
+	buf := make([]byte, s3PartSize)
+	var written int64
+	for partNumber := 1; ; partNumber++ {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			query := url.Values{"partNumber": {fmt.Sprint(partNumber)}, "uploadId": {uploadID}}
+			resp, err := t.do(http.MethodPut, name, query, bytes.NewReader(buf[:n]), int64(n), hex.EncodeToString(sum[:]), nil)
+			if err != nil {
+				return nil, fmt.Errorf("upload part %d: %w", partNumber, err)
+			}
+			err = s3ResponseError(resp)
+			resp.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("upload part %d: %w", partNumber, err)
+			}
+			complete.Parts = append(complete.Parts, s3CompletedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+			written += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	if written != size {
+		return nil, fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	return complete, nil
+}
+func (t *s3BackupTarget) call(method, name string, query url.Values, body []byte, headers map[string]string, result interface{}) error {
+	sum := sha256.Sum256(body)
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	resp, err := t.do(method, name, query, reader, int64(len(body)), hex.EncodeToString(sum[:]), headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := s3ResponseError(resp); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	var s3Err s3Error
+	if xml.Unmarshal(data, &s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("s3 %s: %s", s3Err.Code, s3Err.Message)
+	}
+	if result != nil {
+		return xml.Unmarshal(data, result)
+	}
+	return nil
+}
+func (t *s3BackupTarget) Verify(name string, size int64, checksum string) error {
+	resp, err := t.do(http.MethodHead, name, nil, nil, 0, s3EmptyPayloadHash, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := s3ResponseError(resp); err != nil {
+		return err
+	}
+	return checkBackupCopy(resp.ContentLength, resp.Header.Get(s3ChecksumMetaHeader), size, checksum)
+}
+func (t *s3BackupTarget) Get(name string, w io.Writer) error {
+	resp, err := t.do(http.MethodGet, name, nil, nil, 0, s3EmptyPayloadHash, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := s3ResponseError(resp); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+func (t *s3BackupTarget) Delete(name string) error {
+	resp, err := t.do(http.MethodDelete, name, nil, nil, 0, s3EmptyPayloadHash, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := s3ResponseError(resp); err != nil && err != ErrBackupCopyNotFound {
+		return err
+	}
+	return nil
+}
+func (t *s3BackupTarget) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+func (t *s3BackupTarget) do(method, name string, query url.Values, body io.Reader, size int64, payloadHash string, headers map[string]string) (*http.Response, error) {
+	objectURL := *t.endpoint
+	objectPath := strings.TrimSuffix(objectURL.Path, "/") + "/" + t.target.Bucket + "/" + t.key(name)
+	objectURL.Path = objectPath
+	objectURL.RawPath = s3EscapePath(objectPath)
+	objectURL.RawQuery = query.Encode()
+	req, err := http.NewRequest(method, objectURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	for header, value := range headers {
+		if value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+	signS3Request(req, t.target.Username, t.target.Secret, t.region, payloadHash, time.Now())
+	return t.client.Do(req)
+}
+func s3ResponseError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrBackupCopyNotFound
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var s3Err s3Error
+	if xml.Unmarshal(data, &s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("s3 %s: %s: %s", resp.Status, s3Err.Code, s3Err.Message)
+	}
+	return fmt.Errorf("s3 %s", resp.Status)
+}
+func signS3Request(req *http.Request, accessKey, secretKey, region, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" || name == "content-md5" || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = s3HMAC(key, part)
+	}
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package services
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"terraria-panel/models"
+	"time"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+const sftpDialTimeout = 15 * time.Second
+type sftpBackupTarget struct {
+	target *models.BackupTarget
+	conn   *ssh.Client
+	client *sftp.Client
+}
+func openSFTPBackupTarget(target *models.BackupTarget) (*sftpBackupTarget, error) {
+	auth := []ssh.AuthMethod{}
+	if target.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(target.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if target.Secret != "" {
+		auth = append(auth, ssh.Password(target.Secret))
+	}
+	address := target.Host
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+	conn, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            target.Username,
+		Auth:            auth,
+		HostKeyCallback: sftpHostKeyCallback(target),
+		Timeout:         sftpDialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &sftpBackupTarget{target: target, conn: conn, client: client}, nil
+}
+func sftpHostKeyCallback(target *models.BackupTarget) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+		expected := strings.TrimSpace(target.HostKey)
+		if expected == "" {
+			log.Printf("[Backup] Pinning SFTP host key of %s on first connect: %s", hostname, fingerprint)
+			target.HostKey = fingerprint
+			return nil
+		}
+		if expected != fingerprint {
+			return fmt.Errorf("host key mismatch for %s: got %s, pinned %s", hostname, fingerprint, expected)
+		}
+		return nil
+	}
+}
+func (t *sftpBackupTarget) path(name string) string {
+	return path.Join(t.target.Path, path.Base(name))
+}
+func (t *sftpBackupTarget) Location(name string) string {
+	return fmt.Sprintf("sftp://%s@%s/%s", t.target.Username, t.target.Host, strings.TrimPrefix(t.path(name), "/"))
+}
+func (t *sftpBackupTarget) Put(name string, r io.Reader, size int64, checksum string) error {
+	remotePath := t.path(name)
+	if err := t.client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return err
+	}
+	tmpPath := remotePath + ".part"
+	file, err := t.client.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	written, err := file.ReadFrom(r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	if err != nil {
+		t.client.Remove(tmpPath)
+		return err
+	}
+	if _, ok := t.client.HasExtension("posix-rename@openssh.com"); ok {
+		return t.client.PosixRename(tmpPath, remotePath)
+	}
+	if err := t.client.Remove(remotePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return t.client.Rename(tmpPath, remotePath)
+}
+func (t *sftpBackupTarget) Verify(name string, size int64, checksum string) error {
+	info, err := t.client.Stat(t.path(name))
+	if os.IsNotExist(err) {
+		return ErrBackupCopyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() != size {
+		return checkBackupCopy(info.Size(), "", size, "")
+	}
+	hash := sha256.New()
+	if err := t.Get(name, hash); err != nil {
+		return err
+	}
+	return checkBackupCopy(info.Size(), hex.EncodeToString(hash.Sum(nil)), size, checksum)
+}
+func (t *sftpBackupTarget) Get(name string, w io.Writer) error {
+	file, err := t.client.Open(t.path(name))
+	if os.IsNotExist(err) {
+		return ErrBackupCopyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteTo(w)
+	return err
+}
+func (t *sftpBackupTarget) Delete(name string) error {
+	if err := t.client.Remove(t.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+func (t *sftpBackupTarget) Close() error {
+	err := t.client.Close()
+	if closeErr := t.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
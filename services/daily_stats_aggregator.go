@@ -0,0 +1,210 @@
+package services
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"time"
+)
+const dailyStatsInterval = 5 * time.Minute
+type DailyStatsAggregator struct {
+	db                *sql.DB
+	dailyStatsStorage storage.PlayerDailyStatsStorage
+	mu                sync.Mutex
+	stopChan          chan struct{}
+	wg                sync.WaitGroup
+}
+func NewDailyStatsAggregator(db *sql.DB, dailyStatsStorage storage.PlayerDailyStatsStorage) *DailyStatsAggregator {
+	return &DailyStatsAggregator{
+		db:                db,
+		dailyStatsStorage: dailyStatsStorage,
+		stopChan:          make(chan struct{}),
+	}
+}
+func (a *DailyStatsAggregator) Start() {
+	a.wg.Add(1)
+	go a.run()
+}
+func (a *DailyStatsAggregator) Stop() {
+	close(a.stopChan)
+	a.wg.Wait()
+}
+func (a *DailyStatsAggregator) run() {
+	defer a.wg.Done()
+	if err := a.Backfill(); err != nil {
+		log.Printf("[DailyStats] Backfill failed: %v", err)
+	}
+	lastDay := startOfDay(time.Now())
+	ticker := time.NewTicker(dailyStatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stopChan:
+			return
+		case <-ticker.C:
+			today := startOfDay(time.Now())
+			for day := lastDay; day.Before(today); day = day.AddDate(0, 0, 1) {
+				if _, err := a.AggregateDay(day); err != nil {
+					log.Printf("[DailyStats] Failed to finalize %s: %v", day.Format("2006-01-02"), err)
+				}
+			}
+			lastDay = today
+			if _, err := a.AggregateDay(today); err != nil {
+				log.Printf("[DailyStats] Failed to update %s: %v", today.Format("2006-01-02"), err)
+			}
+		}
+	}
+}
+func (a *DailyStatsAggregator) Backfill() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	firstSeen, err := a.loadFirstSeen()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	today := startOfDay(now)
+	earliest := today
+	for _, seen := range firstSeen {
+		if seen.Before(earliest) {
+			earliest = startOfDay(seen)
+		}
+	}
+	var firstJoin sql.NullTime
+	if err := a.db.QueryRow("SELECT join_time FROM player_sessions ORDER BY join_time ASC LIMIT 1").Scan(&firstJoin); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if firstJoin.Valid && firstJoin.Time.Before(earliest) {
+		earliest = startOfDay(firstJoin.Time)
+	}
+	existing, err := a.dailyStatsStorage.GetRange(earliest.Format("2006-01-02"), today.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+	recorded := make(map[string]bool, len(existing))
+	for _, stats := range existing {
+		recorded[stats.Date] = true
+	}
+	yesterday := today.AddDate(0, 0, -1)
+	filled := 0
+	for day := earliest; !day.After(today); day = day.AddDate(0, 0, 1) {
+		if recorded[day.Format("2006-01-02")] && day.Before(yesterday) {
+			continue
+		}
+		if _, err := a.aggregate(day, firstSeen, now); err != nil {
+			return err
+		}
+		filled++
+	}
+	log.Printf("[DailyStats] Backfill finished: %d days aggregated since %s", filled, earliest.Format("2006-01-02"))
+	return nil
+}
+func (a *DailyStatsAggregator) AggregateDay(day time.Time) (*models.PlayerDailyStats, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	firstSeen, err := a.loadFirstSeen()
+	if err != nil {
+		return nil, err
+	}
+	return a.aggregate(startOfDay(day), firstSeen, time.Now())
+}
+func (a *DailyStatsAggregator) aggregate(dayStart time.Time, firstSeen map[int]time.Time, now time.Time) (*models.PlayerDailyStats, error) {
+	dayEnd := dayStart.AddDate(0, 0, 1)
+	stats := &models.PlayerDailyStats{Date: dayStart.Format("2006-01-02")}
+	for _, seen := range firstSeen {
+		if seen.Before(dayEnd) {
+			stats.TotalPlayers++
+			if !seen.Before(dayStart) {
+				stats.NewPlayers++
+			}
+		}
+	}
+	rows, err := a.db.Query(`
+		SELECT player_id, join_time, leave_time
+		FROM player_sessions
+		WHERE join_time < ? AND (leave_time IS NULL OR leave_time >= ?)
+	`, dayEnd.Add(24*time.Hour), dayStart.Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	active := make(map[int]bool)
+	var playTime time.Duration
+	for rows.Next() {
+		var playerID int
+		var joinTime time.Time
+		var leaveTime sql.NullTime
+		if err := rows.Scan(&playerID, &joinTime, &leaveTime); err != nil {
+			return nil, err
+		}
+		overlap, ok := sessionDayOverlap(joinTime, leaveTime, dayStart, now)
+		if !ok {
+			continue
+		}
+		active[playerID] = true
+		playTime += overlap
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	stats.ActivePlayers = len(active)
+	stats.TotalPlayTime = int(playTime.Seconds())
+	if err := a.dailyStatsStorage.Upsert(stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+func sessionDayOverlap(joinTime time.Time, leaveTime sql.NullTime, dayStart time.Time, now time.Time) (time.Duration, bool) {
+	dayEnd := dayStart.AddDate(0, 0, 1)
+	end := now
+	if leaveTime.Valid && leaveTime.Time.Before(now) {
+		end = leaveTime.Time
+	}
+	if !joinTime.Before(dayEnd) || end.Before(dayStart) || joinTime.After(now) {
+		return 0, false
+	}
+	start := joinTime
+	if start.Before(dayStart) {
+		start = dayStart
+	}
+	if end.After(dayEnd) {
+		end = dayEnd
+	}
+	if !end.After(start) {
+		return 0, true
+	}
+	return end.Sub(start), true
+}
+func (a *DailyStatsAggregator) loadFirstSeen() (map[int]time.Time, error) {
+	rows, err := a.db.Query(`
+		SELECT p.id, p.created_at, s.first_seen
+		FROM players p
+		LEFT JOIN player_stats s ON s.player_id = p.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	firstSeen := make(map[int]time.Time)
+	for rows.Next() {
+		var playerID int
+		var createdAt, statsFirstSeen sql.NullTime
+		if err := rows.Scan(&playerID, &createdAt, &statsFirstSeen); err != nil {
+			return nil, err
+		}
+		switch {
+		case createdAt.Valid && statsFirstSeen.Valid && statsFirstSeen.Time.Before(createdAt.Time):
+			firstSeen[playerID] = statsFirstSeen.Time
+		case createdAt.Valid:
+			firstSeen[playerID] = createdAt.Time
+		case statsFirstSeen.Valid:
+			firstSeen[playerID] = statsFirstSeen.Time
+		}
+	}
+	return firstSeen, rows.Err()
+}
+func startOfDay(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,91 @@
+package services
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"terraria-panel/db"
+	"terraria-panel/storage"
+	"time"
+)
+func TestSessionDayOverlap(t *testing.T) {
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.Local)
+	at := func(dayOffset, hour, minute int) time.Time {
+		return day.AddDate(0, 0, dayOffset).Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	left := func(t time.Time) sql.NullTime {
+		return sql.NullTime{Time: t, Valid: true}
+	}
+	open := sql.NullTime{}
+	now := at(5, 0, 0)
+	tests := []struct {
+		name       string
+		join       time.Time
+		leave      sql.NullTime
+		now        time.Time
+		wantActive bool
+		want       time.Duration
+	}{
+		{"inside the day", at(0, 10, 0), left(at(0, 11, 30)), now, true, 90 * time.Minute},
+		{"starts before midnight", at(-1, 23, 0), left(at(0, 1, 30)), now, true, 90 * time.Minute},
+		{"ends after midnight", at(0, 23, 15), left(at(1, 2, 0)), now, true, 45 * time.Minute},
+		{"spans the whole day", at(-1, 20, 0), left(at(1, 4, 0)), now, true, 24 * time.Hour},
+		{"ends exactly at midnight", at(-1, 22, 0), left(at(0, 0, 0)), now, true, 0},
+		{"starts exactly at next midnight", at(1, 0, 0), left(at(1, 1, 0)), now, false, 0},
+		{"previous day only", at(-1, 10, 0), left(at(-1, 12, 0)), now, false, 0},
+		{"next day only", at(1, 10, 0), left(at(1, 12, 0)), now, false, 0},
+		{"open session counts up to now", at(0, 22, 0), open, at(0, 23, 0), true, time.Hour},
+		{"open session capped at day end", at(0, 22, 0), open, at(1, 3, 0), true, 2 * time.Hour},
+		{"leave after now is capped", at(0, 9, 0), left(at(0, 12, 0)), at(0, 10, 0), true, time.Hour},
+		{"join in the future", at(0, 12, 0), open, at(0, 10, 0), false, 0},
+	}
+	for _, tt := range tests {
+		got, active := sessionDayOverlap(tt.join, tt.leave, day, tt.now)
+		if active != tt.wantActive || got != tt.want {
+			t.Errorf("%s: sessionDayOverlap() = (%v, %v), want (%v, %v)", tt.name, got, active, tt.want, tt.wantActive)
+		}
+	}
+}
+func TestAggregateDaySplitsAtMidnight(t *testing.T) {
+	if err := db.Init(filepath.Join(t.TempDir(), "panel.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB.Close()
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.Local)
+	db.DB.Exec("INSERT INTO rooms (id, name, server_type, port) VALUES (1, 'r', 'vanilla', 7777)")
+	db.DB.Exec("INSERT INTO players (id, name, room_id, created_at) VALUES (1, 'alice', 1, ?), (2, 'bob', 1, ?)",
+		day.Add(-48*time.Hour), day.Add(2*time.Hour))
+	sessions := [][]interface{}{
+		{1, day.Add(-time.Hour), day.Add(30 * time.Minute)},
+		{2, day.Add(2 * time.Hour), day.Add(3 * time.Hour)},
+		{2, day.Add(23 * time.Hour), day.Add(25 * time.Hour)},
+	}
+	for _, session := range sessions {
+		if _, err := db.DB.Exec("INSERT INTO player_sessions (player_id, room_id, join_time, leave_time) VALUES (?, 1, ?, ?)", session...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aggregator := NewDailyStatsAggregator(db.DB, storage.NewSQLitePlayerDailyStatsStorage(db.DB))
+	tests := []struct {
+		day      time.Time
+		active   int
+		playTime int
+		total    int
+		newCount int
+	}{
+		{day.AddDate(0, 0, -1), 1, 3600, 1, 0},
+		{day, 2, 30*60 + 3600 + 3600, 2, 1},
+		{day.AddDate(0, 0, 1), 1, 3600, 2, 0},
+		{day.AddDate(0, 0, 2), 0, 0, 2, 0},
+	}
+	for _, tt := range tests {
+		stats, err := aggregator.AggregateDay(tt.day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.ActivePlayers != tt.active || stats.TotalPlayTime != tt.playTime || stats.TotalPlayers != tt.total || stats.NewPlayers != tt.newCount {
+			t.Errorf("%s: got active=%d playTime=%d total=%d new=%d, want %d %d %d %d", stats.Date,
+				stats.ActivePlayers, stats.TotalPlayTime, stats.TotalPlayers, stats.NewPlayers,
+				tt.active, tt.playTime, tt.total, tt.newCount)
+		}
+	}
+}
@@ -1,32 +1,26 @@
 package services
 import (
-	"bufio"
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
 	"sync"
 	"terraria-panel/config"
 	"terraria-panel/models"
 	"terraria-panel/storage"
+	"terraria-panel/utils"
 	"time"
 )
 type LogMonitor struct {
-	db                  *sql.DB
-	roomStorage         storage.RoomStorage
-	sessionStorage      storage.PlayerSessionStorage
-	statsStorage        storage.PlayerStatsStorage
-	dailyStatsStorage   storage.PlayerDailyStatsStorage
-	playerNameToID      map[string]int
-	activeRooms         map[int]bool
-	mu                  sync.RWMutex
-	lastReadPos         map[string]int64
-	positionMutex       sync.RWMutex
-	stopChan            chan struct{}
-	wg                  sync.WaitGroup
+	db                *sql.DB
+	roomStorage       storage.RoomStorage
+	sessionStorage    storage.PlayerSessionStorage
+	statsStorage      storage.PlayerStatsStorage
+	dailyStatsStorage storage.PlayerDailyStatsStorage
+	pipeline          *LogPipeline
+	playerNameToID    map[string]int
+	mu                sync.RWMutex
 }
 func NewLogMonitor(
 	db *sql.DB,
@@ -34,6 +28,7 @@ func NewLogMonitor(
 	sessionStorage storage.PlayerSessionStorage,
 	statsStorage storage.PlayerStatsStorage,
 	dailyStatsStorage storage.PlayerDailyStatsStorage,
+	pipeline *LogPipeline,
 ) *LogMonitor {
 	return &LogMonitor{
 		db:                db,
@@ -41,25 +36,16 @@ func NewLogMonitor(
 		sessionStorage:    sessionStorage,
 		statsStorage:      statsStorage,
 		dailyStatsStorage: dailyStatsStorage,
+		pipeline:          pipeline,
 		playerNameToID:    make(map[string]int),
-		activeRooms:       make(map[int]bool),
-		lastReadPos:       make(map[string]int64),
-		stopChan:          make(chan struct{}),
 	}
 }
 func (m *LogMonitor) Start() {
 	log.Println("📊 Starting log monitor service...")
 	m.loadPlayerNameCache()
-	m.wg.Add(1)
-	go m.monitorLoop()
+	m.pipeline.Subscribe("stats", m.handleEvent)
 	log.Println("✅ Log monitor service started")
 }
-func (m *LogMonitor) Stop() {
-	log.Println("🛑 Stopping log monitor service...")
-	close(m.stopChan)
-	m.wg.Wait()
-	log.Println("✅ Log monitor service stopped")
-}
 func (m *LogMonitor) loadPlayerNameCache() {
 	query := `SELECT id, name FROM players`
 	rows, err := m.db.Query(query)
@@ -80,84 +66,81 @@ func (m *LogMonitor) loadPlayerNameCache() {
 	}
 	log.Printf("Loaded %d player names into cache", len(m.playerNameToID))
 }
-func (m *LogMonitor) monitorLoop() {
-	defer m.wg.Done()
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-m.stopChan:
-			return
-		case <-ticker.C:
-			m.checkLogs()
-		}
+func (m *LogMonitor) handleEvent(event *models.GameEvent) {
+	switch event.Type {
+	case models.GameEventJoin:
+		m.handlePlayerJoin(event.PlayerName, event.IPAddress, event.RoomID, event.Time)
+	case models.GameEventLeave:
+		m.handlePlayerLeave(event.PlayerName, event.RoomID, event.Time)
+	case models.GameEventStop:
+		m.CloseRoomSessions(event.RoomID, event.Time)
 	}
 }
-func (m *LogMonitor) checkLogs() {
-	rooms, err := m.roomStorage.GetAll()
+func (m *LogMonitor) ReconcileSessions() {
+	sessions, err := m.sessionStorage.GetAllActive()
 	if err != nil {
-		log.Printf("Failed to get rooms: %v", err)
+		log.Printf("Failed to load open sessions: %v", err)
 		return
 	}
-	for _, room := range rooms {
-		if room.Status == "running" {
-			m.processRoomLog(&room)
+	rooms := make(map[int]bool)
+	for _, session := range sessions {
+		rooms[session.RoomID] = true
+	}
+	for roomID := range rooms {
+		if p, exists := utils.GetProcess(roomID); exists && p.IsRunning() {
+			continue
 		}
+		m.CloseRoomSessions(roomID, lastLogTime(roomID))
 	}
+	m.markIdlePlayersOffline()
 }
-func (m *LogMonitor) processRoomLog(room *models.Room) {
-	logFile := filepath.Join(config.DataDir, "logs", "room-"+strconv.Itoa(room.ID)+".log")
-	fileInfo, err := os.Stat(logFile)
-	if os.IsNotExist(err) {
-		return
-	}
-	currentSize := fileInfo.Size()
-	m.positionMutex.RLock()
-	lastPos, exists := m.lastReadPos[logFile]
-	m.positionMutex.RUnlock()
-	if currentSize < lastPos {
-		lastPos = 0
-	}
-	if exists && currentSize == lastPos {
-		return
-	}
-	file, err := os.Open(logFile)
+func (m *LogMonitor) CloseRoomSessions(roomID int, leaveTime time.Time) int {
+	sessions, err := m.sessionStorage.GetActiveByRoom(roomID)
 	if err != nil {
-		log.Printf("Failed to open log file %s: %v", logFile, err)
-		return
+		log.Printf("Failed to load open sessions for room %d: %v", roomID, err)
+		return 0
 	}
-	defer file.Close()
-	if lastPos > 0 {
-		file.Seek(lastPos, 0)
+	closed := 0
+	for _, session := range sessions {
+		end := leaveTime
+		if end.IsZero() || end.Before(session.JoinTime) {
+			end = session.JoinTime
+		}
+		duration := int(end.Sub(session.JoinTime).Seconds())
+		if err := m.sessionStorage.CloseBySystem(session.ID, end, duration); err != nil {
+			log.Printf("Failed to close session %d: %v", session.ID, err)
+			continue
+		}
+		m.updatePlayerStatsOnLeave(session.PlayerID, duration, end)
+		closed++
 	}
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		m.parseLine(line, room.ID)
+	if closed > 0 {
+		m.markIdlePlayersOffline()
+		log.Printf("Closed %d open sessions for room %d (leave time: %s)", closed, roomID, leaveTime.Format("2006-01-02 15:04:05"))
 	}
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading log file %s: %v", logFile, err)
+	return closed
+}
+func (m *LogMonitor) markIdlePlayersOffline() {
+	query := `
+		UPDATE players SET status = 'offline'
+		WHERE status != 'offline' AND id NOT IN (SELECT player_id FROM player_sessions WHERE leave_time IS NULL)
+	`
+	if _, err := m.db.Exec(query); err != nil {
+		log.Printf("Failed to reset player status: %v", err)
 	}
-	m.positionMutex.Lock()
-	m.lastReadPos[logFile] = currentSize
-	m.positionMutex.Unlock()
 }
-func (m *LogMonitor) parseLine(line string, roomID int) {
-	joinPattern := regexp.MustCompile(`:\s*(.+?)\s*\(([0-9.]+):(\d+)\)\s*has joined`)
-	if matches := joinPattern.FindStringSubmatch(line); matches != nil {
-		playerName := strings.TrimSpace(matches[1])
-		ipAddress := matches[2]
-		m.handlePlayerJoin(playerName, ipAddress, roomID)
-		return
+func lastLogTime(roomID int) time.Time {
+	logFile := filepath.Join(config.LogsDir, fmt.Sprintf("room-%d.log", roomID))
+	if roomID == PluginServerID {
+		logFile = filepath.Join(config.ServersDir, "tshock", "logs", "plugin-server.log")
 	}
-	leavePattern := regexp.MustCompile(`:\s*(.+?)\s*has left`)
-	if matches := leavePattern.FindStringSubmatch(line); matches != nil {
-		playerName := strings.TrimSpace(matches[1])
-		m.handlePlayerLeave(playerName, roomID)
-		return
+	info, err := os.Stat(logFile)
+	if err != nil || info.ModTime().After(time.Now()) {
+		return time.Time{}
 	}
+	return info.ModTime()
 }
-func (m *LogMonitor) handlePlayerJoin(playerName, ipAddress string, roomID int) {
+func (m *LogMonitor) handlePlayerJoin(playerName, ipAddress string, roomID int, joinTime time.Time) {
 	playerID := m.getOrCreatePlayerID(playerName, ipAddress, roomID)
 	if playerID == 0 {
 		return
@@ -173,18 +156,18 @@ func (m *LogMonitor) handlePlayerJoin(playerName, ipAddress string, roomID int)
 	session := &models.PlayerSession{
 		PlayerID:  playerID,
 		RoomID:    roomID,
-		JoinTime:  time.Now(),
+		JoinTime:  joinTime,
 		IPAddress: ipAddress,
 	}
 	if err := m.sessionStorage.Create(session); err != nil {
 		log.Printf("Failed to create session: %v", err)
 		return
 	}
-	m.updatePlayerStatsOnJoin(playerID)
+	m.updatePlayerStatsOnJoin(playerID, joinTime)
 	m.updatePlayerStatus(playerID, roomID, "online")
 	log.Printf("Player %s joined room %d", playerName, roomID)
 }
-func (m *LogMonitor) handlePlayerLeave(playerName string, roomID int) {
+func (m *LogMonitor) handlePlayerLeave(playerName string, roomID int, leaveTime time.Time) {
 	playerID := m.getPlayerID(playerName)
 	if playerID == 0 {
 		return
@@ -197,13 +180,12 @@ func (m *LogMonitor) handlePlayerLeave(playerName string, roomID int) {
 	if activeSession == nil {
 		return
 	}
-	leaveTime := time.Now()
 	duration := int(leaveTime.Sub(activeSession.JoinTime).Seconds())
 	if err := m.sessionStorage.UpdateLeaveTime(activeSession.ID, leaveTime, duration); err != nil {
 		log.Printf("Failed to update session: %v", err)
 		return
 	}
-	m.updatePlayerStatsOnLeave(playerID, duration)
+	m.updatePlayerStatsOnLeave(playerID, duration, leaveTime)
 	m.updatePlayerStatus(playerID, roomID, "offline")
 	log.Printf("Player %s left room %d (duration: %d seconds)", playerName, roomID, duration)
 }
@@ -263,15 +245,13 @@ func (m *LogMonitor) getPlayerID(playerName string) int {
 	m.mu.Unlock()
 	return id
 }
-func (m *LogMonitor) updatePlayerStatsOnJoin(playerID int) {
-	now := time.Now()
+func (m *LogMonitor) updatePlayerStatsOnJoin(playerID int, joinTime time.Time) {
 	m.statsStorage.IncrementLoginCount(playerID)
-	m.statsStorage.UpdateLastLogin(playerID, now)
+	m.statsStorage.UpdateLastLogin(playerID, joinTime)
 }
-func (m *LogMonitor) updatePlayerStatsOnLeave(playerID int, duration int) {
-	now := time.Now()
+func (m *LogMonitor) updatePlayerStatsOnLeave(playerID int, duration int, leaveTime time.Time) {
 	m.statsStorage.IncrementPlayTime(playerID, duration)
-	m.statsStorage.UpdateLastLogout(playerID, now)
+	m.statsStorage.UpdateLastLogout(playerID, leaveTime)
 }
 func (m *LogMonitor) updatePlayerStatus(playerID, roomID int, status string) {
 	query := `UPDATE players SET status = ?, room_id = ?, last_seen = CURRENT_TIMESTAMP WHERE id = ?`
@@ -0,0 +1,144 @@
+package services
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"terraria-panel/models"
+)
+type LogParser interface {
+	Parse(line string) *models.GameEvent
+}
+type LogRule struct {
+	Type    string
+	Pattern *regexp.Regexp
+	Build   func(event *models.GameEvent, matches []string)
+}
+type RegexLogParser struct {
+	rules []LogRule
+}
+var (
+	logLinePrefixPattern = regexp.MustCompile(`^(?:[:>]\s*)*(?:\[[^\]]*\]:?\s*)*(?:(Info|Warn|Warning|Error|Fatal|Debug):\s*)?`)
+	logErrorPattern      = regexp.MustCompile(`(?i)^(?:unhandled exception|error\b|fatal\b|[\w.]+exception\b)`)
+)
+var (
+	chatLogRule = LogRule{
+		Type:    models.GameEventChat,
+		Pattern: regexp.MustCompile(`^<([^>]+)>\s?(.*)$`),
+		Build: func(event *models.GameEvent, matches []string) {
+			event.PlayerName = strings.TrimSpace(matches[1])
+			event.Message = matches[2]
+		},
+	}
+	tshockJoinLogRule = LogRule{
+		Type:    models.GameEventJoin,
+		Pattern: regexp.MustCompile(`^(.+?)\s*\(([0-9a-fA-F.:]+?):(\d+)\)\s*has joined\.?$`),
+		Build: func(event *models.GameEvent, matches []string) {
+			event.PlayerName = strings.TrimSpace(matches[1])
+			event.IPAddress = matches[2]
+		},
+	}
+	joinLogRule = LogRule{
+		Type:    models.GameEventJoin,
+		Pattern: regexp.MustCompile(`^(.+?) has joined\.?$`),
+		Build: func(event *models.GameEvent, matches []string) {
+			event.PlayerName = strings.TrimSpace(matches[1])
+		},
+	}
+	leaveLogRule = LogRule{
+		Type:    models.GameEventLeave,
+		Pattern: regexp.MustCompile(`^(.+?) has left\.?$`),
+		Build: func(event *models.GameEvent, matches []string) {
+			event.PlayerName = strings.TrimSpace(matches[1])
+		},
+	}
+	bossAwokenLogRule = LogRule{
+		Type:    models.GameEventBoss,
+		Pattern: regexp.MustCompile(`^(.+?) has awoken!$`),
+		Build: func(event *models.GameEvent, matches []string) {
+			event.Target = strings.TrimSpace(matches[1])
+			event.Action = models.BossEventAwoken
+		},
+	}
+	bossDefeatedLogRule = LogRule{
+		Type:    models.GameEventBoss,
+		Pattern: regexp.MustCompile(`^(.+?) has been defeated!$`),
+		Build: func(event *models.GameEvent, matches []string) {
+			event.Target = strings.TrimSpace(matches[1])
+			event.Action = models.BossEventDefeated
+		},
+	}
+	worldSaveStartedLogRule = LogRule{
+		Type:    models.GameEventWorldSave,
+		Pattern: regexp.MustCompile(`(?i)^saving world`),
+		Build: func(event *models.GameEvent, matches []string) {
+			event.Action = models.WorldSaveStarted
+		},
+	}
+	worldSaveFinishedLogRule = LogRule{
+		Type:    models.GameEventWorldSave,
+		Pattern: regexp.MustCompile(`(?i)^world saved\.?$`),
+		Build: func(event *models.GameEvent, matches []string) {
+			event.Action = models.WorldSaveFinished
+		},
+	}
+	deathLogRule = LogRule{
+		Type:    models.GameEventDeath,
+		Pattern: regexp.MustCompile(`^(.+?) (?:was (?:slain|killed|impaled|eviscerated|murdered|torn|destroyed|squashed|pricked|inked|licked|burned|electrocuted|crushed|removed|blown up)|fell to (?:their|his|her) death|drowned|died|bled out|got melted|can't swim|tried to escape|didn't materialize)\b`),
+		Build: func(event *models.GameEvent, matches []string) {
+			event.PlayerName = strings.TrimSpace(matches[1])
+		},
+	}
+)
+var (
+	logParsers = map[string]LogParser{
+		"vanilla":    NewRegexLogParser(chatLogRule, joinLogRule, leaveLogRule, bossAwokenLogRule, bossDefeatedLogRule, worldSaveStartedLogRule, deathLogRule),
+		"tmodloader": NewRegexLogParser(chatLogRule, joinLogRule, leaveLogRule, bossAwokenLogRule, bossDefeatedLogRule, worldSaveStartedLogRule, deathLogRule),
+		"tshock":     NewRegexLogParser(chatLogRule, tshockJoinLogRule, joinLogRule, leaveLogRule, bossAwokenLogRule, bossDefeatedLogRule, worldSaveStartedLogRule, worldSaveFinishedLogRule, deathLogRule),
+	}
+	logParsersMu             sync.RWMutex
+	worldSaveConfirmingTypes = map[string]bool{
+		"tshock": true,
+	}
+)
+func NewRegexLogParser(rules ...LogRule) *RegexLogParser {
+	return &RegexLogParser{rules: rules}
+}
+func RegisterLogParser(serverType string, parser LogParser) {
+	logParsersMu.Lock()
+	defer logParsersMu.Unlock()
+	logParsers[strings.ToLower(serverType)] = parser
+}
+func logParserFor(serverType string) LogParser {
+	logParsersMu.RLock()
+	defer logParsersMu.RUnlock()
+	if parser, exists := logParsers[strings.ToLower(serverType)]; exists {
+		return parser
+	}
+	return logParsers["vanilla"]
+}
+func confirmsWorldSave(serverType string) bool {
+	return worldSaveConfirmingTypes[strings.ToLower(serverType)]
+}
+func (p *RegexLogParser) Parse(line string) *models.GameEvent {
+	prefix := logLinePrefixPattern.FindStringSubmatch(line)
+	text := strings.TrimSpace(line[len(prefix[0]):])
+	if text == "" {
+		return nil
+	}
+	for _, rule := range p.rules {
+		matches := rule.Pattern.FindStringSubmatch(text)
+		if matches == nil {
+			continue
+		}
+		event := &models.GameEvent{Type: rule.Type, Message: text, Line: line}
+		if rule.Build != nil {
+			rule.Build(event, matches)
+		}
+		return event
+	}
+	level := strings.ToLower(prefix[1])
+	if level == "error" || level == "fatal" || logErrorPattern.MatchString(text) {
+		return &models.GameEvent{Type: models.GameEventError, Message: text, Line: line}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package services
+import (
+	"testing"
+	"terraria-panel/models"
+)
+func TestLogParsers(t *testing.T) {
+	tests := []struct {
+		serverType string
+		line       string
+		wantType   string
+		player     string
+		ip         string
+		target     string
+		action     string
+		message    string
+	}{
+		{"vanilla", "Steve has joined.", models.GameEventJoin, "Steve", "", "", "", "Steve has joined."},
+		{"vanilla", ": Steve has joined.", models.GameEventJoin, "Steve", "", "", "", "Steve has joined."},
+		{"vanilla", "Dark Knight has left.", models.GameEventLeave, "Dark Knight", "", "", "", "Dark Knight has left."},
+		{"vanilla", "<Steve> hello there", models.GameEventChat, "Steve", "", "", "", "hello there"},
+		{"vanilla", "<Steve>", models.GameEventChat, "Steve", "", "", "", ""},
+		{"vanilla", "Eye of Cthulhu has awoken!", models.GameEventBoss, "", "", "Eye of Cthulhu", models.BossEventAwoken, "Eye of Cthulhu has awoken!"},
+		{"vanilla", "Skeletron has been defeated!", models.GameEventBoss, "", "", "Skeletron", models.BossEventDefeated, "Skeletron has been defeated!"},
+		{"vanilla", "Saving world data: 50%", models.GameEventWorldSave, "", "", "", models.WorldSaveStarted, "Saving world data: 50%"},
+		{"vanilla", "Backing up world file", "", "", "", "", "", ""},
+		{"vanilla", "World saved.", "", "", "", "", "", ""},
+		{"vanilla", "Steve was slain by Zombie.", models.GameEventDeath, "Steve", "", "", "", "Steve was slain by Zombie."},
+		{"vanilla", "Steve fell to their death.", models.GameEventDeath, "Steve", "", "", "", "Steve fell to their death."},
+		{"vanilla", "Steve drowned.", models.GameEventDeath, "Steve", "", "", "", "Steve drowned."},
+		{"vanilla", "Unhandled exception. System.NullReferenceException", models.GameEventError, "", "", "", "", "Unhandled exception. System.NullReferenceException"},
+		{"vanilla", "Terraria Server v1.4.4.9", "", "", "", "", "", ""},
+		{"vanilla", "   ", "", "", "", "", "", ""},
+		{"tshock", "Steve (203.0.113.7:53412) has joined.", models.GameEventJoin, "Steve", "203.0.113.7", "", "", "Steve (203.0.113.7:53412) has joined."},
+		{"tshock", "[Server API] Info: Steve has left.", models.GameEventLeave, "Steve", "", "", "", "Steve has left."},
+		{"tshock", "[Server API] Error: plugin failed to load", models.GameEventError, "", "", "", "", "plugin failed to load"},
+		{"tshock", "Steve has joined.", models.GameEventJoin, "Steve", "", "", "", "Steve has joined."},
+		{"tshock", "Backing up world file", "", "", "", "", "", ""},
+		{"tshock", "World saved.", models.GameEventWorldSave, "", "", "", models.WorldSaveFinished, "World saved."},
+		{"tmodloader", "[12:00:01] [Server thread/INFO] [tML]: <Alex> gg", models.GameEventChat, "Alex", "", "", "", "gg"},
+		{"tmodloader", "Alex has joined.", models.GameEventJoin, "Alex", "", "", "", "Alex has joined."},
+		{"unknown", "Alex has left.", models.GameEventLeave, "Alex", "", "", "", "Alex has left."},
+	}
+	for _, tt := range tests {
+		event := logParserFor(tt.serverType).Parse(tt.line)
+		if tt.wantType == "" {
+			if event != nil {
+				t.Errorf("%s %q: expected no event, got %+v", tt.serverType, tt.line, event)
+			}
+			continue
+		}
+		if event == nil {
+			t.Errorf("%s %q: expected %s event, got none", tt.serverType, tt.line, tt.wantType)
+			continue
+		}
+		if event.Type != tt.wantType || event.PlayerName != tt.player || event.IPAddress != tt.ip ||
+			event.Target != tt.target || event.Action != tt.action || event.Message != tt.message || event.Line != tt.line {
+			t.Errorf("%s %q: got %+v", tt.serverType, tt.line, event)
+		}
+	}
+}
+type staticLogParser struct{}
+func (staticLogParser) Parse(line string) *models.GameEvent {
+	return &models.GameEvent{Type: "custom", Line: line}
+}
+func TestRegisterLogParser(t *testing.T) {
+	RegisterLogParser("Custom", staticLogParser{})
+	defer func() {
+		logParsersMu.Lock()
+		delete(logParsers, "custom")
+		logParsersMu.Unlock()
+	}()
+	if event := logParserFor("custom").Parse("anything"); event == nil || event.Type != "custom" {
+		t.Errorf("registered parser was not used, got %+v", event)
+	}
+}
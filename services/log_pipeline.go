@@ -0,0 +1,145 @@
+package services
+import (
+	"log"
+	"sync"
+	"terraria-panel/models"
+	"terraria-panel/utils"
+	"time"
+)
+const (
+	logPipelineQueueSize   = 4096
+	logSubscriberQueueSize = 1024
+)
+type GameEventHandler func(event *models.GameEvent)
+type pipelineInput struct {
+	line *utils.ProcessLine
+	exit *utils.ProcessExit
+}
+type logSubscriber struct {
+	name    string
+	handler GameEventHandler
+	events  chan *models.GameEvent
+}
+type LogPipeline struct {
+	inputs      chan pipelineInput
+	lastLine    map[int]time.Time
+	subscribers []*logSubscriber
+	mu          sync.RWMutex
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+}
+func NewLogPipeline() *LogPipeline {
+	return &LogPipeline{
+		inputs:   make(chan pipelineInput, logPipelineQueueSize),
+		lastLine: make(map[int]time.Time),
+		stopChan: make(chan struct{}),
+	}
+}
+func (p *LogPipeline) Start() {
+	log.Println("📡 Starting log ingestion pipeline...")
+	utils.OnProcessLine(p.enqueue)
+	utils.OnProcessExit(p.enqueueExit)
+	p.wg.Add(1)
+	go p.run()
+	log.Println("✅ Log ingestion pipeline started")
+}
+func (p *LogPipeline) Stop() {
+	log.Println("🛑 Stopping log ingestion pipeline...")
+	close(p.stopChan)
+	p.wg.Wait()
+	log.Println("✅ Log ingestion pipeline stopped")
+}
+func (p *LogPipeline) Subscribe(name string, handler GameEventHandler) {
+	subscriber := &logSubscriber{
+		name:    name,
+		handler: handler,
+		events:  make(chan *models.GameEvent, logSubscriberQueueSize),
+	}
+	p.mu.Lock()
+	p.subscribers = append(p.subscribers, subscriber)
+	p.mu.Unlock()
+	p.wg.Add(1)
+	go p.deliver(subscriber)
+}
+func (p *LogPipeline) Publish(event *models.GameEvent) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, subscriber := range p.subscribers {
+		select {
+		case subscriber.events <- event:
+		default:
+			log.Printf("[LogPipeline] Subscriber %s queue full, dropping %s event from room %d", subscriber.name, event.Type, event.RoomID)
+		}
+	}
+}
+func (p *LogPipeline) enqueue(line utils.ProcessLine) {
+	select {
+	case <-p.stopChan:
+	case p.inputs <- pipelineInput{line: &line}:
+	default:
+		log.Printf("[LogPipeline] Line queue full, dropping output from room %d", line.RoomID)
+	}
+}
+func (p *LogPipeline) enqueueExit(exit utils.ProcessExit) {
+	select {
+	case <-p.stopChan:
+	case p.inputs <- pipelineInput{exit: &exit}:
+	}
+}
+func (p *LogPipeline) run() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case input := <-p.inputs:
+			if input.exit != nil {
+				p.Publish(p.stopEvent(input.exit))
+				continue
+			}
+			line := input.line
+			p.lastLine[line.RoomID] = line.Time
+			event := logParserFor(line.ServerType).Parse(line.Line)
+			if event == nil {
+				continue
+			}
+			event.RoomID = line.RoomID
+			event.ServerType = line.ServerType
+			event.PID = line.PID
+			event.Time = line.Time
+			p.Publish(event)
+		}
+	}
+}
+func (p *LogPipeline) stopEvent(exit *utils.ProcessExit) *models.GameEvent {
+	event := &models.GameEvent{
+		Type:       models.GameEventStop,
+		RoomID:     exit.RoomID,
+		ServerType: exit.ServerType,
+		PID:        exit.PID,
+		Action:     models.ServerStopped,
+		Time:       exit.ExitedAt,
+	}
+	if !exit.Requested {
+		event.Action = models.ServerCrashed
+	}
+	if exit.Err != nil {
+		event.Message = exit.Err.Error()
+	}
+	if last, exists := p.lastLine[exit.RoomID]; exists && last.Before(exit.ExitedAt) {
+		event.Time = last
+	}
+	delete(p.lastLine, exit.RoomID)
+	return event
+}
+func (p *LogPipeline) deliver(subscriber *logSubscriber) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case event := <-subscriber.events:
+			subscriber.handler(event)
+		}
+	}
+}
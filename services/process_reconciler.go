@@ -0,0 +1,171 @@
+package services
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"terraria-panel/config"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"terraria-panel/utils"
+)
+type ProcessReconciler struct {
+	db          *sql.DB
+	roomStorage storage.RoomStorage
+}
+func NewProcessReconciler(db *sql.DB, roomStorage storage.RoomStorage) *ProcessReconciler {
+	return &ProcessReconciler{
+		db:          db,
+		roomStorage: roomStorage,
+	}
+}
+func (r *ProcessReconciler) Reconcile() {
+	log.Println("🔍 Reconciling game server processes...")
+	rooms, err := r.roomStorage.GetAll()
+	if err != nil {
+		log.Printf("[Reconciler] Failed to load rooms: %v", err)
+		return
+	}
+	scanned := utils.ScanRoomProcesses(config.DataDir)
+	adopted, reset := 0, 0
+	for i := range rooms {
+		room := &rooms[i]
+		pid := 0
+		if room.PID > 0 && utils.VerifyProcessCmdline(room.PID, roomCmdlineMarkers(room.ID)...) {
+			pid = room.PID
+		} else if scannedPID, exists := scanned[room.ID]; exists {
+			pid = scannedPID
+		}
+		if pid == 0 {
+			if room.Status != "stopped" || room.PID != 0 {
+				log.Printf("[Reconciler] Room %d process is gone (status: %s, pid: %d), resetting to stopped", room.ID, room.Status, room.PID)
+				r.roomStorage.UpdateStatus(room.ID, "stopped", 0)
+				reset++
+			}
+			continue
+		}
+		if err := r.adoptRoom(room, pid); err != nil {
+			log.Printf("[Reconciler] Failed to adopt room %d (pid %d): %v", room.ID, pid, err)
+			continue
+		}
+		adopted++
+	}
+	r.reconcilePluginServer()
+	log.Printf("✅ Process reconciliation finished: %d adopted, %d reset to stopped", adopted, reset)
+}
+func (r *ProcessReconciler) adoptRoom(room *models.Room, pid int) error {
+	logFile := filepath.Join(config.LogsDir, fmt.Sprintf("room-%d.log", room.ID))
+	logWriter, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	fmt.Fprintf(logWriter, "[PANEL] 面板重启后接管运行中的服务器进程 (PID: %d)\n", pid)
+	if _, err := utils.AdoptProcess(room.ID, pid, room.ServerType, logWriter, roomLogSource(room, pid)); err != nil {
+		logWriter.Close()
+		return err
+	}
+	if room.Status != "running" || room.PID != pid {
+		r.roomStorage.UpdateStatus(room.ID, "running", pid)
+	}
+	logActivity(r.db, models.ActivityTypeSystem,
+		fmt.Sprintf("房间 \"%s\" 已被面板重新接管", room.Name),
+		fmt.Sprintf("PID: %d，可停止或强制终止，控制台命令需重启房间后恢复", pid),
+		&room.ID, models.ColorBlue)
+	return nil
+}
+func (r *ProcessReconciler) reconcilePluginServer() {
+	pluginServerService := NewPluginServerService(r.db)
+	pluginServer, err := pluginServerService.GetPluginServer()
+	if err != nil || pluginServer == nil {
+		return
+	}
+	globalTshockDir := filepath.Join(config.ServersDir, "tshock")
+	marker := "-configpath " + globalTshockDir + " "
+	if pluginServer.PID > 0 && utils.VerifyProcessCmdline(pluginServer.PID, marker) {
+		logDir := filepath.Join(globalTshockDir, "logs")
+		logWriter, err := os.OpenFile(filepath.Join(logDir, "plugin-server.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Printf("[Reconciler] Failed to open plugin server log: %v", err)
+			return
+		}
+		if _, err := utils.AdoptProcess(PluginServerID, pluginServer.PID, "tshock", logWriter, newestLogFile(logDir, "plugin-server.log")); err != nil {
+			log.Printf("[Reconciler] Failed to adopt plugin server (pid %d): %v", pluginServer.PID, err)
+			logWriter.Close()
+		}
+		return
+	}
+	if pluginServer.Status != "stopped" || pluginServer.PID != 0 {
+		log.Printf("[Reconciler] Plugin server process is gone, resetting to stopped")
+		pluginServerService.UpdatePluginServerStatus("stopped", 0)
+	}
+}
+func roomCmdlineMarkers(roomID int) []string {
+	return []string{
+		filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", roomID)) + "/",
+		filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", roomID)) + " ",
+		filepath.Join(config.DataDir, "configs", fmt.Sprintf("room-%d-", roomID)),
+	}
+}
+func roomLogSource(room *models.Room, pid int) string {
+	roomLog, _ := filepath.Abs(filepath.Join(config.LogsDir, fmt.Sprintf("room-%d.log", room.ID)))
+	if stdout, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "fd", "1")); err != nil || stdout == roomLog {
+		return roomLog
+	}
+	roomDir := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", room.ID))
+	switch room.ServerType {
+	case "tshock":
+		return newestLogFile(filepath.Join(roomDir, "tshock", "logs"), "")
+	case "tmodloader":
+		candidates := []string{
+			filepath.Join(roomDir, "tModLoader-Logs", "server.log"),
+			filepath.Join(config.ServersDir, "tModLoader", "tModLoader-Logs", "server.log"),
+		}
+		for _, candidate := range candidates {
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+func newestLogFile(dir string, exclude string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	type logCandidate struct {
+		path    string
+		modTime int64
+	}
+	candidates := []logCandidate{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".log") || entry.Name() == exclude {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, logCandidate{filepath.Join(dir, entry.Name()), info.ModTime().UnixNano()})
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].modTime > candidates[j].modTime
+	})
+	return candidates[0].path
+}
+func logActivity(db *sql.DB, activityType, title, description string, roomID *int, color string) {
+	query := `
+		INSERT INTO activity_logs (type, title, description, room_id, player_name, color)
+		VALUES (?, ?, ?, ?, '', ?)
+	`
+	if _, err := db.Exec(query, activityType, title, description, roomID, color); err != nil {
+		log.Printf("Failed to log activity: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package services
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"terraria-panel/utils"
+	"time"
+)
+const (
+	restartBaseDelay = 5 * time.Second
+	restartMaxDelay  = 5 * time.Minute
+)
+type RoomStarter func(roomID int) error
+type RoomSupervisor struct {
+	db          *sql.DB
+	roomStorage storage.RoomStorage
+	starter     RoomStarter
+	crashes     map[int][]time.Time
+	timers      map[int]*time.Timer
+	mu          sync.Mutex
+	stopped     bool
+}
+func NewRoomSupervisor(db *sql.DB, roomStorage storage.RoomStorage, starter RoomStarter) *RoomSupervisor {
+	return &RoomSupervisor{
+		db:          db,
+		roomStorage: roomStorage,
+		starter:     starter,
+		crashes:     make(map[int][]time.Time),
+		timers:      make(map[int]*time.Timer),
+	}
+}
+func (s *RoomSupervisor) Start() {
+	log.Println("🛡️ Starting room supervisor...")
+	utils.OnProcessExit(s.handleExit)
+	log.Println("✅ Room supervisor started")
+}
+func (s *RoomSupervisor) Stop() {
+	log.Println("🛑 Stopping room supervisor...")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	for roomID, timer := range s.timers {
+		timer.Stop()
+		delete(s.timers, roomID)
+	}
+	log.Println("✅ Room supervisor stopped")
+}
+func (s *RoomSupervisor) Reset(roomID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timer, exists := s.timers[roomID]; exists {
+		timer.Stop()
+		delete(s.timers, roomID)
+		log.Printf("[Supervisor] Cancelled pending restart for room %d", roomID)
+	}
+	delete(s.crashes, roomID)
+}
+func (s *RoomSupervisor) handleExit(event utils.ProcessExit) {
+	if event.RoomID == 0 || event.Requested {
+		return
+	}
+	room, err := s.roomStorage.GetByID(event.RoomID)
+	if err != nil {
+		log.Printf("[Supervisor] Failed to load room %d: %v", event.RoomID, err)
+		return
+	}
+	if room == nil || room.Status != "running" {
+		return
+	}
+	if event.ExitCode == 0 && room.RestartPolicy != models.RestartPolicyAlways {
+		log.Printf("[Supervisor] Room %d exited cleanly without a stop request", room.ID)
+		s.roomStorage.UpdateStatus(room.ID, "stopped", 0)
+		return
+	}
+	reason := fmt.Sprintf("退出码 %d", event.ExitCode)
+	if event.Err != nil && event.ExitCode < 0 {
+		reason = event.Err.Error()
+	}
+	s.handleCrash(room, reason)
+}
+func (s *RoomSupervisor) handleCrash(room *models.Room, reason string) {
+	window := time.Duration(room.RestartWindow) * time.Second
+	if window <= 0 {
+		window = time.Duration(models.DefaultRestartWindow) * time.Second
+	}
+	maxRestarts := models.DefaultMaxRestarts
+	if room.MaxRestarts != nil {
+		maxRestarts = *room.MaxRestarts
+	}
+	now := time.Now()
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	recent := []time.Time{}
+	for _, t := range s.crashes[room.ID] {
+		if now.Sub(t) <= window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	s.crashes[room.ID] = recent
+	crashCount := len(recent)
+	s.mu.Unlock()
+	log.Printf("[Supervisor] Room %d crashed (%s), %d crash(es) within %s", room.ID, reason, crashCount, window)
+	switch {
+	case room.RestartPolicy == models.RestartPolicyNever:
+		s.roomStorage.UpdateStatus(room.ID, "crashed", 0)
+		s.logCrash(room, reason, fmt.Sprintf("重启策略为 %s，不会自动重启", room.RestartPolicy), models.ColorRed)
+	case crashCount > maxRestarts:
+		s.roomStorage.UpdateStatus(room.ID, "crashed", 0)
+		s.logCrash(room, reason, fmt.Sprintf("%s 内已崩溃 %d 次，放弃自动重启", window, crashCount), models.ColorRed)
+	default:
+		delay := restartDelay(crashCount)
+		s.roomStorage.UpdateStatus(room.ID, "restarting", 0)
+		s.logCrash(room, reason, fmt.Sprintf("第 %d 次崩溃（%s 内），%s 后自动重启", crashCount, window, delay), models.ColorOrange)
+		s.scheduleRestart(room.ID, delay)
+	}
+}
+func restartDelay(crashCount int) time.Duration {
+	delay := restartBaseDelay
+	for i := 1; i < crashCount; i++ {
+		delay *= 2
+		if delay >= restartMaxDelay {
+			return restartMaxDelay
+		}
+	}
+	return delay
+}
+func (s *RoomSupervisor) scheduleRestart(roomID int, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	if timer, exists := s.timers[roomID]; exists {
+		timer.Stop()
+	}
+	s.timers[roomID] = time.AfterFunc(delay, func() {
+		s.restart(roomID)
+	})
+}
+func (s *RoomSupervisor) restart(roomID int) {
+	s.mu.Lock()
+	delete(s.timers, roomID)
+	stopped := s.stopped
+	s.mu.Unlock()
+	if stopped {
+		return
+	}
+	room, err := s.roomStorage.GetByID(roomID)
+	if err != nil || room == nil {
+		log.Printf("[Supervisor] Room %d no longer available, skipping restart", roomID)
+		return
+	}
+	if room.Status != "restarting" {
+		log.Printf("[Supervisor] Room %d status changed to %s, skipping restart", roomID, room.Status)
+		return
+	}
+	if p, exists := utils.GetProcess(roomID); exists && p.IsRunning() {
+		return
+	}
+	log.Printf("[Supervisor] Restarting room %d...", roomID)
+	if err := s.starter(roomID); err != nil {
+		log.Printf("[Supervisor] Failed to restart room %d: %v", roomID, err)
+		s.handleCrash(room, "重启失败: "+err.Error())
+		return
+	}
+	s.logActivity(room.ID, models.ActivityTypeRoomRestart,
+		fmt.Sprintf("房间 \"%s\" 已自动重启", room.Name), "由崩溃守护自动重启", models.ColorBlue)
+}
+func (s *RoomSupervisor) logCrash(room *models.Room, reason, description, color string) {
+	s.logActivity(room.ID, models.ActivityTypeRoomCrash,
+		fmt.Sprintf("房间 \"%s\" 崩溃 (%s)", room.Name, reason), description, color)
+}
+func (s *RoomSupervisor) logActivity(roomID int, activityType, title, description, color string) {
+	logActivity(s.db, activityType, title, description, &roomID, color)
+}
@@ -19,12 +19,18 @@ type PlayerStorage interface {
 }
 type UserStorage interface {
 	GetByUsername(username string) (*models.User, error)
+	GetByID(id int) (*models.User, error)
+	GetAll() ([]models.User, error)
 	Create(user *models.User) error
+	CreateFirst(user *models.User) error
 	Update(user *models.User) error
+	Delete(id int) error
 	Count() (int, error)
+	CountByRole(role string) (int, error)
 }
 type OperationLogStorage interface {
 	Create(log *models.OperationLog) error
 	GetByUserID(userID int, limit int) ([]models.OperationLog, error)
 	GetRecent(limit int) ([]models.OperationLog, error)
+	Query(filter models.OperationLogFilter, limit, offset int) ([]models.OperationLog, int, error)
 }
@@ -0,0 +1,115 @@
+package storage
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"terraria-panel/models"
+	"time"
+)
+type APITokenStorage interface {
+	Create(token *models.APIToken) error
+	GetByHash(hash string) (*models.APIToken, error)
+	GetAll() ([]*models.APIToken, error)
+	Revoke(id int) error
+	TouchLastUsed(id int) error
+}
+type SQLiteAPITokenStorage struct {
+	db *sql.DB
+}
+func NewSQLiteAPITokenStorage(db *sql.DB) *SQLiteAPITokenStorage {
+	return &SQLiteAPITokenStorage{db: db}
+}
+const apiTokenColumns = `id, name, token_hash, token_prefix, COALESCE(scopes, ''), COALESCE(room_ids, ''), COALESCE(created_by, ''),
+	created_at, expires_at, last_used_at, revoked_at`
+func (s *SQLiteAPITokenStorage) Create(token *models.APIToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO api_tokens (name, token_hash, token_prefix, scopes, room_ids, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, token.Name, token.TokenHash, token.Prefix, strings.Join(token.Scopes, ","), joinIDs(token.RoomIDs),
+		token.CreatedBy, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	token.ID = int(id)
+	return nil
+}
+func (s *SQLiteAPITokenStorage) GetByHash(hash string) (*models.APIToken, error) {
+	token, err := scanAPIToken(s.db.QueryRow("SELECT "+apiTokenColumns+" FROM api_tokens WHERE token_hash = ?", hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return token, err
+}
+func (s *SQLiteAPITokenStorage) GetAll() ([]*models.APIToken, error) {
+	rows, err := s.db.Query("SELECT " + apiTokenColumns + " FROM api_tokens ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []*models.APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+func (s *SQLiteAPITokenStorage) Revoke(id int) error {
+	result, err := s.db.Exec(`UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+func (s *SQLiteAPITokenStorage) TouchLastUsed(id int) error {
+	_, err := s.db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, time.Now(), id)
+	return err
+}
+func scanAPIToken(row rowScanner) (*models.APIToken, error) {
+	token := &models.APIToken{}
+	var scopes, roomIDs string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	if err := row.Scan(&token.ID, &token.Name, &token.TokenHash, &token.Prefix, &scopes, &roomIDs, &token.CreatedBy,
+		&token.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	token.Scopes = []string{}
+	if scopes != "" {
+		token.Scopes = strings.Split(scopes, ",")
+	}
+	token.RoomIDs = []int{}
+	for _, value := range strings.Split(roomIDs, ",") {
+		if id, err := strconv.Atoi(value); err == nil {
+			token.RoomIDs = append(token.RoomIDs, id)
+		}
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, nil
+}
+func joinIDs(ids []int) string {
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, strconv.Itoa(id))
+	}
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,190 @@
+package storage
+import (
+	"database/sql"
+	"strings"
+	"terraria-panel/models"
+	"time"
+)
+type BackupStorage interface {
+	Create(backup *models.Backup) error
+	GetByID(id int) (*models.Backup, error)
+	GetByName(name string) (*models.Backup, error)
+	List(filter models.BackupFilter, limit, offset int) ([]*models.Backup, int, error)
+	UpdateStatus(id int, status, errMsg string) error
+	SetPinned(id int, pinned bool) error
+	Delete(id int) error
+	GetRetentionPolicy(roomID int) (*models.BackupRetentionPolicy, error)
+	SaveRetentionPolicy(policy *models.BackupRetentionPolicy) error
+	GetEnabledRetentionRooms() ([]int, error)
+}
+type SQLiteBackupStorage struct {
+	db *sql.DB
+}
+func NewSQLiteBackupStorage(db *sql.DB) *SQLiteBackupStorage {
+	return &SQLiteBackupStorage{db: db}
+}
+const backupColumns = `id, name, file_name, room_id, COALESCE(room_name, ''), trigger_type, type, COALESCE(note, ''),
+	COALESCE(sha256, ''), size, COALESCE(stored_size, 0), file_count, COALESCE(created_by, ''), duration_ms,
+	COALESCE(save_status, ''), COALESCE(save_detail, ''), COALESCE(pinned, 0), status, COALESCE(error, ''), created_at`
+func (s *SQLiteBackupStorage) Create(backup *models.Backup) error {
+	if backup.CreatedAt.IsZero() {
+		backup.CreatedAt = time.Now()
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO backups (name, file_name, room_id, room_name, trigger_type, type, note, sha256, size,
+			stored_size, file_count, created_by, duration_ms, save_status, save_detail, pinned, status, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, backup.Name, backup.FileName, backup.RoomID, backup.RoomName, backup.Trigger, backup.Type, backup.Note, backup.SHA256,
+		backup.Size, backup.StoredSize, backup.FileCount, backup.CreatedBy, backup.DurationMs,
+		backup.SaveStatus, backup.SaveDetail, backup.Pinned, backup.Status, backup.Error, backup.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	backup.ID = int(id)
+	return nil
+}
+func (s *SQLiteBackupStorage) GetByID(id int) (*models.Backup, error) {
+	backup, err := scanBackup(s.db.QueryRow(`SELECT `+backupColumns+` FROM backups WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return backup, err
+}
+func (s *SQLiteBackupStorage) GetByName(name string) (*models.Backup, error) {
+	backup, err := scanBackup(s.db.QueryRow(`SELECT `+backupColumns+` FROM backups WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return backup, err
+}
+func (s *SQLiteBackupStorage) List(filter models.BackupFilter, limit, offset int) ([]*models.Backup, int, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.RoomID != nil {
+		conditions = append(conditions, "room_id = ?")
+		args = append(args, *filter.RoomID)
+	}
+	if filter.RoomIDs != nil {
+		if len(filter.RoomIDs) == 0 {
+			return []*models.Backup{}, 0, nil
+		}
+		conditions = append(conditions, "room_id IN ("+strings.TrimSuffix(strings.Repeat("?,", len(filter.RoomIDs)), ",")+")")
+		for _, roomID := range filter.RoomIDs {
+			args = append(args, roomID)
+		}
+	}
+	if filter.Trigger != "" {
+		conditions = append(conditions, "trigger_type = ?")
+		args = append(args, filter.Trigger)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.SaveStatus != "" {
+		conditions = append(conditions, "save_status = ?")
+		args = append(args, filter.SaveStatus)
+	}
+	if filter.Before != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, *filter.Before)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM backups`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.Query(`SELECT `+backupColumns+` FROM backups`+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	backups := []*models.Backup{}
+	for rows.Next() {
+		backup, err := scanBackup(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		backups = append(backups, backup)
+	}
+	return backups, total, rows.Err()
+}
+func (s *SQLiteBackupStorage) UpdateStatus(id int, status, errMsg string) error {
+	_, err := s.db.Exec(`UPDATE backups SET status = ?, error = ? WHERE id = ?`, status, errMsg, id)
+	return err
+}
+func (s *SQLiteBackupStorage) SetPinned(id int, pinned bool) error {
+	_, err := s.db.Exec(`UPDATE backups SET pinned = ? WHERE id = ?`, pinned, id)
+	return err
+}
+func (s *SQLiteBackupStorage) Delete(id int) error {
+	_, err := s.db.Exec(`DELETE FROM backups WHERE id = ?`, id)
+	return err
+}
+func (s *SQLiteBackupStorage) GetRetentionPolicy(roomID int) (*models.BackupRetentionPolicy, error) {
+	policy := &models.BackupRetentionPolicy{RoomID: roomID}
+	var updatedBy sql.NullString
+	var updatedAt sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT enabled, keep_last, keep_hourly, keep_daily, keep_weekly, keep_monthly, max_size_mb, updated_by, updated_at
+		FROM backup_retention_policies WHERE room_id = ?
+	`, roomID).Scan(&policy.Enabled, &policy.KeepLast, &policy.KeepHourly, &policy.KeepDaily, &policy.KeepWeekly,
+		&policy.KeepMonthly, &policy.MaxSizeMB, &updatedBy, &updatedAt)
+	if err == sql.ErrNoRows {
+		return policy, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	policy.UpdatedBy = updatedBy.String
+	if updatedAt.Valid {
+		policy.UpdatedAt = &updatedAt.Time
+	}
+	return policy, nil
+}
+func (s *SQLiteBackupStorage) SaveRetentionPolicy(policy *models.BackupRetentionPolicy) error {
+	now := time.Now()
+	policy.UpdatedAt = &now
+	_, err := s.db.Exec(`
+		INSERT INTO backup_retention_policies (room_id, enabled, keep_last, keep_hourly, keep_daily, keep_weekly,
+			keep_monthly, max_size_mb, updated_by, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(room_id) DO UPDATE SET
+			enabled = excluded.enabled,
+			keep_last = excluded.keep_last,
+			keep_hourly = excluded.keep_hourly,
+			keep_daily = excluded.keep_daily,
+			keep_weekly = excluded.keep_weekly,
+			keep_monthly = excluded.keep_monthly,
+			max_size_mb = excluded.max_size_mb,
+			updated_by = excluded.updated_by,
+			updated_at = excluded.updated_at
+	`, policy.RoomID, policy.Enabled, policy.KeepLast, policy.KeepHourly, policy.KeepDaily, policy.KeepWeekly,
+		policy.KeepMonthly, policy.MaxSizeMB, policy.UpdatedBy, now)
+	return err
+}
+func (s *SQLiteBackupStorage) GetEnabledRetentionRooms() ([]int, error) {
+	rows, err := s.db.Query(`SELECT room_id FROM backup_retention_policies WHERE enabled = 1 ORDER BY room_id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+func scanBackup(row rowScanner) (*models.Backup, error) {
+	backup := &models.Backup{}
+	err := row.Scan(&backup.ID, &backup.Name, &backup.FileName, &backup.RoomID, &backup.RoomName, &backup.Trigger, &backup.Type,
+		&backup.Note, &backup.SHA256, &backup.Size, &backup.StoredSize, &backup.FileCount, &backup.CreatedBy, &backup.DurationMs,
+		&backup.SaveStatus, &backup.SaveDetail, &backup.Pinned, &backup.Status, &backup.Error, &backup.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
@@ -0,0 +1,243 @@
+package storage
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"terraria-panel/models"
+	"time"
+)
+var ErrHostKeyAlreadyPinned = errors.New("host key already pinned")
+type BackupTargetStorage interface {
+	List() ([]*models.BackupTarget, error)
+	Get(id int) (*models.BackupTarget, error)
+	Create(target *models.BackupTarget) error
+	Update(target *models.BackupTarget) error
+	PinHostKey(id int, hostKey string) error
+	Delete(id int) error
+	GetRoomTargets(roomID int) ([]int, error)
+	SetRoomTargets(roomID int, targetIDs []int) error
+	GetCopy(id int) (*models.BackupCopy, error)
+	FindCopy(backupID, targetID int) (*models.BackupCopy, error)
+	GetCopies(backupIDs []int) ([]*models.BackupCopy, error)
+	GetRetryableCopies(maxAttempts int) ([]*models.BackupCopy, error)
+	SaveCopy(backupCopy *models.BackupCopy) error
+	DeleteCopies(backupID int) error
+	DeleteCopy(id int) error
+}
+type SQLiteBackupTargetStorage struct {
+	db *sql.DB
+}
+func NewSQLiteBackupTargetStorage(db *sql.DB) *SQLiteBackupTargetStorage {
+	return &SQLiteBackupTargetStorage{db: db}
+}
+const backupTargetColumns = `id, name, type, enabled, COALESCE(path, ''), COALESCE(host, ''), COALESCE(bucket, ''),
+	COALESCE(region, ''), COALESCE(username, ''), COALESCE(secret, ''), COALESCE(private_key, ''), COALESCE(host_key, ''),
+	COALESCE(created_by, ''), created_at, updated_at`
+const backupCopyColumns = `c.id, c.backup_id, c.target_id, COALESCE(t.name, ''), COALESCE(t.type, ''), c.remote_name,
+	COALESCE(c.location, ''), COALESCE(c.sha256, ''), c.size, c.status, c.attempts, COALESCE(c.error, ''), c.verified_at, c.updated_at`
+func (s *SQLiteBackupTargetStorage) List() ([]*models.BackupTarget, error) {
+	rows, err := s.db.Query(`SELECT ` + backupTargetColumns + ` FROM backup_targets ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	targets := []*models.BackupTarget{}
+	for rows.Next() {
+		target, err := scanBackupTarget(rows)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
+func (s *SQLiteBackupTargetStorage) Get(id int) (*models.BackupTarget, error) {
+	target, err := scanBackupTarget(s.db.QueryRow(`SELECT `+backupTargetColumns+` FROM backup_targets WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return target, err
+}
+func (s *SQLiteBackupTargetStorage) Create(target *models.BackupTarget) error {
+	now := time.Now()
+	target.CreatedAt = now
+	target.UpdatedAt = now
+	result, err := s.db.Exec(`
+		INSERT INTO backup_targets (name, type, enabled, path, host, bucket, region, username, secret, private_key,
+			host_key, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, target.Name, target.Type, target.Enabled, target.Path, target.Host, target.Bucket, target.Region, target.Username,
+		target.Secret, target.PrivateKey, target.HostKey, target.CreatedBy, now, now)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	target.ID = int(id)
+	return nil
+}
+func (s *SQLiteBackupTargetStorage) Update(target *models.BackupTarget) error {
+	target.UpdatedAt = time.Now()
+	_, err := s.db.Exec(`
+		UPDATE backup_targets SET name = ?, type = ?, enabled = ?, path = ?, host = ?, bucket = ?, region = ?, username = ?,
+			secret = ?, private_key = ?, host_key = ?, updated_at = ?
+		WHERE id = ?
+	`, target.Name, target.Type, target.Enabled, target.Path, target.Host, target.Bucket, target.Region, target.Username,
+		target.Secret, target.PrivateKey, target.HostKey, target.UpdatedAt, target.ID)
+	return err
+}
+func (s *SQLiteBackupTargetStorage) PinHostKey(id int, hostKey string) error {
+	result, err := s.db.Exec(`UPDATE backup_targets SET host_key = ?, updated_at = ? WHERE id = ? AND COALESCE(host_key, '') = ''`,
+		hostKey, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrHostKeyAlreadyPinned
+	}
+	return nil
+}
+func (s *SQLiteBackupTargetStorage) Delete(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		`DELETE FROM backup_copies WHERE target_id = ?`,
+		`DELETE FROM room_backup_targets WHERE target_id = ?`,
+		`DELETE FROM backup_targets WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+func (s *SQLiteBackupTargetStorage) GetRoomTargets(roomID int) ([]int, error) {
+	rows, err := s.db.Query(`SELECT target_id FROM room_backup_targets WHERE room_id = ? ORDER BY target_id`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+func (s *SQLiteBackupTargetStorage) SetRoomTargets(roomID int, targetIDs []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM room_backup_targets WHERE room_id = ?`, roomID); err != nil {
+		return err
+	}
+	for _, targetID := range targetIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO room_backup_targets (room_id, target_id) VALUES (?, ?)`, roomID, targetID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+func (s *SQLiteBackupTargetStorage) GetCopy(id int) (*models.BackupCopy, error) {
+	copies, err := s.queryCopies(`WHERE c.id = ?`, id)
+	if err != nil || len(copies) == 0 {
+		return nil, err
+	}
+	return copies[0], nil
+}
+func (s *SQLiteBackupTargetStorage) FindCopy(backupID, targetID int) (*models.BackupCopy, error) {
+	copies, err := s.queryCopies(`WHERE c.backup_id = ? AND c.target_id = ?`, backupID, targetID)
+	if err != nil || len(copies) == 0 {
+		return nil, err
+	}
+	return copies[0], nil
+}
+func (s *SQLiteBackupTargetStorage) GetCopies(backupIDs []int) ([]*models.BackupCopy, error) {
+	if len(backupIDs) == 0 {
+		return []*models.BackupCopy{}, nil
+	}
+	args := []interface{}{}
+	for _, id := range backupIDs {
+		args = append(args, id)
+	}
+	return s.queryCopies(`WHERE c.backup_id IN (`+strings.TrimSuffix(strings.Repeat("?,", len(backupIDs)), ",")+`)`, args...)
+}
+func (s *SQLiteBackupTargetStorage) GetRetryableCopies(maxAttempts int) ([]*models.BackupCopy, error) {
+	return s.queryCopies(`WHERE c.status = ? OR (c.status = ? AND c.attempts < ?)`,
+		models.BackupCopyPending, models.BackupCopyFailed, maxAttempts)
+}
+func (s *SQLiteBackupTargetStorage) SaveCopy(backupCopy *models.BackupCopy) error {
+	backupCopy.UpdatedAt = time.Now()
+	result, err := s.db.Exec(`
+		INSERT INTO backup_copies (backup_id, target_id, remote_name, location, sha256, size, status, attempts, error,
+			verified_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(backup_id, target_id) DO UPDATE SET
+			remote_name = excluded.remote_name,
+			location = excluded.location,
+			sha256 = excluded.sha256,
+			size = excluded.size,
+			status = excluded.status,
+			attempts = excluded.attempts,
+			error = excluded.error,
+			verified_at = excluded.verified_at,
+			updated_at = excluded.updated_at
+	`, backupCopy.BackupID, backupCopy.TargetID, backupCopy.RemoteName, backupCopy.Location, backupCopy.SHA256,
+		backupCopy.Size, backupCopy.Status, backupCopy.Attempts, backupCopy.Error, backupCopy.VerifiedAt, backupCopy.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if backupCopy.ID == 0 {
+		if id, err := result.LastInsertId(); err == nil {
+			backupCopy.ID = int(id)
+		}
+	}
+	return nil
+}
+func (s *SQLiteBackupTargetStorage) DeleteCopies(backupID int) error {
+	_, err := s.db.Exec(`DELETE FROM backup_copies WHERE backup_id = ?`, backupID)
+	return err
+}
+func (s *SQLiteBackupTargetStorage) DeleteCopy(id int) error {
+	_, err := s.db.Exec(`DELETE FROM backup_copies WHERE id = ?`, id)
+	return err
+}
+func (s *SQLiteBackupTargetStorage) queryCopies(where string, args ...interface{}) ([]*models.BackupCopy, error) {
+	rows, err := s.db.Query(`SELECT `+backupCopyColumns+` FROM backup_copies c
+		LEFT JOIN backup_targets t ON t.id = c.target_id `+where+` ORDER BY c.backup_id, t.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	copies := []*models.BackupCopy{}
+	for rows.Next() {
+		backupCopy := &models.BackupCopy{}
+		var verifiedAt sql.NullTime
+		if err := rows.Scan(&backupCopy.ID, &backupCopy.BackupID, &backupCopy.TargetID, &backupCopy.TargetName, &backupCopy.TargetType, &backupCopy.RemoteName,
+			&backupCopy.Location, &backupCopy.SHA256, &backupCopy.Size, &backupCopy.Status, &backupCopy.Attempts, &backupCopy.Error, &verifiedAt, &backupCopy.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if verifiedAt.Valid {
+			backupCopy.VerifiedAt = &verifiedAt.Time
+		}
+		copies = append(copies, backupCopy)
+	}
+	return copies, rows.Err()
+}
+func scanBackupTarget(row rowScanner) (*models.BackupTarget, error) {
+	target := &models.BackupTarget{}
+	err := row.Scan(&target.ID, &target.Name, &target.Type, &target.Enabled, &target.Path, &target.Host, &target.Bucket,
+		&target.Region, &target.Username, &target.Secret, &target.PrivateKey, &target.HostKey, &target.CreatedBy,
+		&target.CreatedAt, &target.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	target.HasSecret = target.Secret != ""
+	target.HasPrivateKey = target.PrivateKey != ""
+	return target, nil
+}
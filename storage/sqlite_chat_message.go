@@ -0,0 +1,93 @@
+package storage
+import (
+	"database/sql"
+	"strings"
+	"terraria-panel/models"
+	"time"
+)
+type ChatMessageStorage interface {
+	Create(message *models.ChatMessage) error
+	Search(filter models.ChatMessageFilter, limit, offset int) ([]*models.ChatMessage, int, error)
+}
+type SQLiteChatMessageStorage struct {
+	db *sql.DB
+}
+func NewSQLiteChatMessageStorage(db *sql.DB) *SQLiteChatMessageStorage {
+	return &SQLiteChatMessageStorage{db: db}
+}
+func (s *SQLiteChatMessageStorage) Create(message *models.ChatMessage) error {
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO chat_messages (room_id, player_name, message, created_at)
+		VALUES (?, ?, ?, ?)
+	`, message.RoomID, message.PlayerName, message.Message, message.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	message.ID = int(id)
+	return nil
+}
+func (s *SQLiteChatMessageStorage) Search(filter models.ChatMessageFilter, limit, offset int) ([]*models.ChatMessage, int, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.PlayerName != "" {
+		conditions = append(conditions, "player_name = ?")
+		args = append(args, filter.PlayerName)
+	}
+	if filter.RoomID != nil {
+		conditions = append(conditions, "room_id = ?")
+		args = append(args, *filter.RoomID)
+	}
+	if filter.RoomIDs != nil {
+		if len(filter.RoomIDs) == 0 {
+			return []*models.ChatMessage{}, 0, nil
+		}
+		conditions = append(conditions, "room_id IN ("+strings.TrimSuffix(strings.Repeat("?,", len(filter.RoomIDs)), ",")+")")
+		for _, roomID := range filter.RoomIDs {
+			args = append(args, roomID)
+		}
+	}
+	if filter.Keyword != "" {
+		conditions = append(conditions, "message LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+escapeLike(filter.Keyword)+"%")
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, *filter.Since)
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, *filter.Until)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM chat_messages"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.Query("SELECT id, room_id, player_name, message, created_at FROM chat_messages"+where+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	messages := []*models.ChatMessage{}
+	for rows.Next() {
+		message := &models.ChatMessage{}
+		if err := rows.Scan(&message.ID, &message.RoomID, &message.PlayerName, &message.Message, &message.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, total, rows.Err()
+}
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,59 @@
+package storage
+import (
+	"database/sql"
+	"terraria-panel/models"
+	"time"
+)
+type ConsoleHistoryStorage interface {
+	Add(entry *models.ConsoleCommand) error
+	GetRecent(userID, roomID, limit int) ([]*models.ConsoleCommand, error)
+}
+type SQLiteConsoleHistoryStorage struct {
+	db *sql.DB
+}
+func NewSQLiteConsoleHistoryStorage(db *sql.DB) *SQLiteConsoleHistoryStorage {
+	return &SQLiteConsoleHistoryStorage{db: db}
+}
+func (s *SQLiteConsoleHistoryStorage) Add(entry *models.ConsoleCommand) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO console_history (user_id, username, room_id, command, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, entry.UserID, entry.Username, entry.RoomID, entry.Command, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = int(id)
+	return nil
+}
+func (s *SQLiteConsoleHistoryStorage) GetRecent(userID, roomID, limit int) ([]*models.ConsoleCommand, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, COALESCE(username, ''), room_id, command, created_at
+		FROM console_history
+		WHERE user_id = ? AND room_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, userID, roomID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []*models.ConsoleCommand{}
+	for rows.Next() {
+		entry := &models.ConsoleCommand{}
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Username, &entry.RoomID, &entry.Command, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, rows.Err()
+}
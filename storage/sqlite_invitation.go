@@ -0,0 +1,129 @@
+package storage
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"terraria-panel/models"
+	"time"
+)
+var ErrInvitationUnavailable = errors.New("invitation already used or expired")
+type InvitationStorage interface {
+	Create(invitation *models.Invitation) error
+	GetByCode(code string) (*models.Invitation, error)
+	GetAll() ([]*models.Invitation, error)
+	Redeem(invitation *models.Invitation, user *models.User) error
+	Delete(id int) error
+}
+type SQLiteInvitationStorage struct {
+	db *sql.DB
+}
+func NewSQLiteInvitationStorage(db *sql.DB) *SQLiteInvitationStorage {
+	return &SQLiteInvitationStorage{db: db}
+}
+const invitationColumns = `id, code, role, COALESCE(room_grants, ''), COALESCE(created_by, ''), created_at, expires_at, used_at, COALESCE(used_by, '')`
+func (s *SQLiteInvitationStorage) Create(invitation *models.Invitation) error {
+	if invitation.CreatedAt.IsZero() {
+		invitation.CreatedAt = time.Now()
+	}
+	grants, err := json.Marshal(invitation.Grants)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO user_invitations (code, role, room_grants, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, invitation.Code, invitation.Role, string(grants), invitation.CreatedBy, invitation.CreatedAt, invitation.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	invitation.ID = int(id)
+	return nil
+}
+func (s *SQLiteInvitationStorage) GetByCode(code string) (*models.Invitation, error) {
+	invitation, err := scanInvitation(s.db.QueryRow("SELECT "+invitationColumns+" FROM user_invitations WHERE code = ?", code))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return invitation, err
+}
+func (s *SQLiteInvitationStorage) GetAll() ([]*models.Invitation, error) {
+	rows, err := s.db.Query("SELECT " + invitationColumns + " FROM user_invitations ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invitations := []*models.Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+func (s *SQLiteInvitationStorage) Redeem(invitation *models.Invitation, user *models.User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now()
+	result, err := tx.Exec(`
+		UPDATE user_invitations SET used_at = ?, used_by = ?
+		WHERE id = ? AND used_at IS NULL AND (expires_at IS NULL OR expires_at > ?)
+	`, now, user.Username, invitation.ID, now)
+	if err != nil {
+		return err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if claimed == 0 {
+		return ErrInvitationUnavailable
+	}
+	result, err = tx.Exec(`INSERT INTO users (username, password, role) VALUES (?, ?, ?)`, user.Username, user.Password, user.Role)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	user.ID = int(id)
+	invitation.UsedAt = &now
+	invitation.UsedBy = user.Username
+	return nil
+}
+func (s *SQLiteInvitationStorage) Delete(id int) error {
+	_, err := s.db.Exec(`DELETE FROM user_invitations WHERE id = ?`, id)
+	return err
+}
+func scanInvitation(row rowScanner) (*models.Invitation, error) {
+	invitation := &models.Invitation{}
+	var grants string
+	var expiresAt, usedAt sql.NullTime
+	if err := row.Scan(&invitation.ID, &invitation.Code, &invitation.Role, &grants, &invitation.CreatedBy,
+		&invitation.CreatedAt, &expiresAt, &usedAt, &invitation.UsedBy); err != nil {
+		return nil, err
+	}
+	invitation.Grants = []models.RoomGrant{}
+	if grants != "" {
+		json.Unmarshal([]byte(grants), &invitation.Grants)
+	}
+	if expiresAt.Valid {
+		invitation.ExpiresAt = &expiresAt.Time
+	}
+	if usedAt.Valid {
+		invitation.UsedAt = &usedAt.Time
+	}
+	return invitation, nil
+}
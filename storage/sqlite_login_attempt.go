@@ -0,0 +1,167 @@
+package storage
+import (
+	"database/sql"
+	"strings"
+	"terraria-panel/models"
+	"time"
+)
+type LoginAttemptStorage interface {
+	RecordFailure(username, ipAddress string) error
+	CountFailures(username, ipAddress string, since time.Time) (int, error)
+	ClearFailures(username, ipAddress string) error
+	GetRecent(username, ipAddress string, limit, offset int) ([]*models.LoginAttempt, int, error)
+	DeleteBefore(before time.Time) (int, error)
+	GetLockout(scope, key string) (*models.LoginLockout, error)
+	GetLockoutByID(id int) (*models.LoginLockout, error)
+	GetLockouts(activeOnly bool) ([]*models.LoginLockout, error)
+	SaveLockout(lockout *models.LoginLockout) error
+	DeleteLockout(id int) error
+}
+type SQLiteLoginAttemptStorage struct {
+	db *sql.DB
+}
+func NewSQLiteLoginAttemptStorage(db *sql.DB) *SQLiteLoginAttemptStorage {
+	return &SQLiteLoginAttemptStorage{db: db}
+}
+const loginLockoutColumns = `id, scope, lock_key, COALESCE(username, ''), COALESCE(ip_address, ''), level, failed_count,
+	locked_until, created_at, updated_at`
+func (s *SQLiteLoginAttemptStorage) RecordFailure(username, ipAddress string) error {
+	_, err := s.db.Exec(`INSERT INTO login_attempts (username, ip_address, failed_at) VALUES (?, ?, ?)`, username, ipAddress, time.Now())
+	return err
+}
+func (s *SQLiteLoginAttemptStorage) CountFailures(username, ipAddress string, since time.Time) (int, error) {
+	conditions, args := loginAttemptFilter(username, ipAddress)
+	conditions = append(conditions, "failed_at >= ?")
+	args = append(args, since)
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM login_attempts WHERE "+strings.Join(conditions, " AND "), args...).Scan(&count)
+	return count, err
+}
+func (s *SQLiteLoginAttemptStorage) ClearFailures(username, ipAddress string) error {
+	conditions, args := loginAttemptFilter(username, ipAddress)
+	if len(conditions) == 0 {
+		return nil
+	}
+	_, err := s.db.Exec("DELETE FROM login_attempts WHERE "+strings.Join(conditions, " AND "), args...)
+	return err
+}
+func (s *SQLiteLoginAttemptStorage) GetRecent(username, ipAddress string, limit, offset int) ([]*models.LoginAttempt, int, error) {
+	conditions, args := loginAttemptFilter(username, ipAddress)
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM login_attempts"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.Query("SELECT id, username, ip_address, failed_at FROM login_attempts"+where+
+		" ORDER BY failed_at DESC, id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	attempts := []*models.LoginAttempt{}
+	for rows.Next() {
+		attempt := &models.LoginAttempt{}
+		if err := rows.Scan(&attempt.ID, &attempt.Username, &attempt.IPAddress, &attempt.FailedAt); err != nil {
+			return nil, 0, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, total, rows.Err()
+}
+func (s *SQLiteLoginAttemptStorage) DeleteBefore(before time.Time) (int, error) {
+	result, err := s.db.Exec(`DELETE FROM login_attempts WHERE failed_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.db.Exec(`DELETE FROM login_lockouts WHERE locked_until < ?`, before); err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+func (s *SQLiteLoginAttemptStorage) GetLockout(scope, key string) (*models.LoginLockout, error) {
+	lockout, err := scanLoginLockout(s.db.QueryRow("SELECT "+loginLockoutColumns+" FROM login_lockouts WHERE scope = ? AND lock_key = ?", scope, key))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return lockout, err
+}
+func (s *SQLiteLoginAttemptStorage) GetLockoutByID(id int) (*models.LoginLockout, error) {
+	lockout, err := scanLoginLockout(s.db.QueryRow("SELECT "+loginLockoutColumns+" FROM login_lockouts WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return lockout, err
+}
+func (s *SQLiteLoginAttemptStorage) GetLockouts(activeOnly bool) ([]*models.LoginLockout, error) {
+	query := "SELECT " + loginLockoutColumns + " FROM login_lockouts"
+	args := []interface{}{}
+	if activeOnly {
+		query += " WHERE locked_until > ?"
+		args = append(args, time.Now())
+	}
+	rows, err := s.db.Query(query+" ORDER BY locked_until DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lockouts := []*models.LoginLockout{}
+	for rows.Next() {
+		lockout, err := scanLoginLockout(rows)
+		if err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, lockout)
+	}
+	return lockouts, rows.Err()
+}
+func (s *SQLiteLoginAttemptStorage) SaveLockout(lockout *models.LoginLockout) error {
+	now := time.Now()
+	if lockout.CreatedAt.IsZero() {
+		lockout.CreatedAt = now
+	}
+	lockout.UpdatedAt = now
+	_, err := s.db.Exec(`
+		INSERT INTO login_lockouts (scope, lock_key, username, ip_address, level, failed_count, locked_until, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(scope, lock_key) DO UPDATE SET
+			level = excluded.level,
+			failed_count = excluded.failed_count,
+			locked_until = excluded.locked_until,
+			updated_at = excluded.updated_at
+	`, lockout.Scope, lockout.Key, lockout.Username, lockout.IPAddress, lockout.Level, lockout.FailedCount,
+		lockout.LockedUntil, lockout.CreatedAt, lockout.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return s.db.QueryRow(`SELECT id FROM login_lockouts WHERE scope = ? AND lock_key = ?`, lockout.Scope, lockout.Key).Scan(&lockout.ID)
+}
+func (s *SQLiteLoginAttemptStorage) DeleteLockout(id int) error {
+	_, err := s.db.Exec(`DELETE FROM login_lockouts WHERE id = ?`, id)
+	return err
+}
+func loginAttemptFilter(username, ipAddress string) ([]string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	if username != "" {
+		conditions = append(conditions, "username = ?")
+		args = append(args, username)
+	}
+	if ipAddress != "" {
+		conditions = append(conditions, "ip_address = ?")
+		args = append(args, ipAddress)
+	}
+	return conditions, args
+}
+func scanLoginLockout(row rowScanner) (*models.LoginLockout, error) {
+	lockout := &models.LoginLockout{}
+	if err := row.Scan(&lockout.ID, &lockout.Scope, &lockout.Key, &lockout.Username, &lockout.IPAddress, &lockout.Level,
+		&lockout.FailedCount, &lockout.LockedUntil, &lockout.CreatedAt, &lockout.UpdatedAt); err != nil {
+		return nil, err
+	}
+	lockout.Active = lockout.IsActive()
+	return lockout, nil
+}
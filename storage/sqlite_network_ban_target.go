@@ -0,0 +1,89 @@
+package storage
+import (
+	"database/sql"
+	"terraria-panel/models"
+	"time"
+)
+type NetworkBanTargetStorage interface {
+	Save(target *models.NetworkBanTarget) error
+	Get(banID, roomID int) (*models.NetworkBanTarget, error)
+	GetByBanID(banID int) ([]*models.NetworkBanTarget, error)
+	GetPendingRemoval() ([]*models.NetworkBanTarget, error)
+}
+type SQLiteNetworkBanTargetStorage struct {
+	db *sql.DB
+}
+func NewSQLiteNetworkBanTargetStorage(db *sql.DB) *SQLiteNetworkBanTargetStorage {
+	return &SQLiteNetworkBanTargetStorage{db: db}
+}
+const networkBanTargetColumns = `t.id, t.ban_id, t.room_id, t.method, COALESCE(t.tickets, ''), t.status, COALESCE(t.error, ''),
+	t.attempts, t.applied_at, t.removed_at, t.updated_at`
+func (s *SQLiteNetworkBanTargetStorage) Save(target *models.NetworkBanTarget) error {
+	target.UpdatedAt = time.Now()
+	result, err := s.db.Exec(`
+		INSERT INTO network_ban_targets (ban_id, room_id, method, tickets, status, error, attempts, applied_at, removed_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(ban_id, room_id) DO UPDATE SET
+			method = excluded.method,
+			tickets = excluded.tickets,
+			status = excluded.status,
+			error = excluded.error,
+			attempts = excluded.attempts,
+			applied_at = excluded.applied_at,
+			removed_at = excluded.removed_at,
+			updated_at = excluded.updated_at
+	`, target.BanID, target.RoomID, target.Method, target.Tickets, target.Status, target.Error, target.Attempts,
+		target.AppliedAt, target.RemovedAt, target.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if target.ID == 0 {
+		if id, err := result.LastInsertId(); err == nil {
+			target.ID = int(id)
+		}
+	}
+	return nil
+}
+func (s *SQLiteNetworkBanTargetStorage) Get(banID, roomID int) (*models.NetworkBanTarget, error) {
+	targets, err := s.query(`SELECT `+networkBanTargetColumns+` FROM network_ban_targets t WHERE t.ban_id = ? AND t.room_id = ?`, banID, roomID)
+	if err != nil || len(targets) == 0 {
+		return nil, err
+	}
+	return targets[0], nil
+}
+func (s *SQLiteNetworkBanTargetStorage) GetByBanID(banID int) ([]*models.NetworkBanTarget, error) {
+	return s.query(`SELECT `+networkBanTargetColumns+` FROM network_ban_targets t WHERE t.ban_id = ? ORDER BY t.room_id`, banID)
+}
+func (s *SQLiteNetworkBanTargetStorage) GetPendingRemoval() ([]*models.NetworkBanTarget, error) {
+	return s.query(`
+		SELECT `+networkBanTargetColumns+`
+		FROM network_ban_targets t
+		JOIN player_bans b ON b.id = t.ban_id
+		WHERE t.status = ? AND (b.lifted_at IS NOT NULL OR (b.expires_at IS NOT NULL AND b.expires_at <= ?))
+		ORDER BY t.ban_id, t.room_id
+	`, models.NetworkBanStatusApplied, time.Now())
+}
+func (s *SQLiteNetworkBanTargetStorage) query(query string, args ...interface{}) ([]*models.NetworkBanTarget, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	targets := []*models.NetworkBanTarget{}
+	for rows.Next() {
+		target := &models.NetworkBanTarget{}
+		var appliedAt, removedAt sql.NullTime
+		if err := rows.Scan(&target.ID, &target.BanID, &target.RoomID, &target.Method, &target.Tickets, &target.Status,
+			&target.Error, &target.Attempts, &appliedAt, &removedAt, &target.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if appliedAt.Valid {
+			target.AppliedAt = &appliedAt.Time
+		}
+		if removedAt.Valid {
+			target.RemovedAt = &removedAt.Time
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
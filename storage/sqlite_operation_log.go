@@ -0,0 +1,135 @@
+package storage
+import (
+	"database/sql"
+	"strings"
+	"terraria-panel/models"
+	"time"
+)
+type SQLiteOperationLogStorage struct {
+	db *sql.DB
+}
+func NewSQLiteOperationLogStorage(db *sql.DB) *SQLiteOperationLogStorage {
+	return &SQLiteOperationLogStorage{db: db}
+}
+const operationLogColumns = `id, COALESCE(user_id, 0), COALESCE(username, ''), action, COALESCE(method, ''), COALESCE(path, ''),
+	COALESCE(target_type, ''), COALESCE(target_id, 0), COALESCE(target_name, ''), room_id,
+	COALESCE(before_value, ''), COALESCE(after_value, ''), COALESCE(details, ''), COALESCE(status_code, 0),
+	COALESCE(ip_address, ''), created_at`
+func (s *SQLiteOperationLogStorage) Create(log *models.OperationLog) error {
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now()
+	}
+	query := `
+		INSERT INTO operation_logs (user_id, username, action, method, path, target_type, target_id, target_name,
+			room_id, before_value, after_value, details, status_code, ip_address, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := s.db.Exec(query,
+		log.UserID,
+		log.Username,
+		log.Action,
+		log.Method,
+		log.Path,
+		log.TargetType,
+		log.TargetID,
+		log.TargetName,
+		log.RoomID,
+		log.Before,
+		log.After,
+		log.Details,
+		log.StatusCode,
+		log.IPAddress,
+		log.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	log.ID = int(id)
+	return nil
+}
+func (s *SQLiteOperationLogStorage) GetByUserID(userID int, limit int) ([]models.OperationLog, error) {
+	logs, _, err := s.Query(models.OperationLogFilter{UserID: userID}, limit, 0)
+	return logs, err
+}
+func (s *SQLiteOperationLogStorage) GetRecent(limit int) ([]models.OperationLog, error) {
+	logs, _, err := s.Query(models.OperationLogFilter{}, limit, 0)
+	return logs, err
+}
+func (s *SQLiteOperationLogStorage) Query(filter models.OperationLogFilter, limit, offset int) ([]models.OperationLog, int, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.UserID > 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Username != "" {
+		conditions = append(conditions, "username = ?")
+		args = append(args, filter.Username)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action LIKE ?")
+		args = append(args, filter.Action+"%")
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID > 0 {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.RoomID != nil {
+		conditions = append(conditions, "room_id = ?")
+		args = append(args, *filter.RoomID)
+	}
+	if filter.IPAddress != "" {
+		conditions = append(conditions, "ip_address = ?")
+		args = append(args, filter.IPAddress)
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, *filter.Since)
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, *filter.Until)
+	}
+	if filter.FailedOnly {
+		conditions = append(conditions, "status_code >= 400")
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM operation_logs"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	query := "SELECT " + operationLogColumns + " FROM operation_logs" + where + " ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?"
+	rows, err := s.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	logs := []models.OperationLog{}
+	for rows.Next() {
+		var log models.OperationLog
+		var roomID sql.NullInt64
+		if err := rows.Scan(&log.ID, &log.UserID, &log.Username, &log.Action, &log.Method, &log.Path,
+			&log.TargetType, &log.TargetID, &log.TargetName, &roomID,
+			&log.Before, &log.After, &log.Details, &log.StatusCode,
+			&log.IPAddress, &log.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if roomID.Valid {
+			id := int(roomID.Int64)
+			log.RoomID = &id
+		}
+		logs = append(logs, log)
+	}
+	return logs, total, rows.Err()
+}
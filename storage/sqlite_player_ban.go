@@ -0,0 +1,159 @@
+package storage
+import (
+	"database/sql"
+	"terraria-panel/models"
+	"time"
+)
+type PlayerBanStorage interface {
+	Create(ban *models.PlayerBan) error
+	GetByID(id int) (*models.PlayerBan, error)
+	GetActive() ([]*models.PlayerBan, error)
+	GetActiveByPlayerID(playerID int) (*models.PlayerBan, error)
+	GetActiveByName(name string) (*models.PlayerBan, error)
+	GetByName(name string) ([]*models.PlayerBan, error)
+	GetExpired() ([]*models.PlayerBan, error)
+	Lift(id int, liftedBy string) error
+}
+type SQLitePlayerBanStorage struct {
+	db *sql.DB
+}
+func NewSQLitePlayerBanStorage(db *sql.DB) *SQLitePlayerBanStorage {
+	return &SQLitePlayerBanStorage{db: db}
+}
+const playerBanColumns = `id, player_id, player_name, COALESCE(ip, ''), COALESCE(reason, ''), room_id,
+	COALESCE(banned_by, ''), COALESCE(external_ref, ''), COALESCE(network, 0), created_at, expires_at, lifted_at, COALESCE(lifted_by, '')`
+const activeBanCondition = `lifted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`
+func (s *SQLitePlayerBanStorage) Create(ban *models.PlayerBan) error {
+	query := `
+		INSERT INTO player_bans (player_id, player_name, ip, reason, room_id, banned_by, external_ref, network, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	if ban.CreatedAt.IsZero() {
+		ban.CreatedAt = time.Now()
+	}
+	result, err := s.db.Exec(query,
+		ban.PlayerID,
+		ban.PlayerName,
+		ban.IP,
+		ban.Reason,
+		ban.RoomID,
+		ban.BannedBy,
+		ban.ExternalRef,
+		ban.Network,
+		ban.CreatedAt,
+		ban.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	ban.ID = int(id)
+	return nil
+}
+func (s *SQLitePlayerBanStorage) GetByID(id int) (*models.PlayerBan, error) {
+	ban, err := scanPlayerBan(s.db.QueryRow(`SELECT `+playerBanColumns+` FROM player_bans WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ban, err
+}
+func (s *SQLitePlayerBanStorage) GetActive() ([]*models.PlayerBan, error) {
+	query := `SELECT ` + playerBanColumns + ` FROM player_bans WHERE ` + activeBanCondition + ` ORDER BY created_at DESC`
+	rows, err := s.db.Query(query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bans := []*models.PlayerBan{}
+	for rows.Next() {
+		ban, err := scanPlayerBan(rows)
+		if err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+func (s *SQLitePlayerBanStorage) GetActiveByPlayerID(playerID int) (*models.PlayerBan, error) {
+	query := `SELECT ` + playerBanColumns + ` FROM player_bans WHERE player_id = ? AND ` + activeBanCondition + `
+		ORDER BY created_at DESC LIMIT 1`
+	ban, err := scanPlayerBan(s.db.QueryRow(query, playerID, time.Now()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ban, err
+}
+func (s *SQLitePlayerBanStorage) GetActiveByName(name string) (*models.PlayerBan, error) {
+	query := `SELECT ` + playerBanColumns + ` FROM player_bans WHERE player_name = ? AND ` + activeBanCondition + `
+		ORDER BY created_at DESC LIMIT 1`
+	ban, err := scanPlayerBan(s.db.QueryRow(query, name, time.Now()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ban, err
+}
+func (s *SQLitePlayerBanStorage) GetByName(name string) ([]*models.PlayerBan, error) {
+	query := `SELECT ` + playerBanColumns + ` FROM player_bans WHERE player_name = ? ORDER BY created_at DESC`
+	return s.queryBans(query, name)
+}
+func (s *SQLitePlayerBanStorage) GetExpired() ([]*models.PlayerBan, error) {
+	query := `SELECT ` + playerBanColumns + ` FROM player_bans
+		WHERE lifted_at IS NULL AND expires_at IS NOT NULL AND expires_at <= ? ORDER BY expires_at`
+	return s.queryBans(query, time.Now())
+}
+func (s *SQLitePlayerBanStorage) queryBans(query string, args ...interface{}) ([]*models.PlayerBan, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bans := []*models.PlayerBan{}
+	for rows.Next() {
+		ban, err := scanPlayerBan(rows)
+		if err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+func (s *SQLitePlayerBanStorage) Lift(id int, liftedBy string) error {
+	query := `UPDATE player_bans SET lifted_at = ?, lifted_by = ? WHERE id = ? AND lifted_at IS NULL`
+	_, err := s.db.Exec(query, time.Now(), liftedBy, id)
+	return err
+}
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+func scanPlayerBan(row rowScanner) (*models.PlayerBan, error) {
+	ban := &models.PlayerBan{}
+	var expiresAt, liftedAt sql.NullTime
+	err := row.Scan(
+		&ban.ID,
+		&ban.PlayerID,
+		&ban.PlayerName,
+		&ban.IP,
+		&ban.Reason,
+		&ban.RoomID,
+		&ban.BannedBy,
+		&ban.ExternalRef,
+		&ban.Network,
+		&ban.CreatedAt,
+		&expiresAt,
+		&liftedAt,
+		&ban.LiftedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		ban.ExpiresAt = &expiresAt.Time
+	}
+	if liftedAt.Valid {
+		ban.LiftedAt = &liftedAt.Time
+	}
+	return ban, nil
+}
@@ -8,6 +8,7 @@ type PlayerDailyStatsStorage interface {
 	Create(stats *models.PlayerDailyStats) error
 	GetByDate(date string) (*models.PlayerDailyStats, error)
 	Update(stats *models.PlayerDailyStats) error
+	Upsert(stats *models.PlayerDailyStats) error
 	GetRange(startDate, endDate string) ([]*models.PlayerDailyStats, error)
 	GetRecent(days int) ([]*models.PlayerDailyStats, error)
 	Delete(date string) error
@@ -42,7 +43,7 @@ func (s *SQLitePlayerDailyStatsStorage) Create(stats *models.PlayerDailyStats) e
 }
 func (s *SQLitePlayerDailyStatsStorage) GetByDate(date string) (*models.PlayerDailyStats, error) {
 	query := `
-		SELECT id, date, total_players, active_players, new_players, total_play_time, created_at
+		SELECT id, date(date), total_players, active_players, new_players, total_play_time, created_at
 		FROM player_daily_stats
 		WHERE date = ?
 	`
@@ -79,9 +80,28 @@ func (s *SQLitePlayerDailyStatsStorage) Update(stats *models.PlayerDailyStats) e
 	)
 	return err
 }
+func (s *SQLitePlayerDailyStatsStorage) Upsert(stats *models.PlayerDailyStats) error {
+	query := `
+		INSERT INTO player_daily_stats (date, total_players, active_players, new_players, total_play_time)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(date) DO UPDATE SET
+			total_players = excluded.total_players,
+			active_players = excluded.active_players,
+			new_players = excluded.new_players,
+			total_play_time = excluded.total_play_time
+	`
+	_, err := s.db.Exec(query,
+		stats.Date,
+		stats.TotalPlayers,
+		stats.ActivePlayers,
+		stats.NewPlayers,
+		stats.TotalPlayTime,
+	)
+	return err
+}
 func (s *SQLitePlayerDailyStatsStorage) GetRange(startDate, endDate string) ([]*models.PlayerDailyStats, error) {
 	query := `
-		SELECT id, date, total_players, active_players, new_players, total_play_time, created_at
+		SELECT id, date(date), total_players, active_players, new_players, total_play_time, created_at
 		FROM player_daily_stats
 		WHERE date >= ? AND date <= ?
 		ORDER BY date ASC
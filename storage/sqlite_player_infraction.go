@@ -0,0 +1,228 @@
+package storage
+import (
+	"database/sql"
+	"strings"
+	"terraria-panel/models"
+	"time"
+)
+type PlayerInfractionStorage interface {
+	Create(infraction *models.PlayerInfraction) error
+	GetByID(id int) (*models.PlayerInfraction, error)
+	Query(filter models.PlayerInfractionFilter, limit, offset int) ([]*models.PlayerInfraction, int, error)
+	Update(infraction *models.PlayerInfraction) error
+	Revoke(id int, revokedBy string) error
+	RevokeByBanID(banID int, revokedBy string) error
+	Delete(id int) error
+	LastEscalation(name string) (*time.Time, error)
+	GetPendingMuteLifts() ([]*models.PlayerInfraction, error)
+	MarkLifted(id int) error
+}
+type SQLitePlayerInfractionStorage struct {
+	db *sql.DB
+}
+func NewSQLitePlayerInfractionStorage(db *sql.DB) *SQLitePlayerInfractionStorage {
+	return &SQLitePlayerInfractionStorage{db: db}
+}
+const playerInfractionColumns = `id, COALESCE(player_id, 0), player_name, type, COALESCE(reason, ''), COALESCE(evidence_url, ''),
+	room_id, COALESCE(ban_id, 0), COALESCE(escalated, 0), COALESCE(created_by, ''), created_at, expires_at,
+	revoked_at, COALESCE(revoked_by, ''), lifted_at`
+func (s *SQLitePlayerInfractionStorage) Create(infraction *models.PlayerInfraction) error {
+	if infraction.CreatedAt.IsZero() {
+		infraction.CreatedAt = time.Now()
+	}
+	var banID interface{}
+	if infraction.BanID > 0 {
+		banID = infraction.BanID
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO player_infractions (player_id, player_name, type, reason, evidence_url, room_id, ban_id,
+			escalated, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		infraction.PlayerID,
+		infraction.PlayerName,
+		infraction.Type,
+		infraction.Reason,
+		infraction.EvidenceURL,
+		infraction.RoomID,
+		banID,
+		infraction.Escalated,
+		infraction.CreatedBy,
+		infraction.CreatedAt,
+		infraction.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	infraction.ID = int(id)
+	return nil
+}
+func (s *SQLitePlayerInfractionStorage) GetByID(id int) (*models.PlayerInfraction, error) {
+	infraction, err := scanPlayerInfraction(s.db.QueryRow(`SELECT `+playerInfractionColumns+` FROM player_infractions WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return infraction, err
+}
+func (s *SQLitePlayerInfractionStorage) Query(filter models.PlayerInfractionFilter, limit, offset int) ([]*models.PlayerInfraction, int, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.PlayerName != "" {
+		conditions = append(conditions, "player_name = ?")
+		args = append(args, filter.PlayerName)
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.RoomID != nil {
+		conditions = append(conditions, "room_id = ?")
+		args = append(args, *filter.RoomID)
+	}
+	if filter.CreatedBy != "" {
+		conditions = append(conditions, "created_by = ?")
+		args = append(args, filter.CreatedBy)
+	}
+	if filter.ActiveOnly {
+		conditions = append(conditions, "revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)")
+		args = append(args, time.Now())
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, *filter.Since)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM player_infractions"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	query := "SELECT " + playerInfractionColumns + " FROM player_infractions" + where + " ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?"
+	rows, err := s.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	infractions := []*models.PlayerInfraction{}
+	for rows.Next() {
+		infraction, err := scanPlayerInfraction(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		infractions = append(infractions, infraction)
+	}
+	return infractions, total, rows.Err()
+}
+func (s *SQLitePlayerInfractionStorage) Update(infraction *models.PlayerInfraction) error {
+	_, err := s.db.Exec(`UPDATE player_infractions SET reason = ?, evidence_url = ?, room_id = ?, expires_at = ? WHERE id = ?`,
+		infraction.Reason, infraction.EvidenceURL, infraction.RoomID, infraction.ExpiresAt, infraction.ID)
+	return err
+}
+func (s *SQLitePlayerInfractionStorage) Revoke(id int, revokedBy string) error {
+	_, err := s.db.Exec(`UPDATE player_infractions SET revoked_at = ?, revoked_by = ? WHERE id = ? AND revoked_at IS NULL`,
+		time.Now(), revokedBy, id)
+	return err
+}
+func (s *SQLitePlayerInfractionStorage) RevokeByBanID(banID int, revokedBy string) error {
+	_, err := s.db.Exec(`UPDATE player_infractions SET revoked_at = ?, revoked_by = ? WHERE ban_id = ? AND revoked_at IS NULL`,
+		time.Now(), revokedBy, banID)
+	return err
+}
+func (s *SQLitePlayerInfractionStorage) Delete(id int) error {
+	result, err := s.db.Exec("DELETE FROM player_infractions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+func (s *SQLitePlayerInfractionStorage) LastEscalation(name string) (*time.Time, error) {
+	var createdAt time.Time
+	err := s.db.QueryRow(`
+		SELECT created_at FROM player_infractions
+		WHERE player_name = ? AND escalated = 1
+		ORDER BY created_at DESC LIMIT 1
+	`, name).Scan(&createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &createdAt, nil
+}
+func (s *SQLitePlayerInfractionStorage) GetPendingMuteLifts() ([]*models.PlayerInfraction, error) {
+	rows, err := s.db.Query(`
+		SELECT `+playerInfractionColumns+` FROM player_infractions
+		WHERE type = ? AND lifted_at IS NULL AND (revoked_at IS NOT NULL OR (expires_at IS NOT NULL AND expires_at <= ?))
+		ORDER BY id
+	`, models.InfractionMute, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	infractions := []*models.PlayerInfraction{}
+	for rows.Next() {
+		infraction, err := scanPlayerInfraction(rows)
+		if err != nil {
+			return nil, err
+		}
+		infractions = append(infractions, infraction)
+	}
+	return infractions, rows.Err()
+}
+func (s *SQLitePlayerInfractionStorage) MarkLifted(id int) error {
+	_, err := s.db.Exec(`UPDATE player_infractions SET lifted_at = ? WHERE id = ? AND lifted_at IS NULL`, time.Now(), id)
+	return err
+}
+func scanPlayerInfraction(row rowScanner) (*models.PlayerInfraction, error) {
+	infraction := &models.PlayerInfraction{}
+	var roomID sql.NullInt64
+	var expiresAt, revokedAt, liftedAt sql.NullTime
+	err := row.Scan(
+		&infraction.ID,
+		&infraction.PlayerID,
+		&infraction.PlayerName,
+		&infraction.Type,
+		&infraction.Reason,
+		&infraction.EvidenceURL,
+		&roomID,
+		&infraction.BanID,
+		&infraction.Escalated,
+		&infraction.CreatedBy,
+		&infraction.CreatedAt,
+		&expiresAt,
+		&revokedAt,
+		&infraction.RevokedBy,
+		&liftedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if roomID.Valid {
+		id := int(roomID.Int64)
+		infraction.RoomID = &id
+	}
+	if expiresAt.Valid {
+		infraction.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		infraction.RevokedAt = &revokedAt.Time
+	}
+	if liftedAt.Valid {
+		infraction.LiftedAt = &liftedAt.Time
+	}
+	return infraction, nil
+}
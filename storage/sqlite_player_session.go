@@ -10,6 +10,9 @@ type PlayerSessionStorage interface {
 	GetByPlayerID(playerID int, limit, offset int) ([]*models.PlayerSession, int, error)
 	GetActiveSession(playerID, roomID int) (*models.PlayerSession, error)
 	UpdateLeaveTime(id int, leaveTime time.Time, duration int) error
+	GetAllActive() ([]*models.PlayerSession, error)
+	GetActiveByRoom(roomID int) ([]*models.PlayerSession, error)
+	CloseBySystem(id int, leaveTime time.Time, duration int) error
 	GetAll(limit, offset int) ([]*models.PlayerSession, int, error)
 	Delete(id int) error
 }
@@ -44,7 +47,7 @@ func (s *SQLitePlayerSessionStorage) Create(session *models.PlayerSession) error
 }
 func (s *SQLitePlayerSessionStorage) GetByID(id int) (*models.PlayerSession, error) {
 	query := `
-		SELECT id, player_id, room_id, join_time, leave_time, duration, ip_address, created_at
+		SELECT id, player_id, room_id, join_time, leave_time, duration, ip_address, closed_by_system, created_at
 		FROM player_sessions
 		WHERE id = ?
 	`
@@ -57,6 +60,7 @@ func (s *SQLitePlayerSessionStorage) GetByID(id int) (*models.PlayerSession, err
 		&session.LeaveTime,
 		&session.Duration,
 		&session.IPAddress,
+		&session.ClosedBySystem,
 		&session.CreatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -75,7 +79,7 @@ func (s *SQLitePlayerSessionStorage) GetByPlayerID(playerID int, limit, offset i
 		return nil, 0, err
 	}
 	query := `
-		SELECT id, player_id, room_id, join_time, leave_time, duration, ip_address, created_at
+		SELECT id, player_id, room_id, join_time, leave_time, duration, ip_address, closed_by_system, created_at
 		FROM player_sessions
 		WHERE player_id = ?
 		ORDER BY join_time DESC
@@ -97,6 +101,7 @@ func (s *SQLitePlayerSessionStorage) GetByPlayerID(playerID int, limit, offset i
 			&session.LeaveTime,
 			&session.Duration,
 			&session.IPAddress,
+			&session.ClosedBySystem,
 			&session.CreatedAt,
 		)
 		if err != nil {
@@ -108,7 +113,7 @@ func (s *SQLitePlayerSessionStorage) GetByPlayerID(playerID int, limit, offset i
 }
 func (s *SQLitePlayerSessionStorage) GetActiveSession(playerID, roomID int) (*models.PlayerSession, error) {
 	query := `
-		SELECT id, player_id, room_id, join_time, leave_time, duration, ip_address, created_at
+		SELECT id, player_id, room_id, join_time, leave_time, duration, ip_address, closed_by_system, created_at
 		FROM player_sessions
 		WHERE player_id = ? AND room_id = ? AND leave_time IS NULL
 		ORDER BY join_time DESC
@@ -123,6 +128,7 @@ func (s *SQLitePlayerSessionStorage) GetActiveSession(playerID, roomID int) (*mo
 		&session.LeaveTime,
 		&session.Duration,
 		&session.IPAddress,
+		&session.ClosedBySystem,
 		&session.CreatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -142,6 +148,56 @@ func (s *SQLitePlayerSessionStorage) UpdateLeaveTime(id int, leaveTime time.Time
 	_, err := s.db.Exec(query, leaveTime, duration, id)
 	return err
 }
+func (s *SQLitePlayerSessionStorage) GetAllActive() ([]*models.PlayerSession, error) {
+	return s.queryActive(`WHERE leave_time IS NULL`)
+}
+func (s *SQLitePlayerSessionStorage) GetActiveByRoom(roomID int) ([]*models.PlayerSession, error) {
+	return s.queryActive(`WHERE leave_time IS NULL AND room_id = ?`, roomID)
+}
+func (s *SQLitePlayerSessionStorage) queryActive(where string, args ...interface{}) ([]*models.PlayerSession, error) {
+	query := `
+		SELECT id, player_id, room_id, join_time, leave_time, duration, ip_address, closed_by_system, created_at
+		FROM player_sessions
+	` + where + `
+		ORDER BY join_time ASC
+	`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*models.PlayerSession{}
+	for rows.Next() {
+		session := &models.PlayerSession{}
+		var ipAddress sql.NullString
+		err := rows.Scan(
+			&session.ID,
+			&session.PlayerID,
+			&session.RoomID,
+			&session.JoinTime,
+			&session.LeaveTime,
+			&session.Duration,
+			&ipAddress,
+			&session.ClosedBySystem,
+			&session.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		session.IPAddress = ipAddress.String
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+func (s *SQLitePlayerSessionStorage) CloseBySystem(id int, leaveTime time.Time, duration int) error {
+	query := `
+		UPDATE player_sessions
+		SET leave_time = ?, duration = ?, closed_by_system = 1
+		WHERE id = ? AND leave_time IS NULL
+	`
+	_, err := s.db.Exec(query, leaveTime, duration, id)
+	return err
+}
 func (s *SQLitePlayerSessionStorage) GetAll(limit, offset int) ([]*models.PlayerSession, int, error) {
 	var total int
 	countQuery := `SELECT COUNT(*) FROM player_sessions`
@@ -150,7 +206,7 @@ func (s *SQLitePlayerSessionStorage) GetAll(limit, offset int) ([]*models.Player
 		return nil, 0, err
 	}
 	query := `
-		SELECT id, player_id, room_id, join_time, leave_time, duration, ip_address, created_at
+		SELECT id, player_id, room_id, join_time, leave_time, duration, ip_address, closed_by_system, created_at
 		FROM player_sessions
 		ORDER BY join_time DESC
 		LIMIT ? OFFSET ?
@@ -171,6 +227,7 @@ func (s *SQLitePlayerSessionStorage) GetAll(limit, offset int) ([]*models.Player
 			&session.LeaveTime,
 			&session.Duration,
 			&session.IPAddress,
+			&session.ClosedBySystem,
 			&session.CreatedAt,
 		)
 		if err != nil {
@@ -14,7 +14,9 @@ func (s *SQLiteRoomStorage) GetAll() ([]models.Room, error) {
 	query := `
 		SELECT id, name, server_type, world_file, port, max_players,
 		       password, mod_profile, COALESCE(world_size, 'medium'), COALESCE(difficulty, 'normal'),
-		       COALESCE(evil_type, 'corruption'), status, pid, start_time, COALESCE(admin_token, ''), created_at, updated_at
+		       COALESCE(evil_type, 'corruption'), status, pid, start_time, COALESCE(admin_token, ''),
+		       COALESCE(restart_policy, 'on-failure'), COALESCE(max_restarts, 5), COALESCE(restart_window, 600),
+		       created_at, updated_at
 		FROM rooms
 		ORDER BY id
 	`
@@ -31,7 +33,8 @@ func (s *SQLiteRoomStorage) GetAll() ([]models.Room, error) {
 			&room.ID, &room.Name, &room.ServerType, &room.WorldFile,
 			&room.Port, &room.MaxPlayers, &room.Password, &room.ModProfile,
 			&room.WorldSize, &room.Difficulty, &room.EvilType,
-			&room.Status, &room.PID, &startTime, &room.AdminToken, &room.CreatedAt, &room.UpdatedAt,
+			&room.Status, &room.PID, &startTime, &room.AdminToken,
+			&room.RestartPolicy, &room.MaxRestarts, &room.RestartWindow, &room.CreatedAt, &room.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -47,7 +50,9 @@ func (s *SQLiteRoomStorage) GetByID(id int) (*models.Room, error) {
 	query := `
 		SELECT id, name, server_type, world_file, port, max_players,
 		       password, mod_profile, COALESCE(world_size, 'medium'), COALESCE(difficulty, 'normal'),
-		       COALESCE(evil_type, 'corruption'), status, pid, start_time, COALESCE(admin_token, ''), created_at, updated_at
+		       COALESCE(evil_type, 'corruption'), status, pid, start_time, COALESCE(admin_token, ''),
+		       COALESCE(restart_policy, 'on-failure'), COALESCE(max_restarts, 5), COALESCE(restart_window, 600),
+		       created_at, updated_at
 		FROM rooms
 		WHERE id = ?
 	`
@@ -57,7 +62,8 @@ func (s *SQLiteRoomStorage) GetByID(id int) (*models.Room, error) {
 		&room.ID, &room.Name, &room.ServerType, &room.WorldFile,
 		&room.Port, &room.MaxPlayers, &room.Password, &room.ModProfile,
 		&room.WorldSize, &room.Difficulty, &room.EvilType,
-		&room.Status, &room.PID, &startTime, &room.AdminToken, &room.CreatedAt, &room.UpdatedAt,
+		&room.Status, &room.PID, &startTime, &room.AdminToken,
+		&room.RestartPolicy, &room.MaxRestarts, &room.RestartWindow, &room.CreatedAt, &room.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -73,8 +79,9 @@ func (s *SQLiteRoomStorage) GetByID(id int) (*models.Room, error) {
 func (s *SQLiteRoomStorage) Create(room *models.Room) error {
 	query := `
 		INSERT INTO rooms (name, server_type, world_file, port, max_players, password, mod_profile, 
-		                  world_size, difficulty, evil_type, status, pid)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		                  world_size, difficulty, evil_type, status, pid,
+		                  restart_policy, max_restarts, restart_window)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	if room.WorldSize == "" {
 		room.WorldSize = "medium"
@@ -85,12 +92,23 @@ func (s *SQLiteRoomStorage) Create(room *models.Room) error {
 	if room.EvilType == "" {
 		room.EvilType = "corruption"
 	}
+	if room.RestartPolicy == "" {
+		room.RestartPolicy = models.RestartPolicyOnFailure
+	}
+	if room.MaxRestarts == nil {
+		maxRestarts := models.DefaultMaxRestarts
+		room.MaxRestarts = &maxRestarts
+	}
+	if room.RestartWindow <= 0 {
+		room.RestartWindow = models.DefaultRestartWindow
+	}
 	result, err := s.db.Exec(
 		query,
 		room.Name, room.ServerType, room.WorldFile, room.Port,
 		room.MaxPlayers, room.Password, room.ModProfile,
 		room.WorldSize, room.Difficulty, room.EvilType,
 		room.Status, room.PID,
+		room.RestartPolicy, room.MaxRestarts, room.RestartWindow,
 	)
 	if err != nil {
 		return err
@@ -108,13 +126,18 @@ func (s *SQLiteRoomStorage) Update(room *models.Room) error {
 	query := `
 		UPDATE rooms
 		SET name = ?, server_type = ?, world_file = ?, port = ?, max_players = ?,
-		    password = ?, mod_profile = ?, updated_at = CURRENT_TIMESTAMP
+		    password = ?, mod_profile = ?,
+		    restart_policy = COALESCE(NULLIF(?, ''), restart_policy),
+		    max_restarts = COALESCE(?, max_restarts),
+		    restart_window = COALESCE(NULLIF(?, 0), restart_window),
+		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
 	_, err := s.db.Exec(
 		query,
 		room.Name, room.ServerType, room.WorldFile, room.Port,
-		room.MaxPlayers, room.Password, room.ModProfile, room.ID,
+		room.MaxPlayers, room.Password, room.ModProfile,
+		room.RestartPolicy, room.MaxRestarts, room.RestartWindow, room.ID,
 	)
 	return err
 }
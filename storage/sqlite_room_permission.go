@@ -0,0 +1,71 @@
+package storage
+import (
+	"database/sql"
+	"terraria-panel/models"
+)
+type RoomPermissionStorage interface {
+	Get(userID, roomID int) (string, error)
+	GetByUser(userID int) ([]models.RoomGrant, error)
+	Set(grant *models.RoomGrant) error
+	Delete(userID, roomID int) error
+	DeleteByUser(userID int) error
+	DeleteByRoom(roomID int) error
+}
+type SQLiteRoomPermissionStorage struct {
+	db *sql.DB
+}
+func NewSQLiteRoomPermissionStorage(db *sql.DB) *SQLiteRoomPermissionStorage {
+	return &SQLiteRoomPermissionStorage{db: db}
+}
+func (s *SQLiteRoomPermissionStorage) Get(userID, roomID int) (string, error) {
+	var permission string
+	err := s.db.QueryRow(`SELECT permission FROM room_permissions WHERE user_id = ? AND room_id = ?`, userID, roomID).Scan(&permission)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return permission, err
+}
+func (s *SQLiteRoomPermissionStorage) GetByUser(userID int) ([]models.RoomGrant, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, room_id, permission, COALESCE(granted_by, ''), created_at
+		FROM room_permissions
+		WHERE user_id = ?
+		ORDER BY room_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	grants := []models.RoomGrant{}
+	for rows.Next() {
+		var grant models.RoomGrant
+		if err := rows.Scan(&grant.ID, &grant.UserID, &grant.RoomID, &grant.Permission, &grant.GrantedBy, &grant.CreatedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+func (s *SQLiteRoomPermissionStorage) Set(grant *models.RoomGrant) error {
+	_, err := s.db.Exec(`
+		INSERT INTO room_permissions (user_id, room_id, permission, granted_by)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, room_id) DO UPDATE SET
+			permission = excluded.permission,
+			granted_by = excluded.granted_by,
+			created_at = CURRENT_TIMESTAMP
+	`, grant.UserID, grant.RoomID, grant.Permission, grant.GrantedBy)
+	return err
+}
+func (s *SQLiteRoomPermissionStorage) Delete(userID, roomID int) error {
+	_, err := s.db.Exec(`DELETE FROM room_permissions WHERE user_id = ? AND room_id = ?`, userID, roomID)
+	return err
+}
+func (s *SQLiteRoomPermissionStorage) DeleteByUser(userID int) error {
+	_, err := s.db.Exec(`DELETE FROM room_permissions WHERE user_id = ?`, userID)
+	return err
+}
+func (s *SQLiteRoomPermissionStorage) DeleteByRoom(roomID int) error {
+	_, err := s.db.Exec(`DELETE FROM room_permissions WHERE room_id = ?`, roomID)
+	return err
+}
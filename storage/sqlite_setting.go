@@ -0,0 +1,31 @@
+package storage
+import (
+	"database/sql"
+	"time"
+)
+type SettingStorage interface {
+	Get(key string) (string, error)
+	Set(key, value, updatedBy string) error
+}
+type SQLiteSettingStorage struct {
+	db *sql.DB
+}
+func NewSQLiteSettingStorage(db *sql.DB) *SQLiteSettingStorage {
+	return &SQLiteSettingStorage{db: db}
+}
+func (s *SQLiteSettingStorage) Get(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT COALESCE(value, '') FROM panel_settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+func (s *SQLiteSettingStorage) Set(key, value, updatedBy string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO panel_settings (key, value, updated_by, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_by = excluded.updated_by, updated_at = excluded.updated_at
+	`, key, value, updatedBy, time.Now())
+	return err
+}
@@ -0,0 +1,107 @@
+package storage
+import (
+	"database/sql"
+	"terraria-panel/models"
+	"time"
+)
+type TwoFactorStorage interface {
+	Get(userID int) (*models.TwoFactor, error)
+	SetPendingSecret(userID int, secret string) error
+	Enable(userID int, step int64) error
+	Delete(userID int) error
+	ConsumeStep(userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int, hashes []string) error
+	UseRecoveryCode(userID int, hash string) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
+}
+type SQLiteTwoFactorStorage struct {
+	db *sql.DB
+}
+func NewSQLiteTwoFactorStorage(db *sql.DB) *SQLiteTwoFactorStorage {
+	return &SQLiteTwoFactorStorage{db: db}
+}
+func (s *SQLiteTwoFactorStorage) Get(userID int) (*models.TwoFactor, error) {
+	tf := &models.TwoFactor{}
+	var enabledAt sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT user_id, secret, enabled, enabled_at, last_step
+		FROM user_two_factor
+		WHERE user_id = ?
+	`, userID).Scan(&tf.UserID, &tf.Secret, &tf.Enabled, &enabledAt, &tf.LastStep)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		tf.EnabledAt = &enabledAt.Time
+	}
+	return tf, nil
+}
+func (s *SQLiteTwoFactorStorage) SetPendingSecret(userID int, secret string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_two_factor (user_id, secret, enabled, last_step, created_at)
+		VALUES (?, ?, 0, 0, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = excluded.created_at
+		WHERE user_two_factor.enabled = 0
+	`, userID, secret, time.Now())
+	return err
+}
+func (s *SQLiteTwoFactorStorage) Enable(userID int, step int64) error {
+	_, err := s.db.Exec(`UPDATE user_two_factor SET enabled = 1, enabled_at = ?, last_step = ? WHERE user_id = ?`, time.Now(), step, userID)
+	return err
+}
+func (s *SQLiteTwoFactorStorage) Delete(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM user_two_factor WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+func (s *SQLiteTwoFactorStorage) ConsumeStep(userID int, step int64) (bool, error) {
+	result, err := s.db.Exec(`UPDATE user_two_factor SET last_step = ? WHERE user_id = ? AND last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+func (s *SQLiteTwoFactorStorage) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, hash := range hashes {
+		if _, err := tx.Exec(`INSERT INTO user_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`, userID, hash, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+func (s *SQLiteTwoFactorStorage) UseRecoveryCode(userID int, hash string) (bool, error) {
+	result, err := s.db.Exec(`UPDATE user_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		time.Now(), userID, hash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+func (s *SQLiteTwoFactorStorage) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
@@ -1,8 +1,10 @@
 package storage
 import (
 	"database/sql"
+	"errors"
 	"terraria-panel/models"
 )
+var ErrUsersAlreadyExist = errors.New("users already exist")
 type SQLiteUserStorage struct {
 	db *sql.DB
 }
@@ -28,6 +30,47 @@ func (s *SQLiteUserStorage) GetByUsername(username string) (*models.User, error)
 	}
 	return &user, nil
 }
+func (s *SQLiteUserStorage) GetByID(id int) (*models.User, error) {
+	query := `
+		SELECT id, username, password, role, created_at, updated_at
+		FROM users
+		WHERE id = ?
+	`
+	var user models.User
+	err := s.db.QueryRow(query, id).Scan(
+		&user.ID, &user.Username, &user.Password, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+func (s *SQLiteUserStorage) GetAll() ([]models.User, error) {
+	query := `
+		SELECT id, username, password, role, created_at, updated_at
+		FROM users
+		ORDER BY id
+	`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Password, &user.Role,
+			&user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
 func (s *SQLiteUserStorage) Create(user *models.User) error {
 	query := `
 		INSERT INTO users (username, password, role)
@@ -44,6 +87,30 @@ func (s *SQLiteUserStorage) Create(user *models.User) error {
 	user.ID = int(id)
 	return nil
 }
+func (s *SQLiteUserStorage) CreateFirst(user *models.User) error {
+	query := `
+		INSERT INTO users (username, password, role)
+		SELECT ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM users)
+	`
+	result, err := s.db.Exec(query, user.Username, user.Password, user.Role)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUsersAlreadyExist
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	user.ID = int(id)
+	return nil
+}
 func (s *SQLiteUserStorage) Update(user *models.User) error {
 	query := `
 		UPDATE users
@@ -59,3 +126,12 @@ func (s *SQLiteUserStorage) Count() (int, error) {
 	err := s.db.QueryRow(query).Scan(&count)
 	return count, err
 }
+func (s *SQLiteUserStorage) Delete(id int) error {
+	_, err := s.db.Exec(`DELETE FROM users WHERE id = ?`, id)
+	return err
+}
+func (s *SQLiteUserStorage) CountByRole(role string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, role).Scan(&count)
+	return count, err
+}
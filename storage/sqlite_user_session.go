@@ -0,0 +1,118 @@
+package storage
+import (
+	"database/sql"
+	"terraria-panel/models"
+	"time"
+)
+type UserSessionStorage interface {
+	Create(session *models.UserSession) error
+	GetByID(id int) (*models.UserSession, error)
+	GetByRefreshHash(hash string) (*models.UserSession, error)
+	GetActiveByUser(userID int) ([]*models.UserSession, error)
+	Rotate(id int, refreshHash, ipAddress string, expiresAt time.Time) error
+	Revoke(id int) error
+	RevokeByUser(userID int) (int, error)
+	DeleteExpired(before time.Time) (int, error)
+}
+type SQLiteUserSessionStorage struct {
+	db *sql.DB
+}
+func NewSQLiteUserSessionStorage(db *sql.DB) *SQLiteUserSessionStorage {
+	return &SQLiteUserSessionStorage{db: db}
+}
+const userSessionColumns = `id, user_id, refresh_token_hash, COALESCE(device, ''), COALESCE(user_agent, ''), COALESCE(ip_address, ''),
+	created_at, last_active_at, expires_at, revoked_at`
+func (s *SQLiteUserSessionStorage) Create(session *models.UserSession) error {
+	now := time.Now()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+	if session.LastActiveAt.IsZero() {
+		session.LastActiveAt = now
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO user_sessions (user_id, refresh_token_hash, device, user_agent, ip_address, created_at, last_active_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, session.UserID, session.RefreshHash, session.Device, session.UserAgent, session.IPAddress,
+		session.CreatedAt, session.LastActiveAt, session.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	session.ID = int(id)
+	return nil
+}
+func (s *SQLiteUserSessionStorage) GetByID(id int) (*models.UserSession, error) {
+	session, err := scanUserSession(s.db.QueryRow("SELECT "+userSessionColumns+" FROM user_sessions WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return session, err
+}
+func (s *SQLiteUserSessionStorage) GetByRefreshHash(hash string) (*models.UserSession, error) {
+	session, err := scanUserSession(s.db.QueryRow("SELECT "+userSessionColumns+" FROM user_sessions WHERE refresh_token_hash = ?", hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return session, err
+}
+func (s *SQLiteUserSessionStorage) GetActiveByUser(userID int) ([]*models.UserSession, error) {
+	rows, err := s.db.Query("SELECT "+userSessionColumns+` FROM user_sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_active_at DESC`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*models.UserSession{}
+	for rows.Next() {
+		session, err := scanUserSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+func (s *SQLiteUserSessionStorage) Rotate(id int, refreshHash, ipAddress string, expiresAt time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE user_sessions SET refresh_token_hash = ?, ip_address = ?, last_active_at = ?, expires_at = ?
+		WHERE id = ?
+	`, refreshHash, ipAddress, time.Now(), expiresAt, id)
+	return err
+}
+func (s *SQLiteUserSessionStorage) Revoke(id int) error {
+	_, err := s.db.Exec(`UPDATE user_sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now(), id)
+	return err
+}
+func (s *SQLiteUserSessionStorage) RevokeByUser(userID int) (int, error) {
+	result, err := s.db.Exec(`UPDATE user_sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+func (s *SQLiteUserSessionStorage) DeleteExpired(before time.Time) (int, error) {
+	result, err := s.db.Exec(`DELETE FROM user_sessions WHERE expires_at < ? OR revoked_at < ?`, before, before)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+func scanUserSession(row rowScanner) (*models.UserSession, error) {
+	session := &models.UserSession{}
+	var revokedAt sql.NullTime
+	if err := row.Scan(&session.ID, &session.UserID, &session.RefreshHash, &session.Device, &session.UserAgent,
+		&session.IPAddress, &session.CreatedAt, &session.LastActiveAt, &session.ExpiresAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, nil
+}
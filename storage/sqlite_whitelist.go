@@ -0,0 +1,234 @@
+package storage
+import (
+	"database/sql"
+	"terraria-panel/models"
+	"time"
+)
+type WhitelistStorage interface {
+	GetRoomSettings(roomID int) (*models.RoomWhitelist, error)
+	SaveRoomSettings(settings *models.RoomWhitelist) error
+	GetEntries(scope string, scopeID int) ([]*models.WhitelistEntry, error)
+	GetRoomEntries(roomID int) ([]*models.WhitelistEntry, error)
+	SaveEntry(entry *models.WhitelistEntry) error
+	DeleteEntry(id int, scope string, scopeID int) error
+	ClearEntries(scope string, scopeID int) error
+	IsListed(roomID int, playerName string) (bool, error)
+	ListGroups() ([]*models.WhitelistGroup, error)
+	GetGroup(id int) (*models.WhitelistGroup, error)
+	CreateGroup(group *models.WhitelistGroup) error
+	DeleteGroup(id int) error
+	GetGroupRooms(groupID int) ([]int, error)
+}
+type SQLiteWhitelistStorage struct {
+	db *sql.DB
+}
+func NewSQLiteWhitelistStorage(db *sql.DB) *SQLiteWhitelistStorage {
+	return &SQLiteWhitelistStorage{db: db}
+}
+const whitelistEntryColumns = `id, scope, scope_id, player_name, COALESCE(ip, ''), COALESCE(note, ''), COALESCE(added_by, ''), created_at`
+const roomWhitelistEntryCondition = `(scope = 'room' AND scope_id = ?)
+	OR (scope = 'group' AND scope_id = (SELECT group_id FROM room_whitelists WHERE room_id = ?))`
+func (s *SQLiteWhitelistStorage) GetRoomSettings(roomID int) (*models.RoomWhitelist, error) {
+	settings := &models.RoomWhitelist{RoomID: roomID}
+	var groupID sql.NullInt64
+	var updatedBy sql.NullString
+	var updatedAt sql.NullTime
+	err := s.db.QueryRow(`SELECT enabled, group_id, updated_by, updated_at FROM room_whitelists WHERE room_id = ?`, roomID).
+		Scan(&settings.Enabled, &groupID, &updatedBy, &updatedAt)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if groupID.Valid {
+		id := int(groupID.Int64)
+		settings.GroupID = &id
+	}
+	settings.UpdatedBy = updatedBy.String
+	if updatedAt.Valid {
+		settings.UpdatedAt = &updatedAt.Time
+	}
+	return settings, nil
+}
+func (s *SQLiteWhitelistStorage) SaveRoomSettings(settings *models.RoomWhitelist) error {
+	now := time.Now()
+	settings.UpdatedAt = &now
+	_, err := s.db.Exec(`
+		INSERT INTO room_whitelists (room_id, enabled, group_id, updated_by, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(room_id) DO UPDATE SET
+			enabled = excluded.enabled,
+			group_id = excluded.group_id,
+			updated_by = excluded.updated_by,
+			updated_at = excluded.updated_at
+	`, settings.RoomID, settings.Enabled, settings.GroupID, settings.UpdatedBy, now)
+	return err
+}
+func (s *SQLiteWhitelistStorage) GetEntries(scope string, scopeID int) ([]*models.WhitelistEntry, error) {
+	return s.queryEntries(`SELECT `+whitelistEntryColumns+` FROM whitelist_entries
+		WHERE scope = ? AND scope_id = ? ORDER BY player_name`, scope, scopeID)
+}
+func (s *SQLiteWhitelistStorage) GetRoomEntries(roomID int) ([]*models.WhitelistEntry, error) {
+	return s.queryEntries(`SELECT `+whitelistEntryColumns+` FROM whitelist_entries
+		WHERE `+roomWhitelistEntryCondition+` ORDER BY player_name, scope DESC`, roomID, roomID)
+}
+func (s *SQLiteWhitelistStorage) queryEntries(query string, args ...interface{}) ([]*models.WhitelistEntry, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []*models.WhitelistEntry{}
+	for rows.Next() {
+		entry := &models.WhitelistEntry{}
+		if err := rows.Scan(&entry.ID, &entry.Scope, &entry.ScopeID, &entry.PlayerName, &entry.IP,
+			&entry.Note, &entry.AddedBy, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+func (s *SQLiteWhitelistStorage) SaveEntry(entry *models.WhitelistEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO whitelist_entries (scope, scope_id, player_name, ip, note, added_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(scope, scope_id, player_name) DO UPDATE SET
+			ip = CASE WHEN excluded.ip != '' THEN excluded.ip ELSE whitelist_entries.ip END,
+			note = CASE WHEN excluded.note != '' THEN excluded.note ELSE whitelist_entries.note END
+	`, entry.Scope, entry.ScopeID, entry.PlayerName, entry.IP, entry.Note, entry.AddedBy, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return s.db.QueryRow(`SELECT `+whitelistEntryColumns+` FROM whitelist_entries WHERE scope = ? AND scope_id = ? AND player_name = ?`,
+		entry.Scope, entry.ScopeID, entry.PlayerName).Scan(&entry.ID, &entry.Scope, &entry.ScopeID, &entry.PlayerName,
+		&entry.IP, &entry.Note, &entry.AddedBy, &entry.CreatedAt)
+}
+func (s *SQLiteWhitelistStorage) DeleteEntry(id int, scope string, scopeID int) error {
+	result, err := s.db.Exec(`DELETE FROM whitelist_entries WHERE id = ? AND scope = ? AND scope_id = ?`, id, scope, scopeID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+func (s *SQLiteWhitelistStorage) ClearEntries(scope string, scopeID int) error {
+	_, err := s.db.Exec(`DELETE FROM whitelist_entries WHERE scope = ? AND scope_id = ?`, scope, scopeID)
+	return err
+}
+func (s *SQLiteWhitelistStorage) IsListed(roomID int, playerName string) (bool, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM whitelist_entries WHERE player_name = ? AND (`+roomWhitelistEntryCondition+`)`,
+		playerName, roomID, roomID).Scan(&count)
+	return count > 0, err
+}
+func (s *SQLiteWhitelistStorage) ListGroups() ([]*models.WhitelistGroup, error) {
+	rows, err := s.db.Query(`
+		SELECT g.id, g.name, COALESCE(g.description, ''), COALESCE(g.created_by, ''), g.created_at,
+			(SELECT COUNT(*) FROM whitelist_entries e WHERE e.scope = 'group' AND e.scope_id = g.id)
+		FROM whitelist_groups g ORDER BY g.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	groups := []*models.WhitelistGroup{}
+	for rows.Next() {
+		group := &models.WhitelistGroup{}
+		if err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.CreatedBy, &group.CreatedAt, &group.EntryCount); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.RoomIDs, err = s.GetGroupRooms(group.ID); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+func (s *SQLiteWhitelistStorage) GetGroup(id int) (*models.WhitelistGroup, error) {
+	groups, err := s.ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.ID == id {
+			return group, nil
+		}
+	}
+	return nil, nil
+}
+func (s *SQLiteWhitelistStorage) CreateGroup(group *models.WhitelistGroup) error {
+	if group.CreatedAt.IsZero() {
+		group.CreatedAt = time.Now()
+	}
+	result, err := s.db.Exec(`INSERT INTO whitelist_groups (name, description, created_by, created_at) VALUES (?, ?, ?, ?)`,
+		group.Name, group.Description, group.CreatedBy, group.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	group.ID = int(id)
+	group.RoomIDs = []int{}
+	return nil
+}
+func (s *SQLiteWhitelistStorage) DeleteGroup(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`DELETE FROM whitelist_groups WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM whitelist_entries WHERE scope = 'group' AND scope_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE room_whitelists SET group_id = NULL WHERE group_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+func (s *SQLiteWhitelistStorage) GetGroupRooms(groupID int) ([]int, error) {
+	rows, err := s.db.Query(`SELECT room_id FROM room_whitelists WHERE group_id = ? ORDER BY room_id`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
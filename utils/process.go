@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"github.com/creack/pty"
@@ -26,11 +27,52 @@ type Process struct {
 	outputBuffer []string
 	bufferMu     sync.RWMutex
 	maxBufferLines int
+	bufferTotal    int64
+	pendingLine    string
+	done          chan struct{}
+	exitErr       error
+	adopted       bool
+	stopRequested atomic.Bool
+}
+type ProcessLine struct {
+	RoomID     int
+	PID        int
+	ServerType string
+	Line       string
+	Time       time.Time
+}
+type ProcessExit struct {
+	RoomID     int
+	PID        int
+	ServerType string
+	ExitCode   int
+	Err        error
+	Requested  bool
+	ExitedAt   time.Time
 }
 var (
 	processes = make(map[int]*Process)
 	processMu sync.RWMutex
+	exitHandlers   []func(ProcessExit)
+	exitHandlersMu sync.RWMutex
+	lineHandlers   []func(ProcessLine)
+	lineHandlersMu sync.RWMutex
 )
+var (
+	ansiOSCPattern    = regexp.MustCompile(`\x1b\][^\x07\x1b\n]*(\x07|\x1b\\)?`)
+	ansiScreenPattern = regexp.MustCompile(`\x1b\[[0-9;]*[HJKsu]`)
+	ansiCursorPattern = regexp.MustCompile(`\x1b\[[0-9;]*[ABCDEFGSTf]`)
+)
+func OnProcessExit(handler func(ProcessExit)) {
+	exitHandlersMu.Lock()
+	defer exitHandlersMu.Unlock()
+	exitHandlers = append(exitHandlers, handler)
+}
+func OnProcessLine(handler func(ProcessLine)) {
+	lineHandlersMu.Lock()
+	defer lineHandlersMu.Unlock()
+	lineHandlers = append(lineHandlers, handler)
+}
 func StartProcess(roomID int, command string, args []string, workDir string, envVars map[string]string, logWriter io.Writer, serverType string) (*Process, error) {
 	processMu.Lock()
 	defer processMu.Unlock()
@@ -53,15 +95,20 @@ func StartProcess(roomID int, command string, args []string, workDir string, env
 	if err != nil {
 		return nil, fmt.Errorf("创建 stdin 管道失败: %v", err)
 	}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		stdin.Close()
-		return nil, err
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		stdin.Close()
-		return nil, err
+	logFile, directLog := logWriter.(*os.File)
+	var stdout, stderr io.ReadCloser
+	if directLog {
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+	} else {
+		if stdout, err = cmd.StdoutPipe(); err != nil {
+			stdin.Close()
+			return nil, err
+		}
+		if stderr, err = cmd.StderrPipe(); err != nil {
+			stdin.Close()
+			return nil, err
+		}
 	}
 	if err := cmd.Start(); err != nil {
 		stdin.Close()
@@ -75,9 +122,17 @@ func StartProcess(roomID int, command string, args []string, workDir string, env
 		serverType: serverType,
 		roomID:     roomID,
 		logWriter:  logWriter,
+		done:       make(chan struct{}),
+		outputBuffer:   make([]string, 0, 1000),
+		maxBufferLines: 1000,
 	}
-	go p.readOutput(stdout, "STDOUT")
-	go p.readOutput(stderr, "STDERR")
+	if directLog {
+		go p.followLog(logFile.Name(), true)
+	} else {
+		go p.readOutput(stdout, "STDOUT")
+		go p.readOutput(stderr, "STDERR")
+	}
+	go p.waitExit()
 	processes[roomID] = p
 	return p, nil
 }
@@ -113,12 +168,57 @@ func StartProcessWithPTY(roomID int, command string, args []string, workDir stri
 		logWriter:      logWriter,
 		outputBuffer:   make([]string, 0, 1000),
 		maxBufferLines: 1000,
+		done:           make(chan struct{}),
 	}
 	go p.readPTYOutput()
+	go p.waitExit()
 	processes[roomID] = p
 	log.Printf("[INFO] 进程启动成功 (PTY模式) - PID: %d, Room: %d, Type: %s", p.pid, roomID, serverType)
 	return p, nil
 }
+func (p *Process) waitExit() {
+	err := p.cmd.Wait()
+	p.exitErr = err
+	close(p.done)
+	exitCode := -1
+	if p.cmd.ProcessState != nil {
+		exitCode = p.cmd.ProcessState.ExitCode()
+	}
+	event := ProcessExit{
+		RoomID:     p.roomID,
+		PID:        p.pid,
+		ServerType: p.serverType,
+		ExitCode:   exitCode,
+		Err:        err,
+		Requested:  p.stopRequested.Load(),
+		ExitedAt:   time.Now(),
+	}
+	if event.Requested {
+		log.Printf("[INFO] 进程已退出 - PID: %d, Room: %d, ExitCode: %d", p.pid, p.roomID, exitCode)
+	} else {
+		log.Printf("[WARN] 进程意外退出 - PID: %d, Room: %d, ExitCode: %d, Err: %v", p.pid, p.roomID, exitCode, err)
+	}
+	p.notifyExit(event)
+}
+func (p *Process) notifyExit(event ProcessExit) {
+	exitHandlersMu.RLock()
+	handlers := append([]func(ProcessExit){}, exitHandlers...)
+	exitHandlersMu.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+func (p *Process) waitChan() <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		<-p.done
+		done <- p.exitErr
+	}()
+	return done
+}
 func (p *Process) readPTYOutput() {
 	buf := make([]byte, 1024)
 	for {
@@ -138,36 +238,56 @@ func (p *Process) readPTYOutput() {
 					f.Sync()
 				}
 			}
-			if p.roomID == 0 {
-				filtered := filterANSIEscapeSequences(output)
-				if filtered != "" {
-					BroadcastPluginServerLog(filtered)
-				}
-			}
 			if p.serverType == "tshock" && strings.Contains(output, "/setup") {
 				p.captureAdminToken(output)
 			}
 		}
 	}
 }
-var BroadcastPluginServerLog func(string) = func(msg string) {
-}
 func (p *Process) addToBuffer(output string) {
-	p.bufferMu.Lock()
-	defer p.bufferMu.Unlock()
 	filtered := filterANSIEscapeSequences(output)
 	if filtered == "" {
 		return
 	}
+	p.bufferMu.Lock()
 	p.outputBuffer = append(p.outputBuffer, filtered)
+	p.bufferTotal++
 	if len(p.outputBuffer) > p.maxBufferLines {
 		p.outputBuffer = p.outputBuffer[len(p.outputBuffer)-p.maxBufferLines:]
 	}
+	lines := strings.Split(p.pendingLine+filtered, "\n")
+	p.pendingLine = lines[len(lines)-1]
+	p.bufferMu.Unlock()
+	p.notifyLines(lines[:len(lines)-1])
+}
+func (p *Process) notifyLines(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	lineHandlersMu.RLock()
+	handlers := append([]func(ProcessLine){}, lineHandlers...)
+	lineHandlersMu.RUnlock()
+	now := time.Now()
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		event := ProcessLine{
+			RoomID:     p.roomID,
+			PID:        p.pid,
+			ServerType: p.serverType,
+			Line:       line,
+			Time:       now,
+		}
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
 }
 func filterANSIEscapeSequences(output string) string {
-	output = regexp.MustCompile(`\x1b\][^\x07\x1b\n]*(\x07|\x1b\\)?`).ReplaceAllString(output, "")
-	output = regexp.MustCompile(`\x1b\[[0-9;]*[HJKsu]`).ReplaceAllString(output, "")
-	output = regexp.MustCompile(`\x1b\[[0-9;]*[ABCDEFGSTf]`).ReplaceAllString(output, "")
+	output = ansiOSCPattern.ReplaceAllString(output, "")
+	output = ansiScreenPattern.ReplaceAllString(output, "")
+	output = ansiCursorPattern.ReplaceAllString(output, "")
 	output = strings.ReplaceAll(output, "\r\n", "\n")
 	output = strings.ReplaceAll(output, "\r", "")
 	return output
@@ -177,10 +297,60 @@ func (p *Process) GetOutputBuffer() string {
 	defer p.bufferMu.RUnlock()
 	return strings.Join(p.outputBuffer, "")
 }
+func (p *Process) OutputSince(seq int64) (string, int64) {
+	p.bufferMu.RLock()
+	defer p.bufferMu.RUnlock()
+	count := int(p.bufferTotal - seq)
+	if count <= 0 {
+		return "", p.bufferTotal
+	}
+	if count > len(p.outputBuffer) {
+		count = len(p.outputBuffer)
+	}
+	return strings.Join(p.outputBuffer[len(p.outputBuffer)-count:], ""), p.bufferTotal
+}
+func (p *Process) RecentOutput(lines int) (string, int64) {
+	p.bufferMu.RLock()
+	output := strings.Join(p.outputBuffer, "")
+	seq := p.bufferTotal
+	p.bufferMu.RUnlock()
+	all := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	if len(all) == 1 && all[0] == "" {
+		return "", seq
+	}
+	return strings.Join(all, "\n") + "\n", seq
+}
+func (p *Process) SendCommandWithOutput(command string, timeout time.Duration) (string, error) {
+	_, seq := p.OutputSince(0)
+	if err := p.SendCommand(command); err != nil {
+		return "", err
+	}
+	deadline := time.Now().Add(timeout)
+	lastSeq := seq
+	quietSince := time.Now()
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		_, current := p.OutputSince(0)
+		if current != lastSeq {
+			lastSeq = current
+			quietSince = time.Now()
+			continue
+		}
+		if lastSeq != seq && time.Since(quietSince) >= 300*time.Millisecond {
+			break
+		}
+	}
+	output, _ := p.OutputSince(seq)
+	return output, nil
+}
 func (p *Process) readOutput(reader io.Reader, prefix string) {
 	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
 		line := scanner.Text()
+		p.addToBuffer(line + "\n")
 		if p.logWriter != nil {
 			fmt.Fprintf(p.logWriter, "[%s] %s\n", prefix, line)
 		}
@@ -193,15 +363,26 @@ func (p *Process) IsRunning() bool {
 	if p.cmd == nil || p.cmd.Process == nil {
 		return false
 	}
+	select {
+	case <-p.done:
+		return false
+	default:
+	}
 	err := p.cmd.Process.Signal(syscall.Signal(0))
 	return err == nil
 }
 func (p *Process) GetPID() int {
 	return p.pid
 }
+func (p *Process) GetServerType() string {
+	return p.serverType
+}
 func (p *Process) SendCommand(command string) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if p.adopted {
+		return fmt.Errorf("该进程由面板重启后接管，无法发送控制台命令，请重启房间以恢复控制台")
+	}
 	if p.usePTY {
 		if p.ptyFile == nil {
 			return fmt.Errorf("PTY is not available")
@@ -220,6 +401,9 @@ func (p *Process) SendCommand(command string) error {
 	if p.stdin == nil {
 		return fmt.Errorf("stdin is not available")
 	}
+	if !strings.HasSuffix(command, "\n") {
+		command += "\n"
+	}
 	_, err := p.stdin.Write([]byte(command))
 	return err
 }
@@ -230,6 +414,7 @@ func (p *Process) Stop() error {
 		return fmt.Errorf("进程未运行")
 	}
 	pid := p.cmd.Process.Pid
+	p.stopRequested.Store(true)
 	fmt.Printf("[INFO] ========== 开始优雅关闭进程 ==========\n")
 	fmt.Printf("[INFO] 进程 PID: %d\n", pid)
 	fmt.Printf("[INFO] 服务器类型: %s\n", p.serverType)
@@ -247,10 +432,7 @@ func (p *Process) Stop() error {
 			return p.cmd.Process.Kill()
 		}
 		fmt.Println("[INFO] SIGTERM 信号已发送，等待服务器优雅退出（10秒）...")
-		done := make(chan error, 1)
-		go func() {
-			done <- p.cmd.Wait()
-		}()
+		done := p.waitChan()
 		select {
 		case waitErr := <-done:
 			if waitErr != nil {
@@ -327,10 +509,7 @@ func (p *Process) Stop() error {
 			fmt.Println("[SUCCESS] stdin 管道已关闭")
 		}
 		fmt.Println("[INFO] 等待服务器优雅退出（5秒）...")
-		done := make(chan error, 1)
-		go func() {
-			done <- p.cmd.Wait()
-		}()
+		done := p.waitChan()
 		select {
 		case <-done:
 			fmt.Printf("[INFO] 进程 %d 已通过控制台命令正常退出\n", pid)
@@ -349,10 +528,7 @@ func (p *Process) Stop() error {
 		fmt.Printf("[WARN] SIGTERM失败，强制杀死进程: %v\n", err)
 		return p.cmd.Process.Kill()
 	}
-	done := make(chan error, 1)
-	go func() {
-		done <- p.cmd.Wait()
-	}()
+	done := p.waitChan()
 	select {
 	case <-done:
 		fmt.Printf("[INFO] 进程 %d 已正常退出\n", pid)
@@ -0,0 +1,218 @@
+package utils
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"github.com/hpcloud/tail"
+)
+var roomMarkerPattern = regexp.MustCompile(`(?:rooms/room-|configs/room-)(\d+)(?:[/-]|$)`)
+var serverExecutables = []string{"TerrariaServer", "TShock.Server", "tModLoader.dll"}
+func isGameServerCmdline(cmdline string) bool {
+	for _, executable := range serverExecutables {
+		if strings.Contains(cmdline, executable) {
+			return true
+		}
+	}
+	return false
+}
+func ReadProcessCmdline(pid int) (string, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " ")), nil
+}
+func IsPIDAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+func VerifyProcessCmdline(pid int, markers ...string) bool {
+	if !IsPIDAlive(pid) {
+		return false
+	}
+	cmdline, err := ReadProcessCmdline(pid)
+	if err != nil || cmdline == "" {
+		return false
+	}
+	for _, marker := range markers {
+		if marker != "" && strings.Contains(cmdline, marker) {
+			return true
+		}
+	}
+	return false
+}
+func ScanRoomProcesses(dataDir string) map[int]int {
+	found := make(map[int]int)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return found
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		cmdline, err := ReadProcessCmdline(pid)
+		if err != nil || !strings.Contains(cmdline, dataDir) || !isGameServerCmdline(cmdline) {
+			continue
+		}
+		matches := roomMarkerPattern.FindStringSubmatch(cmdline)
+		if len(matches) < 2 {
+			continue
+		}
+		roomID, err := strconv.Atoi(matches[1])
+		if err != nil || roomID <= 0 {
+			continue
+		}
+		if existing, exists := found[roomID]; !exists || pid < existing {
+			found[roomID] = pid
+		}
+	}
+	return found
+}
+func AdoptProcess(roomID int, pid int, serverType string, logWriter io.Writer, logSource string) (*Process, error) {
+	processMu.Lock()
+	defer processMu.Unlock()
+	if p, exists := processes[roomID]; exists && p.IsRunning() {
+		return nil, fmt.Errorf("进程已在运行中")
+	}
+	if !IsPIDAlive(pid) {
+		return nil, fmt.Errorf("进程 %d 不存在", pid)
+	}
+	osProcess, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("查找进程失败: %v", err)
+	}
+	p := &Process{
+		cmd:        &exec.Cmd{Process: osProcess},
+		pid:        pid,
+		serverType: serverType,
+		roomID:     roomID,
+		logWriter:  logWriter,
+		adopted:    true,
+		done:       make(chan struct{}),
+		outputBuffer:   make([]string, 0, 1000),
+		maxBufferLines: 1000,
+	}
+	go p.pollExit()
+	if logSource != "" && logWriter != nil {
+		go p.followLog(logSource, false)
+	}
+	processes[roomID] = p
+	log.Printf("[INFO] 已接管运行中的进程 - PID: %d, Room: %d, Type: %s", pid, roomID, serverType)
+	return p, nil
+}
+func (p *Process) IsAdopted() bool {
+	return p.adopted
+}
+func (p *Process) pollExit() {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !IsPIDAlive(p.pid) {
+			break
+		}
+	}
+	close(p.done)
+	event := ProcessExit{
+		RoomID:     p.roomID,
+		PID:        p.pid,
+		ServerType: p.serverType,
+		ExitCode:   -1,
+		Err:        fmt.Errorf("接管的进程已退出"),
+		Requested:  p.stopRequested.Load(),
+		ExitedAt:   time.Now(),
+	}
+	log.Printf("[INFO] 接管的进程已退出 - PID: %d, Room: %d, Requested: %v", p.pid, p.roomID, event.Requested)
+	p.notifyExit(event)
+}
+func (p *Process) followLog(logSource string, fromStart bool) {
+	whence := io.SeekEnd
+	if fromStart {
+		whence = io.SeekStart
+	}
+	t, err := tail.TailFile(logSource, tail.Config{
+		Follow: true,
+		ReOpen: true,
+		Poll:   true,
+		Location: &tail.SeekInfo{
+			Offset: 0,
+			Whence: whence,
+		},
+		Logger: tail.DiscardingLogger,
+	})
+	if err != nil {
+		log.Printf("[ERROR] 无法跟踪接管进程的日志 %s: %v", logSource, err)
+		return
+	}
+	defer t.Cleanup()
+	if p.adopted {
+		log.Printf("[INFO] 房间 %d 日志已重新挂载: %s", p.roomID, logSource)
+	}
+	echo := true
+	if f, ok := p.logWriter.(*os.File); ok && f.Name() == logSource {
+		echo = false
+	}
+	var drain <-chan time.Time
+	done := p.done
+	for {
+		select {
+		case <-done:
+			done = nil
+			drain = time.After(time.Second)
+		case <-drain:
+			t.Stop()
+			return
+		case line, ok := <-t.Lines:
+			if !ok {
+				return
+			}
+			if line.Err != nil {
+				continue
+			}
+			p.addToBuffer(line.Text + "\n")
+			if echo {
+				fmt.Fprintln(p.logWriter, line.Text)
+			}
+			if p.serverType == "tshock" && !p.adopted && strings.Contains(line.Text, "/setup") && !strings.HasPrefix(line.Text, "[ADMIN_TOKEN]") {
+				p.captureAdminToken(line.Text)
+			}
+		}
+	}
+}
+func KillProcess(roomID int) error {
+	processMu.Lock()
+	defer processMu.Unlock()
+	p, exists := processes[roomID]
+	if !exists {
+		return fmt.Errorf("进程不存在")
+	}
+	if p.cmd == nil || p.cmd.Process == nil {
+		return fmt.Errorf("进程未运行")
+	}
+	p.stopRequested.Store(true)
+	if err := p.cmd.Process.Kill(); err != nil && IsPIDAlive(p.pid) {
+		return fmt.Errorf("强制终止进程失败: %v", err)
+	}
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		if IsPIDAlive(p.pid) {
+			return fmt.Errorf("进程 %d 无法终止", p.pid)
+		}
+	}
+	delete(processes, roomID)
+	log.Printf("[INFO] 进程已被强制终止 - PID: %d, Room: %d", p.pid, roomID)
+	return nil
+}
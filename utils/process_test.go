@@ -0,0 +1,43 @@
+package utils
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+func TestStartProcessWritesOutputToLogFile(t *testing.T) {
+	script := `readlink /proc/$$/fd/1; readlink /proc/$$/fd/2 >&2; echo "Type /setup 123456 to set up"; sleep 0.2`
+	for i, serverType := range []string{"vanilla", "tshock", "tmodloader"} {
+		logPath := filepath.Join(t.TempDir(), "room.log")
+		logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := StartProcess(90000+i, "sh", []string{"-c", script}, "", nil, logFile, serverType)
+		if err != nil {
+			t.Fatalf("%s: StartProcess: %v", serverType, err)
+		}
+		<-p.Done()
+		deadline := time.Now().Add(3 * time.Second)
+		for !strings.Contains(p.GetOutputBuffer(), "/setup") && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+		}
+		time.Sleep(300 * time.Millisecond)
+		logFile.Close()
+		data, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := string(data)
+		if strings.Count(content, logPath) != 2 {
+			t.Errorf("%s: stdout and stderr are not the room log file:\n%s", serverType, content)
+		}
+		if !strings.Contains(p.GetOutputBuffer(), "/setup 123456") {
+			t.Errorf("%s: output buffer %q is missing the server output", serverType, p.GetOutputBuffer())
+		}
+		if got := strings.Contains(content, "[ADMIN_TOKEN] /setup 123456"); got != (serverType == "tshock") {
+			t.Errorf("%s: admin token recorded = %v, want %v", serverType, got, serverType == "tshock")
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package utils
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+func TestTOTPCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d): %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantOK   bool
+		wantStep int64
+	}{
+		{"current step", rfc6238Secret, "050471", true, step},
+		{"previous step", rfc6238Secret, "081804", true, step - 1},
+		{"spaces and padding", rfc6238Secret + "====", " 050 471 ", true, step},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", true, step},
+		{"wrong code", rfc6238Secret, "123456", false, 0},
+		{"too short", rfc6238Secret, "05047", false, 0},
+		{"eight digits", rfc6238Secret, "14050471", false, 0},
+		{"invalid secret", "not base32!", "050471", false, 0},
+	}
+	for _, tt := range tests {
+		gotStep, ok := ValidateTOTP(tt.secret, tt.code, now)
+		if ok != tt.wantOK || gotStep != tt.wantStep {
+			t.Errorf("%s: ValidateTOTP() = (%d, %v), want (%d, %v)", tt.name, gotStep, ok, tt.wantStep, tt.wantOK)
+		}
+	}
+	stale, _ := TOTPCode(rfc6238Secret, now.Add(-2*totpPeriod*time.Second))
+	if _, ok := ValidateTOTP(rfc6238Secret, stale, now); ok {
+		t.Errorf("code from two steps ago should be rejected")
+	}
+}
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ValidateTOTP(secret, code, time.Now()); !ok {
+		t.Errorf("generated secret does not validate its own code")
+	}
+}
@@ -0,0 +1,157 @@
+package websocket
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"terraria-panel/middleware"
+	"terraria-panel/models"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+type ChatClient struct {
+	conn      *websocket.Conn
+	userID    int
+	roomID    int
+	allowed   map[int]bool
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+var (
+	chatClients    = make(map[*ChatClient]bool)
+	chatClientsMu  sync.RWMutex
+	chatAuthorizer func(userID, roomID int) bool
+)
+func SetChatAuthorizer(authorizer func(userID, roomID int) bool) {
+	chatAuthorizer = authorizer
+}
+func HandleChatStream(c *gin.Context) {
+	claims, err := middleware.ParseToken(SocketToken(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录或登录已过期"})
+		return
+	}
+	client := &ChatClient{
+		userID:  claims.UserID,
+		roomID:  -1,
+		allowed: make(map[int]bool),
+		send:    make(chan []byte, 256),
+		done:    make(chan struct{}),
+	}
+	if value := c.Query("roomId"); value != "" {
+		roomID, err := strconv.Atoi(value)
+		if err != nil || roomID < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+			return
+		}
+		if !client.canView(roomID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "没有该房间的 view 权限"})
+			return
+		}
+		client.roomID = roomID
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[WebSocket] Failed to upgrade chat connection: %v", err)
+		return
+	}
+	client.conn = conn
+	chatClientsMu.Lock()
+	chatClients[client] = true
+	chatClientsMu.Unlock()
+	log.Printf("[WebSocket] Chat stream connected (user: %s, room: %d)", claims.Username, client.roomID)
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":   "connected",
+		"roomId": client.roomID,
+		"time":   time.Now().Format("2006-01-02 15:04:05"),
+	})
+	client.queue(data)
+	go client.writePump()
+	go WatchSession(conn, claims, client.done, func() bool {
+		return client.roomID < 0 || chatAuthorizer == nil || chatAuthorizer(client.userID, client.roomID)
+	})
+	client.readPump()
+}
+func BroadcastChatMessage(message *models.ChatMessage) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type": "chat",
+		"chat": message,
+	})
+	chatClientsMu.RLock()
+	defer chatClientsMu.RUnlock()
+	for client := range chatClients {
+		if client.roomID >= 0 && client.roomID != message.RoomID {
+			continue
+		}
+		if !client.canView(message.RoomID) {
+			continue
+		}
+		client.queue(data)
+	}
+}
+func (c *ChatClient) canView(roomID int) bool {
+	if chatAuthorizer == nil {
+		return true
+	}
+	allowed, cached := c.allowed[roomID]
+	if !cached {
+		allowed = chatAuthorizer(c.userID, roomID)
+		c.allowed[roomID] = allowed
+	}
+	return allowed
+}
+func (c *ChatClient) readPump() {
+	defer func() {
+		chatClientsMu.Lock()
+		delete(chatClients, c)
+		chatClientsMu.Unlock()
+		c.closeOnce.Do(func() {
+			close(c.done)
+		})
+		c.conn.Close()
+	}()
+	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	}
+}
+func (c *ChatClient) writePump() {
+	ticker := time.NewTicker(54 * time.Second)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case <-c.done:
+			return
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+func (c *ChatClient) queue(data []byte) {
+	select {
+	case c.send <- data:
+	default:
+		log.Printf("[WebSocket] Send buffer full for chat stream of user %d, dropping message", c.userID)
+	}
+}
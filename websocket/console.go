@@ -0,0 +1,410 @@
+package websocket
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"terraria-panel/config"
+	"terraria-panel/middleware"
+	"terraria-panel/models"
+	"terraria-panel/storage"
+	"terraria-panel/utils"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+const (
+	consoleReplayLines    = 100
+	consoleMaxReplayLines = 1000
+	consoleHistoryLimit   = 50
+	consolePollInterval   = 250 * time.Millisecond
+)
+type ConsoleClient struct {
+	conn        *websocket.Conn
+	roomID      int
+	userID      int
+	username    string
+	claims      *middleware.Claims
+	interactive bool
+	send        chan []byte
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+var (
+	consoleClients        = make(map[*ConsoleClient]bool)
+	consoleClientsMu      sync.RWMutex
+	consoleHistoryStorage storage.ConsoleHistoryStorage
+	consoleAuthorizer     func(userID, roomID int, permission string) bool
+)
+func SetConsoleHistoryStorage(s storage.ConsoleHistoryStorage) {
+	consoleHistoryStorage = s
+}
+func SetConsoleAuthorizer(authorizer func(userID, roomID int, permission string) bool) {
+	consoleAuthorizer = authorizer
+}
+func HandleRoomConsole(c *gin.Context) {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+	claims, err := middleware.ParseToken(SocketToken(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录或登录已过期"})
+		return
+	}
+	client := &ConsoleClient{
+		roomID:   roomID,
+		userID:   claims.UserID,
+		username: claims.Username,
+		claims:   claims,
+		send:     make(chan []byte, 512),
+		done:     make(chan struct{}),
+	}
+	client.interactive = client.authorized(models.RoomPermissionOperate)
+	if !client.interactive && !client.authorized(models.RoomPermissionView) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有该房间的 view 权限"})
+		return
+	}
+	lines := consoleReplayLines
+	if n, err := strconv.Atoi(c.Query("lines")); err == nil && n >= 0 {
+		lines = n
+		if lines > consoleMaxReplayLines {
+			lines = consoleMaxReplayLines
+		}
+	}
+	since, _ := strconv.ParseInt(c.Query("since"), 10, 64)
+	pid, _ := strconv.Atoi(c.Query("pid"))
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[WebSocket] Failed to upgrade connection: %v", err)
+		return
+	}
+	client.conn = conn
+	consoleClientsMu.Lock()
+	consoleClients[client] = true
+	consoleClientsMu.Unlock()
+	log.Printf("[WebSocket] Client connected to room %d console (user: %s)", roomID, client.username)
+	message := fmt.Sprintf("🎮 已连接到房间 %d 的控制台", roomID)
+	if !client.interactive {
+		message = fmt.Sprintf("🎮 已连接到房间 %d 的日志流（只读，需要该房间的操作权限才能发送命令）", roomID)
+	}
+	client.sendJSON(map[string]interface{}{
+		"type":        "connected",
+		"roomId":      roomID,
+		"interactive": client.interactive,
+		"message":     message,
+		"time":        time.Now().Format("2006-01-02 15:04:05"),
+	})
+	if client.interactive {
+		client.sendHistory()
+	}
+	go client.writePump()
+	go client.streamOutput(pid, since, lines)
+	go WatchSession(conn, claims, client.done, func() bool {
+		return client.authorized(models.RoomPermissionView)
+	})
+	client.readPump()
+}
+func (c *ConsoleClient) authorized(permission string) bool {
+	return consoleAuthorizer == nil || consoleAuthorizer(c.userID, c.roomID, permission)
+}
+func SendConsoleCommand(roomID, userID int, username, command string) error {
+	command = strings.TrimSpace(strings.NewReplacer("\r", " ", "\n", " ").Replace(command))
+	if command == "" {
+		return fmt.Errorf("命令不能为空")
+	}
+	p, exists := utils.GetProcess(roomID)
+	if !exists || !p.IsRunning() {
+		return fmt.Errorf("服务器未运行")
+	}
+	if err := p.SendCommand(command); err != nil {
+		return err
+	}
+	log.Printf("[Console] Room %d command by %s: %s", roomID, username, command)
+	if consoleHistoryStorage != nil {
+		entry := &models.ConsoleCommand{
+			UserID:   userID,
+			Username: username,
+			RoomID:   roomID,
+			Command:  command,
+		}
+		if err := consoleHistoryStorage.Add(entry); err != nil {
+			log.Printf("[Console] Failed to save command history: %v", err)
+		}
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":     "command",
+		"roomId":   roomID,
+		"username": username,
+		"command":  command,
+		"time":     time.Now().Format("15:04:05"),
+	})
+	consoleClientsMu.RLock()
+	defer consoleClientsMu.RUnlock()
+	for client := range consoleClients {
+		if client.roomID == roomID {
+			client.queue(data)
+		}
+	}
+	return nil
+}
+func BroadcastGameEvent(event *models.GameEvent) {
+	public := *event
+	if public.IPAddress != "" {
+		public.Line = strings.ReplaceAll(public.Line, public.IPAddress, "*")
+		public.Message = strings.ReplaceAll(public.Message, public.IPAddress, "*")
+		public.IPAddress = ""
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":   "event",
+		"roomId": event.RoomID,
+		"event":  public,
+		"time":   event.Time.Format("15:04:05"),
+	})
+	consoleClientsMu.RLock()
+	defer consoleClientsMu.RUnlock()
+	for client := range consoleClients {
+		if client.roomID == event.RoomID {
+			client.queue(data)
+		}
+	}
+}
+func (c *ConsoleClient) readPump() {
+	defer func() {
+		consoleClientsMu.Lock()
+		delete(consoleClients, c)
+		consoleClientsMu.Unlock()
+		c.closeOnce.Do(func() {
+			close(c.done)
+		})
+		c.conn.Close()
+		log.Printf("[WebSocket] Client disconnected from room %d console", c.roomID)
+	}()
+	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("[WebSocket] Read error: %v", err)
+			}
+			break
+		}
+		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		var msg struct {
+			Type    string `json:"type"`
+			Command string `json:"command"`
+		}
+		if err := json.Unmarshal(message, &msg); err != nil {
+			continue
+		}
+		switch msg.Type {
+		case "ping":
+			c.sendJSON(map[string]interface{}{
+				"type": "pong",
+				"time": time.Now().Format("2006-01-02 15:04:05"),
+			})
+		case "command":
+			if !middleware.ValidateSession(c.claims) {
+				closeRevokedSocket(c.conn)
+				return
+			}
+			if !c.interactive || !c.authorized(models.RoomPermissionOperate) {
+				c.sendError("没有该房间的操作权限，无法发送命令")
+				continue
+			}
+			if err := SendConsoleCommand(c.roomID, c.userID, c.username, msg.Command); err != nil {
+				c.sendError("命令发送失败: " + err.Error())
+			}
+		case "history":
+			if c.interactive {
+				c.sendHistory()
+			}
+		}
+	}
+}
+func (c *ConsoleClient) writePump() {
+	ticker := time.NewTicker(54 * time.Second)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case <-c.done:
+			return
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+func (c *ConsoleClient) streamOutput(pid int, since int64, lines int) {
+	ticker := time.NewTicker(consolePollInterval)
+	defer ticker.Stop()
+	var current *utils.Process
+	var seq int64
+	running := false
+	first := true
+	reported := false
+	for {
+		p, exists := utils.GetProcess(c.roomID)
+		if !exists {
+			p = nil
+		}
+		if p != current || first {
+			switch {
+			case p == nil:
+				if first {
+					c.replayLogFile(lines)
+				}
+			case first && pid == p.GetPID() && since > 0:
+				_, total := p.OutputSince(0)
+				if since > total {
+					since = total
+				}
+				seq = since
+			default:
+				var output string
+				output, seq = p.RecentOutput(lines)
+				if first && output != "" {
+					c.sendInfo(fmt.Sprintf("📜 加载最近 %d 行控制台输出", strings.Count(output, "\n")))
+				}
+				c.sendOutput(output, p.GetPID(), seq)
+			}
+			current = p
+			first = false
+		}
+		isRunning := current != nil && current.IsRunning()
+		if current != nil {
+			output, next := current.OutputSince(seq)
+			if output != "" {
+				c.sendOutput(output, current.GetPID(), next)
+			}
+			seq = next
+		}
+		if !reported || isRunning != running {
+			c.sendStatus(current, isRunning)
+			reported = true
+		}
+		running = isRunning
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+func (c *ConsoleClient) replayLogFile(lines int) {
+	logFile := filepath.Join(config.LogsDir, fmt.Sprintf("room-%d.log", c.roomID))
+	if c.roomID == 0 {
+		logFile = filepath.Join(config.ServersDir, "tshock", "logs", "plugin-server.log")
+	}
+	file, err := os.Open(logFile)
+	if err != nil {
+		c.sendInfo("⏳ 服务器未运行，启动后将实时推送控制台输出")
+		return
+	}
+	defer file.Close()
+	history := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		history = append(history, scanner.Text())
+		if len(history) > lines {
+			history = history[1:]
+		}
+	}
+	c.sendInfo(fmt.Sprintf("📜 服务器未运行，加载日志文件最近 %d 行", len(history)))
+	if len(history) > 0 {
+		c.sendOutput(strings.Join(history, "\n")+"\n", 0, 0)
+	}
+}
+func (c *ConsoleClient) sendHistory() {
+	if consoleHistoryStorage == nil {
+		return
+	}
+	entries, err := consoleHistoryStorage.GetRecent(c.userID, c.roomID, consoleHistoryLimit)
+	if err != nil {
+		log.Printf("[Console] Failed to load command history: %v", err)
+		return
+	}
+	commands := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		commands = append(commands, entry.Command)
+	}
+	c.sendJSON(map[string]interface{}{
+		"type":     "history",
+		"roomId":   c.roomID,
+		"commands": commands,
+	})
+}
+func (c *ConsoleClient) sendOutput(output string, pid int, seq int64) {
+	if output == "" {
+		return
+	}
+	c.sendJSON(map[string]interface{}{
+		"type":    "log",
+		"roomId":  c.roomID,
+		"message": output,
+		"pid":     pid,
+		"seq":     seq,
+		"time":    time.Now().Format("15:04:05"),
+	})
+}
+func (c *ConsoleClient) sendStatus(p *utils.Process, running bool) {
+	status := "stopped"
+	pid := 0
+	if running {
+		status = "running"
+		pid = p.GetPID()
+	}
+	c.sendJSON(map[string]interface{}{
+		"type":   "status",
+		"roomId": c.roomID,
+		"status": status,
+		"pid":    pid,
+		"time":   time.Now().Format("15:04:05"),
+	})
+}
+func (c *ConsoleClient) sendInfo(message string) {
+	c.sendJSON(map[string]interface{}{
+		"type":    "info",
+		"message": message,
+		"time":    time.Now().Format("15:04:05"),
+	})
+}
+func (c *ConsoleClient) sendError(message string) {
+	c.sendJSON(map[string]interface{}{
+		"type":    "error",
+		"message": message,
+		"time":    time.Now().Format("15:04:05"),
+	})
+}
+func (c *ConsoleClient) sendJSON(msg map[string]interface{}) {
+	data, _ := json.Marshal(msg)
+	c.queue(data)
+}
+func (c *ConsoleClient) queue(data []byte) {
+	select {
+	case c.send <- data:
+	default:
+		log.Printf("[WebSocket] Send buffer full for room %d console, dropping message", c.roomID)
+	}
+}
@@ -0,0 +1,121 @@
+package websocket
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"terraria-panel/config"
+	"terraria-panel/middleware"
+	"terraria-panel/models"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+func init() {
+	sessionCheckInterval = 100 * time.Millisecond
+}
+func setupConsoleTest(t *testing.T, grants map[int]string) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	logsDir := config.LogsDir
+	config.LogsDir = t.TempDir()
+	t.Cleanup(func() { config.LogsDir = logsDir })
+	if err := middleware.InitJWT("console-test-secret-0123456789abcdef", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	SetConsoleAuthorizer(func(userID, roomID int, permission string) bool {
+		return models.RoomPermissionLevel(grants[userID]) >= models.RoomPermissionLevel(permission)
+	})
+	t.Cleanup(func() { SetConsoleAuthorizer(nil) })
+	r := gin.New()
+	r.GET("/ws/rooms/:id/console", HandleRoomConsole)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+func consoleTestToken(t *testing.T, userID int) string {
+	token, err := middleware.GenerateToken(&models.User{ID: userID, Username: "user", Role: models.RoleViewer}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+func TestHandleRoomConsoleAuthorization(t *testing.T) {
+	server := setupConsoleTest(t, map[int]string{2: models.RoomPermissionView, 3: models.RoomPermissionOperate})
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/rooms/42/console?token="
+	tests := []struct {
+		name        string
+		token       string
+		status      int
+		interactive bool
+	}{
+		{"no token", "", http.StatusUnauthorized, false},
+		{"invalid token", "not-a-jwt", http.StatusUnauthorized, false},
+		{"no room permission", consoleTestToken(t, 1), http.StatusForbidden, false},
+		{"view permission", consoleTestToken(t, 2), http.StatusSwitchingProtocols, false},
+		{"operate permission", consoleTestToken(t, 3), http.StatusSwitchingProtocols, true},
+	}
+	for _, tt := range tests {
+		conn, resp, err := websocket.DefaultDialer.Dial(url+tt.token, nil)
+		if resp == nil {
+			t.Fatalf("%s: dial failed without a response: %v", tt.name, err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if conn == nil {
+			continue
+		}
+		var connected struct {
+			Type        string `json:"type"`
+			Interactive bool   `json:"interactive"`
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&connected); err != nil {
+			t.Errorf("%s: reading connected message: %v", tt.name, err)
+		} else if connected.Type != "connected" || connected.Interactive != tt.interactive {
+			t.Errorf("%s: got %+v, want connected with interactive=%v", tt.name, connected, tt.interactive)
+		}
+		conn.Close()
+	}
+}
+func TestConsoleClosesSocketWhenSessionIsRevoked(t *testing.T) {
+	server := setupConsoleTest(t, map[int]string{3: models.RoomPermissionOperate})
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/rooms/42/console?token=" + consoleTestToken(t, 3)
+	var revoked atomic.Bool
+	middleware.SetSessionValidator(func(claims *middleware.Claims) bool {
+		return !revoked.Load()
+	})
+	t.Cleanup(func() { middleware.SetSessionValidator(nil) })
+	expectRevokedClose := func(name string, conn *websocket.Conn) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			_, _, err := conn.ReadMessage()
+			if err == nil {
+				continue
+			}
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Errorf("%s: socket ended with %v, want a policy violation close", name, err)
+			}
+			return
+		}
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked.Store(true)
+	if err := conn.WriteJSON(map[string]string{"type": "command", "command": "save"}); err != nil {
+		t.Fatal(err)
+	}
+	expectRevokedClose("command after logout", conn)
+	conn.Close()
+	revoked.Store(false)
+	conn, _, err = websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	revoked.Store(true)
+	expectRevokedClose("idle socket after logout", conn)
+}
@@ -3,28 +3,54 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"sync"
+	"terraria-panel/middleware"
 	"time"
-	"terraria-panel/config"
-	"terraria-panel/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"github.com/hpcloud/tail"
 )
-func init() {
-	utils.BroadcastPluginServerLog = BroadcastPluginServerLog
-}
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
+var sessionCheckInterval = 30 * time.Second
+func SocketToken(c *gin.Context) string {
+	if token := c.Query("token"); token != "" {
+		return token
+	}
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) == 2 && parts[0] == "Bearer" {
+		return parts[1]
+	}
+	return ""
+}
+func WatchSession(conn *websocket.Conn, claims *middleware.Claims, done <-chan struct{}, authorized func() bool) {
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !middleware.ValidateSession(claims) || (authorized != nil && !authorized()) {
+				log.Printf("[WebSocket] Closing socket of user %s: session revoked or access removed", claims.Username)
+				closeRevokedSocket(conn)
+				return
+			}
+		}
+	}
+}
+func closeRevokedSocket(conn *websocket.Conn) {
+	message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "会话已失效，请重新登录")
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	conn.Close()
+}
 type Client struct {
 	conn   *websocket.Conn
 	roomID int
@@ -185,249 +211,3 @@ func BroadcastLog(roomID int, message string) {
 		}
 	}
 }
-type LogClient struct {
-	conn   *websocket.Conn
-	roomID int
-	send   chan []byte
-	tail   *tail.Tail
-	mu     sync.Mutex
-}
-var (
-	logClients   = make(map[*LogClient]bool)
-	logClientsMu sync.RWMutex
-)
-func HandleRoomLogs(c *gin.Context) {
-	roomIDStr := c.Param("id")
-	roomID, err := strconv.Atoi(roomIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
-		return
-	}
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("[WebSocket] Failed to upgrade connection: %v", err)
-		return
-	}
-	client := &LogClient{
-		conn:   conn,
-		roomID: roomID,
-		send:   make(chan []byte, 256),
-	}
-	logClientsMu.Lock()
-	logClients[client] = true
-	logClientsMu.Unlock()
-	log.Printf("[WebSocket] Client connected to room %d logs", roomID)
-	welcomeMsg := map[string]interface{}{
-		"type":    "connected",
-		"message": fmt.Sprintf("🎮 已连接到房间 %d 的日志流", roomID),
-		"time":    time.Now().Format("2006-01-02 15:04:05"),
-	}
-	data, _ := json.Marshal(welcomeMsg)
-	conn.WriteMessage(websocket.TextMessage, data)
-	if roomID == 0 {
-		buffer := utils.GetPluginServerOutputBuffer()
-		if buffer != "" {
-			bufferMsg := map[string]interface{}{
-				"type":    "log",
-				"message": buffer,
-				"time":    time.Now().Format("15:04:05"),
-			}
-			data, _ := json.Marshal(bufferMsg)
-			conn.WriteMessage(websocket.TextMessage, data)
-			log.Printf("[WebSocket] Sent output buffer to client (%d chars)", len(buffer))
-		}
-	}
-	go client.writePump()
-	go client.tailLogs()
-	client.readPump()
-}
-func (c *LogClient) readPump() {
-	defer func() {
-		logClientsMu.Lock()
-		delete(logClients, c)
-		logClientsMu.Unlock()
-		if c.tail != nil {
-			c.tail.Stop()
-		}
-		c.conn.Close()
-		log.Printf("[WebSocket] Client disconnected from room %d logs", c.roomID)
-	}()
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
-	})
-	for {
-		_, message, err := c.conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("[WebSocket] Read error: %v", err)
-			}
-			break
-		}
-		var msg map[string]interface{}
-		if err := json.Unmarshal(message, &msg); err != nil {
-			continue
-		}
-		if msg["type"] == "ping" {
-			pongMsg := map[string]interface{}{
-				"type": "pong",
-				"time": time.Now().Format("2006-01-02 15:04:05"),
-			}
-			data, _ := json.Marshal(pongMsg)
-			c.send <- data
-		}
-	}
-}
-func (c *LogClient) writePump() {
-	ticker := time.NewTicker(54 * time.Second)
-	defer func() {
-		ticker.Stop()
-		c.conn.Close()
-	}()
-	for {
-		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				return
-			}
-		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				return
-			}
-		}
-	}
-}
-func (c *LogClient) tailLogs() {
-	logFile := filepath.Join(config.DataDir, "rooms", fmt.Sprintf("room-%d", c.roomID), "server.log")
-	if _, err := os.Stat(logFile); os.IsNotExist(err) {
-		infoMsg := map[string]interface{}{
-			"type":    "info",
-			"message": "⏳ 等待服务器启动并生成日志文件...",
-			"time":    time.Now().Format("15:04:05"),
-		}
-		data, _ := json.Marshal(infoMsg)
-		c.send <- data
-		for i := 0; i < 30; i++ {
-			time.Sleep(1 * time.Second)
-			if _, err := os.Stat(logFile); err == nil {
-				break
-			}
-		}
-		if _, err := os.Stat(logFile); os.IsNotExist(err) {
-			errorMsg := map[string]interface{}{
-				"type":    "error",
-				"message": "❌ 日志文件不存在，请先启动服务器",
-				"time":    time.Now().Format("15:04:05"),
-			}
-			data, _ := json.Marshal(errorMsg)
-			c.send <- data
-			return
-		}
-	}
-	c.sendHistoryLogs(logFile)
-	t, err := tail.TailFile(logFile, tail.Config{
-		Follow: true,
-		ReOpen: true,
-		Poll:   true,
-		Location: &tail.SeekInfo{
-			Offset: 0,
-			Whence: io.SeekEnd,
-		},
-	})
-	if err != nil {
-		log.Printf("[WebSocket] Failed to tail log file: %v", err)
-		errorMsg := map[string]interface{}{
-			"type":    "error",
-			"message": fmt.Sprintf("❌ 无法读取日志文件: %v", err),
-			"time":    time.Now().Format("15:04:05"),
-		}
-		data, _ := json.Marshal(errorMsg)
-		c.send <- data
-		return
-	}
-	c.mu.Lock()
-	c.tail = t
-	c.mu.Unlock()
-	startMsg := map[string]interface{}{
-		"type":    "info",
-		"message": "✅ 开始实时推送日志...",
-		"time":    time.Now().Format("15:04:05"),
-	}
-	data, _ := json.Marshal(startMsg)
-	c.send <- data
-	for line := range t.Lines {
-		if line.Err != nil {
-			log.Printf("[WebSocket] Error reading log line: %v", line.Err)
-			continue
-		}
-		logMsg := map[string]interface{}{
-			"type":    "log",
-			"message": line.Text,
-			"time":    time.Now().Format("15:04:05"),
-		}
-		data, _ := json.Marshal(logMsg)
-		select {
-		case c.send <- data:
-		default:
-			log.Println("[WebSocket] Send buffer full, dropping log line")
-		}
-	}
-}
-func (c *LogClient) sendHistoryLogs(logFile string) {
-	file, err := os.Open(logFile)
-	if err != nil {
-		return
-	}
-	defer file.Close()
-	lines := []string{}
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-		if len(lines) > 100 {
-			lines = lines[1:]
-		}
-	}
-	historyMsg := map[string]interface{}{
-		"type":    "info",
-		"message": fmt.Sprintf("📜 加载最近 %d 条历史日志", len(lines)),
-		"time":    time.Now().Format("15:04:05"),
-	}
-	data, _ := json.Marshal(historyMsg)
-	c.send <- data
-	for _, line := range lines {
-		logMsg := map[string]interface{}{
-			"type":    "log",
-			"message": line,
-			"time":    time.Now().Format("15:04:05"),
-		}
-		data, _ := json.Marshal(logMsg)
-		c.send <- data
-		time.Sleep(1 * time.Millisecond)
-	}
-}
-func BroadcastPluginServerLog(message string) {
-	logClientsMu.RLock()
-	defer logClientsMu.RUnlock()
-	for client := range logClients {
-		if client.roomID == 0 {
-			logMsg := map[string]interface{}{
-				"type":    "log",
-				"message": message,
-				"time":    time.Now().Format("15:04:05"),
-			}
-			data, _ := json.Marshal(logMsg)
-			select {
-			case client.send <- data:
-			default:
-				log.Println("[WebSocket] Send buffer full for plugin server log")
-			}
-		}
-	}
-}